@@ -0,0 +1,81 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// purgeTimeout bounds a single purge request
+const purgeTimeout = 10 * time.Second
+
+// PurgeRequest is the JSON body sent to the purge webhook
+type PurgeRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// Purger asks a CDN to invalidate public URLs through a webhook.
+// Purges are best-effort: they run in the background and failures are only logged.
+type Purger struct {
+	endpoint      string
+	authorization string
+	client        *http.Client
+}
+
+// NewPurger creates a purger that POSTs to endpoint, sending authorization
+// (if set) as the Authorization header
+func NewPurger(endpoint, authorization string) *Purger {
+	return &Purger{
+		endpoint:      endpoint,
+		authorization: authorization,
+		client:        &http.Client{Timeout: purgeTimeout},
+	}
+}
+
+// Purge requests invalidation of the URLs in the background (no-op on a nil Purger)
+func (p *Purger) Purge(urls []string) {
+	if p == nil || len(urls) == 0 {
+		return
+	}
+
+	go func() {
+		if err := p.send(urls); err != nil {
+			log.Printf("Warning: CDN purge failed for %v: %v", urls, err)
+		}
+	}()
+}
+
+// send delivers a purge request synchronously
+func (p *Purger) send(urls []string) error {
+	body, err := json.Marshal(PurgeRequest{URLs: urls})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.authorization != "" {
+		req.Header.Set("Authorization", p.authorization)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPurgerSend(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		wantErr       bool
+	}{
+		{"accepted", "", http.StatusOK, false},
+		{"no content", "Bearer secret", http.StatusNoContent, false},
+		{"rejected", "Bearer wrong", http.StatusUnauthorized, true},
+		{"server error", "", http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got PurgeRequest
+			var gotAuth, gotType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth, gotType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			urls := []string{"https://files.example.com/report", "https://files.example.com/d/report.pdf"}
+			err := NewPurger(server.URL, tt.authorization).send(urls)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send error = %v, want error: %v", err, tt.wantErr)
+			}
+			if len(got.URLs) != 2 || got.URLs[0] != urls[0] || got.URLs[1] != urls[1] {
+				t.Errorf("webhook received %v, want %v", got.URLs, urls)
+			}
+			if gotAuth != tt.authorization || gotType != "application/json" {
+				t.Errorf("headers Authorization = %q, Content-Type = %q", gotAuth, gotType)
+			}
+		})
+	}
+}
+
+func TestPurgerUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	if err := NewPurger(server.URL, "").send([]string{"https://files.example.com/report"}); err == nil {
+		t.Fatal("send to an unreachable webhook succeeded")
+	}
+}
+
+func TestPurgeRunsInBackground(t *testing.T) {
+	received := make(chan PurgeRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PurgeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+	}))
+	defer server.Close()
+
+	// Nothing to purge, and a nil purger (purging disabled), are no-ops
+	NewPurger(server.URL, "").Purge(nil)
+	var disabled *Purger
+	disabled.Purge([]string{"https://files.example.com/report"})
+
+	NewPurger(server.URL, "").Purge([]string{"https://files.example.com/report"})
+	select {
+	case req := <-received:
+		if len(req.URLs) != 1 {
+			t.Fatalf("webhook received %v, want the one URL", req.URLs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("purge was never sent")
+	}
+
+	select {
+	case req := <-received:
+		t.Fatalf("unexpected purge of %v", req.URLs)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/yorukot/sharing/internal/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -14,8 +16,26 @@ import (
 
 var DB *gorm.DB
 
-// Initialize sets up the database connection and runs migrations
-func Initialize(dbPath string) error {
+// Migration states reported by MigrationStatus
+const (
+	MigrationPending  = "pending"
+	MigrationRunning  = "running"
+	MigrationComplete = "complete"
+	MigrationFailed   = "failed"
+	MigrationSkipped  = "skipped" // Auto-migration disabled (MIGRATE=false); the schema is managed externally
+)
+
+var (
+	migrationMu     sync.RWMutex
+	migrationStatus = MigrationPending
+	migrationErr    error
+)
+
+// Initialize sets up the database connection. Call Migrate before serving requests
+// that depend on the schema.
+// SQLite runs in WAL mode with a busy timeout (in milliseconds), so concurrent
+// uploads and downloads wait for the write lock instead of failing with "database is locked".
+func Initialize(dbPath string, busyTimeoutMS int) error {
 	// Ensure the database directory exists
 	dbDir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
@@ -24,22 +44,77 @@ func Initialize(dbPath string) error {
 
 	// Open database connection
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	DB, err = gorm.Open(sqlite.Open(sqliteDSN(dbPath, busyTimeoutMS)), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Run auto-migration
-	if err := DB.AutoMigrate(&models.File{}); err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
+	log.Println("Database initialized successfully")
+	return nil
+}
+
+// Migrate applies pending schema migrations and records their status
+func Migrate() error {
+	setMigrationStatus(MigrationRunning, nil)
+	start := time.Now()
+
+	if err := applyMigrations(); err != nil {
+		err = fmt.Errorf("failed to run migrations: %w", err)
+		setMigrationStatus(MigrationFailed, err)
+		return err
 	}
 
-	log.Println("Database initialized successfully")
+	setMigrationStatus(MigrationComplete, nil)
+	log.Printf("Database migrations completed in %s (schema version %d)", time.Since(start), LatestSchemaVersion())
 	return nil
 }
 
+// SkipMigrations marks the schema as externally managed, warning if it is
+// behind the version this build expects
+func SkipMigrations() {
+	setMigrationStatus(MigrationSkipped, nil)
+
+	version, err := SchemaVersion()
+	if err != nil {
+		log.Printf("Warning: auto-migration disabled and %v", err)
+		return
+	}
+	if latest := LatestSchemaVersion(); version < latest {
+		log.Printf("Warning: auto-migration disabled, but the schema is at version %d (expected %d); run with --migrate", version, latest)
+	}
+}
+
+func setMigrationStatus(status string, err error) {
+	migrationMu.Lock()
+	defer migrationMu.Unlock()
+	migrationStatus, migrationErr = status, err
+}
+
+// MigrationStatus returns the current migration state and the error if it failed
+func MigrationStatus() (string, error) {
+	migrationMu.RLock()
+	defer migrationMu.RUnlock()
+	return migrationStatus, migrationErr
+}
+
+// Ready reports whether migrations have completed (or were skipped) and the schema can be used
+func Ready() bool {
+	status, _ := MigrationStatus()
+	return status == MigrationComplete || status == MigrationSkipped
+}
+
+// sqliteDSN adds the connection pragmas to the database path.
+// They are set through the DSN so every pooled connection gets them, not just the first.
+func sqliteDSN(dbPath string, busyTimeoutMS int) string {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s_journal_mode=WAL&_busy_timeout=%d&_synchronous=NORMAL", dbPath, separator, busyTimeoutMS)
+}
+
 // Close closes the database connection
 func Close() error {
 	sqlDB, err := DB.DB()
@@ -0,0 +1,308 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// SchemaMigration records a migration that has been applied to the database
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName keeps the version table name independent of the struct name
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migration is a single, versioned schema change
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+}
+
+// migrations lists every schema change in order. Add a new entry at the end for each
+// schema change; never edit or reorder entries that have already been released.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.File{}, &models.Report{})
+		},
+	},
+	{
+		version: 2,
+		name:    "scope slugs to custom domains",
+		up: func(tx *gorm.DB) error {
+			// Slugs used to be globally unique; they are now unique per custom domain
+			if tx.Migrator().HasIndex(&models.File{}, "idx_slug_deleted") {
+				return tx.Migrator().DropIndex(&models.File{}, "idx_slug_deleted")
+			}
+			return nil
+		},
+	},
+	{
+		version: 3,
+		name:    "add download access log",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Download{})
+		},
+	},
+	{
+		version: 4,
+		name:    "add pending direct uploads",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.PendingUpload{})
+		},
+	},
+	{
+		version: 5,
+		name:    "enforce unique original names per domain",
+		up: func(tx *gorm.DB) error {
+			// /d/{filename} looks files up by original name, so it must identify one active file
+			if err := renameDuplicates(tx, "original_name"); err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_original_name ON files(domain, original_name) WHERE deleted_at IS NULL").Error
+		},
+	},
+	{
+		version: 6,
+		name:    "enforce unique active slugs per domain",
+		up: func(tx *gorm.DB) error {
+			// idx_domain_slug_deleted includes deleted_at, and SQLite treats NULLs as distinct,
+			// so it doesn't stop two concurrent uploads from claiming the same active slug
+			if err := renameDuplicates(tx, "slug"); err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_slug_active ON files(domain, slug) WHERE deleted_at IS NULL").Error
+		},
+	},
+	{
+		version: 7,
+		name:    "add per-file access lists",
+		up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.File{}, "AccessTokens") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.File{}, "AccessTokens")
+		},
+	},
+	{
+		version: 8,
+		name:    "add live uploads",
+		up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.File{}, "InProgress") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.File{}, "InProgress")
+		},
+	},
+	{
+		version: 9,
+		name:    "add original upload times",
+		up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&models.File{}, "OriginalUploadedAt") {
+				if err := tx.Migrator().AddColumn(&models.File{}, "OriginalUploadedAt"); err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec("UPDATE files SET original_uploaded_at = created_at WHERE original_uploaded_at IS NULL").Error; err != nil {
+				return err
+			}
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_files_original_uploaded_at ON files(original_uploaded_at)").Error
+		},
+	},
+	{
+		version: 10,
+		name:    "hash-chain the download access log",
+		up: func(tx *gorm.DB) error {
+			for _, column := range []string{"PrevHash", "Hash"} {
+				if tx.Migrator().HasColumn(&models.Download{}, column) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&models.Download{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 11,
+		name:    "add audit log",
+		up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&models.AuditLog{}); err != nil {
+				return err
+			}
+			// Refuse changes in the database too, not just through the application
+			for _, event := range []string{"UPDATE", "DELETE"} {
+				trigger := fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS audit_logs_no_%s BEFORE %s ON audit_logs "+
+					"BEGIN SELECT RAISE(ABORT, 'audit log entries cannot be modified'); END", strings.ToLower(event), event)
+				if err := tx.Exec(trigger).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 12,
+		name:    "add client metadata to files",
+		up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.File{}, "ClientMetadata") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.File{}, "ClientMetadata")
+		},
+	},
+	{
+		version: 13,
+		name:    "add image variant cache",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.ImageVariant{})
+		},
+	},
+	{
+		version: 14,
+		name:    "add slug history",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.SlugHistory{})
+		},
+	},
+	{
+		version: 15,
+		name:    "add resized image variants",
+		up: func(tx *gorm.DB) error {
+			// Variants are now unique per size too; the column and new index are added below
+			if tx.Migrator().HasIndex(&models.ImageVariant{}, "idx_variant_file_format") {
+				if err := tx.Migrator().DropIndex(&models.ImageVariant{}, "idx_variant_file_format"); err != nil {
+					return err
+				}
+			}
+			return tx.AutoMigrate(&models.ImageVariant{})
+		},
+	},
+	{
+		version: 16,
+		name:    "add transfers",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Transfer{})
+		},
+	},
+	{
+		version: 17,
+		name:    "add storage backends",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.File{}, &models.PendingUpload{})
+		},
+	},
+	{
+		version: 18,
+		name:    "add web sessions",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.WebSession{})
+		},
+	},
+}
+
+// renameDuplicates gives every active file that shares the value of column with an older
+// file in the same domain a unique value ("report-42.pdf", using the file ID)
+func renameDuplicates(tx *gorm.DB, column string) error {
+	var rows []struct {
+		ID     uint
+		Domain string
+		Value  string
+	}
+	if err := tx.Model(&models.File{}).Select("id, domain, " + column + " AS value").Order("id").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	taken := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		taken[row.Domain+"/"+row.Value] = true
+	}
+
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		key := row.Domain + "/" + row.Value
+		if !seen[key] {
+			seen[key] = true
+			continue
+		}
+
+		ext := filepath.Ext(row.Value)
+		base := strings.TrimSuffix(row.Value, ext)
+		value := fmt.Sprintf("%s-%d%s", base, row.ID, ext)
+		for i := 2; taken[row.Domain+"/"+value]; i++ {
+			value = fmt.Sprintf("%s-%d-%d%s", base, row.ID, i, ext)
+		}
+		taken[row.Domain+"/"+value] = true
+		seen[row.Domain+"/"+value] = true
+
+		if err := tx.Model(&models.File{}).Where("id = ?", row.ID).Update(column, value).Error; err != nil {
+			return err
+		}
+		log.Printf("Renamed duplicate %s of file %d: %q -> %q", column, row.ID, row.Value, value)
+	}
+	return nil
+}
+
+// LatestSchemaVersion returns the version the schema has once all migrations are applied
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the highest applied migration version (0 for an unversioned database)
+func SchemaVersion() (int, error) {
+	if !DB.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+
+	var version int
+	if err := DB.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// applyMigrations runs the migrations newer than the recorded schema version,
+// each in its own transaction together with its version record
+func applyMigrations() error {
+	if err := DB.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	current, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		log.Printf("Applied migration %d: %s", m.version, m.name)
+	}
+	return nil
+}
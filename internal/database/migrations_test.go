@@ -0,0 +1,172 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// migrateTo applies the migrations up to and including version, as applyMigrations does
+func migrateTo(t *testing.T, version int) {
+	t.Helper()
+	if err := DB.AutoMigrate(&SchemaMigration{}); err != nil {
+		t.Fatalf("creating schema_migrations: %v", err)
+	}
+	for _, m := range migrations {
+		if m.version > version {
+			break
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			t.Fatalf("migration %d: %v", m.version, err)
+		}
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	newTestDB(t)
+
+	if version, err := SchemaVersion(); err != nil || version != 0 {
+		t.Fatalf("fresh database at version %d (%v), want 0", version, err)
+	}
+	if err := Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if version, err := SchemaVersion(); err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("migrated database at version %d (%v), want %d", version, err, LatestSchemaVersion())
+	}
+	var applied int64
+	DB.Model(&SchemaMigration{}).Count(&applied)
+	if applied != int64(len(migrations)) {
+		t.Fatalf("%d migrations recorded, want %d", applied, len(migrations))
+	}
+}
+
+func TestMigrateAppliesOnlyNewMigrations(t *testing.T) {
+	tests := []struct {
+		name string
+		from int // Version the database is at before Migrate
+	}{
+		{"fully migrated", LatestSchemaVersion()},
+		{"one behind", LatestSchemaVersion() - 1},
+		{"before the unique name indexes", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			migrateTo(t, tt.from)
+
+			var before []SchemaMigration
+			DB.Order("version").Find(&before)
+
+			if err := Migrate(); err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+
+			var after []SchemaMigration
+			DB.Order("version").Find(&after)
+			if len(after) != len(migrations) {
+				t.Fatalf("%d migrations recorded, want %d", len(after), len(migrations))
+			}
+			for i, record := range before {
+				if !after[i].AppliedAt.Equal(record.AppliedAt) {
+					t.Errorf("migration %d was applied again", record.Version)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateRenamesDuplicates(t *testing.T) {
+	type row struct {
+		domain       string
+		originalName string
+		slug         string
+		deleted      bool
+	}
+
+	tests := []struct {
+		name      string
+		rows      []row
+		wantNames []string // Original names after migrating, in ID order
+		wantSlugs []string // Slugs after migrating, in ID order
+	}{
+		{
+			name:      "no duplicates",
+			rows:      []row{{"", "a.pdf", "a", false}, {"", "b.pdf", "b", false}},
+			wantNames: []string{"a.pdf", "b.pdf"},
+			wantSlugs: []string{"a", "b"},
+		},
+		{
+			name:      "duplicate name and slug",
+			rows:      []row{{"", "report.pdf", "report", false}, {"", "report.pdf", "report", false}},
+			wantNames: []string{"report.pdf", "report-2.pdf"},
+			wantSlugs: []string{"report", "report-2"},
+		},
+		{
+			name:      "renamed value already taken",
+			rows:      []row{{"", "report.pdf", "report", false}, {"", "report.pdf", "report", false}, {"", "report-2.pdf", "report-2", false}},
+			wantNames: []string{"report.pdf", "report-2-2.pdf", "report-2.pdf"},
+			wantSlugs: []string{"report", "report-2-2", "report-2"},
+		},
+		{
+			name:      "same name in other domains",
+			rows:      []row{{"", "report.pdf", "report", false}, {"files.example.com", "report.pdf", "report", false}},
+			wantNames: []string{"report.pdf", "report.pdf"},
+			wantSlugs: []string{"report", "report"},
+		},
+		{
+			name:      "deleted duplicates are kept",
+			rows:      []row{{"", "report.pdf", "report", true}, {"", "report.pdf", "report", false}},
+			wantNames: []string{"report.pdf", "report.pdf"},
+			wantSlugs: []string{"report", "report"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			migrateTo(t, 4)
+
+			for i, r := range tt.rows {
+				file := &models.File{
+					Filename:     fmt.Sprintf("stored-%d", i),
+					OriginalName: r.originalName,
+					FilePath:     fmt.Sprintf("data/stored-%d", i),
+					ContentType:  "application/pdf",
+					Slug:         r.slug,
+					Domain:       r.domain,
+				}
+				if err := DB.Create(file).Error; err != nil {
+					t.Fatalf("creating file %d: %v", i, err)
+				}
+				if r.deleted {
+					DB.Delete(file)
+				}
+			}
+
+			if err := Migrate(); err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+
+			var files []models.File
+			if err := DB.Unscoped().Order("id").Find(&files).Error; err != nil {
+				t.Fatalf("listing files: %v", err)
+			}
+			for i, file := range files {
+				if file.OriginalName != tt.wantNames[i] || file.Slug != tt.wantSlugs[i] {
+					t.Errorf("file %d = %q (slug %q), want %q (slug %q)", file.ID, file.OriginalName, file.Slug, tt.wantNames[i], tt.wantSlugs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a fresh in-memory database of its own for the test, with migrations pending
+func newTestDB(t *testing.T) {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	if err := Initialize(fmt.Sprintf("file:%s?mode=memory&cache=shared", name), 5000); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	DB.Logger = logger.Discard
+	setMigrationStatus(MigrationPending, nil)
+	t.Cleanup(func() {
+		Close()
+		setMigrationStatus(MigrationPending, nil)
+	})
+}
+
+// readyStatus sends a request through RequireReady and returns the response status
+func readyStatus() int {
+	handler := mw.RequireReady(Ready)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/files", nil))
+	return rec.Code
+}
+
+func TestRequireReadyFollowsMigrationStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{MigrationPending, http.StatusServiceUnavailable},
+		{MigrationRunning, http.StatusServiceUnavailable},
+		{MigrationFailed, http.StatusServiceUnavailable},
+		{MigrationComplete, http.StatusOK},
+		{MigrationSkipped, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			setMigrationStatus(tt.status, nil)
+			t.Cleanup(func() { setMigrationStatus(MigrationPending, nil) })
+
+			if got := readyStatus(); got != tt.want {
+				t.Fatalf("request while migrations are %s = %d, want %d", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireReadyAfterMigrate(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        func() error
+		wantStatus string
+		want       int
+	}{
+		{"migrated", Migrate, MigrationComplete, http.StatusOK},
+		{"skipped", func() error { SkipMigrations(); return nil }, MigrationSkipped, http.StatusOK},
+		{"failed", func() error { Close(); return Migrate() }, MigrationFailed, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			if got := readyStatus(); got != http.StatusServiceUnavailable {
+				t.Fatalf("request before migrating = %d, want %d", got, http.StatusServiceUnavailable)
+			}
+
+			runErr := tt.run()
+			status, err := MigrationStatus()
+			if status != tt.wantStatus {
+				t.Fatalf("migration status = %s, want %s", status, tt.wantStatus)
+			}
+			if (tt.wantStatus == MigrationFailed) != (err != nil && runErr != nil) {
+				t.Fatalf("migration error = %v (returned %v)", err, runErr)
+			}
+			if got := readyStatus(); got != tt.want {
+				t.Fatalf("request after migrating = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the service
+const (
+	TypeUpload   = "upload"
+	TypeDownload = "download"
+	TypeDelete   = "delete"
+	TypeExpiry   = "expiry"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber before new events are dropped
+const subscriberBuffer = 64
+
+// Event describes file activity
+type Event struct {
+	Type         string    `json:"type"`
+	FileID       uint      `json:"file_id"`
+	Slug         string    `json:"slug"`
+	OriginalName string    `json:"original_name"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// Broker fans out published events to all subscribers
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewBroker creates a new event broker
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber and returns its event channel
+func (b *Broker) Subscribe() chan Event {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *Broker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+}
+
+// Publish sends an event to all subscribers.
+// Slow subscribers never block publishers: if a subscriber's buffer is full, the event is dropped for it.
+func (b *Broker) Publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Default is the process-wide broker used by services and handlers
+var Default = NewBroker()
+
+// Publish sends an event through the default broker
+func Publish(eventType string, fileID uint, slug, originalName string) {
+	Default.Publish(Event{
+		Type:         eventType,
+		FileID:       fileID,
+		Slug:         slug,
+		OriginalName: originalName,
+	})
+}
@@ -1,41 +1,193 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/models"
 	"github.com/yorukot/sharing/internal/services"
 	"github.com/yorukot/sharing/internal/storage"
+	"github.com/yorukot/sharing/internal/torrent"
 )
 
+// defaultMaxPasteSize is the largest paste accepted when PASTE_MAX_SIZE is not set (1 MB)
+const defaultMaxPasteSize = 1 << 20
+
+// defaultMaxBase64UploadSize is the largest decoded base64 upload accepted when
+// BASE64_UPLOAD_MAX_SIZE is not set (32 MB)
+const defaultMaxBase64UploadSize = 32 << 20
+
+// base64RequestOverhead is room in a base64 upload request body for the JSON fields besides the data
+const base64RequestOverhead = 64 << 10
+
+// pasteLanguageRegex limits paste languages to short identifiers (e.g., "go", "c++", "shell")
+var pasteLanguageRegex = regexp.MustCompile(`^[a-z0-9+#._-]{1,32}$`)
+
 // APIHandler handles API requests
 type APIHandler struct {
-	fileService *services.FileService
+	fileService    *services.FileService
+	torrentCache   *torrent.Cache
+	torrentTracker string
+	maxPasteSize   int64
+
+	maxBase64UploadSize int64
 }
 
 // NewAPIHandler creates a new API handler
-func NewAPIHandler(storageBackend storage.Storage) *APIHandler {
+func NewAPIHandler(backends *storage.Registry) *APIHandler {
+	maxPasteSize := int64(defaultMaxPasteSize)
+	if sizeStr := os.Getenv("PASTE_MAX_SIZE"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size <= 0 {
+			log.Printf("Warning: invalid PASTE_MAX_SIZE value, using default (%d)", defaultMaxPasteSize)
+		} else {
+			maxPasteSize = size
+		}
+	}
+
+	maxBase64UploadSize := int64(defaultMaxBase64UploadSize)
+	if sizeStr := os.Getenv("BASE64_UPLOAD_MAX_SIZE"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size <= 0 {
+			log.Printf("Warning: invalid BASE64_UPLOAD_MAX_SIZE value, using default (%d)", defaultMaxBase64UploadSize)
+		} else {
+			maxBase64UploadSize = size
+		}
+	}
+
 	return &APIHandler{
-		fileService: services.NewFileService(storageBackend),
+		fileService:    services.NewFileService(backends),
+		torrentCache:   torrent.NewCache(),
+		torrentTracker: os.Getenv("TORRENT_TRACKER_URL"),
+		maxPasteSize:   maxPasteSize,
+
+		maxBase64UploadSize: maxBase64UploadSize,
 	}
 }
 
 // UploadRequest represents the upload request payload
 type UploadRequest struct {
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExpiresAt *inputTime `json:"expires_at,omitempty"`
 	Password  *string    `json:"password,omitempty"`
 }
 
+// UploadOptionsRequest holds the optional upload settings shared by the JSON upload endpoints
+type UploadOptionsRequest struct {
+	ExpiresAt                 *inputTime      `json:"expires_at,omitempty"`
+	ExpiresAfterFirstDownload string          `json:"expires_after_first_download,omitempty"` // Duration (e.g., "24h")
+	Password                  *string         `json:"password,omitempty"`
+	AccessTokens              []string        `json:"access_tokens,omitempty"`
+	Slug                      *string         `json:"slug,omitempty"`
+	Replace                   bool            `json:"replace,omitempty"`
+	LockedUntil               *inputTime      `json:"locked_until,omitempty"`
+	MaxDownloads              *int64          `json:"max_downloads,omitempty"`
+	Policy                    string          `json:"policy,omitempty"`
+	Domain                    string          `json:"domain,omitempty"`
+	OriginalUploadedAt        *inputTime      `json:"original_uploaded_at,omitempty"`
+	ClientMetadata            json.RawMessage `json:"client_metadata,omitempty"` // Opaque, e.g. client-side encryption parameters
+	Storage                   string          `json:"storage,omitempty"`         // Storage backend name (STORAGE_BACKENDS)
+}
+
+// saveOptions validates the settings and converts them to service options
+func (req UploadOptionsRequest) saveOptions() (services.SaveOptions, error) {
+	var expiresAfterFirstDownload *time.Duration
+	if req.ExpiresAfterFirstDownload != "" {
+		d, err := time.ParseDuration(req.ExpiresAfterFirstDownload)
+		if err != nil {
+			return services.SaveOptions{}, errors.New("Invalid expires_after_first_download format (use a duration like 24h)")
+		}
+		expiresAfterFirstDownload = &d
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads <= 0 {
+		return services.SaveOptions{}, errors.New("Invalid max_downloads (use a positive number)")
+	}
+	if req.Password != nil && *req.Password == "" {
+		req.Password = nil
+	}
+
+	return services.SaveOptions{
+		ExpiresAt:                 req.ExpiresAt.ptr(),
+		ExpiresAfterFirstDownload: expiresAfterFirstDownload,
+		Password:                  req.Password,
+		AccessTokens:              req.AccessTokens,
+		Slug:                      req.Slug,
+		Replace:                   req.Replace,
+		LockedUntil:               req.LockedUntil.ptr(),
+		MaxDownloads:              req.MaxDownloads,
+		Policy:                    req.Policy,
+		Domain:                    req.Domain,
+		UploadedAt:                req.OriginalUploadedAt.ptr(),
+		ClientMetadata:            req.ClientMetadata,
+		Storage:                   req.Storage,
+	}, nil
+}
+
+// Base64UploadRequest represents the JSON upload payload.
+// Data is standard or URL-safe base64, or a data URI ("data:image/png;base64,...").
+type Base64UploadRequest struct {
+	Filename    string `json:"filename"`
+	Data        string `json:"data"`
+	ContentType string `json:"content_type,omitempty"`
+	UploadOptionsRequest
+}
+
+// PresignRequest asks for a URL to upload a file of exactly Size bytes directly to storage
+type PresignRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	Storage     string `json:"storage,omitempty"` // Storage backend name (STORAGE_BACKENDS)
+}
+
+// RegisterUploadRequest creates the file for a finished direct upload
+type RegisterUploadRequest struct {
+	Key string `json:"key"`
+	UploadOptionsRequest
+}
+
 // UpdateRequest represents the update request payload
 type UpdateRequest struct {
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
-	Password  *string    `json:"password,omitempty"`
-	Slug      *string    `json:"slug,omitempty"`
+	ExpiresAt      *inputTime      `json:"expires_at,omitempty"`
+	Password       *string         `json:"password,omitempty"`
+	AccessTokens   *[]string       `json:"access_tokens,omitempty"` // [] removes the restriction
+	Slug           *string         `json:"slug,omitempty"`
+	LockedUntil    *inputTime      `json:"locked_until,omitempty"`
+	Disabled       *bool           `json:"disabled,omitempty"`
+	MaxDownloads   *int64          `json:"max_downloads,omitempty"`   // 0 removes the limit
+	ContentType    *string         `json:"content_type,omitempty"`    // Fixes a misdetected type
+	ClientMetadata json.RawMessage `json:"client_metadata,omitempty"` // null removes it
+}
+
+// ExtendRequest represents a bulk expiry extension: the files listed in IDs, or the
+// active files whose original name contains Search, get expires_at or now + expires_in
+type ExtendRequest struct {
+	IDs       []uint     `json:"ids,omitempty"`
+	Search    string     `json:"search,omitempty"`
+	ExpiresAt *inputTime `json:"expires_at,omitempty"`
+	ExpiresIn string     `json:"expires_in,omitempty"` // Duration (e.g., "72h" or "30d")
+}
+
+// ExtendResponse reports the outcome for every selected file
+type ExtendResponse struct {
+	Extended int                     `json:"extended"`
+	Results  []services.ExtendResult `json:"results"`
 }
 
 // ErrorResponse represents an error response
@@ -45,75 +197,833 @@ type ErrorResponse struct {
 
 // UploadFile handles file upload
 func (h *APIHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	// Create-only uploads with the slug in the query string fail fast: a taken slug
+	// is rejected before the request body is read
+	query := r.URL.Query()
+	if slug := query.Get("slug"); slug != "" && createOnly(r) {
+		if err := h.fileService.CheckSlugAvailable(query.Get("domain"), slug); err != nil {
+			message, status := saveErrorResponse(w, err)
+			respondUploadError(w, r, message, status)
+			return
+		}
+	}
+
 	// Parse multipart form (32 MB max)
+	defer removeMultipartFiles(r)
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		respondError(w, "Failed to parse form", http.StatusBadRequest)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondUploadError(w, r, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		respondUploadError(w, r, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
 
 	// Get file from form
 	file, fileHeader, err := r.FormFile("file")
 	if err != nil {
-		respondError(w, "File is required", http.StatusBadRequest)
+		respondUploadError(w, r, "File is required", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
-	// Parse optional parameters
+	opts, err := parseSaveOptions(r)
+	if err != nil {
+		respondUploadError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Save file
+	savedFile, err := h.fileService.WithContext(r.Context()).SaveFile(fileHeader, opts)
+	if err != nil {
+		message, status := saveErrorResponse(w, err)
+		respondUploadError(w, r, message, status)
+		return
+	}
+
+	h.respondUploaded(w, r, savedFile)
+}
+
+// CreatePaste handles text snippet uploads.
+// The text is taken from the "content" form field, or from the raw request body
+// for non-form requests (options are then read from the query string).
+func (h *APIHandler) CreatePaste(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxPasteSize)
+
+	var content string
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data", "application/x-www-form-urlencoded":
+		defer removeMultipartFiles(r)
+		if err := r.ParseMultipartForm(h.maxPasteSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			respondError(w, "Failed to parse form (paste too large?)", http.StatusBadRequest)
+			return
+		}
+		content = r.FormValue("content")
+	default:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondError(w, "Failed to read paste (paste too large?)", http.StatusRequestEntityTooLarge)
+			return
+		}
+		content = string(body)
+	}
+
+	if content == "" {
+		respondError(w, "Paste content is required", http.StatusBadRequest)
+		return
+	}
+	if !utf8.ValidString(content) {
+		respondError(w, "Paste content must be UTF-8 text", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseSaveOptions(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts.Language = strings.ToLower(r.FormValue("language"))
+	if opts.Language == "" {
+		opts.Language = "text"
+	}
+	if !pasteLanguageRegex.MatchString(opts.Language) {
+		respondError(w, "Invalid language (use a short identifier like go or python)", http.StatusBadRequest)
+		return
+	}
+
+	filename := r.FormValue("filename")
+	if filename == "" {
+		filename = "paste.txt"
+	}
+
+	savedFile, err := h.fileService.WithContext(r.Context()).SaveFileFromReader(filename, "text/plain; charset=utf-8", strings.NewReader(content), opts)
+	if err != nil {
+		respondSaveError(w, err)
+		return
+	}
+
+	h.respondUploaded(w, r, savedFile)
+}
+
+// UploadBase64 handles JSON uploads with base64 or data-URI content, for clients that
+// can't send multipart forms. The content is decoded while it is written to storage.
+func (h *APIHandler) UploadBase64(w http.ResponseWriter, r *http.Request) {
+	// Base64 takes 4 bytes for every 3 decoded bytes
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBase64UploadSize/3*4+4+base64RequestOverhead)
+
+	var req Base64UploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondError(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Filename == "" {
+		respondError(w, "Filename is required", http.StatusBadRequest)
+		return
+	}
+	if req.Data == "" {
+		respondError(w, "Data is required", http.StatusBadRequest)
+		return
+	}
+
+	content, dataType, err := base64PayloadReader(req.Data)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = dataType
+	}
+
+	opts, err := req.saveOptions()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	savedFile, err := h.fileService.WithContext(r.Context()).SaveFileFromStream(req.Filename, contentType, content, h.maxBase64UploadSize, opts)
+	if err != nil {
+		var corruptErr base64.CorruptInputError
+		if errors.As(err, &corruptErr) {
+			respondError(w, fmt.Sprintf("Invalid base64 data (at byte %d)", int64(corruptErr)), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrFileTooLarge) {
+			respondError(w, fmt.Sprintf("File too large (decoded data is limited to %d bytes)", h.maxBase64UploadSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		respondSaveError(w, err)
+		return
+	}
+
+	h.respondUploaded(w, r, savedFile)
+}
+
+// UploadLive handles live uploads: the raw request body is stored as it arrives, and the
+// file can be downloaded while the upload is still in progress (local storage only).
+// The filename and upload options are read from the query string; pick a slug there
+// to share the link before the upload finishes.
+func (h *APIHandler) UploadLive(w http.ResponseWriter, r *http.Request) {
+	filename := r.URL.Query().Get("filename")
+	if filename == "" {
+		respondError(w, "filename is required", http.StatusBadRequest)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	switch mediaType, _, _ := mime.ParseMediaType(contentType); mediaType {
+	case "multipart/form-data":
+		respondError(w, "Send the content as the raw request body", http.StatusBadRequest)
+		return
+	case "application/x-www-form-urlencoded":
+		contentType = "" // Default of clients like curl, not a real declaration
+	}
+
+	// Options come from the query string only; the body is the content and must not be
+	// parsed as a form
+	r.Form, r.PostForm, r.MultipartForm = r.URL.Query(), url.Values{}, &multipart.Form{}
+	opts, err := parseSaveOptions(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	savedFile, err := h.fileService.WithContext(r.Context()).SaveLive(filename, contentType, r.Body, opts)
+	if err != nil {
+		if errors.Is(err, services.ErrLiveUploadUnsupported) {
+			respondError(w, "Live uploads require local storage", http.StatusNotImplemented)
+			return
+		}
+		respondSaveError(w, err)
+		return
+	}
+
+	h.respondUploaded(w, r, savedFile)
+}
+
+// PresignUpload handles reserving a direct-to-storage upload (S3 only).
+// The client PUTs the content to the returned URL, then calls RegisterUpload with the key.
+func (h *APIHandler) PresignUpload(w http.ResponseWriter, r *http.Request) {
+	var req PresignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Filename == "" {
+		respondError(w, "Filename is required", http.StatusBadRequest)
+		return
+	}
+
+	presigned, err := h.fileService.PresignUpload(req.Filename, req.ContentType, req.Size, req.Storage)
+	if err != nil {
+		if errors.Is(err, services.ErrDirectUploadUnsupported) {
+			respondError(w, "Direct uploads require S3 storage", http.StatusNotImplemented)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidUploadSize) {
+			respondError(w, "Invalid size (must be positive and within PRESIGN_MAX_SIZE)", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrFilenameTooLong) {
+			respondError(w, "Filename is too long", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUnknownStorage) {
+			respondError(w, unknownStorageMessage, http.StatusBadRequest)
+			return
+		}
+		respondError(w, "Failed to presign upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, presigned, http.StatusCreated)
+}
+
+// RegisterUpload handles creating the file for a finished direct upload
+func (h *APIHandler) RegisterUpload(w http.ResponseWriter, r *http.Request) {
+	var req RegisterUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Key == "" {
+		respondError(w, "Key is required", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := req.saveOptions()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	savedFile, err := h.fileService.WithContext(r.Context()).RegisterUpload(req.Key, opts)
+	if err != nil {
+		if errors.Is(err, services.ErrDirectUploadUnsupported) {
+			respondError(w, "Direct uploads require S3 storage", http.StatusNotImplemented)
+			return
+		}
+		if errors.Is(err, services.ErrUploadNotFound) {
+			respondError(w, "Unknown or already registered upload key", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrUploadRegistered) {
+			respondError(w, "Upload already registered", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrUploadIncomplete) {
+			respondError(w, "Upload not found in storage (upload the content before registering)", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrUploadMismatch) {
+			respondError(w, "Uploaded object does not match the presigned size or content type", http.StatusConflict)
+			return
+		}
+		respondSaveError(w, err)
+		return
+	}
+
+	h.respondUploaded(w, r, savedFile)
+}
+
+// CloneFile handles re-sharing an existing file's content as a new file with its own
+// slug, expiry, password, and other settings (JSON body with the upload options)
+func (h *APIHandler) CloneFile(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req UploadOptionsRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Replace {
+		respondError(w, "replace is not supported for clones", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := req.saveOptions()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	savedFile, err := h.fileService.WithContext(r.Context()).CloneFile(id, opts)
+	if err != nil {
+		if errors.Is(err, services.ErrFileNotFound) {
+			respondError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrFileExpired) {
+			respondError(w, "File has expired", http.StatusGone)
+			return
+		}
+		if errors.Is(err, services.ErrFileInProgress) {
+			respondError(w, "File upload is still in progress", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			respondError(w, "File content not found", http.StatusNotFound)
+			return
+		}
+		respondSaveError(w, err)
+		return
+	}
+
+	h.respondUploaded(w, r, savedFile)
+}
+
+// base64PayloadReader returns a reader that decodes base64 data, along with the
+// media type declared if the data is a data URI
+func base64PayloadReader(data string) (io.Reader, string, error) {
+	mediaType := ""
+	if rest, ok := strings.CutPrefix(data, "data:"); ok {
+		header, payload, found := strings.Cut(rest, ",")
+		params, isBase64 := strings.CutSuffix(header, ";base64")
+		if !found || !isBase64 {
+			return nil, "", errors.New("Invalid data URI (only base64 data URIs are supported)")
+		}
+		mediaType, data = params, payload
+	}
+
+	encoding := base64.StdEncoding
+	if strings.ContainsAny(data, "-_") {
+		encoding = base64.URLEncoding
+	}
+	return base64.NewDecoder(encoding, strings.NewReader(data)), mediaType, nil
+}
+
+// respondUploaded responds with a newly saved file, or just its share URL for
+// clients that prefer plain text (e.g., curl -H "Accept: text/plain").
+// A replaced file keeps its ID, so its cached torrent is dropped here.
+func (h *APIHandler) respondUploaded(w http.ResponseWriter, r *http.Request, file *models.File) {
+	h.torrentCache.InvalidateFile(file.ID)
+	setAuditTarget(r, file.ID)
+	if acceptsPlainText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintln(w, shareURL(r, file))
+		return
+	}
+
+	respondJSON(w, file, http.StatusCreated)
+}
+
+// parseSaveOptions reads the optional upload parameters shared by file and paste uploads
+func parseSaveOptions(r *http.Request) (services.SaveOptions, error) {
 	var expiresAt *time.Time
 	if expiresAtStr := r.FormValue("expires_at"); expiresAtStr != "" {
-		t, err := time.Parse(time.RFC3339, expiresAtStr)
+		t, err := parseTime(expiresAtStr, nil)
 		if err != nil {
-			respondError(w, "Invalid expires_at format (use RFC3339)", http.StatusBadRequest)
-			return
+			return services.SaveOptions{}, errors.New("Invalid expires_at format (use RFC3339 or 2006-01-02T15:04)")
 		}
 		expiresAt = &t
 	}
 
+	var expiresAfterFirstDownload *time.Duration
+	if durationStr := r.FormValue("expires_after_first_download"); durationStr != "" {
+		d, err := time.ParseDuration(durationStr)
+		if err != nil {
+			return services.SaveOptions{}, errors.New("Invalid expires_after_first_download format (use a duration like 24h)")
+		}
+		expiresAfterFirstDownload = &d
+	}
+
+	var lockedUntil *time.Time
+	if lockedUntilStr := r.FormValue("locked_until"); lockedUntilStr != "" {
+		t, err := parseTime(lockedUntilStr, nil)
+		if err != nil {
+			return services.SaveOptions{}, errors.New("Invalid locked_until format (use RFC3339 or 2006-01-02T15:04)")
+		}
+		lockedUntil = &t
+	}
+
+	// Original upload time, for files migrated from another system
+	var uploadedAt *time.Time
+	if uploadedAtStr := r.FormValue("original_uploaded_at"); uploadedAtStr != "" {
+		t, err := parseTime(uploadedAtStr, nil)
+		if err != nil {
+			return services.SaveOptions{}, errors.New("Invalid original_uploaded_at format (use RFC3339 or 2006-01-02T15:04)")
+		}
+		uploadedAt = &t
+	}
+
+	var maxDownloads *int64
+	if maxStr := r.FormValue("max_downloads"); maxStr != "" {
+		n, err := strconv.ParseInt(maxStr, 10, 64)
+		if err != nil || n <= 0 {
+			return services.SaveOptions{}, errors.New("Invalid max_downloads (use a positive number)")
+		}
+		maxDownloads = &n
+	}
+
 	var password *string
 	if pwd := r.FormValue("password"); pwd != "" {
 		password = &pwd
 	}
 
+	// Access list: comma-separated, or the field repeated
+	var accessTokens []string
+	for _, value := range r.Form["access_tokens"] {
+		accessTokens = append(accessTokens, strings.Split(value, ",")...)
+	}
+
 	var slug *string
 	if s := r.FormValue("slug"); s != "" {
 		slug = &s
 	}
 
-	// Parse replace parameter
-	replace := r.FormValue("replace") == "true"
+	// Parse replace parameter
+	replace := r.FormValue("replace") == "true"
+
+	// Named retention policy (resolved to an expiry date by the service)
+	policy := r.FormValue("policy")
+
+	// Custom domain whose namespace the link belongs to (CUSTOM_DOMAINS)
+	domain := r.FormValue("domain")
+
+	// Storage backend to store the content on (STORAGE_BACKENDS, validated by the service)
+	storageName := r.FormValue("storage")
+
+	// Opaque client metadata, e.g. client-side encryption parameters (validated by the service)
+	var clientMetadata json.RawMessage
+	if metadata := r.FormValue("client_metadata"); metadata != "" {
+		clientMetadata = json.RawMessage(metadata)
+	}
+
+	return services.SaveOptions{
+		ExpiresAt:                 expiresAt,
+		ExpiresAfterFirstDownload: expiresAfterFirstDownload,
+		Password:                  password,
+		AccessTokens:              accessTokens,
+		Slug:                      slug,
+		Replace:                   replace,
+		LockedUntil:               lockedUntil,
+		MaxDownloads:              maxDownloads,
+		Policy:                    policy,
+		Domain:                    domain,
+		UploadedAt:                uploadedAt,
+		ClientMetadata:            clientMetadata,
+		Storage:                   storageName,
+	}, nil
+}
+
+// invalidAccessTokensMessage explains the limits on a file's access list
+const invalidAccessTokensMessage = "Invalid access_tokens (at most 100 tokens of up to 256 bytes each)"
+
+// invalidClientMetadataMessage explains the limits on a file's client metadata
+const invalidClientMetadataMessage = "Invalid client_metadata (must be JSON of at most 8 KB)"
+
+// unknownStorageMessage explains the storage upload parameter
+const unknownStorageMessage = "Unknown storage backend (must be listed in STORAGE_BACKENDS or STORAGE_TYPE)"
+
+// respondSaveError maps a save error to an API error response
+func respondSaveError(w http.ResponseWriter, err error) {
+	message, status := saveErrorResponse(w, err)
+	respondError(w, message, status)
+}
+
+// saveErrorResponse maps a save error to an error message and status code, setting
+// Retry-After when storage is unavailable
+func saveErrorResponse(w http.ResponseWriter, err error) (string, int) {
+	if storageUnavailable(w, err) {
+		return "Storage is temporarily unavailable", http.StatusServiceUnavailable
+	}
+	if errors.Is(err, services.ErrInvalidExpiry) {
+		return "Invalid expiry (use either expires_at or a positive expires_after_first_download, not before locked_until)", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrInvalidAccessTokens) {
+		return invalidAccessTokensMessage, http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrInvalidClientMetadata) {
+		return invalidClientMetadataMessage, http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrExpiryRequired) {
+		return "An expiry date is required (set expires_at or policy)", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrFileLocked) {
+		return "Existing file is locked and cannot be replaced", http.StatusLocked
+	}
+	if errors.Is(err, services.ErrContentTypeMismatch) {
+		return "Declared content type does not match file content", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrUnknownPolicy) {
+		return "Unknown retention policy (see GET /api/policies)", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrInvalidUploadTime) {
+		return "Invalid original_uploaded_at (cannot be in the future)", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrFilenameTooLong) {
+		return "Filename is too long", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrPasswordTooLong) {
+		return passwordTooLongMessage(err), http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrUnknownDomain) {
+		return "Unknown domain (must be listed in CUSTOM_DOMAINS)", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrUnknownStorage) {
+		return unknownStorageMessage, http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrSlugTaken) {
+		return "Slug already taken", http.StatusConflict
+	}
+	if errors.Is(err, services.ErrFilenameTaken) {
+		return "A file with this name already exists (rename it and upload again)", http.StatusConflict
+	}
+	if errors.Is(err, services.ErrInvalidSlug) {
+		return invalidSlugMessage(err), http.StatusBadRequest
+	}
+	return "Failed to save file: " + err.Error(), http.StatusInternalServerError
+}
+
+// ListFiles handles listing all files (?tz= renders timestamps in an IANA time zone).
+// The listing can be narrowed to an expiry window with expires_after and expires_before
+// (RFC3339, or 2006-01-02T15:04 in tz) or expiring_soon (e.g., 24h); include_permanent=true also lists files
+// that never expire. ?sort= orders it by a column ("-" prefixed for descending).
+func (h *APIHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	loc, err := parseTimezone(r.URL.Query().Get("tz"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseListFilter(r.URL.Query(), loc)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files, err := h.fileService.ListFilesMatching(filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSort) {
+			respondError(w, "Invalid sort (use "+strings.Join(services.ListSortColumns, ", ")+", optionally prefixed with - for descending)", http.StatusBadRequest)
+			return
+		}
+		respondError(w, "Failed to list files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, localizeFiles(files, loc), http.StatusOK)
+}
+
+// parseListFilter parses the expiry window query parameters of a file listing
+// Times without a zone are read in loc.
+func parseListFilter(query url.Values, loc *time.Location) (services.ListFilter, error) {
+	var filter services.ListFilter
+
+	if afterStr := query.Get("expires_after"); afterStr != "" {
+		t, err := parseTime(afterStr, loc)
+		if err != nil {
+			return filter, errors.New("Invalid expires_after format (use RFC3339 or 2006-01-02T15:04)")
+		}
+		filter.ExpiresAfter = &t
+	}
+	if beforeStr := query.Get("expires_before"); beforeStr != "" {
+		t, err := parseTime(beforeStr, loc)
+		if err != nil {
+			return filter, errors.New("Invalid expires_before format (use RFC3339 or 2006-01-02T15:04)")
+		}
+		filter.ExpiresBefore = &t
+	}
+	if soonStr := query.Get("expiring_soon"); soonStr != "" {
+		if filter.ExpiresBefore != nil {
+			return filter, errors.New("Use either expiring_soon or expires_before")
+		}
+		d, err := services.ParseDuration(soonStr)
+		if err != nil || d <= 0 {
+			return filter, errors.New("Invalid expiring_soon duration (e.g., 24h or 7d)")
+		}
+		t := time.Now().Add(d)
+		filter.ExpiresBefore = &t
+	}
+	if filter.ExpiresAfter != nil && filter.ExpiresBefore != nil && !filter.ExpiresAfter.Before(*filter.ExpiresBefore) {
+		return filter, errors.New("Invalid expiry window (expires_after must be before expires_before)")
+	}
+
+	filter.Sort = strings.ToLower(strings.TrimSpace(query.Get("sort")))
+
+	if permanentStr := query.Get("include_permanent"); permanentStr != "" {
+		includePermanent, err := strconv.ParseBool(permanentStr)
+		if err != nil {
+			return filter, errors.New("Invalid include_permanent value (use true or false)")
+		}
+		filter.IncludePermanent = includePermanent
+	}
+	return filter, nil
+}
+
+// GetFile handles getting a single file's metadata (?tz= renders timestamps in an IANA time zone)
+func (h *APIHandler) GetFile(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := parseTimezone(r.URL.Query().Get("tz"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.fileService.GetFile(id)
+	if err != nil {
+		if errors.Is(err, services.ErrFileNotFound) {
+			respondError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrFileExpired) {
+			respondError(w, "File has expired", http.StatusGone)
+			return
+		}
+		respondError(w, "Failed to get file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, localizeFile(file, loc), http.StatusOK)
+}
+
+// maxBatchFiles caps the number of files in one batch metadata lookup
+const maxBatchFiles = 100
+
+// BatchRequest lists the files to look up in one call
+type BatchRequest struct {
+	IDs []uint `json:"ids"`
+}
+
+// VerifyAccessLog handles checking the download access log's hash chain for edited,
+// inserted, or deleted entries. A broken chain is reported with 200 and valid=false.
+func (h *APIHandler) VerifyAccessLog(w http.ResponseWriter, r *http.Request) {
+	result, err := h.fileService.VerifyAccessLog()
+	if err != nil {
+		respondError(w, "Failed to verify access log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, result, http.StatusOK)
+}
+
+// PurgeFile handles permanently deleting a file's record and content, including files
+// already soft-deleted. ?hard=true is required, as the record can't be restored.
+func (h *APIHandler) PurgeFile(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hard, _ := strconv.ParseBool(r.URL.Query().Get("hard")); !hard {
+		respondError(w, "Purging is permanent; confirm with hard=true", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.fileService.HardDeleteFile(id); err != nil {
+		if errors.Is(err, services.ErrFileNotFound) {
+			respondError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrFileLocked) {
+			respondError(w, "File is locked", http.StatusLocked)
+			return
+		}
+		respondError(w, "Failed to purge file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.torrentCache.InvalidateFile(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeDeletedFiles handles permanently removing the files soft-deleted more than
+// ?older_than= ago (Go duration, e.g. 720h; 0 for all of them)
+func (h *APIHandler) PurgeDeletedFiles(w http.ResponseWriter, r *http.Request) {
+	olderThanStr := r.URL.Query().Get("older_than")
+	if olderThanStr == "" {
+		respondError(w, "older_than is required (Go duration, e.g. 720h; 0 for all deleted files)", http.StatusBadRequest)
+		return
+	}
+	olderThan, err := time.ParseDuration(olderThanStr)
+	if err != nil || olderThan < 0 {
+		respondError(w, "Invalid older_than (Go duration, e.g. 720h)", http.StatusBadRequest)
+		return
+	}
+
+	purged, err := h.fileService.PurgeDeletedFiles(olderThan)
+	if err != nil {
+		respondError(w, "Failed to purge deleted files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, map[string]int{"purged": purged}, http.StatusOK)
+}
+
+// GetFilesBatch handles fetching the metadata of several files in one call
+// (?tz= renders timestamps in an IANA time zone). Every requested id gets a result,
+// in request order, with a status of found, not_found, or expired.
+func (h *APIHandler) GetFilesBatch(w http.ResponseWriter, r *http.Request) {
+	loc, err := parseTimezone(r.URL.Query().Get("tz"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBatchFiles {
+		respondError(w, fmt.Sprintf("at most %d files can be fetched at once", maxBatchFiles), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.fileService.GetFiles(req.IDs)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptySelection) {
+			respondError(w, "ids is required", http.StatusBadRequest)
+			return
+		}
+		respondError(w, "Failed to get files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range results {
+		if results[i].File != nil {
+			results[i].File = localizeFile(results[i].File, loc)
+		}
+	}
+	respondJSON(w, results, http.StatusOK)
+}
+
+// FileLinks lists every URL a file can be reached at. The public links are
+// omitted when PUBLIC_SHARING_ENABLED=false.
+type FileLinks struct {
+	ShareURL         string `json:"share_url,omitempty"`    // Share page (/{slug})
+	DownloadURL      string `json:"download_url,omitempty"` // Direct link by original name (/d/{filename})
+	RawURL           string `json:"raw_url,omitempty"`      // Share link serving the plain bytes, even for text previews
+	APIDownloadURL   string `json:"api_download_url"`       // Download with the API key
+	APIRawURL        string `json:"api_raw_url"`            // Inline content with the API key
+	TorrentURL       string `json:"torrent_url"`            // Generated .torrent (API key)
+	PasswordRequired bool   `json:"password_required"`      // Public links need ?password=
+	AccessRestricted bool   `json:"access_restricted"`      // Public links need a listed ?token=
+}
+
+// GetFileLinks handles returning all of a file's URLs, built from BASE_URL (or the
+// request) and the file's custom domain, slug, and original name
+func (h *APIHandler) GetFileLinks(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Save file
-	savedFile, err := h.fileService.SaveFile(fileHeader, expiresAt, password, slug, replace)
+	file, err := h.fileService.GetFile(id)
 	if err != nil {
-		if errors.Is(err, services.ErrSlugTaken) {
-			respondError(w, "Slug already taken", http.StatusConflict)
+		if errors.Is(err, services.ErrFileNotFound) {
+			respondError(w, "File not found", http.StatusNotFound)
 			return
 		}
-		if errors.Is(err, services.ErrInvalidSlug) {
-			respondError(w, "Invalid slug format (use lowercase letters, numbers, and hyphens only)", http.StatusBadRequest)
+		if errors.Is(err, services.ErrFileExpired) {
+			respondError(w, "File has expired", http.StatusGone)
 			return
 		}
-		respondError(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
+		respondError(w, "Failed to get file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, savedFile, http.StatusCreated)
-}
-
-// ListFiles handles listing all files
-func (h *APIHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
-	files, err := h.fileService.ListFiles()
-	if err != nil {
-		respondError(w, "Failed to list files: "+err.Error(), http.StatusInternalServerError)
-		return
+	apiBaseURL := requestBaseURL(r) + "/api"
+	idStr := strconv.FormatUint(uint64(file.ID), 10)
+	links := FileLinks{
+		APIDownloadURL:   apiBaseURL + "/download/" + idStr,
+		APIRawURL:        apiBaseURL + "/files/" + idStr + "/raw",
+		TorrentURL:       apiBaseURL + "/files/" + idStr + "/torrent",
+		PasswordRequired: file.HasPassword(),
+		AccessRestricted: file.HasAccessList(),
+	}
+	if PublicSharingEnabled() {
+		links.ShareURL = shareURL(r, file)
+		links.DownloadURL = downloadURL(r, file)
+		links.RawURL = links.ShareURL + "?raw"
 	}
 
-	respondJSON(w, files, http.StatusOK)
+	respondJSON(w, links, http.StatusOK)
 }
 
-// GetFile handles getting a single file's metadata
-func (h *APIHandler) GetFile(w http.ResponseWriter, r *http.Request) {
+// VerifyFile handles checking a file's stored content against the checksum recorded
+// at upload. A mismatch is reported with 200 and "match": false.
+func (h *APIHandler) VerifyFile(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
 	if err != nil {
 		respondError(w, err.Error(), http.StatusBadRequest)
@@ -134,7 +1044,17 @@ func (h *APIHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, file, http.StatusOK)
+	result, err := h.fileService.VerifyFile(file)
+	if err != nil {
+		if errors.Is(err, services.ErrNoChecksum) {
+			respondError(w, "File has no stored checksum (uploaded directly to storage)", http.StatusConflict)
+			return
+		}
+		respondOpenError(w, err)
+		return
+	}
+
+	respondJSON(w, result, http.StatusOK)
 }
 
 // UpdateFile handles updating file metadata
@@ -145,14 +1065,39 @@ func (h *APIHandler) UpdateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc, err := parseTimezone(r.URL.Query().Get("tz"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var req UpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	file, err := h.fileService.UpdateFile(id, req.ExpiresAt, req.Password, req.Slug)
+	file, err := h.fileService.UpdateFile(id, services.UpdateOptions{
+		ExpiresAt:    req.ExpiresAt.ptr(),
+		Password:     req.Password,
+		AccessTokens: req.AccessTokens,
+		Slug:         req.Slug,
+		LockedUntil:  req.LockedUntil.ptr(),
+		Disabled:     req.Disabled,
+
+		MaxDownloads:   req.MaxDownloads,
+		ContentType:    req.ContentType,
+		ClientMetadata: req.ClientMetadata,
+	})
 	if err != nil {
+		if errors.Is(err, services.ErrFileLocked) {
+			respondError(w, "File is locked", http.StatusLocked)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidExpiry) {
+			respondError(w, "Expiry cannot be before locked_until", http.StatusBadRequest)
+			return
+		}
 		if errors.Is(err, services.ErrFileNotFound) {
 			respondError(w, "File not found", http.StatusNotFound)
 			return
@@ -165,15 +1110,85 @@ func (h *APIHandler) UpdateFile(w http.ResponseWriter, r *http.Request) {
 			respondError(w, "Slug already taken", http.StatusConflict)
 			return
 		}
+		if errors.Is(err, services.ErrFilenameTaken) {
+			respondError(w, "A file with this name already exists", http.StatusConflict)
+			return
+		}
 		if errors.Is(err, services.ErrInvalidSlug) {
-			respondError(w, "Invalid slug format (use lowercase letters, numbers, and hyphens only)", http.StatusBadRequest)
+			respondError(w, invalidSlugMessage(err), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAccessTokens) {
+			respondError(w, invalidAccessTokensMessage, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidContentType) {
+			respondError(w, "Invalid content_type (use a MIME type like text/plain)", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidClientMetadata) {
+			respondError(w, invalidClientMetadataMessage, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrPasswordTooLong) {
+			respondError(w, passwordTooLongMessage(err), http.StatusBadRequest)
 			return
 		}
 		respondError(w, "Failed to update file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, file, http.StatusOK)
+	respondJSON(w, localizeFile(file, loc), http.StatusOK)
+}
+
+// ExtendFiles handles pushing back the expiry of many files at once
+func (h *APIHandler) ExtendFiles(w http.ResponseWriter, r *http.Request) {
+	var req ExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt time.Time
+	switch {
+	case req.ExpiresAt != nil && req.ExpiresIn != "":
+		respondError(w, "Use either expires_at or expires_in, not both", http.StatusBadRequest)
+		return
+	case req.ExpiresAt != nil:
+		expiresAt = time.Time(*req.ExpiresAt)
+	case req.ExpiresIn != "":
+		d, err := services.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			respondError(w, "Invalid expires_in (use a positive duration like 72h or 30d)", http.StatusBadRequest)
+			return
+		}
+		expiresAt = time.Now().Add(d)
+	default:
+		respondError(w, "expires_at or expires_in is required", http.StatusBadRequest)
+		return
+	}
+	if !expiresAt.After(time.Now()) {
+		respondError(w, "New expiry must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.fileService.ExtendExpiry(services.FileSelection{IDs: req.IDs, Search: req.Search}, expiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptySelection) {
+			respondError(w, "ids or search is required", http.StatusBadRequest)
+			return
+		}
+		respondError(w, "Failed to extend files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	extended := 0
+	for _, result := range results {
+		if result.Status == services.ExtendStatusExtended {
+			extended++
+		}
+	}
+	respondJSON(w, ExtendResponse{Extended: extended, Results: results}, http.StatusOK)
 }
 
 // DeleteFile handles file deletion
@@ -189,15 +1204,30 @@ func (h *APIHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
 			respondError(w, "File not found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, services.ErrFileLocked) {
+			respondError(w, "File is locked", http.StatusLocked)
+			return
+		}
 		respondError(w, "Failed to delete file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	h.torrentCache.InvalidateFile(id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // DownloadFile handles file download with password validation
 func (h *APIHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	h.serveFile(w, r, "attachment")
+}
+
+// RawFile handles serving a file's content inline (no save dialog), e.g. to embed an image
+func (h *APIHandler) RawFile(w http.ResponseWriter, r *http.Request) {
+	h.serveFile(w, r, "inline")
+}
+
+// serveFile serves a file's content with the given Content-Disposition type
+func (h *APIHandler) serveFile(w http.ResponseWriter, r *http.Request, disposition string) {
 	id, err := getIDFromURL(r)
 	if err != nil {
 		respondError(w, err.Error(), http.StatusBadRequest)
@@ -233,28 +1263,391 @@ func (h *APIHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set headers for file download
-	w.Header().Set("Content-Disposition", "attachment; filename=\""+file.OriginalName+"\"")
-	w.Header().Set("Content-Type", file.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(file.FileSize, 10))
+	contentType, err := downloadContentType(r, file)
+	if err != nil {
+		respondError(w, invalidContentTypeOverrideMessage, http.StatusBadRequest)
+		return
+	}
+
+	// Images may be served transcoded to a smaller format (?format= or Accept) or resized
+	reader, served, err := openImageVariant(w, r, h.fileService.WithContext(r.Context()), file)
+	if err != nil {
+		respondError(w, imageVariantErrorMessage(err), http.StatusBadRequest)
+		return
+	}
+	if reader != nil {
+		defer reader.Close()
+		contentType = served.ContentType
+	}
 
-	// Get file reader from storage
-	reader, err := h.fileService.GetFileReader(file)
+	// A single Range resumes an interrupted download
+	rng, err := requestedRange(r, served)
 	if err != nil {
-		respondError(w, "Failed to read file", http.StatusInternalServerError)
+		setUnsatisfiableRange(w, served)
+		respondError(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if disposition == "inline" {
+		// Let clients cache inline content, revalidating with the content hash
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if etag := downloadETag(served); etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	// Open file from storage before writing any success headers (HEAD only needs the headers)
+	if reader != nil && rng != nil {
+		if reader, err = services.SliceReader(reader, rng.start, rng.length); err != nil {
+			respondError(w, "Failed to read file: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if reader == nil && r.Method != http.MethodHead {
+		if reader, err = openDownloadRange(h.fileService.WithContext(r.Context()), file, rng); err != nil {
+			respondOpenError(w, err)
+			return
+		}
+		defer reader.Close()
+	}
+
+	// Set headers for file download
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, downloadName(served)))
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(setRangeHeaders(w, served, rng))
+	if r.Method == http.MethodHead {
 		return
 	}
-	defer reader.Close()
 
 	// Copy file content to response
-	if _, err := io.Copy(w, reader); err != nil {
-		// Log error but don't send response as headers already sent
+	streamDownload(w, r, reader, served)
+}
+
+// respondOpenError responds to a failure to open a file's content from storage
+func respondOpenError(w http.ResponseWriter, err error) {
+	if storageUnavailable(w, err) {
+		respondError(w, "Storage is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		respondError(w, "File content not found", http.StatusNotFound)
+		return
+	}
+	respondError(w, "Failed to read file", http.StatusInternalServerError)
+}
+
+// ListPolicies handles listing the configured retention policies
+func (h *APIHandler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies := h.fileService.RetentionPolicies()
+	if policies == nil {
+		policies = []services.RetentionPolicy{}
+	}
+	respondJSON(w, policies, http.StatusOK)
+}
+
+// defaultStatsWindows is the range returned by GetDownloadStats when no "from" is given
+var defaultStatsWindows = map[string]time.Duration{
+	services.StatsIntervalHour:  48 * time.Hour,
+	services.StatsIntervalDay:   30 * 24 * time.Hour,
+	services.StatsIntervalWeek:  12 * 7 * 24 * time.Hour,
+	services.StatsIntervalMonth: 365 * 24 * time.Hour,
+}
+
+// GetDownloadStats handles returning a file's downloads as a time series
+// (?interval=hour|day|week|month, ?tz=Europe/Berlin, ?from= and ?to= in RFC3339)
+func (h *APIHandler) GetDownloadStats(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = services.StatsIntervalDay
+	}
+	window, ok := defaultStatsWindows[interval]
+	if !ok {
+		respondError(w, "Invalid interval (use hour, day, week, or month)", http.StatusBadRequest)
+		return
+	}
+
+	loc, err := parseTimezone(query.Get("tz"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc = inputLocation(loc)
+
+	to := time.Now()
+	if toStr := query.Get("to"); toStr != "" {
+		to, err = parseTime(toStr, loc)
+		if err != nil {
+			respondError(w, "Invalid to format (use RFC3339 or 2006-01-02T15:04)", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-window)
+	if fromStr := query.Get("from"); fromStr != "" {
+		from, err = parseTime(fromStr, loc)
+		if err != nil {
+			respondError(w, "Invalid from format (use RFC3339 or 2006-01-02T15:04)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats, err := h.fileService.DownloadStats(id, interval, from, to, loc)
+	if err != nil {
+		if errors.Is(err, services.ErrFileNotFound) {
+			respondError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidRange) {
+			respondError(w, "Invalid range (from must be before to, with at most 1000 buckets)", http.StatusBadRequest)
+			return
+		}
+		respondError(w, "Failed to get download stats: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, stats, http.StatusOK)
+}
+
+// GetCacheStats handles reporting file metadata cache usage (hits, misses, size)
+func (h *APIHandler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, h.fileService.CacheStats(), http.StatusOK)
+}
+
+// StorageCheckResponse reports the round-trip check of each storage backend
+type StorageCheckResponse struct {
+	OK       bool                    `json:"ok"` // Every checked backend passed
+	Backends []services.StorageCheck `json:"backends"`
+}
+
+// CheckStorage handles checking that storage is configured correctly by writing, reading
+// back, and deleting a sentinel object on each backend (?storage= checks just one).
+// It returns 503 if any backend fails, with the failing step and the backend's error.
+func (h *APIHandler) CheckStorage(w http.ResponseWriter, r *http.Request) {
+	checks, err := h.fileService.WithContext(r.Context()).CheckStorage(r.URL.Query().Get("storage"))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownStorage) {
+			respondError(w, unknownStorageMessage, http.StatusBadRequest)
+			return
+		}
+		respondError(w, "Failed to check storage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := StorageCheckResponse{OK: true, Backends: checks}
+	for _, check := range checks {
+		response.OK = response.OK && check.OK
+	}
+	status := http.StatusOK
+	if !response.OK {
+		status = http.StatusServiceUnavailable
+	}
+	respondJSON(w, response, status)
+}
+
+// GetUsage handles reporting the authenticated key's file count, bytes used, and limits
+func (h *APIHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.fileService.Usage()
+	if err != nil {
+		respondError(w, "Failed to get usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, usage, http.StatusOK)
+}
+
+// GetTorrent handles generating a .torrent file (or magnet link with ?format=magnet) for a file
+func (h *APIHandler) GetTorrent(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.fileService.GetFile(id)
+	if err != nil {
+		if errors.Is(err, services.ErrFileNotFound) {
+			respondError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrFileExpired) {
+			respondError(w, "File has expired", http.StatusGone)
+			return
+		}
+		respondError(w, "Failed to get file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Pieces can only be hashed once the content is complete
+	if file.InProgress {
+		respondError(w, "File is still being uploaded", http.StatusConflict)
 		return
 	}
+
+	key := torrentCacheKey(file)
+	info, ok := h.torrentCache.Get(key)
+	if !ok {
+		reader, err := h.fileService.GetFileReader(file)
+		if err != nil {
+			if storageUnavailable(w, err) {
+				respondError(w, "Storage is temporarily unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				respondError(w, "File content not found", http.StatusNotFound)
+				return
+			}
+			respondError(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		defer reader.Close()
+
+		info, err = torrent.HashPieces(reader, downloadName(file), file.FileSize)
+		if err != nil {
+			if errors.Is(err, torrent.ErrEmptyContent) {
+				respondError(w, "Empty files cannot be shared as torrents", http.StatusConflict)
+				return
+			}
+			respondError(w, "Failed to hash file: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.torrentCache.Put(file.ID, key, info)
+	}
+
+	// The public download route works as a web seed unless a password or access token is required
+	webSeed := ""
+	if !file.HasPassword() && !file.HasAccessList() && PublicSharingEnabled() {
+		webSeed = downloadURL(r, file)
+	}
+
+	if r.URL.Query().Get("format") == "magnet" {
+		magnet, err := torrent.MagnetLink(info, h.torrentTracker, webSeed)
+		if err != nil {
+			respondError(w, "Failed to create magnet link", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, map[string]string{"magnet": magnet}, http.StatusOK)
+		return
+	}
+
+	metaInfo, err := torrent.MetaInfo(info, h.torrentTracker, webSeed)
+	if err != nil {
+		respondError(w, "Failed to create torrent", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", downloadName(file)+".torrent"))
+	w.Header().Set("Content-Length", strconv.Itoa(len(metaInfo)))
+	w.Write(metaInfo)
 }
 
 // Helper functions
 
+// torrentCacheKey is the torrent cache key for a file. The info dictionary holds the
+// download name as well as the piece hashes, so files sharing content (clones,
+// content-addressed copies) only share an entry when their names match too.
+// Files without a content hash fall back to the stored blob name, which changes when
+// the content is replaced.
+func torrentCacheKey(file *models.File) string {
+	content := file.ContentHash
+	if content == "" {
+		content = "blob:" + file.Filename
+	}
+	return content + "/" + downloadName(file)
+}
+
+// createOnly reports whether an upload asks not to be created if its slug exists
+// (If-None-Match: * or fail_if_exists=true in the query string)
+func createOnly(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") == "*" || r.URL.Query().Get("fail_if_exists") == "true"
+}
+
+// remoteIP returns the client's IP address without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acceptsPlainText reports whether the client prefers text/plain over JSON.
+// The first recognized media type in the Accept header wins; JSON is the default.
+func acceptsPlainText(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accepted, ";")
+		switch strings.TrimSpace(strings.ToLower(mediaType)) {
+		case "text/plain":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// shareURL returns the public share link for a file
+func shareURL(r *http.Request, file *models.File) string {
+	return fileBaseURL(r, file) + services.SlugPath(file.Slug)
+}
+
+// downloadURL returns the public direct download link for a file (by original name).
+// Files without an original name are downloaded from their share link.
+func downloadURL(r *http.Request, file *models.File) string {
+	if strings.TrimSpace(file.OriginalName) == "" {
+		return shareURL(r, file)
+	}
+	return fileBaseURL(r, file) + "/d/" + url.PathEscape(file.OriginalName)
+}
+
+// fileBaseURL returns the base URL the file's links are served from: its custom
+// domain (keeping the scheme of the public base URL) or the public base URL itself
+func fileBaseURL(r *http.Request, file *models.File) string {
+	baseURL := requestBaseURL(r)
+	if file.Domain == "" {
+		return baseURL
+	}
+
+	scheme, _, _ := strings.Cut(baseURL, "://")
+	return scheme + "://" + file.Domain
+}
+
+// requestBaseURL returns the public base URL (e.g., "https://example.com").
+// BASE_URL takes precedence; otherwise it is derived from the request's scheme (as
+// forwarded by a trusted proxy, see TRUSTED_PROXIES) and host.
+func requestBaseURL(r *http.Request) string {
+	if baseURL := os.Getenv("BASE_URL"); baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+
+	return mw.Scheme(r) + "://" + r.Host
+}
+
+// passwordTooLongMessage describes the password length limit
+func passwordTooLongMessage(err error) string {
+	var lengthErr *services.PasswordTooLongError
+	if errors.As(err, &lengthErr) {
+		return fmt.Sprintf("Password is too long (at most %d bytes)", lengthErr.Max)
+	}
+	return "Password is too long"
+}
+
+// invalidSlugMessage describes why a slug was rejected
+func invalidSlugMessage(err error) string {
+	var slugErr *services.InvalidSlugError
+	if errors.As(err, &slugErr) {
+		return "Invalid slug format (" + slugErr.Reason + ")"
+	}
+	return "Invalid slug format"
+}
+
 func getIDFromURL(r *http.Request) (uint, error) {
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
@@ -278,3 +1671,26 @@ func respondJSON(w http.ResponseWriter, data interface{}, status int) {
 func respondError(w http.ResponseWriter, message string, status int) {
 	respondJSON(w, ErrorResponse{Error: message}, status)
 }
+
+// respondUploadError responds with an upload error, as plain text to clients that
+// asked for the share URL as plain text and as JSON otherwise
+func respondUploadError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if !acceptsPlainText(r) {
+		respondError(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, "Error: "+message)
+}
+
+// removeMultipartFiles deletes the temp files a parsed multipart form spilled to disk,
+// whether or not the upload succeeded (net/http only does so after the response is done)
+func removeMultipartFiles(r *http.Request) {
+	if r.MultipartForm == nil {
+		return
+	}
+	if err := r.MultipartForm.RemoveAll(); err != nil {
+		log.Printf("Warning: failed to remove multipart temp files: %v", err)
+	}
+}
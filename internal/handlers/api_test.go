@@ -0,0 +1,848 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yorukot/sharing/internal/database"
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/services"
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+// uploadedFile decodes the file record an upload responded with
+func uploadedFile(t *testing.T, rec *httptest.ResponseRecorder) *models.File {
+	t.Helper()
+	var file models.File
+	if err := json.NewDecoder(rec.Body).Decode(&file); err != nil {
+		t.Fatalf("decoding upload response: %v", err)
+	}
+	return &file
+}
+
+// storedContent returns the stored content of the file with the given ID
+func storedContent(t *testing.T, backends *storage.Registry, id uint) string {
+	t.Helper()
+	s := services.NewFileService(backends)
+	file, err := s.GetFile(id)
+	if err != nil {
+		t.Fatalf("GetFile: %v", err)
+	}
+	reader, err := s.GetFileReader(file)
+	if err != nil {
+		t.Fatalf("opening file %d: %v", id, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading file %d: %v", id, err)
+	}
+	return string(content)
+}
+
+func TestCreatePaste(t *testing.T) {
+	t.Setenv("PASTE_MAX_SIZE", "64")
+
+	formBody := url.Values{"content": {"package main"}, "language": {"Go"}}.Encode()
+
+	tests := []struct {
+		name         string
+		target       string
+		contentType  string
+		body         string
+		want         int
+		wantLanguage string
+		wantContent  string
+	}{
+		{"form", "/api/paste", "application/x-www-form-urlencoded", formBody, http.StatusCreated, "go", "package main"},
+		{"raw body", "/api/paste?language=python", "text/plain", "print('hi')", http.StatusCreated, "python", "print('hi')"},
+		{"default language", "/api/paste", "text/plain", "plain notes", http.StatusCreated, "text", "plain notes"},
+		{"empty", "/api/paste", "text/plain", "", http.StatusBadRequest, "", ""},
+		{"not UTF-8", "/api/paste", "text/plain", "\xff\xfe", http.StatusBadRequest, "", ""},
+		{"invalid language", "/api/paste?language=go%20lang!", "text/plain", "x", http.StatusBadRequest, "", ""},
+		{"too large", "/api/paste", "text/plain", strings.Repeat("x", 65), http.StatusRequestEntityTooLarge, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			h := NewAPIHandler(backends)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := serve(http.HandlerFunc(h.CreatePaste), req)
+			if rec.Code != tt.want {
+				t.Fatalf("paste = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			file := uploadedFile(t, rec)
+			if file.Language != tt.wantLanguage {
+				t.Errorf("language = %q, want %q", file.Language, tt.wantLanguage)
+			}
+			if got := storedContent(t, backends, file.ID); got != tt.wantContent {
+				t.Errorf("stored content = %q, want %q", got, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestGetFileLinks(t *testing.T) {
+	password := "secret"
+
+	tests := []struct {
+		name      string
+		baseURL   string
+		public    string // PUBLIC_SHARING_ENABLED
+		filename  string
+		opts      services.SaveOptions
+		missing   bool // Ask for a file that doesn't exist
+		want      int
+		wantLinks FileLinks // {id} and {slug} are replaced by the file's
+	}{
+		{
+			name: "links from the request host", filename: "report 1.pdf", want: http.StatusOK,
+			wantLinks: FileLinks{
+				ShareURL:       "http://files.test{slug}",
+				DownloadURL:    "http://files.test/d/report%201.pdf",
+				RawURL:         "http://files.test{slug}?raw",
+				APIDownloadURL: "http://files.test/api/download/{id}",
+				APIRawURL:      "http://files.test/api/files/{id}/raw",
+				TorrentURL:     "http://files.test/api/files/{id}/torrent",
+			},
+		},
+		{
+			name: "links from BASE_URL", baseURL: "https://share.example.com/", filename: "notes.txt", want: http.StatusOK,
+			wantLinks: FileLinks{
+				ShareURL:       "https://share.example.com{slug}",
+				DownloadURL:    "https://share.example.com/d/notes.txt",
+				RawURL:         "https://share.example.com{slug}?raw",
+				APIDownloadURL: "https://share.example.com/api/download/{id}",
+				APIRawURL:      "https://share.example.com/api/files/{id}/raw",
+				TorrentURL:     "https://share.example.com/api/files/{id}/torrent",
+			},
+		},
+		{
+			name: "public sharing disabled", public: "false", filename: "notes.txt", want: http.StatusOK,
+			wantLinks: FileLinks{
+				APIDownloadURL: "http://files.test/api/download/{id}",
+				APIRawURL:      "http://files.test/api/files/{id}/raw",
+				TorrentURL:     "http://files.test/api/files/{id}/torrent",
+			},
+		},
+		{
+			name: "protected file", filename: "notes.txt", want: http.StatusOK,
+			opts: services.SaveOptions{Password: &password, AccessTokens: []string{"alice"}},
+			wantLinks: FileLinks{
+				ShareURL:         "http://files.test{slug}",
+				DownloadURL:      "http://files.test/d/notes.txt",
+				RawURL:           "http://files.test{slug}?raw",
+				APIDownloadURL:   "http://files.test/api/download/{id}",
+				APIRawURL:        "http://files.test/api/files/{id}/raw",
+				TorrentURL:       "http://files.test/api/files/{id}/torrent",
+				PasswordRequired: true,
+				AccessRestricted: true,
+			},
+		},
+		{name: "missing file", filename: "notes.txt", missing: true, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BASE_URL", tt.baseURL)
+			t.Setenv("PUBLIC_SHARING_ENABLED", tt.public)
+			backends := newTestBackends(t)
+			file := mustUpload(t, backends, tt.filename, []byte("content"), tt.opts)
+			r := chi.NewRouter()
+			r.Get("/api/files/{id}/links", NewAPIHandler(backends).GetFileLinks)
+
+			id := file.ID
+			if tt.missing {
+				id += 1000
+			}
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/files/%d/links", id), nil)
+			req.Host = "files.test"
+			rec := serve(r, req)
+			if rec.Code != tt.want {
+				t.Fatalf("GET links = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var links FileLinks
+			if err := json.NewDecoder(rec.Body).Decode(&links); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			replacer := strings.NewReplacer("{id}", strconv.FormatUint(uint64(file.ID), 10), "{slug}", services.SlugPath(file.Slug))
+			want := tt.wantLinks
+			for _, link := range []*string{&want.ShareURL, &want.DownloadURL, &want.RawURL, &want.APIDownloadURL, &want.APIRawURL, &want.TorrentURL} {
+				*link = replacer.Replace(*link)
+			}
+			if links != want {
+				t.Fatalf("links = %+v, want %+v", links, want)
+			}
+		})
+	}
+}
+
+func TestUploadFileGzipBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int64 // Largest decompressed body, or 0 for one byte less than the upload
+		want  int
+	}{
+		{"within the limit", 1 << 20, http.StatusCreated},
+		{"decompressed size over the limit", 0, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			upload := multipartUpload(t, nil, "notes.txt")
+			body, _ := io.ReadAll(upload.Body)
+
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			gz.Write(body)
+			gz.Close()
+			limit := tt.limit
+			if limit == 0 {
+				limit = int64(len(body)) - 1
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/upload", &compressed)
+			req.Header.Set("Content-Type", upload.Header.Get("Content-Type"))
+			req.Header.Set("Content-Encoding", "gzip")
+			rec := serve(mw.DecompressBody(limit)(http.HandlerFunc(NewAPIHandler(backends).UploadFile)), req)
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			file := uploadedFile(t, rec)
+			if got := storedContent(t, backends, file.ID); got != "content of notes.txt" {
+				t.Errorf("stored content = %q, want the decompressed upload", got)
+			}
+		})
+	}
+}
+
+func TestUploadFileOriginalUploadTime(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		want         int
+		wantUploaded string // RFC3339, in UTC
+	}{
+		{"RFC3339", "2024-05-01T10:30:00+02:00", http.StatusCreated, "2024-05-01T08:30:00Z"},
+		{"datetime-local", "2024-05-01T10:30", http.StatusCreated, "2024-05-01T10:30:00Z"},
+		{"invalid format", "May 1st", http.StatusBadRequest, ""},
+		{"in the future", time.Now().Add(time.Hour).UTC().Format(time.RFC3339), http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			req := multipartUpload(t, map[string]string{"original_uploaded_at": tt.value}, "notes.txt")
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).UploadFile), req)
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			file := uploadedFile(t, rec)
+			if got := file.OriginalUploadedAt.UTC().Format(time.RFC3339); got != tt.wantUploaded {
+				t.Errorf("original upload time = %s, want %s", got, tt.wantUploaded)
+			}
+			if !file.CreatedAt.After(file.OriginalUploadedAt) {
+				t.Errorf("created_at = %v, want the time of the upload", file.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestUploadFileNameCollision(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     int
+		wantName string
+	}{
+		{"suffix-counter", http.StatusCreated, "notes-2.txt"},
+		{"reject", http.StatusConflict, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Setenv("FILENAME_COLLISION", tt.strategy)
+			backends := newTestBackends(t)
+			mustUpload(t, backends, "notes.txt", []byte("first"), services.SaveOptions{})
+
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).UploadFile), multipartUpload(t, nil, "notes.txt"))
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusCreated {
+				if file := uploadedFile(t, rec); file.OriginalName != tt.wantName {
+					t.Errorf("stored as %q, want %q", file.OriginalName, tt.wantName)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadFileStorageChoice(t *testing.T) {
+	tests := []struct {
+		storage string
+		want    int
+	}{
+		{"", http.StatusCreated},
+		{"local", http.StatusCreated},
+		{"gcs", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run("storage="+tt.storage, func(t *testing.T) {
+			backends := newTestBackends(t)
+			req := multipartUpload(t, map[string]string{"storage": tt.storage}, "notes.txt")
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).UploadFile), req)
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusCreated {
+				if file := uploadedFile(t, rec); file.StorageBackend != "local" {
+					t.Errorf("stored on %q, want local", file.StorageBackend)
+				}
+			} else if !strings.Contains(rec.Body.String(), unknownStorageMessage) {
+				t.Errorf("body = %q, want the unknown storage message", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTorrent(t *testing.T) {
+	backends := newTestBackends(t)
+	h := NewAPIHandler(backends)
+	router := chi.NewRouter()
+	router.Get("/api/files/{id}/torrent", h.GetTorrent)
+	router.Post("/api/files/{id}/clone", h.CloneFile)
+	router.Delete("/api/files/{id}", h.DeleteFile)
+
+	magnet := func(t *testing.T, id uint) url.Values {
+		t.Helper()
+		rec := serve(router, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/files/%d/torrent?format=magnet", id), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("torrent of file %d = %d (%s)", id, rec.Code, rec.Body.String())
+		}
+		var resp map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding magnet: %v", err)
+		}
+		link, err := url.Parse(resp["magnet"])
+		if err != nil {
+			t.Fatalf("parsing magnet: %v", err)
+		}
+		return link.Query()
+	}
+
+	original := mustUpload(t, backends, "notes.txt", []byte("first version"), services.SaveOptions{})
+	first := magnet(t, original.ID)
+
+	tests := []struct {
+		name     string
+		step     func(t *testing.T) uint // Returns the file to get the torrent of
+		wantName string
+		wantSize string
+		sameHash bool // Whether the info hash matches that of the original
+	}{
+		{"cached", func(t *testing.T) uint { return original.ID }, "notes.txt", "13", true},
+		{"clone named after itself", func(t *testing.T) uint {
+			rec := serve(router, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/files/%d/clone", original.ID), nil))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("clone = %d (%s)", rec.Code, rec.Body.String())
+			}
+			clone := uploadedFile(t, rec)
+			if clone.OriginalName == original.OriginalName {
+				t.Fatalf("clone named %q like the original", clone.OriginalName)
+			}
+			return clone.ID
+		}, "", "13", false},
+		{"original still named after itself", func(t *testing.T) uint { return original.ID }, "notes.txt", "13", true},
+		{"replaced content", func(t *testing.T) uint {
+			mustUpload(t, backends, "notes.txt", []byte("second version!"), services.SaveOptions{Replace: true})
+			return original.ID
+		}, "notes.txt", "15", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := tt.step(t)
+			got := magnet(t, id)
+			if tt.wantName != "" && got.Get("dn") != tt.wantName {
+				t.Errorf("name = %q, want %q", got.Get("dn"), tt.wantName)
+			}
+			if tt.wantName == "" && got.Get("dn") == first.Get("dn") {
+				t.Errorf("name = %q, want the file's own name", got.Get("dn"))
+			}
+			if got.Get("xl") != tt.wantSize {
+				t.Errorf("length = %s, want %s", got.Get("xl"), tt.wantSize)
+			}
+			if (got.Get("xt") == first.Get("xt")) != tt.sameHash {
+				t.Errorf("info hash %s, want same as the original (%s): %v", got.Get("xt"), first.Get("xt"), tt.sameHash)
+			}
+		})
+	}
+
+	t.Run("deleted", func(t *testing.T) {
+		file, err := services.NewFileService(backends).GetFile(original.ID)
+		if err != nil {
+			t.Fatalf("GetFile: %v", err)
+		}
+		if _, ok := h.torrentCache.Get(torrentCacheKey(file)); !ok {
+			t.Fatal("torrent not cached before the delete")
+		}
+		if rec := serve(router, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/files/%d", original.ID), nil)); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete = %d (%s)", rec.Code, rec.Body.String())
+		}
+		if _, ok := h.torrentCache.Get(torrentCacheKey(file)); ok {
+			t.Fatal("torrent still cached after the delete")
+		}
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		empty := mustUpload(t, backends, "empty.txt", nil, services.SaveOptions{})
+		rec := serve(router, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/files/%d/torrent", empty.ID), nil))
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("torrent of an empty file = %d, want %d (%s)", rec.Code, http.StatusConflict, rec.Body.String())
+		}
+	})
+}
+
+func TestUploadFilePasswordLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string // Under 100 characters either way
+		want     int
+	}{
+		{"72 bytes", strings.Repeat("€", 24), http.StatusCreated},
+		{"73 bytes", strings.Repeat("€", 24) + "a", http.StatusBadRequest},
+		{"99 characters", strings.Repeat("é", 99), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			req := multipartUpload(t, map[string]string{"password": tt.password}, "secret.txt")
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).UploadFile), req)
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "at most 72 bytes") {
+				t.Errorf("body = %q, want the byte limit", rec.Body.String())
+			}
+			if tt.want == http.StatusCreated {
+				stored, err := services.NewFileService(backends).GetFile(uploadedFile(t, rec).ID)
+				if err != nil {
+					t.Fatalf("GetFile: %v", err)
+				}
+				if !stored.HasPassword() {
+					t.Error("uploaded without the password")
+				}
+			}
+		})
+	}
+}
+
+func TestUploadFileAccept(t *testing.T) {
+	tests := []struct {
+		name      string
+		accept    string
+		noFile    bool // Upload without the file field, which fails
+		wantCode  int
+		wantPlain bool
+	}{
+		{"default", "", false, http.StatusCreated, false},
+		{"JSON", "application/json", false, http.StatusCreated, false},
+		{"plain text", "text/plain", false, http.StatusCreated, true},
+		{"plain text preferred", "text/plain;q=0.9, application/json;q=0.8", false, http.StatusCreated, true},
+		{"JSON preferred", "application/json, text/plain", false, http.StatusCreated, false},
+		{"anything", "*/*", false, http.StatusCreated, false},
+		{"error as JSON", "application/json", true, http.StatusBadRequest, false},
+		{"error as plain text", "text/plain", true, http.StatusBadRequest, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BASE_URL", "https://share.example.com/")
+			backends := newTestBackends(t)
+			var req *http.Request
+			if tt.noFile {
+				req = multipartUpload(t, map[string]string{"slug": "notes"})
+			} else {
+				req = multipartUpload(t, map[string]string{"slug": "notes"}, "notes.txt")
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).UploadFile), req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+
+			contentType := rec.Header().Get("Content-Type")
+			switch {
+			case tt.wantPlain && contentType != "text/plain; charset=utf-8",
+				!tt.wantPlain && contentType != "application/json":
+				t.Fatalf("Content-Type = %q, want plain text: %v", contentType, tt.wantPlain)
+			case tt.wantPlain && tt.noFile:
+				if got := rec.Body.String(); got != "Error: File is required\n" {
+					t.Errorf("body = %q, want the plain error", got)
+				}
+			case tt.wantPlain:
+				if got := rec.Body.String(); got != "https://share.example.com/notes\n" {
+					t.Errorf("body = %q, want the share URL", got)
+				}
+			case tt.noFile:
+				var resp ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Error != "File is required" {
+					t.Errorf("body = %+v (%v), want the JSON error", resp, err)
+				}
+			default:
+				if file := uploadedFile(t, rec); file.Slug != "notes" {
+					t.Errorf("uploaded %+v, want the file record", file)
+				}
+			}
+		})
+	}
+}
+
+// readTracker records whether a request body was read
+type readTracker struct {
+	io.Reader
+	read bool
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+// storedBlobs counts the objects stored under dir
+func storedBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walking %s: %v", dir, err)
+	}
+	return count
+}
+
+func TestUploadFileCreateOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		fields      map[string]string
+		ifNoneMatch bool
+		want        int
+		wantRead    bool // Whether the body was read before responding
+		wantBlobs   int  // Objects stored afterwards, counting the existing file's
+	}{
+		{"If-None-Match, taken slug", "?slug=taken", nil, true, http.StatusConflict, false, 1},
+		{"fail_if_exists, taken slug", "?slug=taken&fail_if_exists=true", nil, false, http.StatusConflict, false, 1},
+		{"If-None-Match, free slug", "?slug=free", nil, true, http.StatusCreated, true, 2},
+		{"If-None-Match, invalid slug", "?slug=a/b", nil, true, http.StatusBadRequest, false, 1},
+		{"fail_if_exists=false, taken slug", "?slug=taken&fail_if_exists=false", nil, false, http.StatusConflict, true, 1},
+		{"taken slug in the form", "", map[string]string{"slug": "taken"}, true, http.StatusConflict, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			slug := "taken"
+			existing := mustUpload(t, backends, "existing.txt", []byte("existing"), services.SaveOptions{Slug: &slug})
+
+			req := multipartUpload(t, tt.fields, "large.iso")
+			req.URL.RawQuery = strings.TrimPrefix(tt.query, "?")
+			if tt.ifNoneMatch {
+				req.Header.Set("If-None-Match", "*")
+			}
+			body := &readTracker{Reader: req.Body}
+			req.Body = io.NopCloser(body)
+
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).UploadFile), req)
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if body.read != tt.wantRead {
+				t.Errorf("body read = %v, want %v", body.read, tt.wantRead)
+			}
+			if blobs := storedBlobs(t, filepath.Dir(existing.FilePath)); blobs != tt.wantBlobs {
+				t.Errorf("%d objects stored, want %d", blobs, tt.wantBlobs)
+			}
+		})
+	}
+}
+
+func TestUploadFileRequireExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   int
+	}{
+		{"no expiry", nil, http.StatusBadRequest},
+		{"expiry date", map[string]string{"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339)}, http.StatusCreated},
+		{"only after the first download", map[string]string{"expires_after_first_download": "1h"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REQUIRE_EXPIRY", "true")
+			backends := newTestBackends(t)
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).UploadFile), multipartUpload(t, tt.fields, "notes.txt"))
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "An expiry date is required") {
+				t.Errorf("body = %q, want the expiry requirement", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestListFilesSortParam(t *testing.T) {
+	tests := []struct {
+		name string
+		sort string
+		want int
+	}{
+		{"default", "", http.StatusOK},
+		{"column", "file_size", http.StatusOK},
+		{"case and spaces ignored", " -File_Size ", http.StatusOK},
+		{"unknown column", "size", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			mustUpload(t, backends, "notes.txt", []byte("notes"), services.SaveOptions{})
+
+			target := "/api/files?sort=" + url.QueryEscape(tt.sort)
+			rec := serve(http.HandlerFunc(NewAPIHandler(backends).ListFiles), httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d (%s)", target, rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "Invalid sort") {
+				t.Errorf("body = %q, want the sort error", rec.Body.String())
+			}
+		})
+	}
+}
+
+// largeMultipartUpload builds an upload form whose file is too large to be kept in
+// memory, so parsing it spills the file to a temp file. With truncate, the body is
+// cut off inside the file, as when the client aborts the upload.
+func largeMultipartUpload(t *testing.T, fields map[string]string, truncate bool) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("file", "large.bin")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(bytes.Repeat([]byte{'x'}, 33<<20))
+	form.Close()
+
+	content := body.Bytes()
+	if truncate {
+		content = content[:len(content)-1024]
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", bytes.NewReader(content))
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestUploadRemovesMultipartTempFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		fields        map[string]string
+		requireExpiry bool // Set REQUIRE_EXPIRY, so saving fails after the form is parsed
+		truncate      bool
+		wantAPI       int
+		wantWeb       int
+	}{
+		{"stored", nil, false, false, http.StatusCreated, http.StatusOK},
+		{"invalid option", map[string]string{"expires_after_first_download": "soon"}, false, false, http.StatusBadRequest, http.StatusBadRequest},
+		{"save failed", nil, true, false, http.StatusBadRequest, http.StatusBadRequest},
+		{"aborted", nil, false, true, http.StatusBadRequest, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		for _, handler := range []string{"api", "web"} {
+			t.Run(tt.name+"/"+handler, func(t *testing.T) {
+				tmp := t.TempDir()
+				t.Setenv("TMPDIR", tmp)
+				t.Setenv("REQUIRE_EXPIRY", strconv.FormatBool(tt.requireExpiry))
+
+				var upload http.HandlerFunc
+				want := tt.wantAPI
+				if handler == "api" {
+					upload = NewAPIHandler(newTestBackends(t)).UploadFile
+				} else {
+					upload = newTestWebHandler(t).UploadFileWeb
+					want = tt.wantWeb
+				}
+
+				rec := serve(upload, largeMultipartUpload(t, tt.fields, tt.truncate))
+				if rec.Code != want {
+					t.Fatalf("upload = %d, want %d (%s)", rec.Code, want, rec.Body.String())
+				}
+				entries, err := os.ReadDir(tmp)
+				if err != nil {
+					t.Fatalf("reading the temp directory: %v", err)
+				}
+				if len(entries) != 0 {
+					var names []string
+					for _, entry := range entries {
+						names = append(names, entry.Name())
+					}
+					t.Errorf("temp files left after the upload: %v", names)
+				}
+			})
+		}
+	}
+}
+
+func TestUpdateFileContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		want        int
+		wantServed  string // Content-Type of a download after the update
+	}{
+		{"override", `"text/plain; charset=utf-8"`, http.StatusOK, "text/plain; charset=utf-8"},
+		{"malformed", `"plain"`, http.StatusBadRequest, "text/html; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			file := mustUpload(t, backends, "page.html", []byte("<html><body>hi</body></html>"), services.SaveOptions{})
+			h := NewAPIHandler(backends)
+			r := chi.NewRouter()
+			r.Patch("/api/files/{id}", h.UpdateFile)
+			r.Get("/api/download/{id}", h.DownloadFile)
+
+			body := strings.NewReader(`{"content_type": ` + tt.contentType + `}`)
+			rec := serve(r, httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/files/%d", file.ID), body))
+			if rec.Code != tt.want {
+				t.Fatalf("PATCH = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "Invalid content_type") {
+				t.Errorf("body = %q, want the content type error", rec.Body.String())
+			}
+
+			rec = serve(r, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/download/%d", file.ID), nil))
+			if got := rec.Header().Get("Content-Type"); got != tt.wantServed {
+				t.Errorf("download Content-Type = %q, want %q", got, tt.wantServed)
+			}
+		})
+	}
+}
+
+func TestGetFilesBatch(t *testing.T) {
+	backends := newTestBackends(t)
+	found := mustUpload(t, backends, "found.txt", []byte("found"), services.SaveOptions{})
+	expired := mustUpload(t, backends, "expired.txt", []byte("expired"), services.SaveOptions{})
+	if err := database.DB.Model(&models.File{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("expiring the file: %v", err)
+	}
+	deleted := mustUpload(t, backends, "deleted.txt", []byte("deleted"), services.SaveOptions{})
+	if err := services.NewFileService(backends).DeleteFile(deleted.ID); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+
+	ids := make([]string, maxBatchFiles+1)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		want        int
+		wantResults []string // "id:status" of each result, in order
+	}{
+		{"mixed", fmt.Sprintf(`{"ids": [%d, 999, %d, %d]}`, found.ID, deleted.ID, expired.ID), http.StatusOK, []string{
+			fmt.Sprintf("%d:found", found.ID), "999:not_found", fmt.Sprintf("%d:not_found", deleted.ID), fmt.Sprintf("%d:expired", expired.ID),
+		}},
+		{"only unknown", `{"ids": [999, 998]}`, http.StatusOK, []string{"999:not_found", "998:not_found"}},
+		{"no ids", `{"ids": []}`, http.StatusBadRequest, nil},
+		{"malformed body", `{"ids": "1,2"}`, http.StatusBadRequest, nil},
+		{"negative id", `{"ids": [-1]}`, http.StatusBadRequest, nil},
+		{"too many ids", `{"ids": [` + strings.Join(ids, ",") + `]}`, http.StatusBadRequest, nil},
+	}
+
+	handler := http.HandlerFunc(NewAPIHandler(backends).GetFilesBatch)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodPost, "/api/files/batch", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Fatalf("POST %s = %d, want %d (%s)", tt.body, rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var results []struct {
+				ID     uint         `json:"id"`
+				Status string       `json:"status"`
+				File   *models.File `json:"file"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+				t.Fatalf("decoding results: %v", err)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, fmt.Sprintf("%d:%s", result.ID, result.Status))
+				if (result.File != nil) != (result.Status == services.BatchStatusFound) {
+					t.Errorf("file %d (%s) metadata = %+v, want it only when found", result.ID, result.Status, result.File)
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantResults, " ") {
+				t.Fatalf("results %v, want %v", got, tt.wantResults)
+			}
+		})
+	}
+}
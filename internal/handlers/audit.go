@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/services"
+)
+
+// maxAuditBody is the largest JSON request body whose fields are recorded in the audit log
+const maxAuditBody = 64 << 10
+
+// auditKey is the context key for the audit entry of the request being handled
+type auditKey struct{}
+
+// AuditHandler records management actions and serves the audit log
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler() *AuditHandler {
+	return &AuditHandler{
+		auditService: services.NewAuditService(),
+	}
+}
+
+// Audit records every request through the route as the given action, with the actor,
+// the target file (or report) from the URL, the request's parameters with secrets
+// redacted, and the response status. Failing to record never fails the request.
+// It must be the last middleware, so it sees the form fields parsed by the handler.
+func (h *AuditHandler) Audit(action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := &models.AuditLog{
+				Actor:    mw.Actor(r),
+				Action:   action,
+				Method:   r.Method,
+				Path:     r.URL.Path,
+				RemoteIP: remoteIP(r),
+			}
+			if id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32); err == nil {
+				target := uint(id)
+				entry.TargetID = &target
+			}
+
+			// Keep a copy of small JSON bodies; the handler still reads the original
+			var body []byte
+			if isJSONRequest(r) {
+				buf, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+				if err == nil && len(buf) <= maxAuditBody {
+					body = buf
+				}
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			r = r.WithContext(context.WithValue(r.Context(), auditKey{}, entry))
+			defer func() {
+				entry.Status = ww.Status()
+				if entry.Status == 0 {
+					entry.Status = http.StatusOK
+				}
+				entry.Params = auditParams(r, body)
+				if err := h.auditService.Record(entry); err != nil {
+					log.Printf("Audit: %s %s by %q not recorded: %v", entry.Method, entry.Path, entry.Actor, err)
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// setAuditTarget records the file an audited request acted on, for actions whose
+// target isn't in the URL (e.g., uploads). The first target set is kept.
+func setAuditTarget(r *http.Request, id uint) {
+	if entry, ok := r.Context().Value(auditKey{}).(*models.AuditLog); ok && entry.TargetID == nil {
+		entry.TargetID = &id
+	}
+}
+
+// isJSONRequest reports whether the request body is JSON
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// auditParams collects a request's parameters (query string, form fields, uploaded file
+// names and JSON body fields) with secrets redacted and bulky content left out
+func auditParams(r *http.Request, body []byte) map[string]interface{} {
+	params := make(map[string]interface{})
+	addValues := func(values map[string][]string) {
+		for key, vals := range values {
+			if len(vals) == 1 {
+				params[key] = vals[0]
+			} else {
+				params[key] = vals
+			}
+		}
+	}
+
+	addValues(r.URL.Query())
+	if r.MultipartForm != nil {
+		addValues(r.MultipartForm.Value)
+		for key, headers := range r.MultipartForm.File {
+			names := make([]string, len(headers))
+			for i, header := range headers {
+				names[i] = header.Filename
+			}
+			params[key] = names
+		}
+	} else if r.PostForm != nil {
+		addValues(r.PostForm)
+	}
+
+	var fields map[string]interface{}
+	if len(body) > 0 && json.Unmarshal(body, &fields) == nil {
+		for key, value := range fields {
+			params[key] = value
+		}
+	}
+
+	for key := range params {
+		switch name := strings.ToLower(key); {
+		case strings.Contains(name, "password"), strings.Contains(name, "token"), strings.Contains(name, "secret"):
+			params[key] = "[redacted]"
+		case name == "content", name == "data":
+			params[key] = "[omitted]"
+		}
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// ListAuditLogs handles listing the audit log, newest first. Filters: actor, action,
+// target_id, since and until (RFC3339, or local times with tz), and before_id and limit
+// for paging.
+func (h *AuditHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	loc, err := parseTimezone(query.Get("tz"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := services.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+	}
+	if targetStr := query.Get("target_id"); targetStr != "" {
+		id, err := strconv.ParseUint(targetStr, 10, 32)
+		if err != nil {
+			respondError(w, "Invalid target_id", http.StatusBadRequest)
+			return
+		}
+		target := uint(id)
+		filter.TargetID = &target
+	}
+	for name, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := parseTime(value, loc)
+			if err != nil {
+				respondError(w, "Invalid "+name+" format (use RFC3339 or 2006-01-02T15:04)", http.StatusBadRequest)
+				return
+			}
+			*dest = &t
+		}
+	}
+	if beforeStr := query.Get("before_id"); beforeStr != "" {
+		id, err := strconv.ParseUint(beforeStr, 10, 32)
+		if err != nil {
+			respondError(w, "Invalid before_id", http.StatusBadRequest)
+			return
+		}
+		filter.BeforeID = uint(id)
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respondError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := h.auditService.List(filter)
+	if err != nil {
+		respondError(w, "Failed to list audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if loc != nil {
+		for i := range entries {
+			entries[i].CreatedAt = entries[i].CreatedAt.In(loc)
+		}
+	}
+
+	respondJSON(w, entries, http.StatusOK)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/services"
+)
+
+func TestAuditRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		want        map[string]interface{}
+	}{
+		{
+			name:        "JSON body",
+			target:      "/api/files/1",
+			contentType: "application/json",
+			body:        `{"password":"hunter2","access_token":"abc","client_secret":"xyz","slug":"report"}`,
+			want:        map[string]interface{}{"password": "[redacted]", "access_token": "[redacted]", "client_secret": "[redacted]", "slug": "report"},
+		},
+		{
+			name:        "form fields",
+			target:      "/web/update/1",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "Password=hunter2&csrf_token=abc&slug=report",
+			want:        map[string]interface{}{"Password": "[redacted]", "csrf_token": "[redacted]", "slug": "report"},
+		},
+		{
+			name:   "query string",
+			target: "/api/files/1?token=abc&expires_in=24h",
+			want:   map[string]interface{}{"token": "[redacted]", "expires_in": "24h"},
+		},
+		{
+			name:        "bulky content",
+			target:      "/api/paste",
+			contentType: "application/json",
+			body:        `{"content":"a long paste","language":"go"}`,
+			want:        map[string]interface{}{"content": "[omitted]", "language": "go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestBackends(t)
+			h := NewAuditHandler()
+			handler := h.Audit("file.update")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			serve(handler, req)
+
+			entries, err := services.NewAuditService().List(services.AuditFilter{})
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("audit log = %v (%v), want one entry", entries, err)
+			}
+			params := entries[0].Params
+			if len(params) != len(tt.want) {
+				t.Fatalf("params = %v, want %v", params, tt.want)
+			}
+			for key, want := range tt.want {
+				if params[key] != want {
+					t.Errorf("params[%q] = %v, want %v", key, params[key], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+)
+
+const (
+	defaultBrandAccentColor = "#3498db"
+	brandLogoPath           = "/brand/logo"
+)
+
+// hexColorRegex matches CSS hex colors (#rgb or #rrggbb)
+var hexColorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Brand holds the white-label settings shown on public pages
+type Brand struct {
+	Name        string // Shown in page headers and titles (BRAND_NAME)
+	LogoURL     string // Logo image URL (BRAND_LOGO_URL, or the served BRAND_LOGO_PATH)
+	AccentColor string // Button and focus color (BRAND_ACCENT_COLOR)
+}
+
+// loadBrand reads the branding configuration from the environment
+func loadBrand() Brand {
+	brand := Brand{
+		Name:        os.Getenv("BRAND_NAME"),
+		LogoURL:     os.Getenv("BRAND_LOGO_URL"),
+		AccentColor: defaultBrandAccentColor,
+	}
+
+	// A local logo file is served by the app itself
+	if brand.LogoURL == "" && os.Getenv("BRAND_LOGO_PATH") != "" {
+		brand.LogoURL = brandLogoPath
+	}
+
+	if color := os.Getenv("BRAND_ACCENT_COLOR"); color != "" {
+		if hexColorRegex.MatchString(color) {
+			brand.AccentColor = color
+		} else {
+			log.Printf("Warning: invalid BRAND_ACCENT_COLOR value, using default (%s)", defaultBrandAccentColor)
+		}
+	}
+
+	return brand
+}
+
+// BrandLogo serves the logo file configured with BRAND_LOGO_PATH
+func (h *PublicHandler) BrandLogo(w http.ResponseWriter, r *http.Request) {
+	logoPath := os.Getenv("BRAND_LOGO_PATH")
+	if logoPath == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(w, r, logoPath)
+}
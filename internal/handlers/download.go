@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yorukot/sharing/internal/events"
+	"github.com/yorukot/sharing/internal/metrics"
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/services"
+	"github.com/yorukot/sharing/internal/storage"
+	"github.com/yorukot/sharing/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Download name fallbacks (DOWNLOAD_NAME_FALLBACK), for records without an original name
+const (
+	DownloadNameFallbackSlug     = "slug"     // The slug, with the stored file's extension (default)
+	DownloadNameFallbackFilename = "filename" // The stored filename (random, with the original extension)
+)
+
+var (
+	downloadNameFallbackOnce sync.Once
+	downloadNameFallback     string
+)
+
+// downloadName returns the filename offered for a download: the original name or, for
+// records that are missing it (e.g., a bad import), a name derived from the slug or the
+// stored filename, so Content-Disposition never carries an empty filename
+func downloadName(file *models.File) string {
+	if strings.TrimSpace(file.OriginalName) != "" {
+		return file.OriginalName
+	}
+
+	downloadNameFallbackOnce.Do(func() {
+		downloadNameFallback = strings.ToLower(os.Getenv("DOWNLOAD_NAME_FALLBACK"))
+		switch downloadNameFallback {
+		case DownloadNameFallbackFilename:
+		case "", DownloadNameFallbackSlug:
+			downloadNameFallback = DownloadNameFallbackSlug
+		default:
+			log.Printf("Warning: invalid DOWNLOAD_NAME_FALLBACK value, using default (%s)", DownloadNameFallbackSlug)
+			downloadNameFallback = DownloadNameFallbackSlug
+		}
+	})
+
+	ext := filepath.Ext(file.Filename)
+	if downloadNameFallback == DownloadNameFallbackSlug && file.Slug != "" {
+		if strings.HasSuffix(strings.ToLower(file.Slug), strings.ToLower(ext)) {
+			return file.Slug
+		}
+		return file.Slug + ext
+	}
+	if file.Filename != "" {
+		return file.Filename
+	}
+	return "download" + ext
+}
+
+const (
+	defaultDownloadBufferSize = 32 * 1024        // 32KB, io.Copy's own buffer size
+	maxDownloadBufferSize     = 16 * 1024 * 1024 // 16MB
+)
+
+var (
+	downloadBuffersOnce sync.Once
+	downloadBuffers     *sync.Pool
+)
+
+// getDownloadBuffer takes a copy buffer of DOWNLOAD_BUFFER_SIZE bytes from a shared pool.
+// Return it with downloadBuffers.Put once the copy is done.
+func getDownloadBuffer() *[]byte {
+	downloadBuffersOnce.Do(func() {
+		size := defaultDownloadBufferSize
+		if sizeStr := os.Getenv("DOWNLOAD_BUFFER_SIZE"); sizeStr != "" {
+			parsed, err := strconv.Atoi(sizeStr)
+			if err != nil || parsed <= 0 || parsed > maxDownloadBufferSize {
+				log.Printf("Warning: invalid DOWNLOAD_BUFFER_SIZE value, using default (%d)", defaultDownloadBufferSize)
+			} else {
+				size = parsed
+			}
+		}
+		downloadBuffers = &sync.Pool{New: func() any {
+			buf := make([]byte, size)
+			return &buf
+		}}
+	})
+	return downloadBuffers.Get().(*[]byte)
+}
+
+// writerOnly hides the ResponseWriter's ReadFrom, which would copy with its own
+// fixed-size buffer instead of the one passed to io.CopyBuffer
+type writerOnly struct {
+	io.Writer
+}
+
+// flushWriter flushes every write to the client
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+// Write writes p and flushes it
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, http.NewResponseController(f.w).Flush()
+}
+
+// storageUnavailable reports whether err means storage is temporarily unavailable (the
+// circuit breaker is open) and, if so, sets Retry-After for the 503 the caller sends
+func storageUnavailable(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, storage.ErrStorageUnavailable) {
+		return false
+	}
+	w.Header().Set("Retry-After", "5")
+	return true
+}
+
+// openDownload opens the file's content from storage and confirms it is readable.
+// It must be called before any success headers are written, so storage failures
+// can still be reported with a proper status code. A missing object may prune the
+// file's record (AUTO_PRUNE_MISSING).
+func openDownload(fileService *services.FileService, file *models.File) (io.ReadCloser, error) {
+	return openDownloadRange(fileService, file, nil)
+}
+
+// openDownloadRange opens a byte range of the file's content (all of it if rng is nil),
+// like openDownload
+func openDownloadRange(fileService *services.FileService, file *models.File, rng *byteRange) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	var err error
+	if rng != nil {
+		reader, err = fileService.GetFileRangeReader(file, rng.start, rng.length)
+	} else {
+		reader, err = fileService.GetFileReader(file)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			if pruneErr := fileService.PruneMissingFile(file); pruneErr != nil {
+				log.Printf("Failed to prune file %d: %v", file.ID, pruneErr)
+			}
+		}
+		return nil, err
+	}
+
+	// Read ahead the first byte so a broken backend fails here, not mid-response
+	buffered := bufio.NewReader(reader)
+	if _, err := buffered.Peek(1); err != nil && err != io.EOF {
+		reader.Close()
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{buffered, reader}, nil
+}
+
+// contentDisposition builds a Content-Disposition header value.
+// The filename is quoted and escaped (RFC 2231 encoded if non-ASCII), so names
+// with quotes or separators can't break the header.
+func contentDisposition(disposition, filename string) string {
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// invalidContentTypeOverrideMessage is returned when ?content_type= isn't a safe MIME type
+const invalidContentTypeOverrideMessage = "Invalid content_type (use a safe type like text/plain, image/png, or application/pdf)"
+
+// downloadContentType returns the type to serve a file as: the stored type, or a safe
+// override requested with ?content_type=
+func downloadContentType(r *http.Request, file *models.File) (string, error) {
+	override := r.URL.Query().Get("content_type")
+	if override == "" {
+		return file.ContentType, nil
+	}
+	return services.OverrideContentType(override)
+}
+
+// invalidImageFormatMessage is returned when ?format= names a format images can't be transcoded to
+const invalidImageFormatMessage = "Invalid format (supported: webp)"
+
+// imageVariantErrorMessage describes why an image download's ?format= or size was rejected
+func imageVariantErrorMessage(err error) string {
+	if errors.Is(err, services.ErrInvalidImageResize) {
+		sizes := make([]string, len(services.ImageResizeSizes()))
+		for i, size := range services.ImageResizeSizes() {
+			sizes[i] = strconv.Itoa(size)
+		}
+		return "Invalid image size (w and h must be one of " + strings.Join(sizes, ", ") + "; fit is contain or cover, and cover needs both)"
+	}
+	return invalidImageFormatMessage
+}
+
+// requestedImageFormat returns the format an image download asks to be transcoded to:
+// ?format=, or else the first supported type listed in the Accept header (wildcards
+// don't count). "" asks for the original.
+func requestedImageFormat(r *http.Request) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		if _, ok := services.ImageFormats[format]; !ok {
+			return "", services.ErrUnsupportedImageFormat
+		}
+		return format, nil
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue // Explicitly refused
+		}
+		for format, contentType := range services.ImageFormats {
+			if mediaType == contentType {
+				return format, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// openImageVariant opens the transcoded or resized variant of an image download, if one
+// is asked for (?format= or Accept, and ?w=, ?h= and ?fit=) and worth serving, and returns
+// it with a copy of file describing what is served (type, size, name, and content hash
+// for ETags). A nil reader means the original is served; transcoding failures are logged
+// and fall back to it. Only an unsupported ?format= or size is an error. Downloads with
+// a ?content_type= override are never transcoded, and other files ignore the parameters.
+func openImageVariant(w http.ResponseWriter, r *http.Request, fileService *services.FileService, file *models.File) (io.ReadCloser, *models.File, error) {
+	if r.URL.Query().Get("content_type") != "" {
+		return nil, file, nil
+	}
+
+	var format string
+	var resize services.ImageResize
+	var err error
+	if services.CanTranscode(file) {
+		w.Header().Add("Vary", "Accept") // The response depends on Accept from here on
+		if format, err = requestedImageFormat(r); err != nil {
+			return nil, file, err
+		}
+	}
+	if services.CanResize(file) {
+		query := r.URL.Query()
+		if resize, err = services.ParseImageResize(query.Get("w"), query.Get("h"), query.Get("fit")); err != nil {
+			return nil, file, err
+		}
+	}
+	if format == "" && resize.IsZero() {
+		return nil, file, nil
+	}
+
+	variant, err := fileService.ImageVariant(file, format, resize)
+	if err != nil {
+		log.Printf("Failed to transcode file %d, serving the original: %v", file.ID, err)
+		return nil, file, nil
+	}
+	if variant == nil {
+		return nil, file, nil
+	}
+	reader, err := fileService.OpenImageVariant(variant)
+	if err != nil {
+		log.Printf("Failed to open %s variant of file %d, serving the original: %v", variant.Format, file.ID, err)
+		return nil, file, nil
+	}
+
+	served := *file
+	served.ContentType = services.VariantContentType(variant)
+	served.FileSize = variant.FileSize
+	served.ContentHash = file.ContentHash + "-" + variant.Format
+	if variant.Resize != "" {
+		served.ContentHash += "-" + variant.Resize
+	}
+	if served.ContentType != file.ContentType {
+		served.OriginalName = strings.TrimSuffix(downloadName(file), filepath.Ext(downloadName(file))) + "." + variant.Format
+	}
+	return reader, &served, nil
+}
+
+// setContentLength sets the download's Content-Length. Live uploads don't have a final
+// size yet, so they are sent with chunked encoding until the upload ends.
+func setContentLength(w http.ResponseWriter, file *models.File) {
+	if !file.InProgress {
+		w.Header().Set("Content-Length", strconv.FormatInt(file.FileSize, 10))
+	}
+}
+
+// byteRange is a part of a download's content
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// errRangeNotSatisfiable means a Range starts past the end of the file
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// requestedRange returns the byte range a download asks for with Range, or nil for all
+// of the content. Single ranges are served, which is what resuming tools send (curl -C -,
+// wget -c). Multiple ranges, malformed headers, an If-Range that no longer matches the
+// file's ETag, and files still being uploaded get the full content, as RFC 9110 allows.
+func requestedRange(r *http.Request, file *models.File) (*byteRange, error) {
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || file.InProgress || !validRangeHeader(rangeHeader) || strings.Contains(rangeHeader, ",") {
+		return nil, nil
+	}
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != downloadETag(file) {
+		return nil, nil // The file changed since the client's partial download
+	}
+
+	spec := strings.TrimPrefix(strings.TrimSpace(rangeHeader), "bytes=")
+	startStr, endStr, _ := strings.Cut(strings.TrimSpace(spec), "-")
+	size := file.FileSize
+	start, end := int64(0), size-1 // end is inclusive
+	if startStr == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return nil, nil
+		}
+		if n == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+		start = max(size-n, 0)
+	} else {
+		var err error
+		if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+			return nil, errRangeNotSatisfiable // Beyond any file size
+		}
+		if endStr != "" {
+			if last, err := strconv.ParseInt(endStr, 10, 64); err == nil {
+				end = min(last, end)
+			}
+		}
+	}
+	if start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+	return &byteRange{start: start, length: end - start + 1}, nil
+}
+
+// downloadETag returns a download's ETag, from its content hash ("" if it has none)
+func downloadETag(file *models.File) string {
+	if file.ContentHash == "" {
+		return ""
+	}
+	return `"` + file.ContentHash + `"`
+}
+
+// setRangeHeaders announces that a download can be resumed (Accept-Ranges, and the ETag
+// for If-Range) and sets its length: all of it, or the requested range with
+// Content-Range and a 206 status code once the header is written
+func setRangeHeaders(w http.ResponseWriter, file *models.File, rng *byteRange) int {
+	if file.InProgress {
+		w.Header().Set("Accept-Ranges", "none")
+		return http.StatusOK
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	if etag := downloadETag(file); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if rng == nil {
+		setContentLength(w, file)
+		return http.StatusOK
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(rng.length, 10))
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.start, rng.start+rng.length-1, file.FileSize))
+	return http.StatusPartialContent
+}
+
+// setUnsatisfiableRange sets the Content-Range of a 416 response
+func setUnsatisfiableRange(w http.ResponseWriter, file *models.File) {
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", file.FileSize))
+}
+
+// streamDownload copies file content to the response.
+// If the copy fails mid-stream the connection is aborted, so the client sees
+// a reset instead of a silently truncated body.
+// Range requests are tracked separately in the download metrics.
+func streamDownload(w http.ResponseWriter, r *http.Request, reader io.Reader, file *models.File) {
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && !validRangeHeader(rangeHeader) {
+		metrics.Default.ObserveRangeParseFailure()
+	}
+
+	// Live uploads are sent as their content arrives, not once a buffer fills
+	var dst io.Writer = writerOnly{w}
+	if file.InProgress {
+		dst = flushWriter{w}
+	}
+
+	_, span := tracing.Start(r.Context(), "copyContent",
+		attribute.Int64("file.id", int64(file.ID)),
+		attribute.Int64("file.size", file.FileSize),
+	)
+	written, err := copyContent(dst, reader)
+	span.SetAttributes(attribute.Int64("bytes.written", written))
+	tracing.End(span, err)
+	metrics.Default.ObserveDownload(rangeHeader != "", written)
+	services.RecordTransfer(file.ID, transferClient(r), written, err == nil)
+	if err != nil {
+		log.Printf("Download of file %d (%s) interrupted: %v", file.ID, file.OriginalName, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	events.Publish(events.TypeDownload, file.ID, file.Slug, file.OriginalName)
+}
+
+// copyContent copies file content to dst through a pooled download buffer
+func copyContent(dst io.Writer, reader io.Reader) (int64, error) {
+	buf := getDownloadBuffer()
+	defer downloadBuffers.Put(buf)
+	return io.CopyBuffer(dst, reader, *buf)
+}
+
+// transferClient identifies who a download's bytes are billed to (TRANSFER_ACCOUNTING):
+// the authenticated actor, or the client IP for public downloads
+func transferClient(r *http.Request) string {
+	if actor := mw.Actor(r); actor != "" {
+		return actor
+	}
+	return "ip:" + remoteIP(r)
+}
+
+// validRangeHeader reports whether a Range header is a well-formed byte range set
+// (e.g., "bytes=0-499", "bytes=500-", "bytes=-500", or several separated by commas)
+func validRangeHeader(rangeHeader string) bool {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(rangeHeader), "bytes=")
+	if !ok || spec == "" {
+		return false
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		start, end, found := strings.Cut(strings.TrimSpace(part), "-")
+		if !found || (start == "" && end == "") {
+			return false
+		}
+
+		var first, last uint64
+		var err error
+		if start != "" {
+			if first, err = strconv.ParseUint(start, 10, 64); err != nil {
+				return false
+			}
+		}
+		if end != "" {
+			if last, err = strconv.ParseUint(end, 10, 64); err != nil {
+				return false
+			}
+			if start != "" && last < first {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/yorukot/sharing/internal/database"
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/services"
+)
+
+// benchmarkDownloadSize is the content size each benchmark iteration copies
+const benchmarkDownloadSize = 4 << 20
+
+func TestCopyContent(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var dst bytes.Buffer
+	written, err := copyContent(writerOnly{&dst}, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("copyContent: %v", err)
+	}
+	if written != int64(len(content)) || !bytes.Equal(dst.Bytes(), content) {
+		t.Fatalf("copied %d bytes, want the %d bytes of content", written, len(content))
+	}
+}
+
+// BenchmarkDownloadCopyPooled copies downloads through the shared buffer pool
+func BenchmarkDownloadCopyPooled(b *testing.B) {
+	content := make([]byte, benchmarkDownloadSize)
+	b.SetBytes(benchmarkDownloadSize)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := copyContent(writerOnly{io.Discard}, bytes.NewReader(content)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkDownloadCopyUnpooled copies downloads through a new buffer of the same size
+// each time, as before the pool
+func BenchmarkDownloadCopyUnpooled(b *testing.B) {
+	content := make([]byte, benchmarkDownloadSize)
+	size := len(*getDownloadBuffer())
+	b.SetBytes(benchmarkDownloadSize)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			buf := make([]byte, size)
+			if _, err := io.CopyBuffer(writerOnly{io.Discard}, bytes.NewReader(content), buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition string
+		filename    string
+		want        string
+	}{
+		{"attachment", "report.pdf", "attachment; filename=report.pdf"},
+		{"inline", "my report.pdf", `inline; filename="my report.pdf"`},
+		{"attachment", `say "hi".txt`, `attachment; filename="say \"hi\".txt"`},
+		{"attachment", "a;b=c.txt", `attachment; filename="a;b=c.txt"`},
+		{"attachment", "файл.txt", "attachment; filename*=utf-8''%D1%84%D0%B0%D0%B9%D0%BB.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got := contentDisposition(tt.disposition, tt.filename)
+			if got != tt.want {
+				t.Fatalf("contentDisposition(%q, %q) = %q, want %q", tt.disposition, tt.filename, got, tt.want)
+			}
+			if _, params, err := mime.ParseMediaType(got); err != nil || params["filename"] != tt.filename {
+				t.Fatalf("header %q parses to filename %q (%v), want %q", got, params["filename"], err, tt.filename)
+			}
+		})
+	}
+}
+
+// setDownloadNameFallback sets DOWNLOAD_NAME_FALLBACK for the test, rereading it on next use
+func setDownloadNameFallback(t *testing.T, value string) {
+	t.Setenv("DOWNLOAD_NAME_FALLBACK", value)
+	downloadNameFallbackOnce = sync.Once{}
+	t.Cleanup(func() { downloadNameFallbackOnce = sync.Once{} })
+}
+
+func TestDownloadName(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		file     models.File
+		want     string
+	}{
+		{"original name", "", models.File{OriginalName: "report.pdf", Slug: "abc", Filename: "f00d.pdf"}, "report.pdf"},
+		{"original name with filename fallback", "filename", models.File{OriginalName: "report.pdf", Slug: "abc", Filename: "f00d.pdf"}, "report.pdf"},
+		{"slug by default", "", models.File{Slug: "abc", Filename: "f00d.pdf"}, "abc.pdf"},
+		{"blank original name", "slug", models.File{OriginalName: "  ", Slug: "abc", Filename: "f00d.pdf"}, "abc.pdf"},
+		{"slug with the extension", "slug", models.File{Slug: "report.PDF", Filename: "f00d.pdf"}, "report.PDF"},
+		{"stored filename", "filename", models.File{Slug: "abc", Filename: "f00d.pdf"}, "f00d.pdf"},
+		{"invalid fallback uses the slug", "random", models.File{Slug: "abc", Filename: "f00d.pdf"}, "abc.pdf"},
+		{"no slug", "slug", models.File{Filename: "f00d.pdf"}, "f00d.pdf"},
+		{"nothing to go by", "filename", models.File{}, "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDownloadNameFallback(t, tt.fallback)
+			if got := downloadName(&tt.file); got != tt.want {
+				t.Fatalf("downloadName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadWithoutOriginalName(t *testing.T) {
+	tests := []struct {
+		name         string
+		fallback     string
+		target       string // Path, with {slug} replaced by the file's
+		want         int
+		wantFilename string
+	}{
+		{"share link with the slug", "slug", "/{slug}", http.StatusOK, "{slug}"}, // The slug already ends in .bin
+		{"share link with the stored name", "filename", "/{slug}", http.StatusOK, "{filename}"},
+		{"empty download name", "slug", "/d/%20", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDownloadNameFallback(t, tt.fallback)
+			backends := newTestBackends(t)
+			router := publicRouter(newTestPublicHandler(t, backends))
+			file := mustUpload(t, backends, "data.bin", []byte{0, 1, 2, 3}, services.SaveOptions{})
+			// As left by a bad import
+			if err := database.DB.Model(&models.File{}).Where("id = ?", file.ID).Update("original_name", "").Error; err != nil {
+				t.Fatalf("clearing the original name: %v", err)
+			}
+
+			replacer := strings.NewReplacer("{slug}", file.Slug, "{filename}", file.Filename)
+			rec := serve(router, httptest.NewRequest(http.MethodGet, replacer.Replace(tt.target), nil))
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d", tt.target, rec.Code, tt.want)
+			}
+			if tt.wantFilename == "" {
+				return
+			}
+			_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+			if err != nil {
+				t.Fatalf("parsing Content-Disposition %q: %v", rec.Header().Get("Content-Disposition"), err)
+			}
+			if want := replacer.Replace(tt.wantFilename); params["filename"] != want {
+				t.Fatalf("download filename = %q, want %q", params["filename"], want)
+			}
+		})
+	}
+}
+
+func TestRequestedRange(t *testing.T) {
+	file := &models.File{FileSize: 100, ContentHash: "abc"}
+
+	tests := []struct {
+		name      string
+		rangeSpec string
+		ifRange   string
+		file      *models.File
+		want      *byteRange
+		wantErr   error
+	}{
+		{"no range", "", "", file, nil, nil},
+		{"from an offset", "bytes=40-", "", file, &byteRange{40, 60}, nil},
+		{"closed range", "bytes=10-19", "", file, &byteRange{10, 10}, nil},
+		{"end past the file", "bytes=90-200", "", file, &byteRange{90, 10}, nil},
+		{"suffix", "bytes=-30", "", file, &byteRange{70, 30}, nil},
+		{"suffix longer than the file", "bytes=-300", "", file, &byteRange{0, 100}, nil},
+		{"matching If-Range", "bytes=40-", `"abc"`, file, &byteRange{40, 60}, nil},
+		{"stale If-Range", "bytes=40-", `"old"`, file, nil, nil},
+		{"multiple ranges", "bytes=0-9,20-29", "", file, nil, nil},
+		{"malformed", "pages=1-2", "", file, nil, nil},
+		{"upload in progress", "bytes=40-", "", &models.File{FileSize: 100, InProgress: true}, nil, nil},
+		{"start at the end", "bytes=100-", "", file, nil, errRangeNotSatisfiable},
+		{"empty suffix", "bytes=-0", "", file, nil, errRangeNotSatisfiable},
+		{"empty file", "bytes=0-", "", &models.File{}, nil, errRangeNotSatisfiable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/d/file", nil)
+			if tt.rangeSpec != "" {
+				req.Header.Set("Range", tt.rangeSpec)
+			}
+			if tt.ifRange != "" {
+				req.Header.Set("If-Range", tt.ifRange)
+			}
+
+			got, err := requestedRange(req, tt.file)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("requestedRange error = %v, want %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Fatalf("requestedRange = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeDownload(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	tests := []struct {
+		name        string
+		method      string
+		rangeSpec   string
+		want        int
+		wantBody    string
+		wantRange   string // Content-Range
+		wantLength  string
+		wantCounted int64
+	}{
+		{"full download", http.MethodGet, "", http.StatusOK, string(content), "", "20", 1},
+		{"resumed download", http.MethodGet, "bytes=15-", http.StatusPartialContent, "fghij", "bytes 15-19/20", "5", 1},
+		{"HEAD", http.MethodHead, "", http.StatusOK, "", "", "20", 0},
+		{"HEAD with a range", http.MethodHead, "bytes=0-9", http.StatusPartialContent, "", "bytes 0-9/20", "10", 0},
+		{"range past the end", http.MethodGet, "bytes=20-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */20", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			r := chi.NewRouter()
+			r.Use(middleware.GetHead)
+			r.Mount("/", publicRouter(newTestPublicHandler(t, backends)))
+			file := mustUpload(t, backends, "data.bin", content, services.SaveOptions{})
+
+			req := httptest.NewRequest(tt.method, "/d/data.bin", nil)
+			if tt.rangeSpec != "" {
+				req.Header.Set("Range", tt.rangeSpec)
+			}
+			rec := serve(r, req)
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.rangeSpec, rec.Code, tt.want)
+			}
+			if tt.want != http.StatusRequestedRangeNotSatisfiable && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantRange)
+			}
+			if tt.wantLength != "" {
+				if got := rec.Header().Get("Content-Length"); got != tt.wantLength {
+					t.Errorf("Content-Length = %q, want %q", got, tt.wantLength)
+				}
+				if rec.Header().Get("Accept-Ranges") != "bytes" || rec.Header().Get("ETag") == "" {
+					t.Errorf("Accept-Ranges = %q, ETag = %q, want the download to be resumable", rec.Header().Get("Accept-Ranges"), rec.Header().Get("ETag"))
+				}
+			}
+
+			stored, err := services.NewFileService(backends).GetFile(file.ID)
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			if stored.DownloadCount != tt.wantCounted {
+				t.Errorf("download count = %d, want %d", stored.DownloadCount, tt.wantCounted)
+			}
+		})
+	}
+}
+
+func TestResumeCompressedDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+
+	tests := []struct {
+		name         string
+		method       string
+		rangeSpec    string
+		want         int
+		wantEncoding string
+		wantRange    string // Content-Range
+		wantLength   string // Content-Length, which compressed responses don't have
+		wantBody     string
+	}{
+		{"full download", http.MethodGet, "", http.StatusOK, "gzip", "", "", ""},
+		{"resumed download", http.MethodGet, "bytes=995-", http.StatusPartialContent, "", "bytes 995-999/1000", "5", "56789"},
+		{"HEAD", http.MethodHead, "", http.StatusOK, "", "", "1000", ""},
+		{"HEAD with a range", http.MethodHead, "bytes=0-9", http.StatusPartialContent, "", "bytes 0-9/1000", "10", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			r := chi.NewRouter()
+			r.Use(mw.Compress(5))
+			r.Use(middleware.GetHead)
+			r.Mount("/", publicRouter(newTestPublicHandler(t, backends)))
+			mustUpload(t, backends, "notes.txt", []byte(content), services.SaveOptions{})
+
+			req := httptest.NewRequest(tt.method, "/d/notes.txt", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			if tt.rangeSpec != "" {
+				req.Header.Set("Range", tt.rangeSpec)
+			}
+			rec := serve(r, req)
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.rangeSpec, rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantRange)
+			}
+			if got := rec.Header().Get("Content-Length"); got != tt.wantLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantLength)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDownloadContentTypeOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string // ?content_type= (empty = none)
+		want     int
+		wantType string
+	}{
+		{"stored type", "", http.StatusOK, "text/html; charset=utf-8"},
+		{"safe override", "text/plain", http.StatusOK, "text/plain"},
+		{"override normalized", "Text/Plain; Charset=utf-8", http.StatusOK, "text/plain; charset=utf-8"},
+		{"forced download", "application/octet-stream", http.StatusOK, "application/octet-stream"},
+		{"unsafe override", "image/svg+xml", http.StatusBadRequest, ""},
+		{"malformed override", "text", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			file := mustUpload(t, backends, "page.html", []byte("<html><body>hi</body></html>"), services.SaveOptions{})
+			webHandler, err := NewWebHandler(backends)
+			if err != nil {
+				t.Fatalf("NewWebHandler: %v", err)
+			}
+
+			r := chi.NewRouter()
+			r.Get("/api/download/{id}", NewAPIHandler(backends).DownloadFile)
+			r.Get("/web/download/{id}", webHandler.DownloadFileWeb)
+			r.Mount("/", publicRouter(newTestPublicHandler(t, backends)))
+
+			query := ""
+			if tt.override != "" {
+				query = "?content_type=" + url.QueryEscape(tt.override)
+			}
+			for _, path := range []string{fmt.Sprintf("/api/download/%d", file.ID), fmt.Sprintf("/web/download/%d", file.ID), "/d/page.html"} {
+				rec := serve(r, httptest.NewRequest(http.MethodGet, path+query, nil))
+				if rec.Code != tt.want {
+					t.Fatalf("GET %s%s = %d, want %d (%s)", path, query, rec.Code, tt.want, rec.Body.String())
+				}
+				if tt.want != http.StatusOK {
+					if !strings.Contains(rec.Body.String(), "Invalid content_type") {
+						t.Errorf("GET %s%s body = %q, want the override error", path, query, rec.Body.String())
+					}
+					continue
+				}
+				if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+					t.Errorf("GET %s%s Content-Type = %q, want %q", path, query, got, tt.wantType)
+				}
+				if rec.Body.String() != "<html><body>hi</body></html>" {
+					t.Errorf("GET %s%s body = %q, want the content unchanged", path, query, rec.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yorukot/sharing/internal/events"
+)
+
+// eventsHeartbeatInterval is how often a comment is sent to keep idle SSE connections open
+const eventsHeartbeatInterval = 15 * time.Second
+
+// EventsHandler streams file activity as server-sent events
+type EventsHandler struct {
+	broker *events.Broker
+}
+
+// NewEventsHandler creates a new events handler
+func NewEventsHandler(broker *events.Broker) *EventsHandler {
+	return &EventsHandler{
+		broker: broker,
+	}
+}
+
+// StreamEvents holds an SSE connection and streams upload/download/delete/expiry events
+func (h *EventsHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sub := h.broker.Subscribe()
+	defer h.broker.Unsubscribe(sub)
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// Client disconnected
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case event, ok := <-sub:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/services"
+	"github.com/yorukot/sharing/internal/storage"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	// Templates are parsed relative to the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	// Every test has its own database, whose file IDs would collide in the shared cache
+	os.Setenv("FILE_CACHE_SIZE", "0")
+	os.Exit(m.Run())
+}
+
+// newTestBackends sets up a fresh, migrated database and returns local storage in a
+// temporary directory as the only backend
+func newTestBackends(t *testing.T) *storage.Registry {
+	t.Helper()
+	dir := t.TempDir()
+	if err := database.Initialize(filepath.Join(dir, "test.db"), 5000); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	database.DB.Logger = logger.Discard
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	local, err := storage.NewLocalStorage(filepath.Join(dir, "data"), 0)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return storage.NewSingleRegistry("local", local)
+}
+
+// newTestPublicHandler returns a public handler on the backends. Settings set with
+// t.Setenv beforehand apply.
+func newTestPublicHandler(t *testing.T, backends *storage.Registry) *PublicHandler {
+	t.Helper()
+	h, err := NewPublicHandler(backends)
+	if err != nil {
+		t.Fatalf("NewPublicHandler: %v", err)
+	}
+	return h
+}
+
+// publicRouter routes the public share and download links to h, as main does
+func publicRouter(h *PublicHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/d/{filename}", h.DownloadByOriginalName)
+	r.Get("/{slug}", h.SharePage)
+	r.Get("/*", h.SharePage)
+	return r
+}
+
+// mustUpload stores content as a new file, failing the test on error
+func mustUpload(t *testing.T, backends *storage.Registry, filename string, content []byte, opts services.SaveOptions) *models.File {
+	t.Helper()
+	file, err := services.NewFileService(backends).SaveFileFromReader(filename, "", bytes.NewReader(content), opts)
+	if err != nil {
+		t.Fatalf("saving %s: %v", filename, err)
+	}
+	return file
+}
+
+// serve sends req to handler and returns the recorded response
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
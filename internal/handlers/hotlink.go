@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yorukot/sharing/internal/services"
+)
+
+// referrerPolicy restricts which sites may link to or embed public downloads (ALLOWED_REFERRERS)
+type referrerPolicy struct {
+	allowed    []string // Hosts, or "*.example.com" for any subdomain (empty = no restriction)
+	allowEmpty bool     // Serve requests without a Referer, e.g. typed URLs or strict privacy settings
+}
+
+// loadReferrerPolicy reads the hotlink protection settings
+func loadReferrerPolicy() referrerPolicy {
+	policy := referrerPolicy{allowEmpty: true}
+	for _, host := range strings.Split(os.Getenv("ALLOWED_REFERRERS"), ",") {
+		if host = hostOnly(host); host != "" {
+			policy.allowed = append(policy.allowed, host)
+		}
+	}
+	if allowEmpty, err := strconv.ParseBool(os.Getenv("ALLOW_EMPTY_REFERRER")); err == nil {
+		policy.allowEmpty = allowEmpty
+	}
+	return policy
+}
+
+// allows reports whether a public download may be served for the request's Referer.
+// The service's own hosts are always allowed, so share pages can link to downloads.
+func (p referrerPolicy) allows(r *http.Request) bool {
+	if len(p.allowed) == 0 {
+		return true
+	}
+
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		return p.allowEmpty
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	host := hostOnly(u.Host)
+	if host == hostOnly(r.Host) || services.DomainForHost(host) != "" {
+		return true
+	}
+	if baseURL, err := url.Parse(os.Getenv("BASE_URL")); err == nil && host == hostOnly(baseURL.Host) {
+		return true
+	}
+
+	for _, allowed := range p.allowed {
+		if host == allowed {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok && strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOnly lowercases a host and strips any port and trailing dot
+func hostOnly(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// MaintenanceHandler holds the runtime maintenance mode flag (MAINTENANCE_MODE).
+// While it is on, routes that write files or metadata return 503 and the cleanup
+// job is paused; downloads and listings keep working.
+type MaintenanceHandler struct {
+	enabled atomic.Bool
+}
+
+// MaintenanceStatus is the maintenance mode state
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// NewMaintenanceHandler creates a new maintenance handler
+func NewMaintenanceHandler(enabled bool) *MaintenanceHandler {
+	h := &MaintenanceHandler{}
+	h.enabled.Store(enabled)
+	return h
+}
+
+// Enabled reports whether maintenance mode is on
+func (h *MaintenanceHandler) Enabled() bool {
+	return h.enabled.Load()
+}
+
+// GetMaintenance handles reporting whether maintenance mode is on
+func (h *MaintenanceHandler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, MaintenanceStatus{Enabled: h.Enabled()}, http.StatusOK)
+}
+
+// SetMaintenance handles turning maintenance mode on or off ({"enabled": true})
+func (h *MaintenanceHandler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		respondError(w, "Invalid request body (expected {\"enabled\": true|false})", http.StatusBadRequest)
+		return
+	}
+
+	if h.enabled.Swap(*req.Enabled) != *req.Enabled {
+		log.Printf("Maintenance mode set to %t", *req.Enabled)
+	}
+	respondJSON(w, MaintenanceStatus{Enabled: *req.Enabled}, http.StatusOK)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/yorukot/sharing/internal/events"
+	"github.com/yorukot/sharing/internal/metrics"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/services"
+)
+
+// maxMultiDownloadFiles caps the number of files in one multipart download
+const maxMultiDownloadFiles = 100
+
+// DownloadMultiple handles downloading several files in one multipart/mixed response
+// (?ids=1,2,3). Each part carries the file's own Content-Type, Content-Disposition and
+// Content-Length, in the order requested. A password, if given, is checked against
+// every password-protected file.
+func (h *APIHandler) DownloadMultiple(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseIDList(r.URL.Query()["ids"])
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(ids) == 0 {
+		respondError(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxMultiDownloadFiles {
+		respondError(w, fmt.Sprintf("at most %d files can be downloaded at once", maxMultiDownloadFiles), http.StatusBadRequest)
+		return
+	}
+
+	// Resolve every file first, so a bad ID fails the request before anything is sent
+	password := r.URL.Query().Get("password")
+	files := make([]*models.File, 0, len(ids))
+	for _, id := range ids {
+		file, err := h.fileService.GetFile(id)
+		if err != nil {
+			if errors.Is(err, services.ErrFileNotFound) {
+				respondError(w, fmt.Sprintf("File %d not found", id), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, services.ErrFileExpired) {
+				respondError(w, fmt.Sprintf("File %d has expired", id), http.StatusGone)
+				return
+			}
+			respondError(w, "Failed to get file: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := h.fileService.ValidatePassword(file, password); err != nil {
+			if errors.Is(err, services.ErrPasswordRequired) {
+				respondError(w, fmt.Sprintf("Password required for file %d", id), http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, services.ErrInvalidPassword) {
+				respondError(w, fmt.Sprintf("Invalid password for file %d", id), http.StatusForbidden)
+				return
+			}
+			respondError(w, "Password validation failed", http.StatusInternalServerError)
+			return
+		}
+		files = append(files, file)
+	}
+
+	// Open the first file before writing any success headers; the others are opened
+	// as their parts are reached, so only one storage stream is held at a time
+	reader, err := openDownload(h.fileService.WithContext(r.Context()), files[0])
+	if err != nil {
+		respondOpenError(w, err)
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+
+	for i, file := range files {
+		if i > 0 {
+			if reader, err = openDownload(h.fileService.WithContext(r.Context()), file); err != nil {
+				// Too late for a status code; abort so the client doesn't see a complete body
+				log.Printf("Multipart download aborted: failed to open file %d (%s): %v", file.ID, file.OriginalName, err)
+				panic(http.ErrAbortHandler)
+			}
+		}
+
+		part, err := mw.CreatePart(partHeader(file))
+		var written int64
+		if err == nil {
+			written, err = copyContent(part, reader)
+		}
+		reader.Close()
+		metrics.Default.ObserveDownload(false, written)
+		services.RecordTransfer(file.ID, transferClient(r), written, err == nil)
+		if err != nil {
+			log.Printf("Multipart download of file %d (%s) interrupted: %v", file.ID, file.OriginalName, err)
+			panic(http.ErrAbortHandler)
+		}
+
+		events.Publish(events.TypeDownload, file.ID, file.Slug, file.OriginalName)
+	}
+
+	if err := mw.Close(); err != nil {
+		log.Printf("Failed to finish multipart download: %v", err)
+	}
+}
+
+// partHeader builds the MIME headers of a file's part in a multipart download
+func partHeader(file *models.File) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", file.ContentType)
+	header.Set("Content-Disposition", contentDisposition("attachment", downloadName(file)))
+	if !file.InProgress {
+		header.Set("Content-Length", strconv.FormatInt(file.FileSize, 10))
+	}
+	header.Set("X-File-ID", strconv.FormatUint(uint64(file.ID), 10))
+	return header
+}
+
+// parseIDList parses file IDs given as comma-separated lists, possibly repeated
+// (?ids=1,2&ids=3). Duplicates are dropped, keeping the first occurrence.
+func parseIDList(values []string) ([]uint, error) {
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, value := range values {
+		for _, idStr := range strings.Split(value, ",") {
+			idStr = strings.TrimSpace(idStr)
+			if idStr == "" {
+				continue
+			}
+
+			id, err := strconv.ParseUint(idStr, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ID format: %q", idStr)
+			}
+			if !seen[uint(id)] {
+				seen[uint(id)] = true
+				ids = append(ids, uint(id))
+			}
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/services"
+)
+
+// downloadedPart is one part of a multipart download as the client sees it
+type downloadedPart struct {
+	id          string
+	filename    string
+	contentType string
+	length      string
+	content     string
+}
+
+// readMultipartDownload parses a multipart/mixed download response into its parts
+func readMultipartDownload(t *testing.T, rec *httptest.ResponseRecorder) []downloadedPart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" || params["boundary"] == "" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/mixed with a boundary", rec.Header().Get("Content-Type"), err)
+	}
+
+	var parts []downloadedPart
+	reader := multipart.NewReader(rec.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("reading part %d: %v", len(parts)+1, err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("reading part %d: %v", len(parts)+1, err)
+		}
+		parts = append(parts, downloadedPart{
+			id:          part.Header.Get("X-File-ID"),
+			filename:    part.FileName(),
+			contentType: part.Header.Get("Content-Type"),
+			length:      part.Header.Get("Content-Length"),
+			content:     string(content),
+		})
+	}
+}
+
+func TestDownloadMultiple(t *testing.T) {
+	backends := newTestBackends(t)
+	password, rawSlug := "secret", "raw-data"
+	contents := map[string]string{
+		"notes":    "some notes",
+		"report":   "%PDF-1.4 report",
+		"unnamed":  "\x00\x01\x02\x03",
+		"empty":    "",
+		"secret":   "hidden",
+		"expiring": "old",
+	}
+	upload := func(name, filename string, opts services.SaveOptions) *models.File {
+		return mustUpload(t, backends, filename, []byte(contents[name]), opts)
+	}
+	files := map[string]*models.File{
+		"notes":    upload("notes", "notes.txt", services.SaveOptions{}),
+		"report":   upload("report", "report €.pdf", services.SaveOptions{}),
+		"unnamed":  upload("unnamed", "data.bin", services.SaveOptions{Slug: &rawSlug}),
+		"empty":    upload("empty", "empty.txt", services.SaveOptions{}),
+		"secret":   upload("secret", "secret.txt", services.SaveOptions{Password: &password}),
+		"expiring": upload("expiring", "old.txt", services.SaveOptions{}),
+	}
+	// A file without an original name, as left by a bad import
+	if err := database.DB.Model(&models.File{}).Where("id = ?", files["unnamed"].ID).Update("original_name", "").Error; err != nil {
+		t.Fatalf("clearing the original name: %v", err)
+	}
+	if err := database.DB.Model(&models.File{}).Where("id = ?", files["expiring"].ID).Update("expires_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("expiring the file: %v", err)
+	}
+
+	ids := make([]string, maxMultiDownloadFiles+1)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+	manyIDs := strings.Join(ids, ",")
+
+	tests := []struct {
+		name      string
+		query     string // {name} is replaced by the ID of the named file
+		want      int
+		wantParts []string // Files expected in the body, in order
+	}{
+		{"requested order", "ids={report},{notes}", http.StatusOK, []string{"report", "notes"}},
+		{"repeated ids", "ids={notes}&ids={report}", http.StatusOK, []string{"notes", "report"}},
+		{"duplicates dropped", "ids={notes},{notes}", http.StatusOK, []string{"notes"}},
+		{"part without a filename", "ids={unnamed}", http.StatusOK, []string{"unnamed"}},
+		{"empty file", "ids={empty},{notes}", http.StatusOK, []string{"empty", "notes"}},
+		{"password", "ids={secret},{notes}&password=secret", http.StatusOK, []string{"secret", "notes"}},
+		{"no ids", "", http.StatusBadRequest, nil},
+		{"only commas", "ids=,,", http.StatusBadRequest, nil},
+		{"malformed id", "ids={notes},abc", http.StatusBadRequest, nil},
+		{"unknown id", "ids={notes},999", http.StatusNotFound, nil},
+		{"expired file", "ids={notes},{expiring}", http.StatusGone, nil},
+		{"password required", "ids={notes},{secret}", http.StatusUnauthorized, nil},
+		{"wrong password", "ids={secret}&password=wrong", http.StatusForbidden, nil},
+		{"too many files", "ids=" + manyIDs, http.StatusBadRequest, nil},
+	}
+
+	handler := http.HandlerFunc(NewAPIHandler(backends).DownloadMultiple)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			for name, file := range files {
+				query = strings.ReplaceAll(query, "{"+name+"}", strconv.FormatUint(uint64(file.ID), 10))
+			}
+
+			rec := serve(handler, httptest.NewRequest(http.MethodGet, "/api/download/multi?"+query, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("GET ?%s = %d, want %d (%s)", query, rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				// Errors are reported before any part is written
+				if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+					t.Fatalf("error Content-Type = %q, want JSON", contentType)
+				}
+				return
+			}
+
+			parts := readMultipartDownload(t, rec)
+			if len(parts) != len(tt.wantParts) {
+				t.Fatalf("%d parts, want %d", len(parts), len(tt.wantParts))
+			}
+			for i, name := range tt.wantParts {
+				file := files[name]
+				want := downloadedPart{
+					id:          strconv.FormatUint(uint64(file.ID), 10),
+					filename:    downloadName(file),
+					contentType: file.ContentType,
+					length:      strconv.FormatInt(file.FileSize, 10),
+					content:     contents[name],
+				}
+				if name == "unnamed" {
+					want.filename = "raw-data.bin" // The slug, with the stored file's extension
+				}
+				if parts[i] != want {
+					t.Errorf("part %d = %+v, want %+v", i+1, parts[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// defaultTextPreviewMaxSize is the largest text file rendered on the share page (256 KB)
+const defaultTextPreviewMaxSize = 256 << 10
+
+// textContentTypes are non-text/* media types that hold readable text
+var textContentTypes = map[string]bool{
+	"application/json":       true,
+	"application/xml":        true,
+	"application/javascript": true,
+	"application/x-yaml":     true,
+	"application/yaml":       true,
+	"application/toml":       true,
+	"application/x-sh":       true,
+}
+
+// markdownRenderer converts GitHub-flavored Markdown to HTML
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// markdownPolicy strips scripts, iframes, event handlers and other unsafe HTML from rendered Markdown
+var markdownPolicy = bluemonday.UGCPolicy()
+
+// isTextContentType reports whether a content type holds readable text
+func isTextContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return strings.HasPrefix(mediaType, "text/") || textContentTypes[mediaType]
+}
+
+// looksBinary reports whether content is not valid UTF-8 text
+func looksBinary(content []byte) bool {
+	return bytes.IndexByte(content, 0) != -1 || !utf8.Valid(content)
+}
+
+// isMarkdown reports whether a file should be rendered as Markdown
+func isMarkdown(file *models.File) bool {
+	switch strings.ToLower(file.Language) {
+	case "markdown", "md":
+		return true
+	}
+
+	switch strings.ToLower(filepath.Ext(file.OriginalName)) {
+	case ".md", ".markdown":
+		return true
+	}
+
+	mediaType, _, _ := strings.Cut(strings.ToLower(file.ContentType), ";")
+	return strings.TrimSpace(mediaType) == "text/markdown"
+}
+
+// renderMarkdown renders Markdown to sanitized HTML
+func renderMarkdown(content string) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(content), &buf); err != nil {
+		return "", err
+	}
+
+	// Markdown may contain raw HTML, so the output must be sanitized before embedding
+	return template.HTML(markdownPolicy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// highlightCode renders content as syntax-highlighted HTML.
+// The lexer is chosen by language (for pastes), then by filename, then by content.
+func highlightCode(filename, language, content string) (template.HTML, error) {
+	var lexer chroma.Lexer
+	if language != "" {
+		lexer = lexers.Get(language)
+	}
+	if lexer == nil {
+		lexer = lexers.Match(filename)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	formatter := chromahtml.New(chromahtml.WithLineNumbers(true), chromahtml.TabWidth(4))
+	if err := formatter.Format(&buf, styles.Get("github"), iterator); err != nil {
+		return "", err
+	}
+
+	// chroma escapes the content, so the output is safe to embed
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/services"
+)
+
+func TestSharePageHighlightsText(t *testing.T) {
+	t.Setenv("TEXT_PREVIEW_MAX_SIZE", "64")
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		opts     services.SaveOptions
+		want     int
+		location string // Redirect target, for files that aren't rendered
+		body     string
+	}{
+		{"source file", "main.go", "package main\n", services.SaveOptions{}, http.StatusOK, "", `<span style="color:#cf222e">package</span>`},
+		{"paste language", "snippet.txt", "def main(): pass\n", services.SaveOptions{Language: "python"}, http.StatusOK, "", `<span style="color:#cf222e">def</span>`},
+		{"escaped", "page.txt", "<script>alert(1)</script>\n", services.SaveOptions{}, http.StatusOK, "", "&lt;script&gt;"},
+		{"too large to highlight", "big.go", strings.Repeat("// comment\n", 10), services.SaveOptions{}, http.StatusFound, "/d/big.go", ""},
+		{"large paste shown plain", "big.txt", strings.Repeat("line\n", 20), services.SaveOptions{Language: "text"}, http.StatusOK, "", `<pre class="paste-content"><code>line`},
+		{"binary in a text file", "data.txt", "\x89PNG", services.SaveOptions{}, http.StatusFound, "?raw", ""},
+		{"not text", "image.png", "\x89PNG\r\n\x1a\n", services.SaveOptions{}, http.StatusFound, "/d/image.png", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			router := publicRouter(newTestPublicHandler(t, backends))
+			file := mustUpload(t, backends, tt.filename, []byte(tt.content), tt.opts)
+
+			rec := serve(router, httptest.NewRequest(http.MethodGet, "/"+file.Slug, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("share page = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Location"); !strings.HasSuffix(got, tt.location) {
+				t.Errorf("redirects to %q, want %q", got, tt.location)
+			}
+			if !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.body)
+			}
+			if strings.Contains(rec.Body.String(), "<script>alert") {
+				t.Error("file content is embedded unescaped")
+			}
+		})
+	}
+}
+
+func TestSharePageRendersMarkdown(t *testing.T) {
+	t.Setenv("TEXT_PREVIEW_MAX_SIZE", "128")
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		opts     services.SaveOptions
+		contains []string
+		excludes []string
+	}{
+		{"md file", "README.md", "# Title\n\n- item\n", services.SaveOptions{}, []string{`<div class="markdown-body"><h1>Title</h1>`, "<li>item</li>"}, nil},
+		{"markdown paste", "notes.txt", "**bold**\n", services.SaveOptions{Language: "markdown"}, []string{"<strong>bold</strong>"}, nil},
+		{"unsafe HTML", "evil.md", "<script>alert(1)</script>\n[x](javascript:alert(1))\n<img src=x onerror=alert(1)>\n", services.SaveOptions{}, []string{"markdown-body"}, []string{"<script>alert", "javascript:", "onerror"}},
+		{"too large to render", "big.md", "# Title\n" + strings.Repeat("text\n", 30), services.SaveOptions{Language: "markdown"}, []string{`<pre class="paste-content"><code># Title`}, []string{"<h1>Title</h1>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			router := publicRouter(newTestPublicHandler(t, backends))
+			file := mustUpload(t, backends, tt.filename, []byte(tt.content), tt.opts)
+
+			rec := serve(router, httptest.NewRequest(http.MethodGet, "/"+file.Slug, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("share page = %d, want %d", rec.Code, http.StatusOK)
+			}
+			body := rec.Body.String()
+			for _, want := range tt.contains {
+				if !strings.Contains(body, want) {
+					t.Errorf("body doesn't contain %q", want)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("body contains %q", unwanted)
+				}
+			}
+		})
+	}
+}
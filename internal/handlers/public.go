@@ -1,153 +1,507 @@
 package handlers
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
+	"log"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/yorukot/sharing/internal/events"
+	"github.com/yorukot/sharing/internal/models"
 	"github.com/yorukot/sharing/internal/services"
 	"github.com/yorukot/sharing/internal/storage"
 )
 
+// Not-found modes for the public catch-all routes (NOT_FOUND_MODE)
+const (
+	NotFoundModeStatus   = "404"      // Plain 404 response (default)
+	NotFoundModeRedirect = "redirect" // Redirect to the web UI
+	NotFoundModePage     = "page"     // Styled "not found" page
+)
+
+// Root behaviors (ROOT_REDIRECT); any other value is a URL or path to redirect to
+const (
+	RootLanding  = "landing" // Serve a landing page
+	RootNotFound = "404"     // Plain 404 response
+
+	defaultRootRedirect = "/web/"
+)
+
+// reservedPublicPaths are well-known paths requested by browsers and crawlers.
+// They are never treated as slugs, so they don't trigger a database lookup.
+var reservedPublicPaths = map[string]bool{
+	"favicon.ico":                      true,
+	"robots.txt":                       true,
+	"sitemap.xml":                      true,
+	"apple-touch-icon.png":             true,
+	"apple-touch-icon-precomposed.png": true,
+	"browserconfig.xml":                true,
+	"site.webmanifest":                 true,
+	"manifest.json":                    true,
+}
+
+// reservedAssetPrefixes and reservedAssetExtensions match icon variants browsers and
+// devices request (e.g., favicon-32x32.png, apple-touch-icon-120x120.png). Uploads may
+// be named like other assets, so extensions alone don't make a path reserved.
+var (
+	reservedAssetPrefixes   = []string{"favicon", "apple-touch-icon", "android-chrome-", "mstile-", "safari-pinned-tab"}
+	reservedAssetExtensions = []string{".ico", ".png", ".svg"}
+)
+
 // PublicHandler handles public sharing routes (no API key required)
 type PublicHandler struct {
-	fileService *services.FileService
-	templates   *template.Template
+	fileService    *services.FileService
+	templates      *template.Template
+	notFoundMode   string
+	rootRedirect   string        // Redirect target for "/", or RootLanding / RootNotFound (ROOT_REDIRECT)
+	maxPreviewSize int64         // Files larger than this are downloaded instead of shown inline (0 = no limit)
+	maxTextPreview int64         // Text files up to this size are highlighted on the share page (0 = disabled)
+	notFoundFile   *fallbackFile // Served for unknown slugs and filenames instead of notFoundMode (NOT_FOUND_FILE)
+	referrers      referrerPolicy
+	brand          Brand
 }
 
-// NewPublicHandler creates a new public handler
-func NewPublicHandler(storageBackend storage.Storage) *PublicHandler {
-	// Parse templates for public pages
-	tmpl, err := template.ParseGlob("templates/*.html")
+// NewPublicHandler creates a new public handler. It fails if the templates can't be parsed.
+func NewPublicHandler(backends *storage.Registry) (*PublicHandler, error) {
+	tmpl, err := parseTemplates()
 	if err != nil {
-		// If templates don't exist yet, create empty template
-		tmpl = template.New("public")
+		return nil, err
+	}
+
+	notFoundMode := strings.ToLower(os.Getenv("NOT_FOUND_MODE"))
+	switch notFoundMode {
+	case NotFoundModeRedirect, NotFoundModePage:
+	default:
+		notFoundMode = NotFoundModeStatus
+	}
+
+	rootRedirect := strings.TrimSpace(os.Getenv("ROOT_REDIRECT"))
+	if rootRedirect == "" {
+		rootRedirect = defaultRootRedirect
+	}
+
+	var maxPreviewSize int64
+	if sizeStr := os.Getenv("MAX_PREVIEW_SIZE"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size < 0 {
+			log.Printf("Warning: invalid MAX_PREVIEW_SIZE value, previews are not size limited")
+		} else {
+			maxPreviewSize = size
+		}
+	}
+
+	maxTextPreview := int64(defaultTextPreviewMaxSize)
+	if sizeStr := os.Getenv("TEXT_PREVIEW_MAX_SIZE"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size < 0 {
+			log.Printf("Warning: invalid TEXT_PREVIEW_MAX_SIZE value, using default (%d)", defaultTextPreviewMaxSize)
+		} else {
+			maxTextPreview = size
+		}
 	}
 
 	return &PublicHandler{
-		fileService: services.NewFileService(storageBackend),
-		templates:   tmpl,
+		fileService:    services.NewFileService(backends),
+		templates:      tmpl,
+		notFoundMode:   notFoundMode,
+		rootRedirect:   rootRedirect,
+		maxPreviewSize: maxPreviewSize,
+		maxTextPreview: maxTextPreview,
+		referrers:      loadReferrerPolicy(),
+		brand:          loadBrand(),
+		notFoundFile:   loadNotFoundFile(),
+	}, nil
+}
+
+// maxNotFoundFileSize is the largest NOT_FOUND_FILE accepted; it is held in memory
+const maxNotFoundFileSize = 10 << 20
+
+// fallbackFile is file content served in place of an error response
+type fallbackFile struct {
+	content     []byte
+	contentType string
+}
+
+// loadNotFoundFile reads the file served for unknown share links (NOT_FOUND_FILE), typed
+// by its extension or else its content. It returns nil if none is configured or it can't
+// be used, leaving unknown links to NOT_FOUND_MODE.
+func loadNotFoundFile() *fallbackFile {
+	path := os.Getenv("NOT_FOUND_FILE")
+	if path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err == nil && info.Size() > maxNotFoundFileSize {
+		err = fmt.Errorf("larger than %d bytes", maxNotFoundFileSize)
+	}
+	var content []byte
+	if err == nil {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		log.Printf("Warning: invalid NOT_FOUND_FILE value (%v), using NOT_FOUND_MODE", err)
+		return nil
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	return &fallbackFile{content: content, contentType: contentType}
+}
+
+// PublicSharingEnabled reports whether the anonymous share routes (/{slug}, /d/{filename})
+// are served. PUBLIC_SHARING_ENABLED=false limits all access to the API and web UI.
+func PublicSharingEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("PUBLIC_SHARING_ENABLED"))
+	return err != nil || enabled
+}
+
+// canPreview reports whether a file is small enough to be rendered inline. The final
+// size of a live upload isn't known yet, so it only is when previews aren't limited.
+func (h *PublicHandler) canPreview(file *models.File) bool {
+	return h.maxPreviewSize == 0 || (!file.InProgress && file.FileSize <= h.maxPreviewSize)
+}
+
+// canRenderText reports whether a file is shown as text on the share page.
+// Pastes always are; other files only if they are text and small enough to highlight.
+// Live uploads are downloaded as they grow instead.
+func (h *PublicHandler) canRenderText(file *models.File) bool {
+	if !h.canPreview(file) || file.InProgress {
+		return false
+	}
+	if file.IsPaste() {
+		return true
+	}
+	return h.maxTextPreview > 0 && file.FileSize <= h.maxTextPreview && isTextContentType(file.ContentType)
+}
+
+// isReservedPath reports whether a slug is a well-known non-slug path: one of
+// reservedPublicPaths, an icon variant, or under /.well-known/
+func isReservedPath(slug string) bool {
+	slug = strings.ToLower(slug)
+	if reservedPublicPaths[slug] || strings.HasPrefix(slug, ".well-known/") {
+		return true
+	}
+	hasPrefix := func(prefix string) bool { return strings.HasPrefix(slug, prefix) }
+	hasExtension := func(ext string) bool { return strings.HasSuffix(slug, ext) }
+	return slices.ContainsFunc(reservedAssetPrefixes, hasPrefix) && slices.ContainsFunc(reservedAssetExtensions, hasExtension)
+}
+
+// fileNotFound responds to a share link or filename that matches no file: with the
+// NOT_FOUND_FILE content if configured (still a 404, so embedded images show it as a
+// placeholder), or else according to the configured mode
+func (h *PublicHandler) fileNotFound(w http.ResponseWriter, r *http.Request) {
+	if h.notFoundFile == nil {
+		h.notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", h.notFoundFile.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(h.notFoundFile.content)))
+	w.Header().Set("Cache-Control", "no-cache") // The link may be claimed by a new file
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(h.notFoundFile.content)
+}
+
+// notFound responds to a missing public file according to the configured mode
+func (h *PublicHandler) notFound(w http.ResponseWriter, r *http.Request) {
+	switch h.notFoundMode {
+	case NotFoundModeRedirect:
+		http.Redirect(w, r, "/web/", http.StatusFound)
+	case NotFoundModePage:
+		h.renderNotFoundPage(w)
+	default:
+		http.Error(w, "File not found", http.StatusNotFound)
 	}
 }
 
-// renderPasswordPrompt renders a unified password prompt page
-func (h *PublicHandler) renderPasswordPrompt(w http.ResponseWriter, originalName, filename string, statusCode int) {
+// Root handles "/": redirects (302, so browsers don't cache it permanently),
+// serves a landing page, or returns 404, depending on ROOT_REDIRECT
+func (h *PublicHandler) Root(w http.ResponseWriter, r *http.Request) {
+	switch h.rootRedirect {
+	case RootLanding:
+		h.renderPage(w, "landing.html", http.StatusOK, map[string]interface{}{
+			"Brand": h.brand,
+		})
+	case RootNotFound:
+		http.NotFound(w, r)
+	default:
+		http.Redirect(w, r, h.rootRedirect, http.StatusFound)
+	}
+}
+
+// renderNotFoundPage renders a styled "file not found" page
+func (h *PublicHandler) renderNotFoundPage(w http.ResponseWriter) {
+	h.renderPage(w, "notfound.html", http.StatusNotFound, map[string]interface{}{
+		"Brand": h.brand,
+	})
+}
+
+// renderPasswordPrompt renders a unified password prompt page that submits to downloadPath
+func (h *PublicHandler) renderPasswordPrompt(w http.ResponseWriter, r *http.Request, downloadPath string, statusCode int) {
+	h.renderPage(w, "password.html", statusCode, map[string]interface{}{
+		"Brand":       h.brand,
+		"DownloadURL": withShareParams(r, downloadPath),
+	})
+}
+
+// accessToken returns the access token presented with a request (?token= or X-Access-Token)
+func accessToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	return r.Header.Get("X-Access-Token")
+}
+
+// shareParams are the query parameters kept on links from one public page of a file to another
+var shareParams = []string{"token", "format", "w", "h", "fit"}
+
+// withShareParams carries the access token and image format and size given in the query
+// string over to a link on the same file, so redirects and links on pages keep working for
+// files with an access list and still return the requested image
+func withShareParams(r *http.Request, link string) string {
+	query := r.URL.Query()
+	for _, name := range shareParams {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		separator := "?"
+		if strings.Contains(link, "?") {
+			separator = "&"
+		}
+		link += separator + name + "=" + url.QueryEscape(value)
+	}
+	return link
+}
+
+// checkReferrer enforces hotlink protection, responding 403 to requests linked from
+// sites not listed in ALLOWED_REFERRERS
+func (h *PublicHandler) checkReferrer(w http.ResponseWriter, r *http.Request) bool {
+	if !h.referrers.allows(r) {
+		http.Error(w, "Hotlinking is not allowed", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkAccess enforces the file's access list, responding 403 if the request's token isn't listed
+func (h *PublicHandler) checkAccess(w http.ResponseWriter, r *http.Request, file *models.File) bool {
+	if err := h.fileService.ValidateAccessToken(file, accessToken(r)); err != nil {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// renderPage renders a public page template.
+// The page is rendered to a buffer first, so a template error still gets a proper error response.
+func (h *PublicHandler) renderPage(w http.ResponseWriter, name string, statusCode int, data interface{}) {
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Printf("Failed to render %s: %v", name, err)
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(statusCode)
-	w.Write([]byte(`<!DOCTYPE html>
-<html>
-<head>
-	<meta charset="UTF-8">
-	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	<title>Password Required</title>
-	<style>
-		* { margin: 0; padding: 0; box-sizing: border-box; }
-		body {
-			font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-			display: flex;
-			align-items: center;
-			justify-content: center;
-			min-height: 100vh;
-			background: #f5f5f5;
-		}
-		.container {
-			max-width: 450px;
-			width: 90%;
-			text-align: center;
-		}
-		h1 {
-			font-size: 24px;
-			font-weight: 600;
-			color: #000;
-			margin-bottom: 10px;
-		}
-		p {
-			font-size: 14px;
-			color: #666;
-			margin-bottom: 30px;
-		}
-		input[type="password"] {
-			width: 100%;
-			padding: 12px 16px;
-			border: 1px solid #ddd;
-			border-radius: 4px;
-			font-size: 14px;
-			margin-bottom: 15px;
-			background: white;
-		}
-		input[type="password"]:focus {
-			outline: none;
-			border-color: #3498db;
-		}
-		button {
-			width: 100%;
-			padding: 12px;
-			background: #3498db;
-			color: white;
-			border: none;
-			border-radius: 4px;
-			font-size: 14px;
-			font-weight: 500;
-			cursor: pointer;
-			transition: background 0.2s;
-		}
-		button:hover {
-			background: #2980b9;
-		}
-	</style>
-</head>
-<body>
-	<div class="container">
-		<h1>Password Required</h1>
-		<p>This file is password protected.</p>
-		<form onsubmit="download(event)">
-			<input type="password" id="pwd" placeholder="Enter password" required autofocus>
-			<button type="submit">Download</button>
-		</form>
-	</div>
-	<script>
-		function download(e) {
-			e.preventDefault();
-			const pwd = document.getElementById('pwd').value;
-			window.location.href = '/d/` + originalName + `?password=' + encodeURIComponent(pwd);
-		}
-	</script>
-</body>
-</html>`))
+	buf.WriteTo(w)
+}
+
+// slugParam returns the slug of a share route: {slug}, or the rest of the path for slugs
+// with "/" (see SLUG_TEMPLATE)
+func slugParam(r *http.Request) string {
+	if slug := chi.URLParam(r, "slug"); slug != "" {
+		return slug
+	}
+	return chi.URLParam(r, "*")
 }
 
 // SharePage redirects directly to download (with password prompt if needed)
 func (h *PublicHandler) SharePage(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
+	slug := slugParam(r)
+
+	// Skip the database lookup for well-known browser/crawler paths
+	if isReservedPath(slug) {
+		h.notFound(w, r)
+		return
+	}
+
+	if !h.checkReferrer(w, r) {
+		return
+	}
 
-	file, err := h.fileService.GetFileBySlug(slug)
+	domain := services.DomainForHost(r.Host)
+	file, err := h.fileService.GetFileBySlug(domain, slug)
+	if errors.Is(err, services.ErrFileNotFound) {
+		// The file may have been renamed; send old links to its current slug
+		if file, err = h.fileService.GetFileByFormerSlug(domain, slug); err == nil {
+			redirectToSlug(w, r, file.Slug)
+			return
+		}
+	}
 	if err != nil {
 		if errors.Is(err, services.ErrFileNotFound) {
-			http.Error(w, "File not found", http.StatusNotFound)
+			h.fileNotFound(w, r)
 			return
 		}
 		if errors.Is(err, services.ErrFileExpired) {
 			http.Error(w, "This file has expired", http.StatusGone)
 			return
 		}
+		if errors.Is(err, services.ErrFileDisabled) {
+			http.Error(w, "This file has been disabled", http.StatusGone)
+			return
+		}
 		http.Error(w, "Failed to load file", http.StatusInternalServerError)
 		return
 	}
 
+	// Files with an access list are only served to listed tokens
+	if !h.checkAccess(w, r, file) {
+		return
+	}
+
+	// A companion decryptor fetches the client metadata from the share link (?metadata)
+	if r.URL.Query().Has("metadata") {
+		h.serveClientMetadata(w, r, file)
+		return
+	}
+
+	// Records without an original name (e.g., from a bad import) have no /d/ link;
+	// serve them from the share link instead
+	if strings.TrimSpace(file.OriginalName) == "" {
+		h.serveDownload(w, r, file, services.SlugPath(file.Slug))
+		return
+	}
+
 	// If password protected, show simple password prompt
 	if file.HasPassword() {
 		// For password prompt, always use original filename in the /d/ URL
-		h.renderPasswordPrompt(w, file.OriginalName, file.OriginalName, http.StatusOK)
+		h.renderPasswordPrompt(w, r, "/d/"+url.PathEscape(file.OriginalName), http.StatusOK)
+		return
+	}
+
+	// Pastes and text files are rendered on the share page, unless the raw bytes are requested
+	if !r.URL.Query().Has("raw") && h.canRenderText(file) {
+		h.renderTextPreview(w, r, file)
 		return
 	}
 
 	// No password, redirect directly to download using original filename
 	// URL encode the filename to handle Unicode characters properly
-	http.Redirect(w, r, "/d/"+url.PathEscape(file.OriginalName), http.StatusFound)
+	http.Redirect(w, r, withShareParams(r, "/d/"+url.PathEscape(file.OriginalName)), http.StatusFound)
+}
+
+// redirectToSlug permanently redirects a former share link to the file's current slug,
+// keeping the query string. Access and password checks happen at the new link.
+func redirectToSlug(w http.ResponseWriter, r *http.Request, slug string) {
+	target := services.SlugPath(slug)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// renderTextPreview renders a paste or text file on an HTML page, highlighted when small enough
+func (h *PublicHandler) renderTextPreview(w http.ResponseWriter, r *http.Request, file *models.File) {
+	reader, err := openDownload(h.fileService.WithContext(r.Context()), file)
+	if err != nil {
+		if storageUnavailable(w, err) {
+			http.Error(w, "Storage is temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			http.Error(w, "File content not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	// Text-typed files can still hold binary data; serve those as-is
+	rawURL := withShareParams(r, services.SlugPath(file.Slug)+"?raw")
+	if !file.IsPaste() && looksBinary(content) {
+		http.Redirect(w, r, rawURL, http.StatusFound)
+		return
+	}
+
+	if !h.recordDownload(w, r, file) {
+		return
+	}
+
+	// Large pastes are shown as plain text
+	var highlighted, markdown template.HTML
+	if h.maxTextPreview > 0 && file.FileSize <= h.maxTextPreview {
+		if isMarkdown(file) {
+			markdown, err = renderMarkdown(string(content))
+			if err != nil {
+				log.Printf("Failed to render Markdown for file %d: %v", file.ID, err)
+			}
+		} else {
+			highlighted, err = highlightCode(file.OriginalName, file.Language, string(content))
+			if err != nil {
+				log.Printf("Failed to highlight file %d: %v", file.ID, err)
+			}
+		}
+	}
+
+	h.renderPage(w, "preview.html", http.StatusOK, map[string]interface{}{
+		"Brand":       h.brand,
+		"File":        file,
+		"Content":     string(content),
+		"Highlighted": highlighted,
+		"Markdown":    markdown,
+		"RawURL":      rawURL,
+	})
+
+	events.Publish(events.TypeDownload, file.ID, file.Slug, file.OriginalName)
+
+	if err := h.fileService.ActivateExpiry(file); err != nil {
+		log.Printf("Failed to activate expiry for file %d: %v", file.ID, err)
+	}
+}
+
+// recordDownload counts a public download before it is served.
+// Range requests only count for a client not already counted within the window.
+// It returns false if the response was already written because the download limit was reached.
+func (h *PublicHandler) recordDownload(w http.ResponseWriter, r *http.Request, file *models.File) bool {
+	var err error
+	if r.Header.Get("Range") != "" {
+		err = h.fileService.RecordRangeDownload(file, remoteIP(r))
+	} else {
+		err = h.fileService.RecordDownload(file)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrDownloadLimitReached) {
+			http.Error(w, "This file has reached its download limit", http.StatusGone)
+			return false
+		}
+		log.Printf("Failed to record download for file %d: %v", file.ID, err)
+	}
+	return true
 }
 
 // DownloadByOriginalName handles file download via original filename (public, no API key required)
@@ -161,26 +515,82 @@ func (h *PublicHandler) DownloadByOriginalName(w http.ResponseWriter, r *http.Re
 		filename = encodedFilename
 	}
 
-	file, err := h.fileService.GetFileByOriginalName(filename)
+	// Never match records that are missing their original name
+	if strings.TrimSpace(filename) == "" {
+		h.notFound(w, r)
+		return
+	}
+
+	if !h.checkReferrer(w, r) {
+		return
+	}
+
+	file, err := h.fileService.GetFileByOriginalName(services.DomainForHost(r.Host), filename)
 	if err != nil {
 		if errors.Is(err, services.ErrFileNotFound) {
-			http.Error(w, "File not found", http.StatusNotFound)
+			h.fileNotFound(w, r)
 			return
 		}
 		if errors.Is(err, services.ErrFileExpired) {
 			http.Error(w, "This file has expired", http.StatusGone)
 			return
 		}
+		if errors.Is(err, services.ErrFileDisabled) {
+			http.Error(w, "This file has been disabled", http.StatusGone)
+			return
+		}
 		http.Error(w, "Failed to get file", http.StatusInternalServerError)
 		return
 	}
 
+	// Files with an access list are only served to listed tokens
+	if !h.checkAccess(w, r, file) {
+		return
+	}
+
+	if r.URL.Query().Has("metadata") {
+		h.serveClientMetadata(w, r, file)
+		return
+	}
+
+	h.serveDownload(w, r, file, "/d/"+url.PathEscape(file.OriginalName))
+}
+
+// serveClientMetadata serves a file's client metadata as JSON, under the same password
+// (?password=) as its content. It doesn't count as a download.
+func (h *PublicHandler) serveClientMetadata(w http.ResponseWriter, r *http.Request, file *models.File) {
+	if err := h.fileService.ValidatePassword(file, r.URL.Query().Get("password")); err != nil {
+		if errors.Is(err, services.ErrPasswordRequired) {
+			http.Error(w, "Password required", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPassword) {
+			http.Error(w, "Invalid password", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Password validation failed", http.StatusInternalServerError)
+		return
+	}
+
+	if len(file.ClientMetadata) == 0 {
+		http.Error(w, "This file has no client metadata", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(file.ClientMetadata)
+}
+
+// serveDownload serves a file's content on a public route after checking its password.
+// A missing password shows the prompt, which submits back to downloadPath.
+func (h *PublicHandler) serveDownload(w http.ResponseWriter, r *http.Request, file *models.File, downloadPath string) {
 	// Validate password if required
 	password := r.URL.Query().Get("password")
 	if err := h.fileService.ValidatePassword(file, password); err != nil {
 		if errors.Is(err, services.ErrPasswordRequired) {
 			// Show password prompt page
-			h.renderPasswordPrompt(w, file.OriginalName, file.OriginalName, http.StatusUnauthorized)
+			h.renderPasswordPrompt(w, r, downloadPath, http.StatusUnauthorized)
 			return
 		}
 		if errors.Is(err, services.ErrInvalidPassword) {
@@ -191,22 +601,77 @@ func (h *PublicHandler) DownloadByOriginalName(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Set headers for inline viewing (browser preview instead of download)
-	w.Header().Set("Content-Disposition", "inline; filename=\""+file.OriginalName+"\"")
-	w.Header().Set("Content-Type", file.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(file.FileSize, 10))
+	contentType, err := downloadContentType(r, file)
+	if err != nil {
+		http.Error(w, invalidContentTypeOverrideMessage, http.StatusBadRequest)
+		return
+	}
 
-	// Get file reader from storage
-	reader, err := h.fileService.GetFileReader(file)
+	// Images may be served transcoded to a smaller format (?format= or Accept) or resized;
+	// otherwise the file is opened from storage before writing any success headers
+	reader, served, err := openImageVariant(w, r, h.fileService.WithContext(r.Context()), file)
 	if err != nil {
-		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		http.Error(w, imageVariantErrorMessage(err), http.StatusBadRequest)
 		return
 	}
-	defer reader.Close()
+	if reader != nil {
+		defer reader.Close()
+		contentType = served.ContentType
+	}
 
-	// Copy file content to response
-	if _, err := io.Copy(w, reader); err != nil {
-		// Log error but don't send response as headers already sent
+	// A single Range resumes an interrupted download
+	rng, err := requestedRange(r, served)
+	if err != nil {
+		setUnsatisfiableRange(w, served)
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if reader != nil && rng != nil {
+		if reader, err = services.SliceReader(reader, rng.start, rng.length); err != nil {
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+	} else if reader == nil && r.Method != http.MethodHead {
+		if reader, err = openDownloadRange(h.fileService.WithContext(r.Context()), file, rng); err != nil {
+			if storageUnavailable(w, err) {
+				http.Error(w, "Storage is temporarily unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				http.Error(w, "File content not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		defer reader.Close()
+	}
+
+	// Count the download before serving it, so the download limit is enforced
+	// (HEAD requests don't download anything)
+	if r.Method != http.MethodHead && !h.recordDownload(w, r, file) {
+		return
+	}
+
+	// Set headers for inline viewing (browser preview instead of download),
+	// unless the file is too large to preview safely
+	disposition := "inline"
+	if !h.canPreview(file) {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, downloadName(served)))
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(setRangeHeaders(w, served, rng))
+	if r.Method == http.MethodHead {
 		return
 	}
+
+	// Copy file content to response
+	streamDownload(w, r, reader, served)
+
+	// Start the relative expiry clock on the first successful download
+	if err := h.fileService.ActivateExpiry(file); err != nil {
+		log.Printf("Failed to activate expiry for file %d: %v", file.ID, err)
+	}
 }
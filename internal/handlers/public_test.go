@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/services"
+	"gorm.io/gorm"
+)
+
+// testPNG returns a PNG of noise, whose encoded size grows with its dimensions
+func testPNG(t *testing.T, size int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestMaxPreviewSizeDisposition(t *testing.T) {
+	t.Setenv("MAX_PREVIEW_SIZE", "2000")
+	backends := newTestBackends(t)
+	router := publicRouter(newTestPublicHandler(t, backends))
+
+	small, large := testPNG(t, 4), testPNG(t, 64)
+	if len(small) > 2000 || len(large) <= 2000 {
+		t.Fatalf("test images are %d and %d bytes, want one on each side of the limit", len(small), len(large))
+	}
+
+	tests := []struct {
+		name        string
+		content     []byte
+		disposition string
+	}{
+		{"small.png", small, "inline"},
+		{"large.png", large, "attachment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mustUpload(t, backends, tt.name, tt.content, services.SaveOptions{})
+
+			rec := serve(router, httptest.NewRequest(http.MethodGet, "/d/"+tt.name, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, tt.disposition+";") {
+				t.Fatalf("Content-Disposition = %q, want %s", got, tt.disposition)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "image/png" {
+				t.Fatalf("Content-Type = %q, want image/png", got)
+			}
+		})
+	}
+}
+
+func TestNotFoundMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		want     int
+		location string
+		body     string
+	}{
+		{"", http.StatusNotFound, "", "File not found"},
+		{"404", http.StatusNotFound, "", "File not found"},
+		{"redirect", http.StatusFound, "/web/", ""},
+		{"page", http.StatusNotFound, "", "<html"},
+		{"unknown", http.StatusNotFound, "", "File not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			t.Setenv("NOT_FOUND_MODE", tt.mode)
+			backends := newTestBackends(t)
+			router := publicRouter(newTestPublicHandler(t, backends))
+			file := mustUpload(t, backends, "notes.txt", []byte("notes"), services.SaveOptions{})
+
+			if rec := serve(router, httptest.NewRequest(http.MethodGet, "/"+file.Slug, nil)); rec.Code != http.StatusOK {
+				t.Fatalf("existing slug = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			for _, target := range []string{"/missing", "/d/missing.txt"} {
+				rec := serve(router, httptest.NewRequest(http.MethodGet, target, nil))
+				if rec.Code != tt.want {
+					t.Fatalf("GET %s = %d, want %d", target, rec.Code, tt.want)
+				}
+				if got := rec.Header().Get("Location"); got != tt.location {
+					t.Errorf("GET %s redirects to %q, want %q", target, got, tt.location)
+				}
+				if !strings.Contains(rec.Body.String(), tt.body) {
+					t.Errorf("GET %s body = %q, want it to contain %q", target, rec.Body.String(), tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestReservedPathsSkipLookup(t *testing.T) {
+	backends := newTestBackends(t)
+	router := publicRouter(newTestPublicHandler(t, backends))
+	mustUpload(t, backends, "robots.txt", []byte("an upload named robots.txt"), services.SaveOptions{})
+	mustUpload(t, backends, "report.png", []byte("an image"), services.SaveOptions{})
+
+	var queries int
+	if err := database.DB.Callback().Query().Before("gorm:query").Register("test:count", func(*gorm.DB) { queries++ }); err != nil {
+		t.Fatalf("counting queries: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Callback().Query().Remove("test:count") })
+
+	tests := []struct {
+		path       string
+		want       int
+		wantLookup bool
+	}{
+		{"/favicon.ico", http.StatusNotFound, false},
+		{"/FAVICON.ICO", http.StatusNotFound, false},
+		{"/robots.txt", http.StatusNotFound, false}, // Even though a file has that slug
+		{"/favicon-32x32.png", http.StatusNotFound, false},
+		{"/apple-touch-icon-120x120-precomposed.png", http.StatusNotFound, false},
+		{"/.well-known/security.txt", http.StatusNotFound, false},
+		{"/missing", http.StatusNotFound, true},
+		{"/favicon-notes.txt", http.StatusNotFound, true},
+		{"/report.png", http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			queries = 0
+			rec := serve(router, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+			}
+			if looked := queries > 0; looked != tt.wantLookup {
+				t.Fatalf("GET %s made %d queries, want a lookup: %v", tt.path, queries, tt.wantLookup)
+			}
+		})
+	}
+}
+
+func TestRootRedirect(t *testing.T) {
+	tests := []struct {
+		setting  string
+		want     int
+		location string
+		body     string
+	}{
+		{"", http.StatusFound, "/web/", ""},
+		{"https://example.com/", http.StatusFound, "https://example.com/", ""},
+		{" /about ", http.StatusFound, "/about", ""},
+		{"landing", http.StatusOK, "", "<html"},
+		{"404", http.StatusNotFound, "", "404 page not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run("ROOT_REDIRECT="+tt.setting, func(t *testing.T) {
+			t.Setenv("ROOT_REDIRECT", tt.setting)
+			h := newTestPublicHandler(t, newTestBackends(t))
+
+			rec := serve(http.HandlerFunc(h.Root), httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("GET / = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Location"); got != tt.location {
+				t.Errorf("GET / redirects to %q, want %q", got, tt.location)
+			}
+			if !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestAccessList(t *testing.T) {
+	password := "secret"
+
+	tests := []struct {
+		name     string
+		opts     services.SaveOptions
+		target   string // Path, with {name} and {slug} replaced by the file's
+		header   string // X-Access-Token
+		want     int
+		wantBody string
+	}{
+		{"download without a list", services.SaveOptions{}, "/d/{name}", "", http.StatusOK, "notes"},
+		{"download with a listed token", services.SaveOptions{AccessTokens: []string{"alice"}}, "/d/{name}?token=alice", "", http.StatusOK, "notes"},
+		{"download with the token header", services.SaveOptions{AccessTokens: []string{"alice"}}, "/d/{name}", "alice", http.StatusOK, "notes"},
+		{"download without a token", services.SaveOptions{AccessTokens: []string{"alice"}}, "/d/{name}", "", http.StatusForbidden, "Access denied"},
+		{"download with an unlisted token", services.SaveOptions{AccessTokens: []string{"alice"}}, "/d/{name}?token=mallory", "", http.StatusForbidden, "Access denied"},
+		{"share page without a token", services.SaveOptions{AccessTokens: []string{"alice"}}, "/{slug}", "", http.StatusForbidden, "Access denied"},
+		{"share page with a listed token", services.SaveOptions{AccessTokens: []string{"alice"}}, "/{slug}?token=alice", "", http.StatusOK, "notes"},
+		{"password prompt keeps the token", services.SaveOptions{AccessTokens: []string{"alice"}, Password: &password}, "/d/{name}?token=alice", "", http.StatusUnauthorized, "token=alice"},
+		{"password checked after the token", services.SaveOptions{AccessTokens: []string{"alice"}, Password: &password}, "/d/{name}?password=secret", "", http.StatusForbidden, "Access denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			router := publicRouter(newTestPublicHandler(t, backends))
+			file := mustUpload(t, backends, "notes.txt", []byte("notes"), tt.opts)
+
+			target := strings.NewReplacer("{name}", file.OriginalName, "{slug}", file.Slug).Replace(tt.target)
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Access-Token", tt.header)
+			}
+
+			rec := serve(router, req)
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d", target, rec.Code, tt.want)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s body = %q, want it to contain %q", target, rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestFormerSlugRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		want     int
+		location string
+	}{
+		{"former slug", "/first", http.StatusMovedPermanently, "/second"},
+		{"query string kept", "/first?token=alice&raw", http.StatusMovedPermanently, "/second?token=alice&raw"},
+		{"current slug", "/second", http.StatusOK, ""},
+		{"unknown slug", "/third", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			router := publicRouter(newTestPublicHandler(t, backends))
+			slug := "first"
+			file := mustUpload(t, backends, "notes.txt", []byte("notes"), services.SaveOptions{Slug: &slug})
+			renamed := "second"
+			if _, err := services.NewFileService(backends).UpdateFile(file.ID, services.UpdateOptions{Slug: &renamed}); err != nil {
+				t.Fatalf("renaming: %v", err)
+			}
+
+			rec := serve(router, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d", tt.target, rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Location"); got != tt.location {
+				t.Fatalf("GET %s redirects to %q, want %q", tt.target, got, tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/yorukot/sharing/internal/services"
+)
+
+// ReportHandler handles abuse reports (public submission and admin triage)
+type ReportHandler struct {
+	reportService *services.ReportService
+}
+
+// NewReportHandler creates a new report handler
+func NewReportHandler() *ReportHandler {
+	var threshold int64
+	if thresholdStr := os.Getenv("REPORT_AUTO_DISABLE_THRESHOLD"); thresholdStr != "" {
+		t, err := strconv.ParseInt(thresholdStr, 10, 64)
+		if err != nil || t < 0 {
+			log.Printf("Warning: invalid REPORT_AUTO_DISABLE_THRESHOLD value, auto-disable is off")
+		} else {
+			threshold = t
+		}
+	}
+
+	return &ReportHandler{
+		reportService: services.NewReportService(threshold),
+	}
+}
+
+// ReportUpdateRequest represents the report triage payload
+type ReportUpdateRequest struct {
+	Status string `json:"status"`
+}
+
+// ReportFile handles a public abuse report for a slug (no API key required)
+func (h *ReportHandler) ReportFile(w http.ResponseWriter, r *http.Request) {
+	slug := slugParam(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.reportService.CreateReport(services.DomainForHost(r.Host), slug, r.FormValue("reason"), remoteIP(r)); err != nil {
+		if errors.Is(err, services.ErrFileNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to submit report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("Report received"))
+}
+
+// ListReports handles listing abuse reports (optional ?status= filter)
+func (h *ReportHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := h.reportService.ListReports(r.URL.Query().Get("status"))
+	if err != nil {
+		respondError(w, "Failed to list reports: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, reports, http.StatusOK)
+}
+
+// UpdateReport handles triaging a report
+func (h *ReportHandler) UpdateReport(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req ReportUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.reportService.UpdateReportStatus(id, req.Status)
+	if err != nil {
+		if errors.Is(err, services.ErrReportNotFound) {
+			respondError(w, "Report not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidReportStatus) {
+			respondError(w, "Invalid status (use open, resolved, or dismissed)", http.StatusBadRequest)
+			return
+		}
+		respondError(w, "Failed to update report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, report, http.StatusOK)
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// staticCacheControl is the Cache-Control header sent with static assets
+const staticCacheControl = "public, max-age=86400"
+
+// NewStaticHandler serves web UI assets from the given filesystem under /static/
+func NewStaticHandler(assets fs.FS) http.Handler {
+	fileServer := http.StripPrefix("/static/", http.FileServer(http.FS(assets)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", staticCacheControl)
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticHandler(t *testing.T) {
+	assets := fstest.MapFS{
+		"css/app.css": {Data: []byte("body { margin: 0; }")},
+		"js/app.js":   {Data: []byte("function logout() {}")},
+	}
+	handler := NewStaticHandler(assets)
+
+	tests := []struct {
+		path        string
+		want        int
+		contentType string
+		body        string
+	}{
+		{"/static/css/app.css", http.StatusOK, "text/css", "margin: 0"},
+		{"/static/js/app.js", http.StatusOK, "javascript", "logout"},
+		{"/static/js/missing.js", http.StatusNotFound, "", ""},
+		{"/static/../main.go", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/static/", nil)
+			req.URL.Path = tt.path // Unclean, as a client may send it
+			rec := serve(handler, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Cache-Control"); tt.want == http.StatusOK && got != staticCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, staticCacheControl)
+			}
+			if !strings.Contains(rec.Header().Get("Content-Type"), tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", rec.Header().Get("Content-Type"), tt.contentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
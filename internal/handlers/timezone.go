@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// invalidTimezoneMessage is returned when a tz parameter isn't a known IANA time zone
+const invalidTimezoneMessage = "Invalid tz (use an IANA time zone like Europe/Berlin)"
+
+// parseTimezone loads the IANA time zone named by a tz parameter.
+// An empty name returns nil, meaning timestamps are shown as stored.
+func parseTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, errors.New(invalidTimezoneMessage)
+	}
+	return loc, nil
+}
+
+// inputLocation is the zone to interpret entered times in: loc, or UTC when no tz was given
+func inputLocation(loc *time.Location) *time.Location {
+	if loc == nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localizeFile returns the file with its timestamps rendered in loc (unchanged if loc is nil)
+func localizeFile(file *models.File, loc *time.Location) *models.File {
+	if loc == nil {
+		return file
+	}
+	return file.In(loc)
+}
+
+// localizeFiles renders the timestamps of every file in loc (unchanged if loc is nil)
+func localizeFiles(files []models.File, loc *time.Location) []models.File {
+	if loc == nil {
+		return files
+	}
+	localized := make([]models.File, len(files))
+	for i := range files {
+		localized[i] = *files[i].In(loc)
+	}
+	return localized
+}
+
+// inputLayouts are the accepted formats of entered times: RFC3339, or the datetime-local
+// format of HTML forms (with or without seconds), which has no zone
+var inputLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// parseTime parses an entered time in any of inputLayouts. Times without a zone are
+// read in loc (UTC if nil).
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range inputLayouts {
+		if t, err := time.ParseInLocation(layout, value, inputLocation(loc)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// inputTime is a time in a JSON request body, accepted in the same formats as
+// form values (times without a zone are UTC)
+type inputTime time.Time
+
+func (t *inputTime) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := parseTime(value, nil)
+	if err != nil {
+		return err
+	}
+	*t = inputTime(parsed)
+	return nil
+}
+
+// ptr returns the time, or nil if it wasn't given
+func (t *inputTime) ptr() *time.Time {
+	if t == nil {
+		return nil
+	}
+	value := time.Time(*t)
+	return &value
+}
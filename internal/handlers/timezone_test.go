@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yorukot/sharing/internal/services"
+)
+
+func TestParseTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"Europe/Berlin", "Europe/Berlin", false},
+		{"UTC", "UTC", false},
+		{"Local", "", true},
+		{"Mars/Olympus", "", true},
+		{"../../etc/passwd", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := parseTimezone(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimezone(%q) error = %v, want error: %v", tt.name, err, tt.wantErr)
+			}
+			if got := ""; loc != nil {
+				got = loc.String()
+				if got != tt.want {
+					t.Fatalf("parseTimezone(%q) = %s, want %s", tt.name, got, tt.want)
+				}
+			} else if tt.want != "" {
+				t.Fatalf("parseTimezone(%q) = nil, want %s", tt.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	tests := []struct {
+		value   string
+		loc     *time.Location
+		want    string // RFC3339 in UTC
+		wantErr bool
+	}{
+		{"2026-07-01T12:00:00Z", berlin, "2026-07-01T12:00:00Z", false},
+		{"2026-07-01T12:00:00+02:00", nil, "2026-07-01T10:00:00Z", false},
+		{"2026-07-01T12:00", nil, "2026-07-01T12:00:00Z", false},
+		{"2026-07-01T12:00", berlin, "2026-07-01T10:00:00Z", false},
+		{"2026-01-01T12:00:30", berlin, "2026-01-01T11:00:30Z", false},
+		{"tomorrow", nil, "", true},
+		{"2026-07-01", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTime(tt.value, tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTime(%q) error = %v, want error: %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && got.UTC().Format(time.RFC3339) != tt.want {
+				t.Fatalf("parseTime(%q) = %s, want %s", tt.value, got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFileTimezone(t *testing.T) {
+	tests := []struct {
+		tz         string
+		want       int
+		wantOffset string // Suffix of created_at, if any
+	}{
+		{"", http.StatusOK, ""},
+		{"Asia/Tokyo", http.StatusOK, "+09:00"},
+		{"Nowhere/City", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run("tz="+tt.tz, func(t *testing.T) {
+			backends := newTestBackends(t)
+			file := mustUpload(t, backends, "notes.txt", []byte("notes"), services.SaveOptions{})
+			r := chi.NewRouter()
+			r.Get("/api/files/{id}", NewAPIHandler(backends).GetFile)
+
+			target := fmt.Sprintf("/api/files/%d?tz=%s", file.ID, tt.tz)
+			rec := serve(r, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d", target, rec.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				CreatedAt string `json:"created_at"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if _, err := time.Parse(time.RFC3339, body.CreatedAt); err != nil {
+				t.Fatalf("created_at = %q: %v", body.CreatedAt, err)
+			}
+			if !strings.HasSuffix(body.CreatedAt, tt.wantOffset) {
+				t.Fatalf("created_at = %s, want it in %s", body.CreatedAt, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestUpdateFileTimeInput(t *testing.T) {
+	year := time.Now().Year() + 1
+
+	tests := []struct {
+		name        string
+		expiresAt   string // JSON value
+		want        int
+		wantExpires string // expires_at in the response
+	}{
+		{"RFC3339", fmt.Sprintf(`"%d-05-01T10:30:00+02:00"`, year), http.StatusOK, fmt.Sprintf("%d-05-01T10:30:00+02:00", year)},
+		{"fractional seconds", fmt.Sprintf(`"%d-05-01T10:30:15.75Z"`, year), http.StatusOK, fmt.Sprintf("%d-05-01T10:30:15Z", year)},
+		{"datetime-local", fmt.Sprintf(`"%d-05-01T10:30"`, year), http.StatusOK, fmt.Sprintf("%d-05-01T10:30:00Z", year)},
+		{"datetime-local with seconds", fmt.Sprintf(`"%d-05-01T10:30:45"`, year), http.StatusOK, fmt.Sprintf("%d-05-01T10:30:45Z", year)},
+		{"invalid", `"next tuesday"`, http.StatusBadRequest, ""},
+		{"not a string", "1714559400", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t)
+			file := mustUpload(t, backends, "notes.txt", []byte("notes"), services.SaveOptions{})
+			r := chi.NewRouter()
+			r.Patch("/api/files/{id}", NewAPIHandler(backends).UpdateFile)
+
+			body := strings.NewReader(`{"expires_at": ` + tt.expiresAt + `}`)
+			rec := serve(r, httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/files/%d", file.ID), body))
+			if rec.Code != tt.want {
+				t.Fatalf("PATCH = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var updated struct {
+				ExpiresAt string `json:"expires_at"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&updated); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			got, _ := time.Parse(time.RFC3339, updated.ExpiresAt)
+			want, _ := time.Parse(time.RFC3339, tt.wantExpires)
+			if !got.Equal(want) || strings.Contains(updated.ExpiresAt, ".") {
+				t.Fatalf("expires_at = %s, want %s", updated.ExpiresAt, tt.wantExpires)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/yorukot/sharing/internal/version"
+)
+
+// VersionHandler reports build and runtime information
+type VersionHandler struct {
+	storageType string
+}
+
+// NewVersionHandler creates a new version handler
+func NewVersionHandler(storageType string) *VersionHandler {
+	return &VersionHandler{
+		storageType: storageType,
+	}
+}
+
+// GetVersion handles returning build information
+func (h *VersionHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, version.Get(h.storageType), http.StatusOK)
+}
@@ -2,36 +2,95 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/models"
 	"github.com/yorukot/sharing/internal/services"
 	"github.com/yorukot/sharing/internal/storage"
 )
 
 // WebHandler handles web UI requests
 type WebHandler struct {
-	fileService *services.FileService
-	templates   *template.Template
+	fileService   *services.FileService
+	templates     *template.Template
+	loginFailures *mw.FailureLimiter
 }
 
-// NewWebHandler creates a new web handler
-func NewWebHandler(storageBackend storage.Storage) *WebHandler {
-	// Parse templates
-	tmpl := template.Must(template.ParseGlob("templates/*.html"))
+const (
+	defaultLoginMaxAttempts = 5
+	defaultLoginLockout     = 15 * time.Minute
+)
+
+// NewWebHandler creates a new web handler. It fails if the templates can't be parsed.
+func NewWebHandler(backends *storage.Registry) (*WebHandler, error) {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	maxAttempts := defaultLoginMaxAttempts
+	if attemptsStr := os.Getenv("WEB_LOGIN_MAX_ATTEMPTS"); attemptsStr != "" {
+		attempts, err := strconv.Atoi(attemptsStr)
+		if err != nil || attempts < 0 {
+			log.Printf("Warning: invalid WEB_LOGIN_MAX_ATTEMPTS value, using default (%d)", defaultLoginMaxAttempts)
+		} else {
+			maxAttempts = attempts
+		}
+	}
+
+	lockout := defaultLoginLockout
+	if lockoutStr := os.Getenv("WEB_LOGIN_LOCKOUT"); lockoutStr != "" {
+		d, err := time.ParseDuration(lockoutStr)
+		if err != nil || d <= 0 {
+			log.Printf("Warning: invalid WEB_LOGIN_LOCKOUT value, using default (%s)", defaultLoginLockout)
+		} else {
+			lockout = d
+		}
+	}
 
 	return &WebHandler{
-		fileService: services.NewFileService(storageBackend),
-		templates:   tmpl,
+		fileService:   services.NewFileService(backends),
+		templates:     tmpl,
+		loginFailures: mw.NewFailureLimiter(maxAttempts, lockout),
+	}, nil
+}
+
+// templatesPattern matches the page templates, relative to the working directory
+const templatesPattern = "templates/*.html"
+
+// parseTemplates parses the page templates shared by the web UI and public pages
+func parseTemplates() (*template.Template, error) {
+	tmpl, err := template.ParseGlob(templatesPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates (%s): %w", templatesPattern, err)
 	}
+	return tmpl, nil
 }
 
 // Index renders the main page
 func (h *WebHandler) Index(w http.ResponseWriter, r *http.Request) {
+	// With a web password configured, the page requires a session
+	sessionAuth := mw.WebPasswordEnabled()
+	if sessionAuth && !mw.HasValidSession(r) {
+		http.Redirect(w, r, "/web/login", http.StatusFound)
+		return
+	}
+
+	loc, err := parseTimezone(r.URL.Query().Get("tz"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	files, err := h.fileService.ListFiles()
 	if err != nil {
 		http.Error(w, "Failed to load files", http.StatusInternalServerError)
@@ -39,9 +98,19 @@ func (h *WebHandler) Index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Files interface{}
+		Files         interface{}
+		SessionAuth   bool
+		CSRFToken     string
+		Policies      []services.RetentionPolicy
+		Domains       []string
+		RequireExpiry bool
 	}{
-		Files: files,
+		Files:         localizeFiles(files, loc),
+		SessionAuth:   sessionAuth,
+		CSRFToken:     mw.CSRFToken(w, r),
+		Policies:      h.fileService.RetentionPolicies(),
+		Domains:       h.fileService.CustomDomains(),
+		RequireExpiry: h.fileService.RequireExpiry(),
 	}
 
 	if err := h.templates.ExecuteTemplate(w, "index.html", data); err != nil {
@@ -50,33 +119,130 @@ func (h *WebHandler) Index(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// UploadFileWeb handles file upload from web UI
+// LoginPage renders the web password login page
+func (h *WebHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
+	if !mw.WebPasswordEnabled() || mw.HasValidSession(r) {
+		http.Redirect(w, r, "/web/", http.StatusFound)
+		return
+	}
+
+	h.renderLogin(w, r, "", http.StatusOK)
+}
+
+// Login validates the web password and starts a session
+func (h *WebHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if !mw.WebPasswordEnabled() {
+		http.Redirect(w, r, "/web/", http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	// Throttle password guessing per client, even with the right password
+	client := remoteIP(r)
+	if ok, retryAfter := h.loginFailures.Allow(client); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		h.renderLogin(w, r, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if !mw.CheckWebPassword(r.FormValue("password")) {
+		h.loginFailures.Fail(client)
+		h.renderLogin(w, r, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	h.loginFailures.Reset(client)
+	if err := mw.SetSession(w, r); err != nil {
+		log.Printf("Failed to start web session: %v", err)
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/web/", http.StatusSeeOther)
+}
+
+// Logout ends the web session
+func (h *WebHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := mw.ClearSession(w, r); err != nil {
+		log.Printf("Failed to end web session: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/web/login", http.StatusSeeOther)
+}
+
+// renderLogin renders the login page with an optional error message
+func (h *WebHandler) renderLogin(w http.ResponseWriter, r *http.Request, errorMessage string, statusCode int) {
+	data := struct {
+		Error     string
+		CSRFToken string
+	}{
+		Error:     errorMessage,
+		CSRFToken: mw.CSRFToken(w, r),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if err := h.templates.ExecuteTemplate(w, "login.html", data); err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// uploadFailure describes a file that could not be saved during a web upload
+type uploadFailure struct {
+	Filename string
+	Message  string
+}
+
+// UploadFileWeb handles file upload from web UI (supports multiple files)
 func (h *WebHandler) UploadFileWeb(w http.ResponseWriter, r *http.Request) {
 	// Parse multipart form (32 MB max)
+	defer removeMultipartFiles(r)
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
 
-	// Get file from form
-	file, fileHeader, err := r.FormFile("file")
+	// Times are shown and entered in the browser's time zone when it sends one
+	loc, err := parseTimezone(r.FormValue("tz"))
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get files from form
+	fileHeaders := r.MultipartForm.File["file"]
+	if len(fileHeaders) == 0 {
 		http.Error(w, "File is required", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
 	// Parse optional parameters
 	var expiresAt *time.Time
 	if expiresAtStr := r.FormValue("expires_at"); expiresAtStr != "" {
-		t, err := time.Parse("2006-01-02T15:04", expiresAtStr)
+		t, err := parseTime(expiresAtStr, loc)
 		if err != nil {
 			http.Error(w, "Invalid expiry date format", http.StatusBadRequest)
 			return
 		}
+		t = t.UTC() // Stored in UTC whatever zone it was entered in
 		expiresAt = &t
 	}
 
+	var expiresAfterFirstDownload *time.Duration
+	if durationStr := r.FormValue("expires_after_first_download"); durationStr != "" {
+		d, err := time.ParseDuration(durationStr)
+		if err != nil {
+			http.Error(w, "Invalid expiry after first download (use a duration like 24h)", http.StatusBadRequest)
+			return
+		}
+		expiresAfterFirstDownload = &d
+	}
+
 	var password *string
 	if pwd := r.FormValue("password"); pwd != "" {
 		password = &pwd
@@ -84,33 +250,120 @@ func (h *WebHandler) UploadFileWeb(w http.ResponseWriter, r *http.Request) {
 
 	var slug *string
 	if s := r.FormValue("slug"); s != "" {
+		if len(fileHeaders) > 1 {
+			http.Error(w, "Custom short link can only be used when uploading a single file", http.StatusBadRequest)
+			return
+		}
 		slug = &s
 	}
 
 	// Parse replace parameter
 	replace := r.FormValue("replace") == "true"
 
-	// Save file
-	_, err = h.fileService.SaveFile(fileHeader, expiresAt, password, slug, replace)
-	if err != nil {
-		if errors.Is(err, services.ErrSlugTaken) {
-			http.Error(w, "Slug already taken", http.StatusConflict)
-			return
-		}
-		if errors.Is(err, services.ErrInvalidSlug) {
-			http.Error(w, "Invalid slug format (use lowercase letters, numbers, and hyphens only)", http.StatusBadRequest)
-			return
+	// Save each file, collecting per-file failures
+	var uploaded []*models.File
+	var failures []uploadFailure
+	firstStatus := http.StatusOK
+	for _, fileHeader := range fileHeaders {
+		savedFile, err := h.fileService.WithContext(r.Context()).SaveFile(fileHeader, services.SaveOptions{
+			ExpiresAt:                 expiresAt,
+			ExpiresAfterFirstDownload: expiresAfterFirstDownload,
+			Password:                  password,
+			Slug:                      slug,
+			Replace:                   replace,
+			Policy:                    r.FormValue("policy"),
+			Domain:                    r.FormValue("domain"),
+		})
+		if err != nil {
+			message, status := uploadErrorResponse(err)
+			if len(failures) == 0 {
+				firstStatus = status
+			}
+			failures = append(failures, uploadFailure{Filename: fileHeader.Filename, Message: message})
+			continue
 		}
-		http.Error(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
+		uploaded = append(uploaded, savedFile)
+		setAuditTarget(r, savedFile.ID)
+	}
+
+	// Nothing was saved: report the first error like a single-file upload
+	if len(uploaded) == 0 {
+		http.Error(w, failures[0].Message, firstStatus)
 		return
 	}
 
-	// Return updated file list
-	h.FileList(w, r)
+	files, err := h.fileService.ListFiles()
+	if err != nil {
+		http.Error(w, "Failed to load files", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Files    interface{}
+		Uploaded []*models.File
+		Failures []uploadFailure
+	}{
+		Files:    localizeFiles(files, loc),
+		Uploaded: uploaded,
+		Failures: failures,
+	}
+
+	// Return upload summary followed by the updated file list
+	if err := h.templates.ExecuteTemplate(w, "upload-result", data); err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// uploadErrorResponse maps a SaveFile error to a user-facing message and status code
+func uploadErrorResponse(err error) (string, int) {
+	if errors.Is(err, storage.ErrStorageUnavailable) {
+		return "Storage is temporarily unavailable, please retry shortly", http.StatusServiceUnavailable
+	}
+	if errors.Is(err, services.ErrInvalidExpiry) {
+		return "Use either an expiry date or an expiry after first download, not both", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrExpiryRequired) {
+		return "An expiry date is required: set one or choose a retention policy", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrFileLocked) {
+		return "Existing file is locked and cannot be replaced", http.StatusLocked
+	}
+	if errors.Is(err, services.ErrContentTypeMismatch) {
+		return "Declared content type does not match file content", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrUnknownPolicy) {
+		return "Unknown retention policy", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrUnknownDomain) {
+		return "Unknown domain", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrFilenameTooLong) {
+		return "Filename is too long", http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrPasswordTooLong) {
+		return passwordTooLongMessage(err), http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrSlugTaken) {
+		return "Slug already taken", http.StatusConflict
+	}
+	if errors.Is(err, services.ErrFilenameTaken) {
+		return "A file with this name already exists", http.StatusConflict
+	}
+	if errors.Is(err, services.ErrInvalidSlug) {
+		return invalidSlugMessage(err), http.StatusBadRequest
+	}
+	return "Failed to save file: " + err.Error(), http.StatusInternalServerError
 }
 
 // FileList returns the file list HTML fragment
 func (h *WebHandler) FileList(w http.ResponseWriter, r *http.Request) {
+	loc, err := parseTimezone(r.URL.Query().Get("tz"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	files, err := h.fileService.ListFiles()
 	if err != nil {
 		http.Error(w, "Failed to load files", http.StatusInternalServerError)
@@ -120,7 +373,7 @@ func (h *WebHandler) FileList(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Files interface{}
 	}{
-		Files: files,
+		Files: localizeFiles(files, loc),
 	}
 
 	if err := h.templates.ExecuteTemplate(w, "file-list", data); err != nil {
@@ -143,6 +396,10 @@ func (h *WebHandler) DeleteFileWeb(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "File not found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, services.ErrFileLocked) {
+			http.Error(w, "File is locked", http.StatusLocked)
+			return
+		}
 		http.Error(w, "Failed to delete file", http.StatusInternalServerError)
 		return
 	}
@@ -159,6 +416,12 @@ func (h *WebHandler) EditForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc, err := parseTimezone(r.URL.Query().Get("tz"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	file, err := h.fileService.GetFile(uint(id))
 	if err != nil {
 		http.Error(w, "File not found", http.StatusNotFound)
@@ -168,7 +431,7 @@ func (h *WebHandler) EditForm(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		File interface{}
 	}{
-		File: file,
+		File: localizeFile(file, loc),
 	}
 
 	if err := h.templates.ExecuteTemplate(w, "edit-form", data); err != nil {
@@ -191,13 +454,20 @@ func (h *WebHandler) UpdateFileWeb(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc, err := parseTimezone(r.FormValue("tz"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var expiresAt *time.Time
 	if expiresAtStr := r.FormValue("expires_at"); expiresAtStr != "" {
-		t, err := time.Parse("2006-01-02T15:04", expiresAtStr)
+		t, err := parseTime(expiresAtStr, loc)
 		if err != nil {
 			http.Error(w, "Invalid expiry date format", http.StatusBadRequest)
 			return
 		}
+		t = t.UTC() // Stored in UTC whatever zone it was entered in
 		expiresAt = &t
 	}
 
@@ -211,27 +481,38 @@ func (h *WebHandler) UpdateFileWeb(w http.ResponseWriter, r *http.Request) {
 		slug = &s
 	}
 
-	file, err := h.fileService.UpdateFile(uint(id), expiresAt, password, slug)
+	file, err := h.fileService.UpdateFile(uint(id), services.UpdateOptions{
+		ExpiresAt: expiresAt,
+		Password:  password,
+		Slug:      slug,
+	})
 	if err != nil {
+		if errors.Is(err, services.ErrFileLocked) {
+			http.Error(w, "File is locked", http.StatusLocked)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidExpiry) {
+			http.Error(w, "Expiry cannot be before the lock ends", http.StatusBadRequest)
+			return
+		}
 		if errors.Is(err, services.ErrSlugTaken) {
 			http.Error(w, "Slug already taken", http.StatusConflict)
 			return
 		}
 		if errors.Is(err, services.ErrInvalidSlug) {
-			http.Error(w, "Invalid slug format", http.StatusBadRequest)
+			http.Error(w, invalidSlugMessage(err), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrPasswordTooLong) {
+			http.Error(w, passwordTooLongMessage(err), http.StatusBadRequest)
 			return
 		}
 		http.Error(w, "Failed to update file", http.StatusInternalServerError)
 		return
 	}
 
-	data := struct {
-		File interface{}
-	}{
-		File: file,
-	}
-
-	if err := h.templates.ExecuteTemplate(w, "file-row", data); err != nil {
+	// The row template renders the file itself, as in the file list
+	if err := h.templates.ExecuteTemplate(w, "file-row", localizeFile(file, loc)); err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 		return
 	}
@@ -283,22 +564,46 @@ func (h *WebHandler) DownloadFileWeb(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Set headers for file download
-	w.Header().Set("Content-Disposition", "attachment; filename=\""+file.OriginalName+"\"")
-	w.Header().Set("Content-Type", file.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(file.FileSize, 10))
+	contentType, err := downloadContentType(r, file)
+	if err != nil {
+		http.Error(w, invalidContentTypeOverrideMessage, http.StatusBadRequest)
+		return
+	}
 
-	// Get file reader from storage
-	reader, err := h.fileService.GetFileReader(file)
+	// A single Range resumes an interrupted download
+	rng, err := requestedRange(r, file)
 	if err != nil {
-		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		setUnsatisfiableRange(w, file)
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
 		return
 	}
-	defer reader.Close()
 
-	// Copy file content to response
-	if _, err := io.Copy(w, reader); err != nil {
-		// Log error but don't send response as headers already sent
+	// Open file from storage before writing any success headers (HEAD only needs the headers)
+	var reader io.ReadCloser
+	if r.Method != http.MethodHead {
+		if reader, err = openDownloadRange(h.fileService.WithContext(r.Context()), file, rng); err != nil {
+			if storageUnavailable(w, err) {
+				http.Error(w, "Storage is temporarily unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				http.Error(w, "File content not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		defer reader.Close()
+	}
+
+	// Set headers for file download
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", downloadName(file)))
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(setRangeHeaders(w, file, rng))
+	if r.Method == http.MethodHead {
 		return
 	}
+
+	// Copy file content to response
+	streamDownload(w, r, reader, file)
 }
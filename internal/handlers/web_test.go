@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/services"
+)
+
+// newTestWebHandler returns a web handler on the backends. Settings set with t.Setenv
+// beforehand apply.
+func newTestWebHandler(t *testing.T) *WebHandler {
+	t.Helper()
+	h, err := NewWebHandler(newTestBackends(t))
+	if err != nil {
+		t.Fatalf("NewWebHandler: %v", err)
+	}
+	mw.SetSessionStore(services.NewSessionService())
+	return h
+}
+
+// loginRequest builds a login form POST from a client address
+func loginRequest(remoteAddr, password string) *http.Request {
+	form := url.Values{"password": {password}}
+	req := httptest.NewRequest(http.MethodPost, "/web/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+func TestLogin(t *testing.T) {
+	t.Setenv("WEB_PASSWORD", "correct horse")
+	t.Setenv("WEB_LOGIN_MAX_ATTEMPTS", "3")
+
+	tests := []struct {
+		name      string
+		failures  int // Failed attempts by the same client beforehand
+		password  string
+		want      int
+		wantValid bool
+	}{
+		{"good password", 0, "correct horse", http.StatusSeeOther, true},
+		{"bad password", 0, "wrong", http.StatusUnauthorized, false},
+		{"good password after some failures", 2, "correct horse", http.StatusSeeOther, true},
+		{"bad password at the limit", 3, "wrong", http.StatusTooManyRequests, false},
+		{"good password at the limit", 3, "correct horse", http.StatusTooManyRequests, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestWebHandler(t)
+			for i := 0; i < tt.failures; i++ {
+				serve(http.HandlerFunc(h.Login), loginRequest("203.0.113.7:5000", "wrong"))
+			}
+
+			rec := serve(http.HandlerFunc(h.Login), loginRequest("203.0.113.7:5000", tt.password))
+			if rec.Code != tt.want {
+				t.Fatalf("login = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Error("throttled login has no Retry-After header")
+			}
+			if got := hasSessionCookie(rec); got != tt.wantValid {
+				t.Errorf("session cookie set = %v, want %v", got, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestLoginThrottlesPerClient(t *testing.T) {
+	t.Setenv("WEB_PASSWORD", "correct horse")
+	t.Setenv("WEB_LOGIN_MAX_ATTEMPTS", "1")
+	h := newTestWebHandler(t)
+
+	serve(http.HandlerFunc(h.Login), loginRequest("203.0.113.7:5000", "wrong"))
+	if rec := serve(http.HandlerFunc(h.Login), loginRequest("203.0.113.7:5000", "wrong")); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second bad login = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := serve(http.HandlerFunc(h.Login), loginRequest("198.51.100.1:5000", "correct horse")); rec.Code != http.StatusSeeOther {
+		t.Fatalf("login from another client = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+}
+
+func TestLogoutRevokesCapturedCookie(t *testing.T) {
+	t.Setenv("WEB_PASSWORD", "correct horse")
+	h := newTestWebHandler(t)
+	protected := mw.WebAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	login := serve(http.HandlerFunc(h.Login), loginRequest("203.0.113.7:5000", "correct horse"))
+	if !hasSessionCookie(login) {
+		t.Fatalf("login = %d without a session cookie", login.Code)
+	}
+	captured := login.Result().Cookies()[0]
+
+	withCookie := func(method, target string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		req.AddCookie(captured)
+		return req
+	}
+
+	if rec := serve(protected, withCookie(http.MethodGet, "/web/files")); rec.Code != http.StatusOK {
+		t.Fatalf("request with the session cookie = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(http.HandlerFunc(h.Logout), withCookie(http.MethodPost, "/web/logout")); rec.Code != http.StatusSeeOther {
+		t.Fatalf("logout = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+
+	if rec := serve(protected, withCookie(http.MethodGet, "/web/files")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("request with the cookie captured before logout = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serve(http.HandlerFunc(h.Index), withCookie(http.MethodGet, "/web/")); rec.Code != http.StatusFound {
+		t.Fatalf("index with the cookie captured before logout = %d, want a redirect to the login page", rec.Code)
+	}
+}
+
+// webLoginRouter routes the login and logout pages to h, as main does
+func webLoginRouter(h *WebHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/web/login", h.LoginPage)
+	r.With(mw.CSRFProtect).Post("/web/login", h.Login)
+	r.With(mw.CSRFProtect).Post("/web/logout", h.Logout)
+	return r
+}
+
+// csrfPageToken fetches the login page and returns its CSRF cookie and embedded token
+func csrfPageToken(t *testing.T, router http.Handler) (*http.Cookie, string) {
+	t.Helper()
+	rec := serve(router, httptest.NewRequest(http.MethodGet, "/web/login", nil))
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "sharing_csrf" {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("login page = %d without a CSRF cookie", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), `name="csrf_token" value="`+cookie.Value+`"`) {
+		t.Fatal("login page doesn't embed the CSRF token in its form")
+	}
+	return cookie, cookie.Value
+}
+
+func TestLoginLogoutRequireCSRFToken(t *testing.T) {
+	t.Setenv("WEB_PASSWORD", "correct horse")
+
+	tests := []struct {
+		name       string
+		path       string
+		withCookie bool
+		token      string // "valid" for the page's token
+		want       int
+	}{
+		{"login with token", "/web/login", true, "valid", http.StatusSeeOther},
+		{"login without token", "/web/login", true, "", http.StatusForbidden},
+		{"login with wrong token", "/web/login", true, "forged", http.StatusForbidden},
+		{"login without cookie", "/web/login", false, "valid", http.StatusForbidden},
+		{"logout with token", "/web/logout", true, "valid", http.StatusSeeOther},
+		{"logout without token", "/web/logout", true, "", http.StatusForbidden},
+		{"logout with wrong token", "/web/logout", true, "forged", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := webLoginRouter(newTestWebHandler(t))
+			cookie, token := csrfPageToken(t, router)
+			if tt.token != "valid" {
+				token = tt.token
+			}
+
+			form := url.Values{"password": {"correct horse"}, "csrf_token": {token}}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.withCookie {
+				req.AddCookie(cookie)
+			}
+
+			rec := serve(router, req)
+			if rec.Code != tt.want {
+				t.Fatalf("POST %s = %d, want %d", tt.path, rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusForbidden && hasSessionCookie(rec) {
+				t.Error("rejected login started a session")
+			}
+		})
+	}
+}
+
+// hasSessionCookie reports whether a response starts a web session
+func hasSessionCookie(rec *httptest.ResponseRecorder) bool {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "sharing_session" && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// multipartUpload builds a web upload request with a file part for each filename
+func multipartUpload(t *testing.T, fields map[string]string, filenames ...string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	for _, filename := range filenames {
+		part, err := form.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatalf("CreateFormFile: %v", err)
+		}
+		part.Write([]byte("content of " + filename))
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/web/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestUploadFileWebMultipleFiles(t *testing.T) {
+	t.Setenv("FILENAME_COLLISION", "reject")
+
+	tests := []struct {
+		name         string
+		fields       map[string]string
+		filenames    []string
+		want         int
+		wantUploaded int
+		wantBody     string
+	}{
+		{"several files", nil, []string{"a.txt", "b.txt", "c.txt"}, http.StatusOK, 3, "Uploaded 3 file(s)"},
+		{"one file fails", nil, []string{"a.txt", "a.txt"}, http.StatusOK, 1, "upload-failures"},
+		{"invalid option", map[string]string{"expires_after_first_download": "soon"}, []string{"a.txt"}, http.StatusBadRequest, 0, "Invalid expiry"},
+		{"no files", nil, nil, http.StatusBadRequest, 0, "File is required"},
+		{"custom slug for several files", map[string]string{"slug": "mine"}, []string{"a.txt", "b.txt"}, http.StatusBadRequest, 0, "single file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestWebHandler(t)
+
+			rec := serve(http.HandlerFunc(h.UploadFileWeb), multipartUpload(t, tt.fields, tt.filenames...))
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+
+			files, err := h.fileService.ListFiles()
+			if err != nil {
+				t.Fatalf("ListFiles: %v", err)
+			}
+			if len(files) != tt.wantUploaded {
+				t.Errorf("%d files stored, want %d", len(files), tt.wantUploaded)
+			}
+		})
+	}
+}
+
+func TestUploadFileWebPasswordLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{"72 bytes", strings.Repeat("€", 24), http.StatusOK},
+		{"73 bytes", strings.Repeat("€", 24) + "a", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestWebHandler(t)
+			rec := serve(http.HandlerFunc(h.UploadFileWeb), multipartUpload(t, map[string]string{"password": tt.password}, "secret.txt"))
+			if rec.Code != tt.want {
+				t.Fatalf("upload = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "at most 72 bytes") {
+				t.Errorf("body = %q, want the byte limit", rec.Body.String())
+			}
+		})
+	}
+}
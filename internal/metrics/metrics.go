@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// Downloads counts served file content since the process started
+type Downloads struct {
+	full               atomic.Uint64
+	ranged             atomic.Uint64
+	bytesServed        atomic.Uint64
+	rangeParseFailures atomic.Uint64
+}
+
+// Default is the process-wide download metrics instance
+var Default = &Downloads{}
+
+// ObserveDownload records a served download and the bytes actually written
+// (which is less than the file size if the client disconnected)
+func (d *Downloads) ObserveDownload(ranged bool, bytes int64) {
+	if ranged {
+		d.ranged.Add(1)
+	} else {
+		d.full.Add(1)
+	}
+	if bytes > 0 {
+		d.bytesServed.Add(uint64(bytes))
+	}
+}
+
+// ObserveRangeParseFailure records a request whose Range header couldn't be parsed
+func (d *Downloads) ObserveRangeParseFailure() {
+	d.rangeParseFailures.Add(1)
+}
+
+// WritePrometheus writes the counters in the Prometheus text exposition format
+func (d *Downloads) WritePrometheus(w io.Writer) {
+	fmt.Fprintln(w, "# HELP sharing_downloads_total Downloads served, by request type.")
+	fmt.Fprintln(w, "# TYPE sharing_downloads_total counter")
+	fmt.Fprintf(w, "sharing_downloads_total{type=\"full\"} %d\n", d.full.Load())
+	fmt.Fprintf(w, "sharing_downloads_total{type=\"range\"} %d\n", d.ranged.Load())
+
+	fmt.Fprintln(w, "# HELP sharing_download_bytes_total Bytes of file content written to clients.")
+	fmt.Fprintln(w, "# TYPE sharing_download_bytes_total counter")
+	fmt.Fprintf(w, "sharing_download_bytes_total %d\n", d.bytesServed.Load())
+
+	fmt.Fprintln(w, "# HELP sharing_range_parse_failures_total Download requests with an unparseable Range header.")
+	fmt.Fprintln(w, "# TYPE sharing_range_parse_failures_total counter")
+	fmt.Fprintf(w, "sharing_range_parse_failures_total %d\n", d.rangeParseFailures.Load())
+}
+
+// Handler serves the counters for a Prometheus scraper
+func (d *Downloads) Handler() http.Handler {
+	return Handler(d)
+}
+
+// Collector writes metrics in the Prometheus text exposition format
+type Collector interface {
+	WritePrometheus(w io.Writer)
+}
+
+// Func is a single unlabeled metric whose value is read when scraped
+type Func struct {
+	Name  string
+	Help  string
+	Type  string // "gauge" or "counter"
+	Value func() float64
+}
+
+// WritePrometheus writes the metric's current value
+func (f Func) WritePrometheus(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.Name, f.Help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type)
+	fmt.Fprintf(w, "%s %g\n", f.Name, f.Value())
+}
+
+// Handler serves the metrics of all collectors for a Prometheus scraper
+func Handler(collectors ...Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, c := range collectors {
+			c.WritePrometheus(w)
+		}
+	})
+}
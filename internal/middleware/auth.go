@@ -1,10 +1,34 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"os"
 )
 
+// actorKey is the context key for the authenticated actor set by APIKeyAuth and WebAuth
+type actorKey struct{}
+
+// Actor identifies who made an authenticated request, for audit logs: "api_key:" and a
+// fingerprint of the key (never the key itself), "web_session", or "" if unauthenticated
+func Actor(r *http.Request) string {
+	actor, _ := r.Context().Value(actorKey{}).(string)
+	return actor
+}
+
+// withActor records the authenticated actor in the request's context
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), actorKey{}, actor))
+}
+
+// keyFingerprint returns a short SHA-256 prefix that tells API keys apart in logs
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
 // APIKeyAuth validates the API key from the request header
 func APIKeyAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -26,6 +50,6 @@ func APIKeyAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withActor(r, "api_key:"+keyFingerprint(apiKey)))
 	})
 }
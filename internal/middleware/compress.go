@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// Compress compresses responses like chi's Compress, except those to Range and HEAD
+// requests. Their Content-Range and Content-Length describe the stored bytes, which
+// an encoded body (sent without Content-Length) would no longer match, breaking resumed downloads.
+func Compress(level int, types ...string) func(http.Handler) http.Handler {
+	compress := chimw.Compress(level, types...)
+	return func(next http.Handler) http.Handler {
+		compressed := compress(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("compressible text ", 100)
+	handler := Compress(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+
+	tests := []struct {
+		name         string
+		method       string
+		rangeSpec    string
+		wantEncoding string
+	}{
+		{"GET", http.MethodGet, "", "gzip"},
+		{"GET with a range", http.MethodGet, "bytes=0-9", ""},
+		{"HEAD", http.MethodHead, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			if tt.rangeSpec != "" {
+				req.Header.Set("Range", tt.rangeSpec)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if tt.wantEncoding == "" && tt.method == http.MethodGet && rec.Body.String() != body {
+				t.Fatal("uncompressed body changed")
+			}
+		})
+	}
+}
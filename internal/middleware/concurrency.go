@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Semaphore bounds how many requests may run a handler at the same time.
+// A nil Semaphore places no limit.
+type Semaphore chan struct{}
+
+// NewSemaphore returns a semaphore with limit slots, or nil (unlimited) if limit is 0 or less
+func NewSemaphore(limit int) Semaphore {
+	if limit <= 0 {
+		return nil
+	}
+	return make(Semaphore, limit)
+}
+
+// TryAcquire takes a slot without waiting and reports whether one was free
+func (s Semaphore) TryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release returns a slot taken with TryAcquire
+func (s Semaphore) Release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// LimitConcurrent rejects requests with 503 Service Unavailable while every slot of sem
+// is in use. Share one semaphore between routes to apply a single limit across them.
+func LimitConcurrent(sem Semaphore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if sem == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !sem.TryAcquire() {
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, "Too many uploads in progress, please retry shortly", http.StatusServiceUnavailable)
+				return
+			}
+			defer sem.Release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitConcurrentPerClient rejects requests with 429 Too Many Requests while the client IP
+// already has limit requests in progress, so one client (e.g., with many HTTP/2 streams)
+// can't take every upload slot. A limit of 0 or less disables it.
+func LimitConcurrentPerClient(limit int) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	inFlight := make(map[string]int)
+
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+
+			mu.Lock()
+			if inFlight[ip] >= limit {
+				mu.Unlock()
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, "Too many uploads in progress from this client, please wait for one to finish", http.StatusTooManyRequests)
+				return
+			}
+			inFlight[ip]++
+			mu.Unlock()
+
+			// Released however the request ends, including aborted uploads
+			defer func() {
+				mu.Lock()
+				if inFlight[ip]--; inFlight[ip] == 0 {
+					delete(inFlight, ip)
+				}
+				mu.Unlock()
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
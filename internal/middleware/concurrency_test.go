@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// blockingHandler holds every request until release is closed, signalling entered for each
+type blockingHandler struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{entered: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (b *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.entered <- struct{}{}
+	<-b.release
+}
+
+func TestLimitConcurrent(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		inFlight int // Requests held in the handler before the checked one
+		want     int
+	}{
+		{"unlimited", 0, 3, http.StatusOK},
+		{"free slot", 2, 1, http.StatusOK},
+		{"all slots in use", 2, 2, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sem := NewSemaphore(tt.limit)
+			held := newBlockingHandler()
+			// Two routes sharing one semaphore count against the same limit
+			upload := LimitConcurrent(sem)(held)
+			paste := LimitConcurrent(sem)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.inFlight; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					upload.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/upload", nil))
+				}()
+				<-held.entered
+			}
+
+			rec := httptest.NewRecorder()
+			paste.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/paste", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("request with %d in flight = %d, want %d", tt.inFlight, rec.Code, tt.want)
+			}
+			if tt.want == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+				t.Error("rejected request has no Retry-After header")
+			}
+
+			// Finished requests free their slots
+			close(held.release)
+			wg.Wait()
+			rec = httptest.NewRecorder()
+			paste.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/paste", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("request after the others finished = %d, want %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+}
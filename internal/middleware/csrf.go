@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	csrfCookieName = "sharing_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+// CSRFToken returns the CSRF token for the request, issuing a new token cookie if needed.
+// The token is embedded in pages and sent back with state-changing requests (double-submit cookie).
+func CSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		panic("failed to generate CSRF token: " + err.Error())
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/web",
+		HttpOnly: true,
+		Secure:   Scheme(r) == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token
+}
+
+// CSRFProtect rejects state-changing web requests without a valid CSRF token.
+// Requests authenticated with the X-API-Key header are exempt, since browsers
+// can't attach that header to cross-site requests.
+func CSRFProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("X-API-Key") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(csrfCookieName)
+		if err != nil || cookie.Value == "" {
+			http.Error(w, "Missing CSRF token", http.StatusForbidden)
+			return
+		}
+
+		token := r.Header.Get(csrfHeaderName)
+		if token == "" {
+			token = r.FormValue(csrfFormField)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
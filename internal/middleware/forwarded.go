@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// schemeKey is the context key for the scheme set by ForwardedProto
+type schemeKey struct{}
+
+// ForwardedProto records the scheme clients used to reach a TLS-terminating proxy.
+// Only requests whose direct peer is in trusted may set it, with the Forwarded header
+// (proto=https) or X-Forwarded-Proto; the headers are ignored from anyone else.
+// It must run before RealIP, which rewrites RemoteAddr.
+func ForwardedProto(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := net.ParseIP(clientIP(r)); ip != nil && containsIP(trusted, ip) {
+				if scheme := forwardedScheme(r.Header); scheme != "" {
+					r = r.WithContext(context.WithValue(r.Context(), schemeKey{}, scheme))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RealIP sets RemoteAddr to the client address reported by a trusted proxy, so per-client
+// limits and logs see the client instead of the proxy. Only requests whose direct peer
+// is in trusted may set it, with the Forwarded header (for=), X-Forwarded-For or
+// X-Real-IP; the headers are ignored from anyone else, so clients can't choose the
+// address they are limited by. In a chain of proxies, the nearest address that isn't
+// a trusted proxy is the client.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := net.ParseIP(clientIP(r)); ip != nil && containsIP(trusted, ip) {
+				if client := forwardedClient(r.Header, trusted); client != "" {
+					r.RemoteAddr = client
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient returns the client address from the Forwarded, X-Forwarded-For or
+// X-Real-IP header, or "" if none holds a valid IP. Addresses are read from the nearest
+// proxy backwards, skipping trusted proxies; if every address is trusted, the farthest is used.
+func forwardedClient(header http.Header, trusted []*net.IPNet) string {
+	var chain []string
+	if forwarded := header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					chain = append(chain, forwardedNode(value))
+				}
+			}
+		}
+	} else if forwardedFor := header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		chain = strings.Split(strings.Join(forwardedFor, ","), ",")
+	} else if realIP := header.Get("X-Real-IP"); realIP != "" {
+		chain = []string{realIP}
+	}
+
+	var client string
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(chain[i]))
+		if ip == nil {
+			return client // Can't tell who sent anything before an invalid entry
+		}
+		client = ip.String()
+		if !containsIP(trusted, ip) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedNode returns the IP of a Forwarded for= value, without quotes, brackets and port
+// (e.g., "[2001:db8::1]:4711" -> "2001:db8::1")
+func forwardedNode(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return host
+	}
+	return strings.Trim(value, "[]")
+}
+
+// Scheme returns the scheme ("http" or "https") the client used, taking a trusted
+// proxy's forwarded scheme into account
+func Scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if scheme, ok := r.Context().Value(schemeKey{}).(string); ok {
+		return scheme
+	}
+	return "http"
+}
+
+// ParseTrustedProxies parses a comma-separated list of proxy IPs and CIDR ranges
+// (e.g., "10.0.0.0/8,192.168.1.5")
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy range %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// containsIP reports whether ip is in any of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedScheme returns the scheme from the Forwarded or X-Forwarded-Proto header, or ""
+// if neither names http or https. With several proxies, the last (nearest) value wins,
+// since earlier values may have been sent by the client.
+func forwardedScheme(header http.Header) string {
+	var scheme string
+	if forwarded := header.Values("Forwarded"); len(forwarded) > 0 {
+		elements := strings.Split(strings.Join(forwarded, ","), ",")
+		for _, pair := range strings.Split(elements[len(elements)-1], ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(key, "proto") {
+				scheme = strings.Trim(value, `"`)
+			}
+		}
+	} else if proto := header.Values("X-Forwarded-Proto"); len(proto) > 0 {
+		values := strings.Split(strings.Join(proto, ","), ",")
+		scheme = values[len(values)-1]
+	}
+
+	scheme = strings.ToLower(strings.TrimSpace(scheme))
+	if scheme != "http" && scheme != "https" {
+		return ""
+	}
+	return scheme
+}
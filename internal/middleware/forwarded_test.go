@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// mustParseProxies parses a TRUSTED_PROXIES value, failing the test on error
+func mustParseProxies(t *testing.T, value string) []*net.IPNet {
+	t.Helper()
+	proxies, err := ParseTrustedProxies(value)
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies(%q): %v", value, err)
+	}
+	return proxies
+}
+
+func TestRealIP(t *testing.T) {
+	trusted := mustParseProxies(t, "10.0.0.0/8")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{"untrusted peer X-Forwarded-For", "203.0.113.7:5000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		{"untrusted peer X-Real-IP", "203.0.113.7:5000", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "203.0.113.7"},
+		{"untrusted peer Forwarded", "203.0.113.7:5000", http.Header{"Forwarded": {"for=198.51.100.1"}}, "203.0.113.7"},
+		{"trusted proxy X-Forwarded-For", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"trusted proxy X-Real-IP", "10.0.0.2:5000", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		{"trusted proxy Forwarded", "10.0.0.2:5000", http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https`}}, "2001:db8::1"},
+		{"spoofed entry before the client", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1"}}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"198.51.100.1, 10.0.0.5"}}, "198.51.100.1"},
+		{"invalid address", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"unknown"}}, "10.0.0.2"},
+		{"no header", "10.0.0.2:5000", http.Header{}, "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header = tt.header
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpoofedForwardedForDoesNotChangeUploadLimitKey(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	limited := LimitConcurrentPerClient(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+	handler := RealIP(mustParseProxies(t, "10.0.0.0/8"))(limited)
+
+	upload := func(forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/upload", nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	done := make(chan struct{})
+	go func() {
+		upload("198.51.100.1")
+		close(done)
+	}()
+	<-entered // The client's only slot is taken
+
+	if rec := upload("198.51.100.2"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("upload with a different spoofed X-Forwarded-For = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	close(release)
+	<-done
+}
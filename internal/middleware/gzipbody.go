@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecompressBody decompresses request bodies sent with Content-Encoding: gzip, so
+// handlers read and store the original content. The decompressed stream is capped
+// at limit bytes to guard against decompression bombs; other encodings are rejected
+// with 415 Unsupported Media Type.
+func DecompressBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			switch encoding {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+			default:
+				http.Error(w, "Unsupported Content-Encoding (use gzip)", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Invalid gzip request body", http.StatusBadRequest)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, gzipBody{Reader: gz, body: r.Body}, limit)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// gzipBody reads a decompressed request body and closes the original
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close closes the gzip reader and the underlying request body
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipped returns content compressed with gzip
+func gzipped(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+// echoBody responds with the request body, or 413 if it exceeds the limit, 400 if it
+// can't be read, and 500 if it is still marked as gzip-encoded
+func echoBody(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+	case err != nil:
+		http.Error(w, "unreadable", http.StatusBadRequest)
+	case strings.Contains(strings.ToLower(r.Header.Get("Content-Encoding")), "gzip"):
+		http.Error(w, "still encoded", http.StatusInternalServerError)
+	default:
+		w.Write(body)
+	}
+}
+
+func TestDecompressBody(t *testing.T) {
+	content := strings.Repeat("hello, world ", 100)
+	compressed := gzipped(t, content)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		limit    int64
+		want     int
+		wantBody string
+	}{
+		{"not encoded", "", []byte("plain"), 4, http.StatusOK, "plain"}, // The limit only applies to decompressed bodies
+		{"identity", "identity", []byte("plain"), 1024, http.StatusOK, "plain"},
+		{"gzip", "gzip", compressed, 4096, http.StatusOK, content},
+		{"x-gzip", "x-gzip", compressed, 4096, http.StatusOK, content},
+		{"mixed case", " GZip ", compressed, 4096, http.StatusOK, content},
+		{"at the limit", "gzip", compressed, int64(len(content)), http.StatusOK, content},
+		{"over the limit", "gzip", compressed, int64(len(content)) - 1, http.StatusRequestEntityTooLarge, "too large"},
+		{"not gzip data", "gzip", []byte("plain"), 4096, http.StatusBadRequest, "Invalid gzip"},
+		{"truncated gzip data", "gzip", compressed[:len(compressed)/2], 4096, http.StatusBadRequest, "unreadable"},
+		{"unsupported encoding", "br", []byte("plain"), 4096, http.StatusUnsupportedMediaType, "Unsupported Content-Encoding"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := DecompressBody(tt.limit)(http.HandlerFunc(echoBody))
+			req := httptest.NewRequest(http.MethodPost, "/api/upload", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("body = %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import "net/http"
+
+// RejectInMaintenance rejects requests with 503 Service Unavailable while enabled reports
+// true, for routes that write files or metadata during a maintenance window
+func RejectInMaintenance(enabled func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if enabled() {
+				http.Error(w, "Service is in maintenance mode: uploads and changes are disabled, downloads still work", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitWindow tracks requests from one client in the current window
+type rateLimitWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimit limits each client IP to limit requests per window (fixed window).
+// A limit of 0 or less disables rate limiting.
+func RateLimit(limit int, window time.Duration) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	clients := make(map[string]*rateLimitWindow)
+
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			now := time.Now()
+
+			mu.Lock()
+			// Drop finished windows so the map doesn't grow without bound
+			for key, entry := range clients {
+				if now.Sub(entry.start) >= window {
+					delete(clients, key)
+				}
+			}
+
+			entry, ok := clients[ip]
+			if !ok {
+				entry = &rateLimitWindow{start: now}
+				clients[ip] = entry
+			}
+			entry.count++
+			count := entry.count
+			retryAfter := window - now.Sub(entry.start)
+			mu.Unlock()
+
+			if count > limit {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the client's IP address without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// FailureLimiter locks a client out after limit failed attempts (e.g., web password
+// guesses) within a window, until the window that started with its first failure ends.
+// A limit of 0 or less never locks anyone out.
+type FailureLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*rateLimitWindow
+}
+
+// NewFailureLimiter creates a limiter allowing limit failures per client per window
+func NewFailureLimiter(limit int, window time.Duration) *FailureLimiter {
+	return &FailureLimiter{limit: limit, window: window, failures: make(map[string]*rateLimitWindow)}
+}
+
+// Allow reports whether a client may make another attempt, and if not, how long until it can
+func (l *FailureLimiter) Allow(client string) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.failures[client]
+	if !ok || now.Sub(entry.start) >= l.window {
+		return true, 0
+	}
+	if entry.count < l.limit {
+		return true, 0
+	}
+	return false, l.window - now.Sub(entry.start)
+}
+
+// Fail records a failed attempt by a client
+func (l *FailureLimiter) Fail(client string) {
+	if l.limit <= 0 {
+		return
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop finished windows so the map doesn't grow without bound
+	for key, entry := range l.failures {
+		if now.Sub(entry.start) >= l.window {
+			delete(l.failures, key)
+		}
+	}
+
+	entry, ok := l.failures[client]
+	if !ok {
+		entry = &rateLimitWindow{start: now}
+		l.failures[client] = entry
+	}
+	entry.count++
+}
+
+// Reset forgets a client's failures, e.g., after it succeeded
+func (l *FailureLimiter) Reset(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, client)
+}
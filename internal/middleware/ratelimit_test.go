@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		window   time.Duration
+		failures int
+		reset    bool
+		wait     time.Duration
+		want     bool
+	}{
+		{"below the limit", 3, time.Minute, 2, false, 0, true},
+		{"at the limit", 3, time.Minute, 3, false, 0, false},
+		{"reset after success", 3, time.Minute, 3, true, 0, true},
+		{"window ended", 1, 20 * time.Millisecond, 1, false, 30 * time.Millisecond, true},
+		{"unlimited", 0, time.Minute, 100, false, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewFailureLimiter(tt.limit, tt.window)
+			for i := 0; i < tt.failures; i++ {
+				l.Fail("203.0.113.7")
+			}
+			if tt.reset {
+				l.Reset("203.0.113.7")
+			}
+			time.Sleep(tt.wait)
+
+			ok, retryAfter := l.Allow("203.0.113.7")
+			if ok != tt.want {
+				t.Fatalf("Allow = %v, want %v", ok, tt.want)
+			}
+			if !ok && (retryAfter <= 0 || retryAfter > tt.window) {
+				t.Errorf("retry after %s, want within the %s window", retryAfter, tt.window)
+			}
+			if ok, _ := l.Allow("198.51.100.1"); !ok {
+				t.Error("another client was locked out")
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import "net/http"
+
+// RequireReady rejects requests with 503 Service Unavailable until ready reports true,
+// e.g. while database migrations are still running
+func RequireReady(ready func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ready() {
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, "Service is starting, please retry shortly", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireStorage rejects requests with 503 Service Unavailable while available reports false,
+// e.g. while the storage circuit breaker is open, before an upload body is read
+func RequireStorage(available func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !available() {
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, "Storage is temporarily unavailable, please retry shortly", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
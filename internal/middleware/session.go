@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName      = "sharing_session"
+	defaultSessionLifetime = 24 * time.Hour
+)
+
+var (
+	sessionKeysOnce sync.Once
+	sessionKeys     [][]byte
+)
+
+// SessionStore keeps the web sessions that haven't been logged out of. A signed cookie
+// is only accepted while its session is active, so a copied cookie stops working on logout.
+type SessionStore interface {
+	Create(id string, expiresAt time.Time) error
+	Active(id string) (bool, error)
+	Revoke(id string) error
+}
+
+// sessionStore holds sessions in memory until SetSessionStore installs a persistent store
+var sessionStore SessionStore = &memorySessionStore{expiresAt: make(map[string]time.Time)}
+
+// SetSessionStore sets where web sessions are kept (call before serving requests)
+func SetSessionStore(store SessionStore) {
+	sessionStore = store
+}
+
+// memorySessionStore keeps sessions in memory, so they end on restart
+type memorySessionStore struct {
+	mu        sync.Mutex
+	expiresAt map[string]time.Time
+}
+
+func (m *memorySessionStore) Create(id string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for other, expires := range m.expiresAt {
+		if !now.Before(expires) {
+			delete(m.expiresAt, other)
+		}
+	}
+	m.expiresAt[id] = expiresAt
+	return nil
+}
+
+func (m *memorySessionStore) Active(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expires, ok := m.expiresAt[id]
+	return ok && time.Now().Before(expires), nil
+}
+
+func (m *memorySessionStore) Revoke(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.expiresAt, id)
+	return nil
+}
+
+// getSessionKeys returns the keys used for session cookies.
+// The first key signs new sessions; all keys are accepted when verifying, so
+// SESSION_SECRET can be rotated by moving the old value to SESSION_SECRET_PREVIOUS.
+// Without SESSION_SECRET a random key is generated, so sessions end on restart.
+func getSessionKeys() [][]byte {
+	sessionKeysOnce.Do(func() {
+		if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+			sessionKeys = append(sessionKeys, []byte(secret))
+		} else {
+			log.Println("Warning: SESSION_SECRET not set, web sessions will not survive a restart")
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				panic("failed to generate session key: " + err.Error())
+			}
+			sessionKeys = append(sessionKeys, key)
+		}
+
+		for _, previous := range strings.Split(os.Getenv("SESSION_SECRET_PREVIOUS"), ",") {
+			if previous = strings.TrimSpace(previous); previous != "" {
+				sessionKeys = append(sessionKeys, []byte(previous))
+			}
+		}
+	})
+	return sessionKeys
+}
+
+// getSessionLifetime returns how long a web session stays valid (SESSION_LIFETIME)
+func getSessionLifetime() time.Duration {
+	if lifetimeStr := os.Getenv("SESSION_LIFETIME"); lifetimeStr != "" {
+		lifetime, err := time.ParseDuration(lifetimeStr)
+		if err == nil && lifetime > 0 {
+			return lifetime
+		}
+		log.Printf("Warning: invalid SESSION_LIFETIME value, using default (%s)", defaultSessionLifetime)
+	}
+	return defaultSessionLifetime
+}
+
+// WebPasswordEnabled reports whether the web UI is protected by WEB_PASSWORD
+func WebPasswordEnabled() bool {
+	return os.Getenv("WEB_PASSWORD") != ""
+}
+
+// CheckWebPassword compares the given password with WEB_PASSWORD in constant time
+func CheckWebPassword(password string) bool {
+	expected := os.Getenv("WEB_PASSWORD")
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+}
+
+// signSession returns the HMAC signature for a session payload
+func signSession(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetSession starts a web UI session and issues its signed cookie.
+// The cookie carries the expiry and a random session id ("expiry-id.signature").
+func SetSession(w http.ResponseWriter, r *http.Request) error {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return fmt.Errorf("failed to generate session id: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	expiresAt := time.Now().Add(getSessionLifetime())
+	if err := sessionStore.Create(id, expiresAt); err != nil {
+		return err
+	}
+	payload := strconv.FormatInt(expiresAt.Unix(), 10) + "-" + id
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    payload + "." + signSession(getSessionKeys()[0], payload),
+		Path:     "/web",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   Scheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// ClearSession ends the request's web UI session and removes its cookie
+func ClearSession(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/web",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   Scheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if id, ok := sessionID(r); ok {
+		return sessionStore.Revoke(id)
+	}
+	return nil
+}
+
+// sessionID returns the id of the request's session if its cookie is correctly signed
+// and unexpired. The session may still have been revoked.
+func sessionID(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return "", false
+	}
+
+	payload, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return "", false
+	}
+
+	// Accept signatures from the current or any previous secret
+	signed := false
+	for _, key := range getSessionKeys() {
+		if hmac.Equal([]byte(signature), []byte(signSession(key, payload))) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return "", false
+	}
+
+	expiresStr, id, ok := strings.Cut(payload, "-")
+	if !ok || id == "" {
+		return "", false
+	}
+	expiresAt, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return "", false
+	}
+	return id, true
+}
+
+// HasValidSession checks if the request carries a valid, unexpired session cookie whose
+// session hasn't been logged out of
+func HasValidSession(r *http.Request) bool {
+	id, ok := sessionID(r)
+	if !ok {
+		return false
+	}
+
+	active, err := sessionStore.Active(id)
+	if err != nil {
+		log.Printf("Warning: failed to check web session: %v", err)
+		return false
+	}
+	return active
+}
+
+// WebAuth protects web UI routes.
+// When WEB_PASSWORD is set, a valid session cookie (or API key header) is required;
+// otherwise it falls back to API key authentication.
+func WebAuth(next http.Handler) http.Handler {
+	apiKeyAuth := APIKeyAuth(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !WebPasswordEnabled() {
+			apiKeyAuth.ServeHTTP(w, r)
+			return
+		}
+
+		if HasValidSession(r) {
+			next.ServeHTTP(w, withActor(r, "web_session"))
+			return
+		}
+
+		if r.Header.Get("X-API-Key") != "" {
+			apiKeyAuth.ServeHTTP(w, r)
+			return
+		}
+
+		// Tell HTMX to send the browser to the login page
+		w.Header().Set("HX-Redirect", "/web/login")
+		http.Error(w, "Login required", http.StatusUnauthorized)
+	})
+}
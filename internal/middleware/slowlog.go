@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// SlowRequestLog logs a warning for every request that takes longer than threshold,
+// with its route, method, status and bytes written, to surface slow storage or large transfers.
+// A threshold of 0 or less disables slow request logging.
+func SlowRequestLog(threshold time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if threshold <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			defer func() {
+				duration := time.Since(start)
+				if duration < threshold {
+					return
+				}
+
+				// The route pattern is only known once chi has routed the request
+				route := r.URL.Path
+				if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+					route = rctx.RoutePattern()
+				}
+
+				slog.Warn("slow request",
+					"method", r.Method,
+					"route", route,
+					"path", r.URL.Path,
+					"status", ww.Status(),
+					"bytes", ww.BytesWritten(),
+					"duration", duration,
+					"threshold", threshold,
+				)
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
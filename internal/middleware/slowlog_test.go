@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// captureSlog sends the default logger's records to a buffer, as JSON, for the test
+func captureSlog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// slowRequestRecord holds the fields of a logged slow request checked by the test
+type slowRequestRecord struct {
+	Level  string `json:"level"`
+	Msg    string `json:"msg"`
+	Method string `json:"method"`
+	Route  string `json:"route"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Bytes  int    `json:"bytes"`
+}
+
+func TestSlowRequestLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		delay     time.Duration // Time the handler takes
+		wantLog   bool
+	}{
+		{"slow", 10 * time.Millisecond, 30 * time.Millisecond, true},
+		{"fast", time.Second, 0, false},
+		{"disabled", 0, 30 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureSlog(t)
+			r := chi.NewRouter()
+			r.Use(SlowRequestLog(tt.threshold))
+			r.Get("/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.delay)
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("slow body"))
+			})
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/files/42", nil))
+
+			if (logs.Len() > 0) != tt.wantLog {
+				t.Fatalf("logged %q, want logged: %v", logs.String(), tt.wantLog)
+			}
+			if !tt.wantLog {
+				return
+			}
+
+			var record slowRequestRecord
+			if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+				t.Fatalf("parsing log record %q: %v", logs.String(), err)
+			}
+			want := slowRequestRecord{"WARN", "slow request", http.MethodGet, "/files/{id}", "/files/42", http.StatusTeapot, len("slow body")}
+			if record != want {
+				t.Errorf("logged %+v, want %+v", record, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yorukot/sharing/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans enables tracing with an exporter that is never reached, and records the
+// spans in memory instead
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	previous := otel.GetTracerProvider()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:4318")
+	if err := tracing.Init(context.Background(), "test"); err != nil {
+		t.Fatalf("tracing.Init: %v", err)
+	}
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		provider.Shutdown(context.Background())
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// spanAttribute returns the value of a span's attribute, or an empty value
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := recordSpans(t)
+
+	const parentTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name        string
+		target      string
+		traceparent string
+		wantName    string
+		wantStatus  int
+		wantError   bool
+	}{
+		{"matched route", "/d/report.pdf", "", "GET /d/{filename}", http.StatusOK, false},
+		{"client trace continued", "/d/report.pdf", "00-" + parentTraceID + "-00f067aa0ba902b7-01", "GET /d/{filename}", http.StatusOK, false},
+		{"handler failure", "/fail", "", "GET /fail", http.StatusInternalServerError, true},
+		{"client error", "/d/missing.pdf", "", "GET /d/{filename}", http.StatusNotFound, false},
+		{"no matched route", "/nowhere/else", "", "GET", http.StatusNotFound, false},
+	}
+
+	r := chi.NewRouter()
+	r.Use(Tracing)
+	r.Get("/d/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "filename") == "missing.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("content"))
+	})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "failed", http.StatusInternalServerError)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			spans := recorder.Ended()
+			if len(spans) != before+1 {
+				t.Fatalf("%d spans ended, want 1", len(spans)-before)
+			}
+			span := spans[before]
+			if span.Name() != tt.wantName {
+				t.Errorf("span name = %q, want %q", span.Name(), tt.wantName)
+			}
+			if span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("span kind = %v, want server", span.SpanKind())
+			}
+			if got := spanAttribute(span, "http.response.status_code").AsInt64(); got != int64(tt.wantStatus) {
+				t.Errorf("status code attribute = %d, want %d", got, tt.wantStatus)
+			}
+			if got := span.Status().Code == codes.Error; got != tt.wantError {
+				t.Errorf("span marked failed = %v, want %v", got, tt.wantError)
+			}
+			if tt.traceparent != "" && span.SpanContext().TraceID().String() != parentTraceID {
+				t.Errorf("trace ID = %s, want the client's %s", span.SpanContext().TraceID(), parentTraceID)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogImmutable is returned when an audit log entry would be changed or deleted
+var ErrAuditLogImmutable = errors.New("audit log entries cannot be modified")
+
+// AuditLog records a management action (upload, update, delete, ...) for compliance.
+// Entries are append-only: updates and deletes through GORM are refused.
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	Actor    string                 `gorm:"index;not null" json:"actor"`             // API key fingerprint or web session (never the key itself)
+	Action   string                 `gorm:"index;not null" json:"action"`            // What was done (e.g., "file.delete")
+	Method   string                 `gorm:"not null" json:"method"`                  // HTTP method of the request
+	Path     string                 `gorm:"not null" json:"path"`                    // Request path
+	TargetID *uint                  `gorm:"index" json:"target_id,omitempty"`        // File or report acted on (nullable)
+	Params   map[string]interface{} `gorm:"serializer:json" json:"params,omitempty"` // Request parameters, secrets redacted
+	Status   int                    `gorm:"not null" json:"status"`                  // HTTP status of the response
+	RemoteIP string                 `json:"remote_ip"`                               // Client IP address
+}
+
+// BeforeUpdate keeps audit log entries from being changed
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete keeps audit log entries from being deleted
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// Download records a single public download of a file (used for time-bucketed stats).
+// Entries form a hash chain, so edits and deletions are detectable.
+type Download struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	FileID    uint      `gorm:"index:idx_downloads_file_created;not null" json:"file_id"` // Downloaded file
+	CreatedAt time.Time `gorm:"index:idx_downloads_file_created" json:"created_at"`       // Time the download was served
+
+	PrevHash string `gorm:"not null;default:''" json:"prev_hash"` // Hash of the previous entry ("" for the first)
+	Hash     string `gorm:"not null;default:''" json:"hash"`      // SHA-256 of PrevHash and this entry's fields
+}
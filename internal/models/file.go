@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -11,21 +12,81 @@ type File struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index;uniqueIndex:idx_slug_deleted;uniqueIndex:idx_filename_deleted" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index;uniqueIndex:idx_domain_slug_deleted;uniqueIndex:idx_filename_deleted" json:"-"`
 
 	// File metadata
 	Filename     string `gorm:"uniqueIndex:idx_filename_deleted;not null" json:"filename"` // Unique stored filename
-	OriginalName string `gorm:"not null" json:"original_name"`                             // Original uploaded filename
+	OriginalName string `gorm:"not null" json:"original_name"`                             // Original uploaded filename (unique per domain among active files)
 	FilePath     string `gorm:"not null" json:"-"`                                         // Full path on disk
 	FileSize     int64  `gorm:"not null" json:"file_size"`                                 // Size in bytes
 	ContentType  string `gorm:"not null" json:"content_type"`                              // MIME type
 
-	// Short link / slug for public sharing
-	Slug string `gorm:"uniqueIndex:idx_slug_deleted;not null" json:"slug"` // URL-safe short link (e.g., "demo-file")
+	// Storage backend holding the content, e.g. "s3" (STORAGE_BACKENDS; empty = the primary,
+	// which files stored before backends were named are on)
+	StorageBackend string `gorm:"not null;default:''" json:"storage_backend,omitempty"`
+
+	// Content-type detection (kept so declared/sniffed mismatches can be audited)
+	DeclaredContentType string `json:"declared_content_type"`     // MIME type sent by the client
+	SniffedContentType  string `json:"sniffed_content_type"`      // MIME type detected from the content
+	ContentHash         string `gorm:"index" json:"content_hash"` // Hex SHA-256 of the content
+
+	// Short link / slug for public sharing (unique within the file's domain)
+	Slug   string `gorm:"uniqueIndex:idx_domain_slug_deleted;not null" json:"slug"`                        // URL-safe short link (e.g., "demo-file")
+	Domain string `gorm:"uniqueIndex:idx_domain_slug_deleted;not null;default:''" json:"domain,omitempty"` // Custom domain serving the link (empty = default host)
 
 	// Security and access control
 	PasswordHash *string    `json:"-"`                                 // Bcrypt hash (nullable)
+	AccessTokens []string   `gorm:"serializer:json" json:"-"`          // SHA-256 hashes of the tokens allowed to download (empty = anyone)
 	ExpiresAt    *time.Time `gorm:"index" json:"expires_at,omitempty"` // Expiration time (nullable)
+
+	// Relative expiry: when set, ExpiresAt is filled in on the first public download
+	ExpiresAfterFirstDownload *time.Duration `json:"expires_after_first_download,omitempty"` // Duration in nanoseconds (nullable)
+
+	// Retention lock: the file cannot be deleted or modified before this time
+	LockedUntil *time.Time `gorm:"index" json:"locked_until,omitempty"` // Lock end time (nullable)
+
+	// Client-side encryption: opaque JSON (e.g., algorithm, IV, wrapped key) stored for a
+	// companion decryptor and never interpreted by the server
+	ClientMetadata json.RawMessage `gorm:"type:text" json:"client_metadata,omitempty"`
+
+	// Pastes: text snippets rendered on the share page instead of downloaded
+	Language string `json:"language,omitempty"` // Syntax language (empty for regular files)
+
+	// Analytics
+	DownloadCount int64  `gorm:"not null;default:0" json:"download_count"` // Public downloads served
+	MaxDownloads  *int64 `json:"max_downloads,omitempty"`                  // Download limit (nil = unlimited)
+
+	// Original upload time: kept from the source system by imports and migrations (CreatedAt is
+	// the time the record was created here). Equal to CreatedAt for regular uploads.
+	OriginalUploadedAt time.Time `gorm:"index" json:"original_uploaded_at"`
+
+	// Live uploads: the content is still being written and can be downloaded as it grows
+	InProgress bool `gorm:"not null;default:false" json:"in_progress,omitempty"`
+
+	// Moderation: disabled files are not served on public routes
+	DisabledAt *time.Time `json:"disabled_at,omitempty"` // Time the file was disabled (nullable)
+}
+
+// In returns a copy of the file with its timestamps in loc, for display.
+// The file itself (and what is stored) is unchanged.
+func (f *File) In(loc *time.Location) *File {
+	c := *f
+	c.CreatedAt = f.CreatedAt.In(loc)
+	c.UpdatedAt = f.UpdatedAt.In(loc)
+	c.OriginalUploadedAt = f.OriginalUploadedAt.In(loc)
+	c.ExpiresAt = timeIn(f.ExpiresAt, loc)
+	c.LockedUntil = timeIn(f.LockedUntil, loc)
+	c.DisabledAt = timeIn(f.DisabledAt, loc)
+	return &c
+}
+
+// timeIn converts an optional time to loc
+func timeIn(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
 }
 
 // IsExpired checks if the file has expired
@@ -40,3 +101,31 @@ func (f *File) IsExpired() bool {
 func (f *File) HasPassword() bool {
 	return f.PasswordHash != nil && *f.PasswordHash != ""
 }
+
+// HasAccessList checks if downloads are restricted to listed access tokens
+func (f *File) HasAccessList() bool {
+	return len(f.AccessTokens) > 0
+}
+
+// HasPendingExpiry checks if the file expires relative to a first download that hasn't happened yet
+func (f *File) HasPendingExpiry() bool {
+	return f.ExpiresAt == nil && f.ExpiresAfterFirstDownload != nil
+}
+
+// IsDisabled checks if the file has been disabled by moderation
+func (f *File) IsDisabled() bool {
+	return f.DisabledAt != nil
+}
+
+// IsPaste checks if the file is a text snippet created with the paste endpoint
+func (f *File) IsPaste() bool {
+	return f.Language != ""
+}
+
+// IsLocked checks if the file is within its retention lock window
+func (f *File) IsLocked() bool {
+	if f.LockedUntil == nil {
+		return false
+	}
+	return time.Now().Before(*f.LockedUntil)
+}
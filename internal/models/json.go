@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JSONTimePrecision is the precision of timestamps in API responses: whole seconds
+// (plain RFC3339, which strict clients expect) unless set to time.Nanosecond for
+// fractional seconds (API_TIME_FORMAT=rfc3339nano). Set it before serving requests.
+var JSONTimePrecision = time.Second
+
+// JSONTime rounds t down to the precision of API responses
+func JSONTime(t time.Time) time.Time {
+	return t.Truncate(JSONTimePrecision)
+}
+
+// JSONTimePtr rounds an optional time down to the precision of API responses
+func JSONTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	rounded := JSONTime(*t)
+	return &rounded
+}
+
+// MarshalJSON encodes the file with its timestamps at the precision of API responses
+func (f File) MarshalJSON() ([]byte, error) {
+	type file File // Same fields, without this method
+	c := file(f)
+	c.CreatedAt = JSONTime(f.CreatedAt)
+	c.UpdatedAt = JSONTime(f.UpdatedAt)
+	c.OriginalUploadedAt = JSONTime(f.OriginalUploadedAt)
+	c.ExpiresAt = JSONTimePtr(f.ExpiresAt)
+	c.LockedUntil = JSONTimePtr(f.LockedUntil)
+	c.DisabledAt = JSONTimePtr(f.DisabledAt)
+	return json.Marshal(c)
+}
+
+// MarshalJSON encodes the report with its timestamps at the precision of API responses
+func (r Report) MarshalJSON() ([]byte, error) {
+	type report Report // Same fields, without this method
+	c := report(r)
+	c.CreatedAt = JSONTime(r.CreatedAt)
+	c.UpdatedAt = JSONTime(r.UpdatedAt)
+	return json.Marshal(c)
+}
+
+// MarshalJSON encodes the audit log entry with its timestamp at the precision of API responses
+func (a AuditLog) MarshalJSON() ([]byte, error) {
+	type auditLog AuditLog // Same fields, without this method
+	c := auditLog(a)
+	c.CreatedAt = JSONTime(a.CreatedAt)
+	return json.Marshal(c)
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFileMarshalJSONTimePrecision(t *testing.T) {
+	created := time.Date(2026, 5, 1, 10, 30, 15, 123456789, time.UTC)
+	expires := created.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		precision   time.Duration
+		file        File
+		wantCreated string
+		wantExpires string // Empty if expires_at must be omitted
+	}{
+		{"whole seconds", time.Second, File{CreatedAt: created, ExpiresAt: &expires}, "2026-05-01T10:30:15Z", "2026-05-01T11:30:15Z"},
+		{"nanoseconds", time.Nanosecond, File{CreatedAt: created, ExpiresAt: &expires}, "2026-05-01T10:30:15.123456789Z", "2026-05-01T11:30:15.123456789Z"},
+		{"rounded down, not to the nearest second", time.Second, File{CreatedAt: created.Add(400 * time.Millisecond)}, "2026-05-01T10:30:15Z", ""},
+		{"zone kept", time.Second, File{CreatedAt: created.In(time.FixedZone("JST", 9*60*60))}, "2026-05-01T19:30:15+09:00", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := JSONTimePrecision
+			JSONTimePrecision = tt.precision
+			t.Cleanup(func() { JSONTimePrecision = previous })
+
+			data, err := json.Marshal(tt.file)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			if got["created_at"] != tt.wantCreated {
+				t.Errorf("created_at = %v, want %s", got["created_at"], tt.wantCreated)
+			}
+			expiresAt, hasExpiry := got["expires_at"]
+			if tt.wantExpires == "" {
+				if hasExpiry {
+					t.Errorf("expires_at = %v, want it omitted", expiresAt)
+				}
+			} else if expiresAt != tt.wantExpires {
+				t.Errorf("expires_at = %v, want %s", expiresAt, tt.wantExpires)
+			}
+			if tt.file.ExpiresAt != nil && !tt.file.ExpiresAt.Equal(expires) {
+				t.Error("marshalling changed the file's own expiry")
+			}
+		})
+	}
+}
+
+func TestJSONTimePtr(t *testing.T) {
+	moment := time.Date(2026, 5, 1, 10, 30, 15, 999999999, time.UTC)
+
+	tests := []struct {
+		name string
+		in   *time.Time
+		want *time.Time
+	}{
+		{"nil", nil, nil},
+		{"truncated", &moment, ptrTime(time.Date(2026, 5, 1, 10, 30, 15, 0, time.UTC))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := JSONTimePtr(tt.in)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Fatalf("JSONTimePtr = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ptrTime returns a pointer to t
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
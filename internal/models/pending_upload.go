@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// PendingUpload is a direct-to-storage upload that has been presigned but not yet registered as a file
+type PendingUpload struct {
+	ID          uint      `gorm:"primarykey" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	Key         string    `gorm:"uniqueIndex;not null" json:"key"`  // Storage key the client uploads to
+	Filename    string    `gorm:"not null" json:"filename"`         // Original filename
+	ContentType string    `gorm:"not null" json:"content_type"`     // Content type the URL was signed for
+	Size        int64     `gorm:"not null" json:"size"`             // Exact size in bytes the URL was signed for
+	ExpiresAt   time.Time `gorm:"index;not null" json:"expires_at"` // When the presigned URL stops working
+
+	StorageBackend string `gorm:"not null;default:''" json:"-"` // Backend the object is stored on (empty = the primary)
+}
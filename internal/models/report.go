@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Report statuses
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+// Report represents an abuse report filed against a shared file
+type Report struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	FileID     uint   `gorm:"index;not null" json:"file_id"`             // Reported file
+	Slug       string `gorm:"not null" json:"slug"`                      // Slug the report was filed against
+	Reason     string `json:"reason"`                                    // Free-text reason from the reporter
+	ReporterIP string `json:"reporter_ip"`                               // Reporter's IP address
+	Status     string `gorm:"index;not null;default:open" json:"status"` // open, resolved, or dismissed
+}
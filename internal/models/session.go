@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// WebSession is a signed-in web UI session. Its cookie is only accepted while the row
+// exists, so logging out revokes the cookie even if it was copied.
+type WebSession struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	TokenHash string    `gorm:"uniqueIndex;not null" json:"-"`    // SHA-256 of the session id in the cookie
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"` // When the cookie expires
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SlugHistory records a slug a file was shared under before it was renamed, so old
+// share links redirect to the current one. Entries are removed with the file.
+type SlugHistory struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"` // When the file was renamed away from the slug
+
+	FileID uint   `gorm:"index;not null" json:"file_id"`
+	Domain string `gorm:"uniqueIndex:idx_slug_history_domain_slug;not null;default:''" json:"domain"`
+	Slug   string `gorm:"uniqueIndex:idx_slug_history_domain_slug;not null" json:"slug"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Transfer records the bytes of file content one download request actually delivered,
+// for billing by bytes served (TRANSFER_ACCOUNTING). Range requests count the bytes of
+// their range, and interrupted downloads only what was sent before the client went away.
+type Transfer struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"` // When the download ended (UTC)
+
+	FileID   uint   `gorm:"index;not null" json:"file_id"`
+	Client   string `gorm:"index;not null" json:"client"` // "api_key:<fingerprint>", "web_session", or "ip:<address>"
+	Bytes    int64  `gorm:"not null" json:"bytes"`
+	Complete bool   `gorm:"not null" json:"complete"` // The whole response was sent
+}
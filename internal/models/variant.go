@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ImageVariant is a cached transcoded or resized copy of an image file (e.g., WebP, or a
+// JPEG at 800px wide), made on the first download that asks for it. It belongs to the
+// content it was made from, so replacing the file's content makes it stale.
+type ImageVariant struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	FileID      uint   `gorm:"uniqueIndex:idx_variant_file_format_resize;not null" json:"file_id"`
+	Format      string `gorm:"uniqueIndex:idx_variant_file_format_resize;not null" json:"format"`            // e.g., "webp"
+	Resize      string `gorm:"uniqueIndex:idx_variant_file_format_resize;not null;default:''" json:"resize"` // e.g., "800x600-cover" ("" = full size)
+	ContentHash string `gorm:"not null" json:"content_hash"`                                                 // Hash of the source content it was made from
+	FilePath    string `json:"-"`                                                                            // Storage path ("" = no better than the original, serve it instead)
+	FileSize    int64  `gorm:"not null;default:0" json:"file_size"`                                          // Size in bytes
+}
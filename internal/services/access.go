@@ -0,0 +1,88 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+var (
+	ErrAccessDenied        = errors.New("access denied")
+	ErrInvalidAccessTokens = errors.New("invalid access tokens")
+)
+
+const (
+	maxAccessTokens      = 100 // Most tokens in one file's access list
+	maxAccessTokenLength = 256 // Longest accepted access token, in bytes
+)
+
+// hashAccessTokens validates an access list (tokens or e.g. email addresses) and returns
+// the SHA-256 hashes to store, or nil for an empty list. Tokens are trimmed, and blank
+// or repeated tokens are dropped.
+func hashAccessTokens(tokens []string) ([]string, error) {
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		if len(token) > maxAccessTokenLength {
+			return nil, ErrInvalidAccessTokens
+		}
+
+		hash := hashAccessToken(token)
+		if !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	if len(hashes) > maxAccessTokens {
+		return nil, ErrInvalidAccessTokens
+	}
+	return hashes, nil
+}
+
+// hashAccessToken returns the hex SHA-256 of an access token
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// accessTokensColumn returns the stored value of an access list (nil clears it)
+func accessTokensColumn(hashes []string) (interface{}, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// ValidateAccessToken checks a presented token against the file's access list.
+// Files without an access list can be downloaded by anyone.
+func (s *FileService) ValidateAccessToken(file *models.File, token string) error {
+	if !file.HasAccessList() {
+		return nil
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ErrAccessDenied
+	}
+
+	hash := []byte(hashAccessToken(token))
+	for _, allowed := range file.AccessTokens {
+		if subtle.ConstantTimeCompare(hash, []byte(allowed)) == 1 {
+			return nil
+		}
+	}
+	return ErrAccessDenied
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSaveAccessTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokens     []string
+		wantErr    error
+		wantHashes int
+	}{
+		{"no access list", nil, nil, 0},
+		{"tokens", []string{"alice@example.com", "bob@example.com"}, nil, 2},
+		{"blank and repeated tokens dropped", []string{"alice", " ", "alice", " alice "}, nil, 1},
+		{"at the token limit", distinctTokens(maxAccessTokens), nil, maxAccessTokens},
+		{"over the token limit", distinctTokens(maxAccessTokens + 1), ErrInvalidAccessTokens, 0},
+		{"token too long", []string{strings.Repeat("x", maxAccessTokenLength+1)}, ErrInvalidAccessTokens, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file, err := s.SaveFileFromReader("notes.txt", "", bytesOf("notes"), SaveOptions{AccessTokens: tt.tokens})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			stored, err := s.GetFile(file.ID)
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			if len(stored.AccessTokens) != tt.wantHashes {
+				t.Fatalf("%d tokens stored, want %d", len(stored.AccessTokens), tt.wantHashes)
+			}
+			for _, token := range tt.tokens {
+				if slices.Contains(stored.AccessTokens, strings.TrimSpace(token)) {
+					t.Fatalf("token %q stored in plain text", token)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAccessToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  []string
+		token   string
+		wantErr error
+	}{
+		{"no access list", nil, "", nil},
+		{"no access list with a token", nil, "anything", nil},
+		{"listed token", []string{"alice", "bob"}, "bob", nil},
+		{"listed token with spaces", []string{"alice"}, " alice ", nil},
+		{"unlisted token", []string{"alice"}, "mallory", ErrAccessDenied},
+		{"missing token", []string{"alice"}, "", ErrAccessDenied},
+		{"token hash", []string{"alice"}, hashAccessToken("alice"), ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{AccessTokens: tt.tokens})
+			if err := s.ValidateAccessToken(file, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateAccessToken(%q) = %v, want %v", tt.token, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateAccessTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     *[]string
+		wantErr    error
+		wantListed bool // Whether the update leaves an access list
+	}{
+		{"unchanged", nil, nil, true},
+		{"replaced", &[]string{"bob"}, nil, true},
+		{"removed", &[]string{}, nil, false},
+		{"invalid", &[]string{strings.Repeat("x", maxAccessTokenLength+1)}, ErrInvalidAccessTokens, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{AccessTokens: []string{"alice"}})
+
+			_, err := s.UpdateFile(file.ID, UpdateOptions{AccessTokens: tt.update})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateFile error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, err := s.GetFile(file.ID)
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			if stored.HasAccessList() != tt.wantListed {
+				t.Fatalf("has access list = %v, want %v", stored.HasAccessList(), tt.wantListed)
+			}
+			if tt.update != nil && len(*tt.update) > 0 && tt.wantErr == nil {
+				if err := s.ValidateAccessToken(stored, "alice"); !errors.Is(err, ErrAccessDenied) {
+					t.Fatalf("replaced token still accepted: %v", err)
+				}
+				if err := s.ValidateAccessToken(stored, (*tt.update)[0]); err != nil {
+					t.Fatalf("new token rejected: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// distinctTokens returns n distinct tokens
+func distinctTokens(n int) []string {
+	tokens := make([]string, n)
+	for i := range tokens {
+		tokens[i] = strings.Repeat("t", i+1)
+	}
+	return tokens
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// accessLogMu serializes appends to the download access log, so every entry is chained
+// to the one before it (concurrent appends would both link to the same predecessor)
+var accessLogMu sync.Mutex
+
+// errChainBroken stops walking the access log at the first break
+var errChainBroken = errors.New("access log chain broken")
+
+// accessLogBatchSize is how many entries VerifyAccessLog loads at a time
+const accessLogBatchSize = 1000
+
+// AccessLogVerification is the result of walking the download access log's hash chain
+type AccessLogVerification struct {
+	Valid     bool      `json:"valid"`
+	Entries   int64     `json:"entries"`             // Entries checked (up to the break, if any)
+	Unchained int64     `json:"unchained"`           // Entries logged before the chain existed
+	Head      string    `json:"head,omitempty"`      // Hash of the last entry, to anchor elsewhere
+	BrokenAt  uint      `json:"broken_at,omitempty"` // ID of the first entry that doesn't fit the chain
+	Reason    string    `json:"reason,omitempty"`    // Why it doesn't fit
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// accessLogHash chains an entry to its predecessor: the SHA-256 of the previous entry's
+// hash and this entry's ID, file, and time
+func accessLogHash(prevHash string, entry *models.Download) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%s",
+		prevHash, entry.ID, entry.FileID, entry.CreatedAt.UTC().Format(time.RFC3339Nano))))
+	return hex.EncodeToString(sum[:])
+}
+
+// appendAccessLog logs a download in tx, chained to the latest entry.
+// Callers must hold accessLogMu until tx commits.
+func appendAccessLog(tx *gorm.DB, fileID uint) error {
+	var prevHash string
+	if err := tx.Model(&models.Download{}).Order("id DESC").Limit(1).Pluck("hash", &prevHash).Error; err != nil {
+		return err
+	}
+
+	// Stored in UTC so range queries compare as text
+	entry := &models.Download{FileID: fileID, CreatedAt: time.Now().UTC(), PrevHash: prevHash}
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	return tx.Model(entry).UpdateColumn("hash", accessLogHash(prevHash, entry)).Error
+}
+
+// VerifyAccessLog walks the download access log in order and checks that every entry
+// links to its predecessor and matches its own hash, so edited, inserted, or deleted
+// entries are detected. Entries logged before the chain was introduced are skipped;
+// removing entries from the end can only be detected by comparing Head with a copy.
+func (s *FileService) VerifyAccessLog() (*AccessLogVerification, error) {
+	result := &AccessLogVerification{Valid: true}
+	prevHash := ""
+	chained := false
+
+	var batch []models.Download
+	err := database.DB.Order("id").FindInBatches(&batch, accessLogBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			result.Entries++
+
+			if !chained && entry.Hash == "" && entry.PrevHash == "" {
+				result.Unchained++
+				continue
+			}
+			chained = true
+
+			switch {
+			case entry.PrevHash != prevHash:
+				result.Reason = "previous hash does not match the preceding entry (entries missing or inserted)"
+			case entry.Hash != accessLogHash(prevHash, entry):
+				result.Reason = "hash does not match the entry (entry altered)"
+			default:
+				prevHash = entry.Hash
+				continue
+			}
+			result.Valid = false
+			result.BrokenAt = entry.ID
+			return errChainBroken
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errChainBroken) {
+		return nil, fmt.Errorf("failed to read access log: %w", err)
+	}
+
+	if result.Valid {
+		result.Head = prevHash
+	}
+	result.CheckedAt = models.JSONTime(time.Now())
+	return result, nil
+}
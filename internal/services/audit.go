@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+const (
+	defaultAuditLimit = 100  // Entries returned when no limit is given
+	maxAuditLimit     = 1000 // Most entries returned at once
+)
+
+// AuditFilter narrows an audit log listing (zero values match everything)
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	TargetID *uint
+	Since    *time.Time
+	Until    *time.Time
+	BeforeID uint // Only entries older than this one, to page backwards
+	Limit    int  // Most entries to return (default 100, max 1000)
+}
+
+// AuditService records and lists management actions
+type AuditService struct{}
+
+// NewAuditService creates a new audit service instance
+func NewAuditService() *AuditService {
+	return &AuditService{}
+}
+
+// Record appends an entry to the audit log
+func (s *AuditService) Record(entry *models.AuditLog) error {
+	entry.CreatedAt = time.Now().UTC()
+	if err := database.DB.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns the audit log entries matching the filter, newest first
+func (s *AuditService) List(filter AuditFilter) ([]models.AuditLog, error) {
+	query := database.DB.Order("id DESC")
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", filter.Until.UTC())
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	var entries []models.AuditLog
+	if err := query.Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
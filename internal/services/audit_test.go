@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+func TestAuditLogIsImmutable(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(entry *models.AuditLog) error
+		wantErr error // Expected error, or nil for any error
+	}{
+		{"update through GORM", func(entry *models.AuditLog) error {
+			return database.DB.Model(entry).Update("actor", "someone else").Error
+		}, models.ErrAuditLogImmutable},
+		{"delete through GORM", func(entry *models.AuditLog) error {
+			return database.DB.Delete(entry).Error
+		}, models.ErrAuditLogImmutable},
+		{"update in SQL", func(entry *models.AuditLog) error {
+			return database.DB.Exec("UPDATE audit_logs SET actor = ? WHERE id = ?", "someone else", entry.ID).Error
+		}, nil},
+		{"delete in SQL", func(entry *models.AuditLog) error {
+			return database.DB.Exec("DELETE FROM audit_logs WHERE id = ?", entry.ID).Error
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDatabase(t)
+			audit := NewAuditService()
+			entry := &models.AuditLog{Actor: "web_session", Action: "file.delete", Method: "DELETE", Path: "/api/files/1", Status: 200}
+			if err := audit.Record(entry); err != nil {
+				t.Fatalf("Record: %v", err)
+			}
+
+			err := tt.change(entry)
+			if err == nil {
+				t.Fatal("audit log entry was changed")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			entries, err := audit.List(AuditFilter{})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Actor != "web_session" {
+				t.Fatalf("audit log after the attempt = %+v, want the original entry", entries)
+			}
+		})
+	}
+}
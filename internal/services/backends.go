@@ -0,0 +1,51 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+// ErrUnknownStorage is returned when an upload chooses a storage backend that isn't configured
+var ErrUnknownStorage = errors.New("unknown storage backend")
+
+// resolveBackend returns the name of the storage backend an upload chooses (STORAGE_BACKENDS),
+// or that of the primary if none is chosen
+func (s *FileService) resolveBackend(name string) (string, error) {
+	resolved, err := s.backends.Resolve(strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		return "", fmt.Errorf("%w %q (configured: %s)", ErrUnknownStorage, name, strings.Join(s.backends.Names(), ", "))
+	}
+	return resolved, nil
+}
+
+// storageFor returns the storage backend with the given name ("" for the primary), which
+// a file's content is read from and deleted on
+func (s *FileService) storageFor(backend string) storage.Storage {
+	return s.backends.For(backend)
+}
+
+// backendName returns the name of a file's storage backend, which is "" for files stored
+// on the primary before backends were named
+func (s *FileService) backendName(backend string) string {
+	if backend == "" {
+		return s.backends.PrimaryName()
+	}
+	return backend
+}
+
+// sameBackend reports whether two backend names refer to the same backend
+func (s *FileService) sameBackend(a, b string) bool {
+	return s.backendName(a) == s.backendName(b)
+}
+
+// backendAliases returns the names files on a backend may be recorded with: its own, and
+// "" for the primary
+func (s *FileService) backendAliases(backend string) []string {
+	if backend = s.backendName(backend); backend == s.backends.PrimaryName() {
+		return []string{backend, ""}
+	}
+	return []string{backend}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+func TestSaveChoosesStorageBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		choice      string
+		wantBackend string
+		wantErr     error
+	}{
+		{"primary by default", "", "local", nil},
+		{"primary by name", "local", "local", nil},
+		{"other backend", "archive", "archive", nil},
+		{"name normalized", " Archive ", "archive", nil},
+		{"unknown backend", "gcs", "", ErrUnknownStorage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newTestDatabase(t)
+			archive, err := storage.NewLocalStorage(t.TempDir(), 0)
+			if err != nil {
+				t.Fatalf("NewLocalStorage: %v", err)
+			}
+			registry := storage.NewRegistry("local")
+			registry.Register("local", local)
+			registry.Register("archive", archive)
+			backends := map[string]*storage.LocalStorage{"local": local, "archive": archive}
+			s := newTestServiceWith(t, registry)
+
+			file, err := s.SaveFileFromReader("notes.txt", "", bytesOf("notes"), SaveOptions{Storage: tt.choice})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if file.StorageBackend != tt.wantBackend {
+				t.Fatalf("stored on %q, want %q", file.StorageBackend, tt.wantBackend)
+			}
+
+			// The content is only on the chosen backend, and is read and deleted there.
+			// Stored paths are absolute, so each backend is asked for the name in its directory.
+			key := filepath.Base(file.FilePath)
+			for name, backend := range backends {
+				exists, err := backend.Exists(key)
+				if err != nil {
+					t.Fatalf("Exists on %s: %v", name, err)
+				}
+				if exists != (name == tt.wantBackend) {
+					t.Fatalf("content on %s = %v, want it only on %s", name, exists, tt.wantBackend)
+				}
+			}
+			if got := string(readContent(t, s, file)); got != "notes" {
+				t.Fatalf("read %q, want the uploaded content", got)
+			}
+			if err := s.DeleteFile(file.ID); err != nil {
+				t.Fatalf("DeleteFile: %v", err)
+			}
+			if exists, _ := backends[tt.wantBackend].Exists(key); exists {
+				t.Fatal("content left on the backend after deleting the file")
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// Per-file outcomes of a batch metadata lookup
+const (
+	BatchStatusFound    = "found"
+	BatchStatusNotFound = "not_found"
+	BatchStatusExpired  = "expired"
+)
+
+// BatchResult is the metadata of one file in a batch lookup, or why it's missing
+type BatchResult struct {
+	ID     uint         `json:"id"`
+	Status string       `json:"status"`
+	File   *models.File `json:"file,omitempty"` // Set when found
+}
+
+// GetFiles looks up several files in one query. The results follow the order of ids
+// (without duplicates); missing and expired files are reported without metadata.
+func (s *FileService) GetFiles(ids []uint) ([]BatchResult, error) {
+	if len(ids) == 0 {
+		return nil, ErrEmptySelection
+	}
+
+	files, err := selectFiles(database.DB, ids, "")
+	if err != nil {
+		return nil, err
+	}
+
+	order := selectionOrder(ids, files)
+	results := make([]BatchResult, 0, len(order))
+	for _, id := range order {
+		file, ok := files[id]
+		switch {
+		case !ok:
+			results = append(results, BatchResult{ID: id, Status: BatchStatusNotFound})
+		case file.IsExpired():
+			results = append(results, BatchResult{ID: id, Status: BatchStatusExpired})
+		default:
+			results = append(results, BatchResult{ID: id, Status: BatchStatusFound, File: file})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+func TestGetFiles(t *testing.T) {
+	s := newTestService(t)
+	first := mustSave(t, s, "first.txt", []byte("first"), SaveOptions{})
+	second := mustSave(t, s, "second.txt", []byte("second"), SaveOptions{})
+	expired := mustSave(t, s, "expired.txt", []byte("expired"), SaveOptions{})
+	if err := database.DB.Model(&models.File{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("expiring the file: %v", err)
+	}
+	deleted := mustSave(t, s, "deleted.txt", []byte("deleted"), SaveOptions{})
+	if err := s.DeleteFile(deleted.ID); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ids     []uint
+		wantErr error
+		want    []BatchResult // Found results only need the ID; the file is checked separately
+	}{
+		{"found", []uint{first.ID, second.ID}, nil, []BatchResult{
+			{ID: first.ID, Status: BatchStatusFound},
+			{ID: second.ID, Status: BatchStatusFound},
+		}},
+		{"request order", []uint{second.ID, first.ID}, nil, []BatchResult{
+			{ID: second.ID, Status: BatchStatusFound},
+			{ID: first.ID, Status: BatchStatusFound},
+		}},
+		{"mixed", []uint{999, second.ID, deleted.ID, expired.ID, first.ID}, nil, []BatchResult{
+			{ID: 999, Status: BatchStatusNotFound},
+			{ID: second.ID, Status: BatchStatusFound},
+			{ID: deleted.ID, Status: BatchStatusNotFound},
+			{ID: expired.ID, Status: BatchStatusExpired},
+			{ID: first.ID, Status: BatchStatusFound},
+		}},
+		{"duplicates", []uint{first.ID, 999, first.ID, 999}, nil, []BatchResult{
+			{ID: first.ID, Status: BatchStatusFound},
+			{ID: 999, Status: BatchStatusNotFound},
+		}},
+		{"none", nil, ErrEmptySelection, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := s.GetFiles(tt.ids)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetFiles error = %v, want %v", err, tt.wantErr)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("%d results, want %d: %+v", len(results), len(tt.want), results)
+			}
+			for i, want := range tt.want {
+				got := results[i]
+				if got.ID != want.ID || got.Status != want.Status {
+					t.Errorf("result %d = %d %s, want %d %s", i, got.ID, got.Status, want.ID, want.Status)
+				}
+				if found := want.Status == BatchStatusFound; (got.File != nil) != found || found && got.File.ID != want.ID {
+					t.Errorf("result %d file = %+v, want metadata only when found", i, got.File)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"container/list"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+const (
+	defaultFileCacheSize = 1000
+	defaultFileCacheTTL  = 30 * time.Second
+)
+
+// CacheStats reports file metadata cache usage
+type CacheStats struct {
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+	TTL      string `json:"ttl"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+}
+
+// fileCacheEntry is a cached file keyed by its lookup (see slugCacheKey and nameCacheKey)
+type fileCacheEntry struct {
+	key       string
+	file      models.File
+	expiresAt time.Time
+}
+
+// fileCache is a TTL LRU cache for slug/original name -> file metadata lookups
+type fileCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // Front = most recently used
+	entries  map[string]*list.Element
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+// newFileCache creates a cache; a capacity of 0 disables caching
+func newFileCache(capacity int, ttl time.Duration) *fileCache {
+	return &fileCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+var (
+	sharedFileCacheOnce sync.Once
+	sharedFileCache     *fileCache
+)
+
+// slugCacheKey is the cache key for a slug lookup within a domain
+func slugCacheKey(domain, slug string) string {
+	return "slug:" + domain + "/" + slug
+}
+
+// nameCacheKey is the cache key for an original-name lookup within a domain
+func nameCacheKey(domain, originalName string) string {
+	return "name:" + domain + "/" + originalName
+}
+
+// getFileCache returns the process-wide file metadata cache, shared by all FileService
+// instances so invalidation from one handler is seen by the others.
+// Configured with FILE_CACHE_SIZE (0 disables) and FILE_CACHE_TTL.
+func getFileCache() *fileCache {
+	sharedFileCacheOnce.Do(func() {
+		capacity := defaultFileCacheSize
+		if sizeStr := os.Getenv("FILE_CACHE_SIZE"); sizeStr != "" {
+			size, err := strconv.Atoi(sizeStr)
+			if err != nil || size < 0 {
+				log.Printf("Warning: invalid FILE_CACHE_SIZE value, using default (%d)", defaultFileCacheSize)
+			} else {
+				capacity = size
+			}
+		}
+
+		ttl := defaultFileCacheTTL
+		if ttlStr := os.Getenv("FILE_CACHE_TTL"); ttlStr != "" {
+			parsed, err := time.ParseDuration(ttlStr)
+			if err != nil || parsed <= 0 {
+				log.Printf("Warning: invalid FILE_CACHE_TTL value, using default (%s)", defaultFileCacheTTL)
+			} else {
+				ttl = parsed
+			}
+		}
+
+		sharedFileCache = newFileCache(capacity, ttl)
+	})
+	return sharedFileCache
+}
+
+// Get returns a copy of the cached file for a lookup key
+func (c *fileCache) Get(key string) (*models.File, bool) {
+	if c.capacity == 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := element.Value.(*fileCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits.Add(1)
+	file := entry.file
+	return &file, true
+}
+
+// Put caches a copy of a file under a lookup key.
+// Entries never outlive the file's own expiry time.
+func (c *fileCache) Put(key string, file *models.File) {
+	if c.capacity == 0 {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+	if file.ExpiresAt != nil && file.ExpiresAt.Before(expiresAt) {
+		expiresAt = *file.ExpiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &fileCacheEntry{key: key, file: *file, expiresAt: expiresAt}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&fileCacheEntry{key: key, file: *file, expiresAt: expiresAt})
+
+	// Evict the least recently used entry
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*fileCacheEntry).key)
+	}
+}
+
+// InvalidateFile removes every cached entry for a file ID (covers renamed slugs and names)
+func (c *fileCache) InvalidateFile(id uint) {
+	if c.capacity == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.entries {
+		if element.Value.(*fileCacheEntry).file.ID == id {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Stats returns current cache usage
+func (c *fileCache) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Size:     size,
+		Capacity: c.capacity,
+		TTL:      c.ttl.String(),
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+	}
+}
+
+// CacheStats returns usage statistics for the file metadata cache
+func (s *FileService) CacheStats() CacheStats {
+	return s.cache.Stats()
+}
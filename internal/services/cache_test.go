@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+func TestFileCacheCountsLookups(t *testing.T) {
+	s := newTestService(t)
+	file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{})
+
+	lookups := []struct {
+		slug       string
+		wantHits   uint64
+		wantMisses uint64
+	}{
+		{file.Slug, 0, 1}, // Loaded from the database
+		{file.Slug, 1, 1},
+		{file.Slug, 2, 1},
+		{"missing", 2, 2}, // Not found, so nothing is cached
+		{"missing", 2, 3},
+	}
+
+	for i, lookup := range lookups {
+		s.GetFileBySlug("", lookup.slug)
+		stats := s.CacheStats()
+		if stats.Hits != lookup.wantHits || stats.Misses != lookup.wantMisses {
+			t.Fatalf("after lookup %d (%s): %d hits, %d misses, want %d hits, %d misses",
+				i+1, lookup.slug, stats.Hits, stats.Misses, lookup.wantHits, lookup.wantMisses)
+		}
+	}
+	if stats := s.CacheStats(); stats.Size != 1 {
+		t.Errorf("%d cached entries, want 1", stats.Size)
+	}
+}
+
+// BenchmarkFileCache measures concurrent lookups in a full cache
+func BenchmarkFileCache(b *testing.B) {
+	c := newFileCache(defaultFileCacheSize, time.Hour)
+	keys := make([]string, defaultFileCacheSize)
+	for i := range keys {
+		keys[i] = slugCacheKey("", "file-"+strconv.Itoa(i))
+		c.Put(keys[i], &models.File{ID: uint(i + 1), Slug: "file-" + strconv.Itoa(i)})
+	}
+
+	b.Run("hit", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, ok := c.Get(keys[i%len(keys)]); !ok {
+					b.Fatal("cached entry missing")
+				}
+			}
+		})
+	})
+	b.Run("miss", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				c.Get(slugCacheKey("", "missing"))
+			}
+		})
+	})
+}
+
+func TestFileCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		capacity  int
+		expiresIn time.Duration // File expiry from when it's cached (0 = never)
+		wait      time.Duration // Time between caching and looking up
+		lookup    string        // Key to look up
+		wantHit   bool
+	}{
+		{"hit", 10, 0, 0, slugCacheKey("", "notes"), true},
+		{"miss", 10, 0, 0, slugCacheKey("", "other"), false},
+		{"other domain", 10, 0, 0, slugCacheKey("files.example.com", "notes"), false},
+		{"original name is a separate key", 10, 0, 0, nameCacheKey("", "notes"), false},
+		{"TTL passed", 10, 0, 150 * time.Millisecond, slugCacheKey("", "notes"), false},
+		{"file expiry before the TTL", 10, 20 * time.Millisecond, 50 * time.Millisecond, slugCacheKey("", "notes"), false},
+		{"file expiry after the TTL", 10, time.Hour, 50 * time.Millisecond, slugCacheKey("", "notes"), true},
+		{"disabled", 0, 0, 0, slugCacheKey("", "notes"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFileCache(tt.capacity, 100*time.Millisecond)
+			file := &models.File{ID: 1}
+			if tt.expiresIn > 0 {
+				file.ExpiresAt = ptr(time.Now().Add(tt.expiresIn))
+			}
+			c.Put(slugCacheKey("", "notes"), file)
+			time.Sleep(tt.wait)
+
+			cached, hit := c.Get(tt.lookup)
+			if hit != tt.wantHit {
+				t.Fatalf("Get(%s) hit = %v, want %v", tt.lookup, hit, tt.wantHit)
+			}
+			if hit && cached.ID != file.ID {
+				t.Errorf("cached file %d, want %d", cached.ID, file.ID)
+			}
+
+			stats := c.Stats()
+			if tt.capacity == 0 {
+				if stats.Size != 0 || stats.Hits != 0 || stats.Misses != 0 {
+					t.Errorf("disabled cache stats = %+v, want nothing counted", stats)
+				}
+				return
+			}
+			if hit && stats.Hits != 1 || !hit && stats.Misses != 1 {
+				t.Errorf("stats = %+v, want the lookup counted", stats)
+			}
+		})
+	}
+}
+
+func TestFileCacheInvalidateFile(t *testing.T) {
+	c := newFileCache(10, time.Hour)
+	notes := &models.File{ID: 1}
+	other := &models.File{ID: 2}
+	c.Put(slugCacheKey("", "notes"), notes)
+	c.Put(slugCacheKey("", "old-notes"), notes) // Slug before a rename
+	c.Put(nameCacheKey("", "notes.txt"), notes)
+	c.Put(slugCacheKey("", "other"), other)
+
+	c.InvalidateFile(notes.ID)
+
+	for _, key := range []string{slugCacheKey("", "notes"), slugCacheKey("", "old-notes"), nameCacheKey("", "notes.txt")} {
+		if _, hit := c.Get(key); hit {
+			t.Errorf("%s still cached after invalidating file %d", key, notes.ID)
+		}
+	}
+	if _, hit := c.Get(slugCacheKey("", "other")); !hit {
+		t.Error("invalidating one file removed another")
+	}
+	if size := c.Stats().Size; size != 1 {
+		t.Errorf("%d cached entries, want 1", size)
+	}
+}
+
+func TestFileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newFileCache(2, time.Hour)
+	c.Put("a", &models.File{ID: 1})
+	c.Put("b", &models.File{ID: 2})
+	c.Get("a") // b is now the least recently used
+	c.Put("c", &models.File{ID: 3})
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, hit := c.Get(key); hit != want {
+			t.Errorf("Get(%s) hit = %v, want %v", key, hit, want)
+		}
+	}
+}
+
+func TestLookupInvalidatedOnUpdate(t *testing.T) {
+	s := newTestService(t)
+	file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{})
+	if _, err := s.GetFileByOriginalName("", "notes.txt"); err != nil {
+		t.Fatalf("GetFileByOriginalName: %v", err)
+	}
+
+	if _, err := s.UpdateFile(file.ID, UpdateOptions{Disabled: ptr(true)}); err != nil {
+		t.Fatalf("UpdateFile: %v", err)
+	}
+	if _, err := s.GetFileByOriginalName("", "notes.txt"); !errors.Is(err, ErrFileDisabled) {
+		t.Fatalf("lookup after disabling = %v, want ErrFileDisabled rather than the cached file", err)
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// Storage key modes (STORAGE_MODE)
+const (
+	StorageModeUnique = "unique" // Every upload is stored under its own random key (default)
+	StorageModeCAS    = "cas"    // Content-addressed: the key is the SHA-256 of the content, shared by identical uploads
+)
+
+// casMu serializes recording and releasing references to content-addressed objects,
+// so an object can't be deleted between another upload checking that it exists and
+// recording its reference. It is never held while content is written.
+var casMu sync.Mutex
+
+// contentLocks serializes storing identical content-addressed objects, so a second
+// upload of the same content reuses the first one's object instead of rewriting it
+var contentLocks = &keyedMutex{locks: make(map[string]*keyedLock)}
+
+// lockContent holds the content-addressed storage lock (no-op in unique mode).
+// Callers must hold it from checking or releasing an object's references until the
+// database reflects the change.
+func (s *FileService) lockContent() func() {
+	if s.storageMode != StorageModeCAS {
+		return func() {}
+	}
+	casMu.Lock()
+	return casMu.Unlock
+}
+
+// storeContent stores an upload's content like saveContent and returns with the
+// content-addressed storage lock held, so the caller can record the reference before
+// calling unlock. The content is written without holding the lock; only uploads of
+// the same content wait for each other. An object reused from another file is checked
+// again under the lock, and stored anew if its last reference was released meanwhile.
+func (s *FileService) storeContent(upload *Upload, uniqueFilename, contentHash string) (storagePath, pendingKey string, unlock func(), err error) {
+	unlockHash := func() {}
+	if s.storageMode == StorageModeCAS && contentHash != "" && upload.StoredPath == "" && !upload.Live {
+		unlockHash = contentLocks.Lock(upload.Backend + "/" + contentHash)
+	}
+
+	for {
+		storagePath, pendingKey, err = s.saveContent(upload, uniqueFilename, contentHash)
+		if err != nil {
+			unlockHash()
+			return "", "", nil, err
+		}
+
+		unlockRefs := s.lockContent()
+		if s.storageMode != StorageModeCAS || pendingKey != "" || upload.StoredPath != "" {
+			return storagePath, pendingKey, func() { unlockRefs(); unlockHash() }, nil
+		}
+		if exists, err := s.storageFor(upload.Backend).Exists(storagePath); err != nil || exists {
+			return storagePath, pendingKey, func() { unlockRefs(); unlockHash() }, nil
+		}
+		unlockRefs() // Released by its last file since it was found; store it again
+	}
+}
+
+// keyedMutex is a set of mutexes by key, created on demand and dropped once unused
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	waiters int // Goroutines holding or waiting for the lock
+}
+
+// Lock locks the mutex for key and returns its unlock function
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.waiters++
+	k.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		k.mu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// saveContent stores an upload's content and returns its storage path, along with the
+// key of the pending upload that journals the object until its file record is committed
+// ("" if nothing was written). In CAS mode the object key is the content hash, and an
+// existing object with the same content (or the object of a cloned file) is reused
+// instead of being stored again; live uploads, whose content isn't known yet, keep
+// their unique key. Objects are only shared within the upload's storage backend.
+func (s *FileService) saveContent(upload *Upload, uniqueFilename, contentHash string) (string, string, error) {
+	if upload.StoredPath != "" {
+		return upload.StoredPath, upload.StoredPath, nil // Uploaded directly to storage by the client
+	}
+
+	backend := s.storageFor(upload.Backend)
+	key := uniqueFilename
+	if s.storageMode == StorageModeCAS && !upload.Live {
+		if upload.Source != nil && s.sameBackend(upload.Source.StorageBackend, upload.Backend) {
+			if exists, err := backend.Exists(upload.Source.FilePath); err == nil && exists {
+				return upload.Source.FilePath, "", nil
+			}
+		}
+		if existing := s.findContentObject(upload.Backend, contentHash); existing != "" {
+			return existing, "", nil
+		}
+		key = contentHash
+	}
+
+	// Journal the object before writing it, so a crash before the file record is
+	// committed leaves a pending upload for cleanup instead of an untracked object
+	if err := journalContent(upload, key); err != nil {
+		return "", "", err
+	}
+
+	src, err := upload.Open()
+	if err != nil {
+		database.DB.Where(&models.PendingUpload{Key: key}).Delete(&models.PendingUpload{})
+		return "", "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	storagePath, err := backend.Save(src, key, upload.Size)
+	if err != nil {
+		// A partial object may have been left behind; the journal entry stays for cleanup
+		return "", "", fmt.Errorf("failed to save file to storage: %w", err)
+	}
+	return storagePath, key, nil
+}
+
+// journalContent records an object about to be stored as a pending upload whose grace
+// period starts now. An entry left by an earlier failed write of the same key is reused.
+func journalContent(upload *Upload, key string) error {
+	pending := &models.PendingUpload{
+		Key:            key,
+		Filename:       upload.Filename,
+		ContentType:    upload.ContentType,
+		Size:           upload.Size,
+		ExpiresAt:      time.Now(),
+		StorageBackend: upload.Backend,
+	}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(pending).Error; err != nil {
+		return fmt.Errorf("failed to record pending upload: %w", err)
+	}
+	return nil
+}
+
+// journalReleased records an object that no file references anymore but that couldn't
+// be deleted as a pending upload past its grace period, so cleanup deletes it
+func journalReleased(backend, storagePath string) {
+	pending := &models.PendingUpload{
+		Key:            storagePath,
+		Filename:       path.Base(filepath.ToSlash(storagePath)),
+		ExpiresAt:      time.Now().Add(-pendingUploadGrace),
+		StorageBackend: backend,
+	}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(pending).Error; err != nil {
+		log.Printf("Warning: failed to record %s for cleanup: %v", storagePath, err)
+	}
+}
+
+// findContentObject returns the storage path of an existing content-addressed object
+// for the hash on a backend, or "" if none is referenced or it is missing from storage
+func (s *FileService) findContentObject(backend, contentHash string) string {
+	var paths []string
+	database.DB.Model(&models.File{}).
+		Where("content_hash = ? AND storage_backend IN ?", contentHash, s.backendAliases(backend)).
+		Distinct().Pluck("file_path", &paths)
+
+	for _, p := range paths {
+		if path.Base(filepath.ToSlash(p)) != contentHash {
+			continue // Stored before CAS mode was enabled
+		}
+		if exists, err := s.storageFor(backend).Exists(p); err == nil && exists {
+			return p
+		}
+	}
+	return ""
+}
+
+// discardContent releases the content stored for an upload that failed to save, and
+// its pending upload once the object is gone. If the delete fails, the pending upload
+// is kept so cleanup retries it. Objects the client uploaded directly are kept, so
+// registering them can be retried.
+func (s *FileService) discardContent(upload *Upload, storagePath, pendingKey string) {
+	if upload.StoredPath != "" || pendingKey == "" {
+		return
+	}
+	if err := s.releaseContent(upload.Backend, storagePath, 0); err != nil {
+		log.Printf("Warning: failed to delete content of failed upload %s: %v", storagePath, err)
+		return
+	}
+	database.DB.Where(&models.PendingUpload{Key: pendingKey}).Delete(&models.PendingUpload{})
+}
+
+// releaseContent deletes an object from a storage backend unless, in CAS mode, another
+// active file on the backend still references it. excludeID is the file giving up the
+// reference (0 if none).
+func (s *FileService) releaseContent(backend, storagePath string, excludeID uint) error {
+	if s.storageMode == StorageModeCAS {
+		var refs int64
+		if err := database.DB.Model(&models.File{}).
+			Where("file_path = ? AND id != ? AND storage_backend IN ?", storagePath, excludeID, s.backendAliases(backend)).
+			Count(&refs).Error; err != nil {
+			return fmt.Errorf("failed to count object references: %w", err)
+		}
+		if refs > 0 {
+			return nil
+		}
+	}
+	return s.storageFor(backend).Delete(storagePath)
+}
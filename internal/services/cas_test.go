@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+// blockingStorage is local storage whose Save of the given filenames waits for release
+type blockingStorage struct {
+	*storage.LocalStorage
+	saving  chan string   // Receives each saved filename before it is written
+	release chan struct{} // Closed to let blocked saves finish
+	block   func(filename string) bool
+}
+
+func (b *blockingStorage) Save(reader io.Reader, filename string, size int64) (string, error) {
+	if b.block(filename) {
+		b.saving <- filename
+		<-b.release
+	}
+	return b.LocalStorage.Save(reader, filename, size)
+}
+
+func TestCASStoresIdenticalContentOnce(t *testing.T) {
+	t.Setenv("STORAGE_MODE", "cas")
+	s := newTestService(t)
+
+	first := mustSave(t, s, "a.txt", []byte("shared bytes"), SaveOptions{})
+	second := mustSave(t, s, "b.txt", []byte("shared bytes"), SaveOptions{})
+	other := mustSave(t, s, "c.txt", []byte("other bytes"), SaveOptions{})
+
+	if first.ID == second.ID {
+		t.Fatal("identical uploads share a file record")
+	}
+	if first.FilePath != second.FilePath {
+		t.Fatalf("identical uploads stored at %q and %q, want one object", first.FilePath, second.FilePath)
+	}
+	if other.FilePath == first.FilePath {
+		t.Fatal("different content stored under the same object")
+	}
+}
+
+func TestCASDeleteKeepsSharedObject(t *testing.T) {
+	t.Setenv("STORAGE_MODE", "cas")
+	s := newTestService(t)
+
+	first := mustSave(t, s, "a.txt", []byte("shared bytes"), SaveOptions{})
+	second := mustSave(t, s, "b.txt", []byte("shared bytes"), SaveOptions{})
+
+	if err := s.DeleteFile(first.ID); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if got := readContent(t, s, second); string(got) != "shared bytes" {
+		t.Fatalf("remaining file reads %q after deleting the other reference", got)
+	}
+
+	if err := s.DeleteFile(second.ID); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if _, err := os.Stat(second.FilePath); !os.IsNotExist(err) {
+		t.Fatalf("object still stored after its last reference was deleted (stat: %v)", err)
+	}
+}
+
+func TestCASReusedObjectIsStoredAgainAfterRelease(t *testing.T) {
+	t.Setenv("STORAGE_MODE", "cas")
+	s := newTestService(t)
+
+	first := mustSave(t, s, "a.txt", []byte("shared bytes"), SaveOptions{})
+	if err := s.DeleteFile(first.ID); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+
+	second := mustSave(t, s, "b.txt", []byte("shared bytes"), SaveOptions{})
+	if got := readContent(t, s, second); string(got) != "shared bytes" {
+		t.Fatalf("new file reads %q, want the uploaded content", got)
+	}
+}
+
+func TestCASSaveDoesNotBlockOtherUploads(t *testing.T) {
+	t.Setenv("STORAGE_MODE", "cas")
+	sum := sha256.Sum256([]byte("slow bytes"))
+	slowHash := hex.EncodeToString(sum[:])
+	backend := &blockingStorage{
+		LocalStorage: newTestDatabase(t),
+		saving:       make(chan string, 1),
+		release:      make(chan struct{}),
+		block:        func(filename string) bool { return filename == slowHash },
+	}
+	s := newTestServiceWith(t, storage.NewSingleRegistry("local", backend))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.SaveFileFromReader("slow.txt", "", bytes.NewReader([]byte("slow bytes")), SaveOptions{})
+		done <- err
+	}()
+	<-backend.saving // The slow upload is now writing its content
+
+	fast := make(chan error, 1)
+	go func() {
+		_, err := s.SaveFileFromReader("fast.txt", "", bytes.NewReader([]byte("fast bytes")), SaveOptions{})
+		fast <- err
+	}()
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatalf("saving fast.txt: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload of other content waited for a slow save")
+	}
+
+	close(backend.release)
+	if err := <-done; err != nil {
+		t.Fatalf("saving slow.txt: %v", err)
+	}
+}
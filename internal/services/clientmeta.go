@@ -0,0 +1,39 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// maxClientMetadataSize is the largest client metadata accepted on a file, in bytes (compacted)
+const maxClientMetadataSize = 8 << 10
+
+var ErrInvalidClientMetadata = errors.New("invalid client metadata")
+
+// normalizeClientMetadata validates opaque client metadata (e.g., the algorithm, IV, and
+// wrapped key of client-side encrypted content) and returns it compacted. The server
+// never interprets it. Empty input or JSON null returns nil, meaning no metadata.
+func normalizeClientMetadata(raw json.RawMessage) (json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, raw); err != nil {
+		return nil, ErrInvalidClientMetadata
+	}
+	if compacted.Len() > maxClientMetadataSize {
+		return nil, ErrInvalidClientMetadata
+	}
+	return compacted.Bytes(), nil
+}
+
+// clientMetadataColumn returns the stored value of client metadata (nil clears it)
+func clientMetadataColumn(metadata json.RawMessage) interface{} {
+	if metadata == nil {
+		return nil
+	}
+	return []byte(metadata)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"io"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// ErrFileInProgress is returned for operations that need a file's complete content
+// while its live upload is still running
+var ErrFileInProgress = errors.New("file upload is still in progress")
+
+// CloneFile creates a new file with the content of an existing one and its own slug,
+// expiry, password, and other settings from opts. In CAS mode the clone shares the
+// stored object, which is deleted with the last file referencing it; otherwise the
+// object is copied to a new key, so either file can be deleted independently.
+// The clone keeps the source's content type (including an override) and paste language.
+func (s *FileService) CloneFile(id uint, opts SaveOptions) (*models.File, error) {
+	source, err := s.GetFile(id)
+	if err != nil {
+		return nil, err
+	}
+	if source.InProgress {
+		return nil, ErrFileInProgress
+	}
+
+	opts.Replace = false
+	opts.Language = source.Language
+
+	return s.saveUpload(&Upload{
+		Filename:    source.OriginalName,
+		ContentType: source.ContentType,
+		Size:        source.FileSize,
+		Open: func() (io.ReadCloser, error) {
+			return s.storageFor(source.StorageBackend).Get(source.FilePath)
+		},
+		Source: source,
+	}, opts)
+}
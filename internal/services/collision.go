@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// Filename collision strategies (FILENAME_COLLISION)
+const (
+	CollisionSuffixRandom  = "suffix-random"  // Append random hex, e.g. report-a3f2.pdf (default)
+	CollisionSuffixCounter = "suffix-counter" // Append the lowest free number from 2, e.g. report-2.pdf
+	CollisionReject        = "reject"         // Reject the upload, so the client can pick another name
+)
+
+// getCollisionStrategy reads how uploads whose filename is taken are named (FILENAME_COLLISION)
+func getCollisionStrategy() string {
+	strategy := strings.ToLower(os.Getenv("FILENAME_COLLISION"))
+	switch strategy {
+	case CollisionSuffixCounter, CollisionReject:
+		return strategy
+	case "", CollisionSuffixRandom:
+		return CollisionSuffixRandom
+	}
+	log.Printf("Warning: invalid FILENAME_COLLISION value, using default (%s)", CollisionSuffixRandom)
+	return CollisionSuffixRandom
+}
+
+// counterName returns originalName with the lowest free counter, e.g. report-2.pdf, or
+// report-4.pdf if report-2 and report-3 are taken. Counters freed by deleted files are
+// reused. With checkSlug, the name must also be free as a slug.
+func (s *FileService) counterName(domain, originalName string, checkSlug bool) (string, error) {
+	ext := filepath.Ext(originalName)
+	prefix := strings.TrimSuffix(originalName, ext) + "-"
+
+	// Load every taken name of the form <prefix><anything><ext> at once
+	pattern := escapeLike(prefix) + "%" + escapeLike(ext)
+	query := database.DB.Model(&models.File{}).Where("domain = ? AND deleted_at IS NULL", domain)
+	var names []string
+	if checkSlug {
+		query = query.Where("original_name LIKE ? ESCAPE '\\' OR slug LIKE ? ESCAPE '\\'", pattern, pattern)
+		var rows []struct{ OriginalName, Slug string }
+		if err := query.Select("original_name, slug").Find(&rows).Error; err != nil {
+			return "", fmt.Errorf("failed to load taken filenames: %w", err)
+		}
+		for _, row := range rows {
+			names = append(names, row.OriginalName, row.Slug)
+		}
+	} else {
+		query = query.Where("original_name LIKE ? ESCAPE '\\'", pattern)
+		if err := query.Pluck("original_name", &names).Error; err != nil {
+			return "", fmt.Errorf("failed to load taken filenames: %w", err)
+		}
+	}
+
+	taken := make(map[int]bool)
+	for _, name := range names {
+		counter, ok := strings.CutPrefix(name, prefix)
+		if !ok || !strings.HasSuffix(counter, ext) {
+			continue
+		}
+		counter = strings.TrimSuffix(counter, ext)
+		if n, err := strconv.Atoi(counter); err == nil && strconv.Itoa(n) == counter {
+			taken[n] = true
+		}
+	}
+
+	n := 2
+	for taken[n] {
+		n++
+	}
+	return fmt.Sprintf("%s%d%s", prefix, n, ext), nil
+}
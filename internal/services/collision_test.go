@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestFilenameCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		existing []string // Files uploaded before, by name
+		deleted  string   // Existing file deleted before the upload, if any
+		slug     string   // Custom slug for the upload
+		upload   string
+		want     string // Regexp the stored original name must match
+		wantErr  error
+	}{
+		{"free name", "", nil, "", "", "report.pdf", `^report\.pdf$`, nil},
+		{"random suffix by default", "", []string{"report.pdf"}, "", "", "report.pdf", `^report-[0-9a-f]{4,}\.pdf$`, nil},
+		{"random suffix", "suffix-random", []string{"report.pdf"}, "", "", "report.pdf", `^report-[0-9a-f]{4,}\.pdf$`, nil},
+		{"invalid strategy uses the default", "rename", []string{"report.pdf"}, "", "", "report.pdf", `^report-[0-9a-f]{4,}\.pdf$`, nil},
+		{"first counter", "suffix-counter", []string{"report.pdf"}, "", "", "report.pdf", `^report-2\.pdf$`, nil},
+		{"next counter", "suffix-counter", []string{"report.pdf", "report.pdf", "report.pdf"}, "", "", "report.pdf", `^report-4\.pdf$`, nil},
+		{"freed counter reused", "suffix-counter", []string{"report.pdf", "report.pdf", "report.pdf"}, "report-2.pdf", "", "report.pdf", `^report-2\.pdf$`, nil},
+		{"counter without an extension", "suffix-counter", []string{"README"}, "", "", "README", `^README-2$`, nil},
+		{"counter with a custom slug", "suffix-counter", []string{"report.pdf"}, "", "mine", "report.pdf", `^report-2\.pdf$`, nil},
+		{"case differs", "reject", []string{"report.pdf"}, "", "", "Report.pdf", `^Report\.pdf$`, nil},
+		{"rejected", "reject", []string{"report.pdf"}, "", "", "report.pdf", "", ErrFilenameTaken},
+		{"rejected with a custom slug", "reject", []string{"report.pdf"}, "", "mine", "report.pdf", "", ErrFilenameTaken},
+		{"free after deletion", "reject", []string{"report.pdf"}, "report.pdf", "", "report.pdf", `^report\.pdf$`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FILENAME_COLLISION", tt.strategy)
+			s := newTestService(t)
+			for i, name := range tt.existing {
+				file := mustSave(t, s, name, []byte{byte(i)}, SaveOptions{})
+				if file.OriginalName == tt.deleted {
+					if err := s.DeleteFile(file.ID); err != nil {
+						t.Fatalf("DeleteFile: %v", err)
+					}
+				}
+			}
+
+			opts := SaveOptions{}
+			if tt.slug != "" {
+				opts.Slug = ptr(tt.slug)
+			}
+			file, err := s.SaveFileFromReader(tt.upload, "", bytesOf("new"), opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !regexp.MustCompile(tt.want).MatchString(file.OriginalName) {
+				t.Fatalf("stored as %q, want it to match %s", file.OriginalName, tt.want)
+			}
+			if tt.slug == "" && file.Slug != file.OriginalName {
+				t.Errorf("slug = %q, want the same as the name %q", file.Slug, file.OriginalName)
+			}
+		})
+	}
+}
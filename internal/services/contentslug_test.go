@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestContentAddressedSlugsReuseIdenticalFiles(t *testing.T) {
+	t.Setenv("CONTENT_ADDRESSED_SLUGS", "true")
+	s := newTestService(t)
+
+	first := mustSave(t, s, "a.txt", []byte("same bytes"), SaveOptions{})
+	second := mustSave(t, s, "b.txt", []byte("same bytes"), SaveOptions{})
+	if second.ID != first.ID {
+		t.Fatalf("identical upload got file %d, want the existing file %d", second.ID, first.ID)
+	}
+}
+
+func TestContentAddressedSlugsKeepPasswordOfNewUpload(t *testing.T) {
+	t.Setenv("CONTENT_ADDRESSED_SLUGS", "true")
+	s := newTestService(t)
+
+	public := mustSave(t, s, "a.txt", []byte("same bytes"), SaveOptions{})
+	protected := mustSave(t, s, "b.txt", []byte("same bytes"), SaveOptions{Password: ptr("secret")})
+
+	if protected.ID == public.ID {
+		t.Fatal("password-protected upload was given the existing unprotected file")
+	}
+	if !protected.HasPassword() {
+		t.Fatal("new file has no password")
+	}
+	if protected.Slug == public.Slug {
+		t.Fatalf("both files have slug %q", protected.Slug)
+	}
+	if err := s.ValidatePassword(protected, "wrong"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("ValidatePassword with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+}
+
+func TestContentAddressedSlugsDontHandOutProtectedFiles(t *testing.T) {
+	t.Setenv("CONTENT_ADDRESSED_SLUGS", "true")
+	s := newTestService(t)
+
+	protected := mustSave(t, s, "a.txt", []byte("same bytes"), SaveOptions{Password: ptr("secret")})
+	public := mustSave(t, s, "b.txt", []byte("same bytes"), SaveOptions{})
+	if public.ID == protected.ID {
+		t.Fatal("upload without a password was given the existing protected file")
+	}
+	if public.HasPassword() {
+		t.Fatal("new file has a password it wasn't uploaded with")
+	}
+}
+
+func TestContentAddressedSlugsCompareSettings(t *testing.T) {
+	t.Setenv("CONTENT_ADDRESSED_SLUGS", "true")
+	s := newTestService(t)
+	base := mustSave(t, s, "base.txt", []byte("same bytes"), SaveOptions{})
+
+	tests := map[string]SaveOptions{
+		"access list":   {AccessTokens: []string{"alice@example.com"}},
+		"max downloads": {MaxDownloads: ptr(int64(1))},
+		"expiry":        {ExpiresAt: ptr(base.CreatedAt.Add(48 * time.Hour))},
+		"metadata":      {ClientMetadata: []byte(`{"alg":"AES-GCM"}`)},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := mustSave(t, s, name+".txt", []byte("same bytes"), opts)
+			if file.ID == base.ID {
+				t.Fatalf("upload with its own %s was given the existing file", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Content-type mismatch policies (CONTENT_TYPE_POLICY)
+const (
+	ContentTypeTrustSniffed  = "trust_sniffed"  // Store the sniffed type (default)
+	ContentTypeTrustDeclared = "trust_declared" // Store the client-declared type
+	ContentTypeReject        = "reject"         // Reject uploads whose declared type disagrees with the content
+)
+
+var (
+	ErrInvalidContentType    = errors.New("invalid content type")
+	ErrContentTypeNotAllowed = errors.New("content type override not allowed")
+)
+
+// overrideContentTypes are the types a download may be served as with ?content_type=.
+// None of them can run scripts in a browser (no HTML, SVG, or XML).
+var overrideContentTypes = map[string]bool{
+	"application/octet-stream": true,
+	"application/json":         true,
+	"application/pdf":          true,
+	"application/zip":          true,
+	"text/plain":               true,
+	"text/csv":                 true,
+	"text/markdown":            true,
+	"image/png":                true,
+	"image/jpeg":               true,
+	"image/gif":                true,
+	"image/webp":               true,
+	"image/avif":               true,
+	"audio/mpeg":               true,
+	"audio/ogg":                true,
+	"audio/wav":                true,
+	"video/mp4":                true,
+	"video/webm":               true,
+}
+
+// genericContentType is returned by the sniffer when it can't identify the content
+const genericContentType = "application/octet-stream"
+
+// executableSignatures are magic numbers for executables, which http.DetectContentType doesn't recognize
+var executableSignatures = []struct {
+	magic       string
+	contentType string
+}{
+	{"MZ", "application/x-msdownload"},                // Windows PE
+	{"\x7fELF", "application/x-executable"},           // Linux ELF
+	{"\xcf\xfa\xed\xfe", "application/x-mach-binary"}, // Mach-O 64-bit
+	{"\xce\xfa\xed\xfe", "application/x-mach-binary"}, // Mach-O 32-bit
+	{"\xca\xfe\xba\xbe", "application/x-mach-binary"}, // Mach-O universal
+}
+
+// sniffContentType detects the content type of an uploaded file from its first 512 bytes
+func sniffContentType(upload *Upload) (string, error) {
+	src, err := upload.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+
+	sniffed := http.DetectContentType(head[:n])
+	if sniffed == genericContentType {
+		for _, sig := range executableSignatures {
+			if strings.HasPrefix(string(head[:n]), sig.magic) {
+				return sig.contentType, nil
+			}
+		}
+	}
+	return sniffed, nil
+}
+
+// hashContent returns the hex SHA-256 of an uploaded file's content
+func hashContent(upload *Upload) (string, error) {
+	src, err := upload.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, src); err != nil {
+		return "", fmt.Errorf("failed to hash uploaded file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// mediaType returns the lowercase media type without parameters (e.g., "text/plain")
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return parsed
+}
+
+// contentTypesMatch reports whether a declared content type is consistent with the sniffed one.
+// The sniffer only knows a limited set of signatures, so some broader families are allowed.
+func contentTypesMatch(declared, sniffed string) bool {
+	declaredType, sniffedType := mediaType(declared), mediaType(sniffed)
+
+	switch {
+	case declaredType == "" || declaredType == sniffedType:
+		return true
+	case sniffedType == genericContentType:
+		// Sniffer couldn't identify the content, nothing to compare against
+		return true
+	case declaredType == genericContentType:
+		// Client didn't claim a specific type
+		return true
+	case sniffedType == "application/zip":
+		// Office documents, archives, and packages are zip containers
+		return strings.HasSuffix(declaredType, "+zip") ||
+			strings.Contains(declaredType, "openxmlformats") ||
+			strings.Contains(declaredType, "opendocument") ||
+			strings.Contains(declaredType, "zip") ||
+			declaredType == "application/java-archive" ||
+			declaredType == "application/epub+zip"
+	case sniffedType == "text/plain":
+		// Plain text covers most non-HTML text formats
+		return declaredType != "text/html" && (strings.HasPrefix(declaredType, "text/") ||
+			declaredType == "application/json" ||
+			declaredType == "application/xml" ||
+			declaredType == "application/javascript" ||
+			declaredType == "application/x-yaml" ||
+			strings.HasSuffix(declaredType, "+json") ||
+			strings.HasSuffix(declaredType, "+xml"))
+	}
+	return false
+}
+
+// resolveContentType picks the stored content type for an upload according to the policy.
+// It returns ErrContentTypeMismatch if the policy is reject and the types disagree.
+func resolveContentType(policy, declared, sniffed string) (string, error) {
+	switch policy {
+	case ContentTypeTrustDeclared:
+		if declared != "" {
+			return declared, nil
+		}
+		return sniffed, nil
+
+	case ContentTypeReject:
+		if !contentTypesMatch(declared, sniffed) {
+			return "", ErrContentTypeMismatch
+		}
+	}
+
+	// Trust the sniffed type, unless the sniffer couldn't identify the content
+	if mediaType(sniffed) == genericContentType && declared != "" {
+		return declared, nil
+	}
+	return sniffed, nil
+}
+
+// NormalizeContentType validates a content type and returns it in canonical form
+// (lowercase type and parameter names, e.g. "text/plain; charset=utf-8")
+func NormalizeContentType(contentType string) (string, error) {
+	parsed, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.Contains(parsed, "/") {
+		return "", ErrInvalidContentType
+	}
+	normalized := mime.FormatMediaType(parsed, params)
+	if normalized == "" {
+		return "", ErrInvalidContentType
+	}
+	return normalized, nil
+}
+
+// OverrideContentType validates a content type requested for a download (?content_type=),
+// which must be one of the safe overrideContentTypes
+func OverrideContentType(contentType string) (string, error) {
+	normalized, err := NormalizeContentType(contentType)
+	if err != nil {
+		return "", err
+	}
+	if !overrideContentTypes[mediaType(normalized)] {
+		return "", ErrContentTypeNotAllowed
+	}
+	return normalized, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+		wantErr     error
+	}{
+		{"text/plain", "text/plain", nil},
+		{"Text/Plain; Charset=utf-8", "text/plain; charset=utf-8", nil},
+		{"  application/pdf  ", "application/pdf", nil},
+		{"text/html", "text/html", nil}, // Any valid type may be stored
+		{"", "", ErrInvalidContentType},
+		{"text", "", ErrInvalidContentType},
+		{"text/plain; charset", "", ErrInvalidContentType},
+		{"text /plain", "", ErrInvalidContentType},
+		{"text/plain; charset=utf-8; charset=latin1", "", ErrInvalidContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got, err := NormalizeContentType(tt.contentType)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeContentType error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("NormalizeContentType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverrideContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+		wantErr     error
+	}{
+		{"application/octet-stream", "application/octet-stream", nil},
+		{"TEXT/PLAIN; charset=utf-8", "text/plain; charset=utf-8", nil},
+		{"image/png", "image/png", nil},
+		{"text/plain;", "text/plain", nil},
+		{"text/html", "", ErrContentTypeNotAllowed},
+		{"text/html; charset=utf-8", "", ErrContentTypeNotAllowed},
+		{"image/svg+xml", "", ErrContentTypeNotAllowed},
+		{"application/xml", "", ErrContentTypeNotAllowed},
+		{"application/javascript", "", ErrContentTypeNotAllowed},
+		{"text", "", ErrInvalidContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got, err := OverrideContentType(tt.contentType)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("OverrideContentType error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("OverrideContentType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateFileContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		wantErr     error
+		want        string
+	}{
+		{"override", "Text/Markdown; Charset=utf-8", nil, "text/markdown; charset=utf-8"},
+		{"malformed", "markdown", ErrInvalidContentType, "text/plain; charset=utf-8"},
+		{"empty", "", ErrInvalidContentType, "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.md", []byte("# Notes"), SaveOptions{})
+
+			_, err := s.UpdateFile(file.ID, UpdateOptions{ContentType: ptr(tt.contentType)})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateFile error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, err := s.GetFile(file.ID)
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			if stored.ContentType != tt.want {
+				t.Errorf("content type = %q, want %q", stored.ContentType, tt.want)
+			}
+			// The detected types are kept for reference
+			if stored.DeclaredContentType != file.DeclaredContentType || stored.SniffedContentType != file.SniffedContentType {
+				t.Errorf("declared/sniffed types = %q/%q, want %q/%q unchanged",
+					stored.DeclaredContentType, stored.SniffedContentType, file.DeclaredContentType, file.SniffedContentType)
+			}
+		})
+	}
+}
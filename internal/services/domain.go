@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownDomain is returned when a file is assigned a domain that isn't configured
+var ErrUnknownDomain = errors.New("unknown custom domain")
+
+var (
+	customDomainsOnce sync.Once
+	customDomains     []string
+)
+
+// getCustomDomains returns the domains configured in CUSTOM_DOMAINS
+// (e.g., "files.example.com,share.example.org"), in configuration order.
+// Each domain has its own slug namespace; requests for other hosts use the default namespace.
+func getCustomDomains() []string {
+	customDomainsOnce.Do(func() {
+		for _, domain := range strings.Split(os.Getenv("CUSTOM_DOMAINS"), ",") {
+			domain = normalizeHost(domain)
+			if domain != "" {
+				customDomains = append(customDomains, domain)
+			}
+		}
+	})
+	return customDomains
+}
+
+// normalizeHost lowercases a host and strips any port and trailing dot
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// resolveDomain validates a domain for a file; empty means the default namespace
+func resolveDomain(domain string) (string, error) {
+	domain = normalizeHost(domain)
+	if domain == "" {
+		return "", nil
+	}
+	for _, configured := range getCustomDomains() {
+		if configured == domain {
+			return domain, nil
+		}
+	}
+	return "", ErrUnknownDomain
+}
+
+// CustomDomains returns the configured custom domains
+func (s *FileService) CustomDomains() []string {
+	return getCustomDomains()
+}
+
+// DomainForHost returns the custom domain whose namespace serves requests for the
+// given Host header, or "" if the host isn't a configured custom domain
+func DomainForHost(host string) string {
+	domain, err := resolveDomain(host)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// rangeCountWindow is how long after its last range request a client's ranges still
+// belong to the same download
+const rangeCountWindow = 30 * time.Minute
+
+// rangeTracker remembers which clients were already counted for a file. Losing it (e.g.,
+// on restart) only counts a client's next range as a new download.
+type rangeTracker struct {
+	mu      sync.Mutex
+	counted map[string]*rangeCount // "fileID|client" -> the client's download
+}
+
+// rangeCount is a client's counted download of a file
+type rangeCount struct {
+	seenAt time.Time     // Time of the client's last range request
+	done   chan struct{} // Closed once the download was counted (or couldn't be)
+	err    error         // Why it couldn't be counted, set before done is closed
+}
+
+var downloadRanges = &rangeTracker{counted: make(map[string]*rangeCount)}
+
+func rangeTrackerKey(fileID uint, client string) string {
+	return fmt.Sprintf("%d|%s", fileID, client)
+}
+
+// prune drops expired entries so the map doesn't grow without bound (caller holds mu)
+func (t *rangeTracker) prune(now time.Time) {
+	for k, count := range t.counted {
+		if now.Sub(count.seenAt) >= rangeCountWindow {
+			delete(t.counted, k)
+		}
+	}
+}
+
+// reserve returns a client's download of a file, extending its window, and reports
+// whether it is new. The caller must count a new download and pass the result to finish;
+// others wait on done for it.
+func (t *rangeTracker) reserve(fileID uint, client string) (*rangeCount, bool) {
+	key := rangeTrackerKey(fileID, client)
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(now)
+	if count, ok := t.counted[key]; ok {
+		count.seenAt = now
+		return count, false
+	}
+	count := &rangeCount{seenAt: now, done: make(chan struct{})}
+	t.counted[key] = count
+	return count, true
+}
+
+// finish records whether a new download was counted. One that couldn't be is forgotten,
+// so the client's next range tries again.
+func (t *rangeTracker) finish(fileID uint, client string, count *rangeCount, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count.err = err
+	close(count.done)
+	if err != nil && t.counted[rangeTrackerKey(fileID, client)] == count {
+		delete(t.counted, rangeTrackerKey(fileID, client))
+	}
+}
+
+// RecordDownload increments a file's download count and logs the download time in the
+// hash-chained access log. The increment and the max-downloads check are one SQL
+// statement, so concurrent downloads can neither lose counts nor exceed the limit.
+// Only appending to the chain is serialized, from reading the latest entry until commit.
+// Returns ErrDownloadLimitReached if the file has no downloads left.
+func (s *FileService) RecordDownload(file *models.File) error {
+	var unlock func()
+	defer func() {
+		if unlock != nil {
+			unlock() // Only after the commit, so the next entry chains to this one
+		}
+	}()
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.File{}).
+			Where("id = ? AND (max_downloads IS NULL OR download_count < max_downloads)", file.ID).
+			UpdateColumn("download_count", gorm.Expr("download_count + ?", 1))
+		if result.Error != nil {
+			return fmt.Errorf("failed to record download: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrDownloadLimitReached
+		}
+
+		// Keep the timestamp for per-interval stats
+		accessLogMu.Lock()
+		unlock = accessLogMu.Unlock
+		if err := appendAccessLog(tx, file.ID); err != nil {
+			return fmt.Errorf("failed to record download: %w", err)
+		}
+		return nil
+	})
+}
+
+// RecordRangeDownload counts a range request as a download unless the client was already
+// counted for this file and has kept requesting ranges since (within the window).
+// Browsers fetch media with many range requests, and resumed downloads continue where
+// they stopped; counting each request would inflate the count. The first range from a
+// client counts wherever it starts, and like RecordDownload returns ErrDownloadLimitReached
+// if the file has no downloads left.
+// Ranges arriving while the first one is being counted wait for it, and are refused with it.
+func (s *FileService) RecordRangeDownload(file *models.File, client string) error {
+	count, isNew := downloadRanges.reserve(file.ID, client)
+	if !isNew {
+		<-count.done
+		return count.err
+	}
+
+	err := s.RecordDownload(file)
+	downloadRanges.finish(file.ID, client, count, err)
+	return err
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// resetRangeTracker gives the test its own range tracker, since file IDs repeat across test databases
+func resetRangeTracker(t *testing.T) {
+	t.Helper()
+	saved := downloadRanges
+	downloadRanges = &rangeTracker{counted: make(map[string]*rangeCount)}
+	t.Cleanup(func() { downloadRanges = saved })
+}
+
+// downloadCount returns a file's current download count
+func downloadCount(t *testing.T, s *FileService, file *models.File) int64 {
+	t.Helper()
+	current, err := s.GetFile(file.ID)
+	if err != nil {
+		t.Fatalf("GetFile: %v", err)
+	}
+	return current.DownloadCount
+}
+
+func TestRecordRangeDownload(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []string // Client of each range request, in order
+		want    int64
+	}{
+		{"ranges of one download", []string{"198.51.100.1", "198.51.100.1", "198.51.100.1"}, 1},
+		{"resumed download from a new client", []string{"198.51.100.1"}, 1},
+		{"two clients", []string{"198.51.100.1", "198.51.100.2", "198.51.100.1"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRangeTracker(t)
+			s := newTestService(t)
+			file := mustSave(t, s, "video.mp4", []byte("content"), SaveOptions{})
+
+			for _, client := range tt.clients {
+				if err := s.RecordRangeDownload(file, client); err != nil {
+					t.Fatalf("RecordRangeDownload(%s): %v", client, err)
+				}
+			}
+			if got := downloadCount(t, s, file); got != tt.want {
+				t.Fatalf("download count = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordRangeDownloadCountsAgainAfterWindow(t *testing.T) {
+	resetRangeTracker(t)
+	s := newTestService(t)
+	file := mustSave(t, s, "video.mp4", []byte("content"), SaveOptions{})
+
+	if err := s.RecordRangeDownload(file, "198.51.100.1"); err != nil {
+		t.Fatalf("RecordRangeDownload: %v", err)
+	}
+	for _, count := range downloadRanges.counted {
+		count.seenAt = time.Now().Add(-rangeCountWindow)
+	}
+	if err := s.RecordRangeDownload(file, "198.51.100.1"); err != nil {
+		t.Fatalf("RecordRangeDownload: %v", err)
+	}
+	if got := downloadCount(t, s, file); got != 2 {
+		t.Fatalf("download count = %d, want 2", got)
+	}
+}
+
+func TestRecordRangeDownloadEnforcesLimit(t *testing.T) {
+	resetRangeTracker(t)
+	s := newTestService(t)
+	file := mustSave(t, s, "video.mp4", []byte("content"), SaveOptions{MaxDownloads: ptr(int64(1))})
+
+	if err := s.RecordRangeDownload(file, "198.51.100.1"); err != nil {
+		t.Fatalf("first client's range: %v", err)
+	}
+
+	// file still has the download count it was loaded with
+	if err := s.RecordRangeDownload(file, "198.51.100.2"); !errors.Is(err, ErrDownloadLimitReached) {
+		t.Fatalf("second client's range = %v, want ErrDownloadLimitReached", err)
+	}
+	if err := s.RecordRangeDownload(file, "198.51.100.1"); err != nil {
+		t.Fatalf("counted client's next range = %v, want it served", err)
+	}
+	if got := downloadCount(t, s, file); got != 1 {
+		t.Fatalf("download count = %d, want 1", got)
+	}
+}
+
+func TestRecordDownloadConcurrentlyStopsAtLimit(t *testing.T) {
+	s := newTestService(t)
+	const limit, downloads = 5, 20
+	file := mustSave(t, s, "limited.txt", []byte("content"), SaveOptions{MaxDownloads: ptr(int64(limit))})
+
+	var wg sync.WaitGroup
+	errs := make([]error, downloads)
+	for i := range downloads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.RecordDownload(file)
+		}()
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrDownloadLimitReached):
+		default:
+			t.Errorf("unexpected download error: %v", err)
+		}
+	}
+	if succeeded != limit {
+		t.Fatalf("%d downloads succeeded, want %d", succeeded, limit)
+	}
+	if got := downloadCount(t, s, file); got != limit {
+		t.Fatalf("download count = %d, want %d", got, limit)
+	}
+
+	verification, err := s.VerifyAccessLog()
+	if err != nil {
+		t.Fatalf("VerifyAccessLog: %v", err)
+	}
+	if !verification.Valid || verification.Entries != limit {
+		t.Fatalf("access log valid = %v with %d entries (%s), want a valid chain of %d",
+			verification.Valid, verification.Entries, verification.Reason, limit)
+	}
+}
+
+func TestVerifyAccessLogTampering(t *testing.T) {
+	tests := []struct {
+		name        string
+		tamper      func(t *testing.T, entries []models.Download) // entries are the 5 logged downloads, in order
+		wantBrokeAt int                                           // Index of the entry reported (-1 = chain valid)
+		wantReason  string
+		wantEntries int64
+	}{
+		{"intact", func(t *testing.T, entries []models.Download) {}, -1, "", 5},
+		{"file altered", func(t *testing.T, entries []models.Download) {
+			updateEntry(t, entries[2].ID, "file_id", entries[2].FileID+1)
+		}, 2, "altered", 3},
+		{"time altered", func(t *testing.T, entries []models.Download) {
+			updateEntry(t, entries[2].ID, "created_at", entries[2].CreatedAt.Add(-time.Hour))
+		}, 2, "altered", 3},
+		{"altered and rehashed", func(t *testing.T, entries []models.Download) {
+			entry := entries[2]
+			entry.FileID++
+			updateEntry(t, entry.ID, "file_id", entry.FileID)
+			updateEntry(t, entry.ID, "hash", accessLogHash(entry.PrevHash, &entry))
+		}, 3, "missing or inserted", 4},
+		{"entry deleted", func(t *testing.T, entries []models.Download) {
+			deleteEntry(t, entries[2].ID)
+		}, 3, "missing or inserted", 3},
+		{"first entry deleted", func(t *testing.T, entries []models.Download) {
+			deleteEntry(t, entries[0].ID)
+		}, 1, "missing or inserted", 1},
+		{"last entry deleted", func(t *testing.T, entries []models.Download) {
+			deleteEntry(t, entries[4].ID) // Only detected by comparing Head
+		}, -1, "", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{})
+			for range 5 {
+				if err := s.RecordDownload(file); err != nil {
+					t.Fatalf("RecordDownload: %v", err)
+				}
+			}
+			var entries []models.Download
+			if err := database.DB.Order("id").Find(&entries).Error; err != nil {
+				t.Fatalf("loading the access log: %v", err)
+			}
+			head := entries[len(entries)-1].Hash
+
+			tt.tamper(t, entries)
+			verification, err := s.VerifyAccessLog()
+			if err != nil {
+				t.Fatalf("VerifyAccessLog: %v", err)
+			}
+
+			if verification.Entries != tt.wantEntries {
+				t.Errorf("checked %d entries, want %d", verification.Entries, tt.wantEntries)
+			}
+			if tt.wantBrokeAt < 0 {
+				if !verification.Valid || verification.BrokenAt != 0 {
+					t.Fatalf("valid = %v, broken at %d (%s), want a valid chain", verification.Valid, verification.BrokenAt, verification.Reason)
+				}
+				if truncated := tt.wantEntries < int64(len(entries)); (verification.Head == head) == truncated {
+					t.Errorf("head = %s, want the original %s: %v", verification.Head, head, !truncated)
+				}
+				return
+			}
+			if verification.Valid || verification.Head != "" {
+				t.Fatalf("valid = %v with head %q, want the break reported", verification.Valid, verification.Head)
+			}
+			if want := entries[tt.wantBrokeAt].ID; verification.BrokenAt != want {
+				t.Errorf("broken at entry %d, want %d", verification.BrokenAt, want)
+			}
+			if !strings.Contains(verification.Reason, tt.wantReason) {
+				t.Errorf("reason = %q, want it to mention %q", verification.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+// updateEntry changes a column of an access log entry directly in the database
+func updateEntry(t *testing.T, id uint, column string, value interface{}) {
+	t.Helper()
+	if err := database.DB.Model(&models.Download{}).Where("id = ?", id).UpdateColumn(column, value).Error; err != nil {
+		t.Fatalf("altering entry %d: %v", id, err)
+	}
+}
+
+// deleteEntry removes an access log entry directly from the database
+func deleteEntry(t *testing.T, id uint) {
+	t.Helper()
+	if err := database.DB.Delete(&models.Download{}, id).Error; err != nil {
+		t.Fatalf("deleting entry %d: %v", id, err)
+	}
+}
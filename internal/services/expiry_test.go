@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSaveExpiresAfterFirstDownload(t *testing.T) {
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		opts    SaveOptions
+		wantErr error
+	}{
+		{"relative expiry", SaveOptions{ExpiresAfterFirstDownload: ptr(time.Hour)}, nil},
+		{"with an absolute expiry", SaveOptions{ExpiresAt: &tomorrow, ExpiresAfterFirstDownload: ptr(time.Hour)}, ErrInvalidExpiry},
+		{"zero duration", SaveOptions{ExpiresAfterFirstDownload: ptr(time.Duration(0))}, ErrInvalidExpiry},
+		{"negative duration", SaveOptions{ExpiresAfterFirstDownload: ptr(-time.Hour)}, ErrInvalidExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file, err := s.SaveFileFromReader("notes.txt", "", bytesOf("notes"), tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if file.ExpiresAt != nil || !file.HasPendingExpiry() {
+				t.Fatalf("new file expires at %v, want its expiry pending until the first download", file.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestActivateExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      SaveOptions
+		wantAfter time.Duration // Expected expiry from now, or 0 for none
+	}{
+		{"relative expiry", SaveOptions{ExpiresAfterFirstDownload: ptr(time.Hour)}, time.Hour},
+		{"locked longer than the expiry", SaveOptions{ExpiresAfterFirstDownload: ptr(time.Hour), LockedUntil: ptr(time.Now().Add(48 * time.Hour))}, 48 * time.Hour},
+		{"no relative expiry", SaveOptions{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.txt", []byte("notes"), tt.opts)
+			stale := *file // A concurrent download's copy, loaded before the first activation
+
+			if err := s.ActivateExpiry(file); err != nil {
+				t.Fatalf("ActivateExpiry: %v", err)
+			}
+			stored, err := s.GetFile(file.ID)
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			if tt.wantAfter == 0 {
+				if stored.ExpiresAt != nil {
+					t.Fatalf("file without a relative expiry now expires at %v", stored.ExpiresAt)
+				}
+				return
+			}
+			if stored.ExpiresAt == nil || time.Until(*stored.ExpiresAt) > tt.wantAfter || time.Until(*stored.ExpiresAt) < tt.wantAfter-time.Minute {
+				t.Fatalf("file expires at %v, want about %s from now", stored.ExpiresAt, tt.wantAfter)
+			}
+
+			// A later download keeps the first download's expiry
+			if err := s.ActivateExpiry(&stale); err != nil {
+				t.Fatalf("second ActivateExpiry: %v", err)
+			}
+			if stale.ExpiresAt == nil || !stale.ExpiresAt.Equal(*stored.ExpiresAt) {
+				t.Fatalf("second download set expiry %v, want the first's %v", stale.ExpiresAt, stored.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestRequireExpiry(t *testing.T) {
+	setRetentionPolicies(t, "week=7d")
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		require string
+		opts    SaveOptions
+		wantErr error
+	}{
+		{"not required", "", SaveOptions{}, nil},
+		{"no expiry", "true", SaveOptions{}, ErrExpiryRequired},
+		{"expiry date", "true", SaveOptions{ExpiresAt: &tomorrow}, nil},
+		{"policy", "true", SaveOptions{Policy: "week"}, nil},
+		{"only after the first download", "true", SaveOptions{ExpiresAfterFirstDownload: ptr(time.Hour)}, ErrExpiryRequired},
+		{"replacing without an expiry", "true", SaveOptions{Replace: true}, nil}, // The replaced file keeps its own expiry
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REQUIRE_EXPIRY", "")
+			s := newTestService(t)
+			existing := mustSave(t, s, "existing.txt", []byte("existing"), SaveOptions{ExpiresAt: &tomorrow})
+
+			t.Setenv("REQUIRE_EXPIRY", tt.require)
+			s = newTestServiceWith(t, s.backends)
+			filename := "notes.txt"
+			if tt.opts.Replace {
+				filename = existing.OriginalName
+			}
+			_, err := s.SaveFileFromReader(filename, "", bytesOf("notes"), tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if objects := storedObjects(t, existing); len(objects) != 1 {
+					t.Errorf("stored objects %v after the rejected upload, want only the existing file's", objects)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrEmptySelection is returned when a bulk operation selects no files by id or search
+var ErrEmptySelection = errors.New("no files selected")
+
+// Per-file outcomes of a bulk expiry extension
+const (
+	ExtendStatusExtended      = "extended"
+	ExtendStatusNotFound      = "not_found"
+	ExtendStatusExpired       = "expired"
+	ExtendStatusLocked        = "locked"
+	ExtendStatusInvalidExpiry = "invalid_expiry" // New expiry falls before the file's lock end
+)
+
+// FileSelection picks the files for a bulk operation: the listed ids, or the active
+// files whose original name contains Search (case-insensitive) when no ids are given
+type FileSelection struct {
+	IDs    []uint
+	Search string
+}
+
+// ExtendResult is the outcome of extending one file's expiry
+type ExtendResult struct {
+	ID        uint       `json:"id"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Expiry after the operation
+}
+
+// ExtendExpiry sets a new expiry on every selected file in a single transaction.
+// Files that can't be changed (locked, missing, already expired) are reported per id
+// and skipped; the remaining files are still updated.
+func (s *FileService) ExtendExpiry(sel FileSelection, expiresAt time.Time) ([]ExtendResult, error) {
+	search := strings.TrimSpace(sel.Search)
+	if len(sel.IDs) == 0 && search == "" {
+		return nil, ErrEmptySelection
+	}
+
+	var results []ExtendResult
+	var updated []*models.File
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		files, err := selectFiles(tx, sel.IDs, search)
+		if err != nil {
+			return err
+		}
+
+		results = make([]ExtendResult, 0, len(files))
+		for _, id := range selectionOrder(sel.IDs, files) {
+			file, ok := files[id]
+			if !ok {
+				results = append(results, ExtendResult{ID: id, Status: ExtendStatusNotFound})
+				continue
+			}
+
+			result := ExtendResult{ID: id, ExpiresAt: models.JSONTimePtr(file.ExpiresAt)}
+			switch {
+			case file.IsExpired():
+				result.Status = ExtendStatusExpired
+			case file.IsLocked():
+				result.Status = ExtendStatusLocked
+			case validateLockExpiry(&expiresAt, file.LockedUntil) != nil:
+				result.Status = ExtendStatusInvalidExpiry
+			default:
+				if err := tx.Model(file).Update("expires_at", expiresAt).Error; err != nil {
+					return fmt.Errorf("failed to update file %d: %w", id, err)
+				}
+				result.Status = ExtendStatusExtended
+				result.ExpiresAt = models.JSONTimePtr(&expiresAt)
+				file.ExpiresAt = &expiresAt
+				updated = append(updated, file)
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range updated {
+		s.cache.InvalidateFile(file.ID)
+		s.tagStorageObject(file)
+	}
+	purgeCDN(updated...)
+
+	return results, nil
+}
+
+// selectFiles loads the files chosen by ids, or by an original-name search, keyed by id.
+// A search only matches files that haven't expired; listed ids are loaded regardless
+// so callers can report why they were skipped.
+func selectFiles(tx *gorm.DB, ids []uint, search string) (map[uint]*models.File, error) {
+	var files []models.File
+	query := tx.Model(&models.File{})
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	} else {
+		pattern := "%" + escapeLike(strings.ToLower(search)) + "%"
+		query = query.Where("LOWER(original_name) LIKE ? ESCAPE '\\'", pattern).
+			Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	}
+	if err := query.Order("id").Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to select files: %w", err)
+	}
+
+	byID := make(map[uint]*models.File, len(files))
+	for i := range files {
+		byID[files[i].ID] = &files[i]
+	}
+	return byID, nil
+}
+
+// selectionOrder returns the ids to report on: the requested ids in request order
+// (without duplicates), or the matched files in id order for a search
+func selectionOrder(ids []uint, files map[uint]*models.File) []uint {
+	order := make([]uint, 0, len(files))
+	if len(ids) > 0 {
+		seen := make(map[uint]bool, len(ids))
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				order = append(order, id)
+			}
+		}
+		return order
+	}
+
+	for id := range files {
+		order = append(order, id)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+	return order
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1,20 +1,34 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/mozillazg/go-unidecode"
 	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/events"
 	"github.com/yorukot/sharing/internal/models"
 	"github.com/yorukot/sharing/internal/storage"
+	"github.com/yorukot/sharing/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -25,65 +39,399 @@ var (
 	ErrInvalidPassword  = errors.New("invalid password")
 	ErrPasswordRequired = errors.New("password required")
 	ErrSlugTaken        = errors.New("slug already taken")
+	ErrFilenameTaken    = errors.New("filename already taken")
 	ErrInvalidSlug      = errors.New("invalid slug format")
+	ErrInvalidExpiry    = errors.New("invalid expiry settings")
+	ErrExpiryRequired   = errors.New("an expiry date is required")
+	ErrFileLocked       = errors.New("file is locked")
+	ErrFileDisabled     = errors.New("file has been disabled")
+
+	ErrContentTypeMismatch = errors.New("declared content type does not match file content")
+
+	ErrDownloadLimitReached = errors.New("download limit reached")
+	ErrFilenameTooLong      = errors.New("filename too long")
+	ErrPasswordTooLong      = errors.New("password too long")
+	ErrInvalidUploadTime    = errors.New("original upload time is in the future")
 )
 
 var slugRegex = regexp.MustCompile(`^[a-zA-Z0-9\p{L}\p{N}._-]+$`)
 
+// strictSlugRegex is the slug format allowed in strict mode (SLUG_STRICT)
+var strictSlugRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// nonStrictSlugChars matches characters that aren't allowed in strict-mode slugs
+var nonStrictSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// InvalidSlugError explains why a slug was rejected (matches ErrInvalidSlug with errors.Is)
+type InvalidSlugError struct {
+	Reason string
+}
+
+func (e *InvalidSlugError) Error() string {
+	return "invalid slug format: " + e.Reason
+}
+
+func (e *InvalidSlugError) Is(target error) bool {
+	return target == ErrInvalidSlug
+}
+
+// PasswordTooLongError reports the password length limit (matches ErrPasswordTooLong with errors.Is)
+type PasswordTooLongError struct {
+	Max int // Longest accepted password in bytes
+}
+
+func (e *PasswordTooLongError) Error() string {
+	return fmt.Sprintf("password too long (at most %d bytes)", e.Max)
+}
+
+func (e *PasswordTooLongError) Is(target error) bool {
+	return target == ErrPasswordTooLong
+}
+
+// nonASCIISlugChars matches characters left over after transliteration that aren't slug-safe
+var nonASCIISlugChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
 // FileService handles file operations
 type FileService struct {
-	storage storage.Storage
+	storage            storage.Storage
+	transliterateSlugs bool   // Generate ASCII slugs for non-ASCII filenames (SLUG_TRANSLITERATE)
+	contentTypePolicy  string // How to handle declared/sniffed content-type mismatches (CONTENT_TYPE_POLICY)
+
+	backends *storage.Registry // Backends files are stored on, by name (STORAGE_BACKENDS); storage is the primary
+
+	contentAddressedSlugs bool // Derive slugs from the content hash and dedupe identical uploads (CONTENT_ADDRESSED_SLUGS)
+	contentHashSlugLength int  // Number of hash characters used for content-addressed slugs
+
+	pruneMissing bool // Soft-delete records whose storage object is gone (AUTO_PRUNE_MISSING)
+	strictSlugs  bool // Restrict slugs to lowercase letters, numbers, and hyphens (SLUG_STRICT)
+
+	slugTemplate string // Template for slugs of new files without a custom one, e.g. "{date}/{name}" (SLUG_TEMPLATE)
+
+	collisionStrategy string // How uploads whose filename is taken are named (FILENAME_COLLISION)
+
+	maxFilenameLength int // Longest accepted original filename in bytes (MAX_FILENAME_LENGTH)
+	maxPasswordLength int // Longest accepted file password in bytes (MAX_PASSWORD_LENGTH)
+
+	requireExpiry bool // Reject uploads without an expiry date (REQUIRE_EXPIRY)
+
+	storageMode string // How storage keys are chosen: unique or content-addressed (STORAGE_MODE)
+
+	presignExpiry       time.Duration // Validity of presigned direct-upload URLs (PRESIGN_EXPIRY)
+	maxDirectUploadSize int64         // Largest presigned direct upload in bytes (PRESIGN_MAX_SIZE)
+
+	defaultListSort string // Listing order when none is given (DEFAULT_LIST_SORT)
+
+	ctx context.Context // Parent of the service's trace spans (nil = none, see WithContext)
+
+	cache *fileCache // Slug/original-name lookup cache (shared by default, see getFileCache)
+}
+
+// defaultMaxFilenameLength is the default limit for original filenames, in bytes
+const defaultMaxFilenameLength = 255
+
+// maxBcryptPasswordLength is the longest password bcrypt uses in full, in bytes. Longer
+// passwords are rejected rather than silently cut, and it is the default limit.
+const maxBcryptPasswordLength = 72
+
+// defaultContentHashSlugLength is the default number of hex characters in a content-addressed slug
+const defaultContentHashSlugLength = 12
+
+// NewFileService creates a new file service instance storing files on the given backends
+func NewFileService(backends *storage.Registry) *FileService {
+	transliterateSlugs, _ := strconv.ParseBool(os.Getenv("SLUG_TRANSLITERATE"))
+
+	contentTypePolicy := strings.ToLower(os.Getenv("CONTENT_TYPE_POLICY"))
+	switch contentTypePolicy {
+	case ContentTypeTrustDeclared, ContentTypeReject:
+	default:
+		contentTypePolicy = ContentTypeTrustSniffed
+	}
+
+	contentAddressedSlugs, _ := strconv.ParseBool(os.Getenv("CONTENT_ADDRESSED_SLUGS"))
+	contentHashSlugLength := defaultContentHashSlugLength
+	if lengthStr := os.Getenv("CONTENT_HASH_SLUG_LENGTH"); lengthStr != "" {
+		if length, err := strconv.Atoi(lengthStr); err == nil && length >= 4 && length <= sha256.Size*2 {
+			contentHashSlugLength = length
+		}
+	}
+
+	pruneMissing, _ := strconv.ParseBool(os.Getenv("AUTO_PRUNE_MISSING"))
+	strictSlugs, _ := strconv.ParseBool(os.Getenv("SLUG_STRICT"))
+
+	maxFilenameLength := defaultMaxFilenameLength
+	if lengthStr := os.Getenv("MAX_FILENAME_LENGTH"); lengthStr != "" {
+		if length, err := strconv.Atoi(lengthStr); err == nil && length > 0 {
+			maxFilenameLength = length
+		}
+	}
+
+	maxPasswordLength := maxBcryptPasswordLength
+	if lengthStr := os.Getenv("MAX_PASSWORD_LENGTH"); lengthStr != "" {
+		if length, err := strconv.Atoi(lengthStr); err == nil && length > 0 && length <= maxBcryptPasswordLength {
+			maxPasswordLength = length
+		} else {
+			log.Printf("Warning: invalid MAX_PASSWORD_LENGTH value (1-%d), using default (%d)", maxBcryptPasswordLength, maxBcryptPasswordLength)
+		}
+	}
+
+	requireExpiry, _ := strconv.ParseBool(os.Getenv("REQUIRE_EXPIRY"))
+
+	storageMode := strings.ToLower(os.Getenv("STORAGE_MODE"))
+	switch storageMode {
+	case StorageModeCAS:
+	case "", StorageModeUnique:
+		storageMode = StorageModeUnique
+	default:
+		log.Printf("Warning: invalid STORAGE_MODE value, using default (%s)", StorageModeUnique)
+		storageMode = StorageModeUnique
+	}
+
+	s := &FileService{
+		storage:               backends.Primary(),
+		backends:              backends,
+		cache:                 getFileCache(),
+		storageMode:           storageMode,
+		presignExpiry:         getPresignExpiry(),
+		maxDirectUploadSize:   getMaxDirectUploadSize(),
+		defaultListSort:       getDefaultListSort(),
+		collisionStrategy:     getCollisionStrategy(),
+		pruneMissing:          pruneMissing,
+		strictSlugs:           strictSlugs,
+		maxFilenameLength:     maxFilenameLength,
+		maxPasswordLength:     maxPasswordLength,
+		requireExpiry:         requireExpiry,
+		transliterateSlugs:    transliterateSlugs,
+		contentTypePolicy:     contentTypePolicy,
+		contentAddressedSlugs: contentAddressedSlugs,
+		contentHashSlugLength: contentHashSlugLength,
+	}
+
+	// Checked once the slug rules above are set
+	if template, err := s.parseSlugTemplate(os.Getenv("SLUG_TEMPLATE")); err != nil {
+		log.Printf("Warning: invalid SLUG_TEMPLATE value (%v), ignoring it", err)
+	} else {
+		s.slugTemplate = template
+	}
+	return s
 }
 
-// NewFileService creates a new file service instance
-func NewFileService(storageBackend storage.Storage) *FileService {
-	return &FileService{
-		storage: storageBackend,
+// WithContext returns a copy of the service whose spans, including those of storage
+// operations, are children of the span in ctx (e.g., the request's). Without tracing
+// configured, the service itself is returned.
+func (s *FileService) WithContext(ctx context.Context) *FileService {
+	if !tracing.Enabled() {
+		return s
 	}
+	c := *s
+	c.ctx = ctx
+	c.backends = s.backends.Wrap(func(backend storage.Storage) storage.Storage {
+		return storage.NewTraced(ctx, backend)
+	})
+	c.storage = c.backends.Primary()
+	return &c
+}
+
+// context returns the parent context of the service's spans
+func (s *FileService) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// SaveOptions holds the optional settings for an upload
+type SaveOptions struct {
+	ExpiresAt                 *time.Time      // Absolute expiration time
+	ExpiresAfterFirstDownload *time.Duration  // Expiry relative to the first public download
+	Password                  *string         // Plaintext password (hashed before storing)
+	AccessTokens              []string        // Tokens allowed to download publicly (hashed before storing; empty = anyone)
+	Slug                      *string         // Custom slug (generated from filename if empty)
+	Replace                   bool            // Replace content of an existing file with the same original name
+	LockedUntil               *time.Time      // Retention lock end time (no delete/modify before then)
+	MaxDownloads              *int64          // Maximum number of public downloads (nil = unlimited)
+	Language                  string          // Paste syntax language (empty for regular files)
+	Policy                    string          // Named retention policy, resolved to ExpiresAt (RETENTION_POLICIES)
+	Domain                    string          // Custom domain serving the link (CUSTOM_DOMAINS, empty = default host)
+	UploadedAt                *time.Time      // Original upload time, e.g. when importing from another system (default = now)
+	ClientMetadata            json.RawMessage // Opaque client-side encryption metadata (clones default to the source's)
+	Storage                   string          // Storage backend to store the content on (STORAGE_BACKENDS, empty = the primary)
+}
+
+// UpdateOptions holds the fields to change on an existing file (nil leaves a field unchanged)
+type UpdateOptions struct {
+	ExpiresAt      *time.Time      // New expiration time
+	Password       *string         // New password (empty string removes protection)
+	AccessTokens   *[]string       // New access list (empty removes the restriction)
+	Slug           *string         // New slug
+	LockedUntil    *time.Time      // New retention lock end time
+	Disabled       *bool           // Disable or re-enable public access
+	MaxDownloads   *int64          // New download limit (0 removes the limit)
+	ContentType    *string         // Content type to serve the file as, e.g. to fix a misdetected type
+	ClientMetadata json.RawMessage // New client metadata (JSON null removes it)
 }
 
 // SaveFile saves an uploaded file to storage and creates a database record
-// If replace is true and a file with the same original name exists, it will replace that file's content
-func (s *FileService) SaveFile(fileHeader *multipart.FileHeader, expiresAt *time.Time, password *string, slug *string, replace bool) (*models.File, error) {
+// If opts.Replace is true and a file with the same original name exists, it will replace that file's content
+func (s *FileService) SaveFile(fileHeader *multipart.FileHeader, opts SaveOptions) (*models.File, error) {
+	return s.saveUpload(uploadFromFileHeader(fileHeader), opts)
+}
+
+// saveUpload stores an upload's content and creates its database record, in a trace span
+func (s *FileService) saveUpload(upload *Upload, opts SaveOptions) (*models.File, error) {
+	ctx, span := tracing.Start(s.context(), "FileService.saveUpload",
+		attribute.String("file.name", upload.Filename),
+		attribute.Int64("file.size", upload.Size),
+	)
+	file, err := s.WithContext(ctx).storeUpload(upload, opts)
+	if file != nil {
+		span.SetAttributes(attribute.Int64("file.id", int64(file.ID)))
+	}
+	tracing.End(span, err)
+	return file, err
+}
+
+// storeUpload stores an upload's content and creates its database record
+func (s *FileService) storeUpload(upload *Upload, opts SaveOptions) (*models.File, error) {
+	expiresAt, password, slug := opts.ExpiresAt, opts.Password, opts.Slug
+
+	// Strip characters that break paths and headers, then enforce the length limit
+	upload.Filename = sanitizeFilename(upload.Filename)
+	if len(upload.Filename) > s.maxFilenameLength {
+		return nil, ErrFilenameTooLong
+	}
+
+	// Slugs and original names are unique within the file's domain
+	domain, err := resolveDomain(opts.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	// Content goes to the chosen storage backend, unless it was already uploaded to one
+	if upload.Backend == "" {
+		if upload.Backend, err = s.resolveBackend(opts.Storage); err != nil {
+			return nil, err
+		}
+	}
+
+	// Imported files keep their original upload time, which policy expiry counts from
+	now := time.Now()
+	uploadedAt := now
+	if opts.UploadedAt != nil {
+		if opts.UploadedAt.After(now) {
+			return nil, ErrInvalidUploadTime
+		}
+		uploadedAt = *opts.UploadedAt
+	}
+
+	// A retention policy replaces an explicit expiry date
+	if opts.Policy != "" {
+		if expiresAt != nil {
+			return nil, ErrInvalidExpiry
+		}
+		policy, err := lookupRetentionPolicy(opts.Policy)
+		if err != nil {
+			return nil, err
+		}
+		policyExpiresAt := uploadedAt.Add(policy.Duration)
+		expiresAt = &policyExpiresAt
+	}
+
+	// Absolute and relative expiry are mutually exclusive
+	if opts.ExpiresAfterFirstDownload != nil {
+		if expiresAt != nil || *opts.ExpiresAfterFirstDownload <= 0 {
+			return nil, ErrInvalidExpiry
+		}
+	}
+
+	// A file can't expire before its lock ends
+	if err := validateLockExpiry(expiresAt, opts.LockedUntil); err != nil {
+		return nil, err
+	}
+
+	accessTokens, err := hashAccessTokens(opts.AccessTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clones of encrypted content need the source's metadata to be decrypted
+	clientMetadata, err := normalizeClientMetadata(opts.ClientMetadata)
+	if err != nil {
+		return nil, err
+	}
+	if clientMetadata == nil && opts.ClientMetadata == nil && upload.Source != nil {
+		clientMetadata = upload.Source.ClientMetadata
+	}
+
+	// Compare the declared content type with the actual content (not available yet for
+	// live uploads, which keep the declared type; clones keep the source's types)
+	declaredType := upload.ContentType
+	sniffedType, contentType := "", declaredType
+	if upload.Source != nil {
+		declaredType, sniffedType = upload.Source.DeclaredContentType, upload.Source.SniffedContentType
+	} else if upload.Live {
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	} else {
+		if sniffedType, err = sniffContentType(upload); err != nil {
+			return nil, err
+		}
+		if contentType, err = resolveContentType(s.contentTypePolicy, declaredType, sniffedType); err != nil {
+			return nil, err
+		}
+	}
+
+	contentHash, err := uploadContentHash(upload)
+	if err != nil {
+		return nil, err
+	}
+
+	// With content-addressed slugs, identical content shares the existing link, unless
+	// either file has settings of its own (then the upload gets a file and a longer slug)
+	useContentSlug := s.contentAddressedSlugs && contentHash != "" && (slug == nil || *slug == "") && upload.Source == nil
+	if useContentSlug && !opts.Replace {
+		if existing := s.findContentAddressedFile(domain, contentHash); existing != nil &&
+			s.sharesSettings(existing, upload, opts, expiresAt) {
+			return existing, nil
+		}
+	}
+
 	// Check if we should replace an existing file
-	if replace {
-		existingFile, err := s.GetFileByOriginalName(fileHeader.Filename)
+	if opts.Replace {
+		existingFile, err := s.GetFileByOriginalName(domain, upload.Filename)
 		if err == nil {
 			// File exists, replace it
-			return s.ReplaceFileByOriginalName(existingFile, fileHeader)
+			replaced, err := s.ReplaceFileByOriginalName(existingFile, upload, clientMetadata)
+			if err != nil {
+				return nil, err
+			}
+			events.Publish(events.TypeUpload, replaced.ID, replaced.Slug, replaced.OriginalName)
+			return replaced, nil
 		}
 		// File doesn't exist or error occurred, continue with normal save
 		// (errors other than ErrFileNotFound will be caught later)
 	}
-	// Generate unique filename
-	uniqueFilename, err := s.generateUniqueFilename(fileHeader.Filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate filename: %w", err)
-	}
 
-	// Open uploaded file
-	src, err := fileHeader.Open()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	// New files must expire when permanent files are forbidden; an expiry after the
+	// first download doesn't count, since a file that is never downloaded never expires
+	if s.requireExpiry && expiresAt == nil {
+		return nil, ErrExpiryRequired
 	}
-	defer src.Close()
 
-	// Save to storage backend
-	storagePath, err := s.storage.Save(src, uniqueFilename, fileHeader.Size)
+	// Generate unique filename
+	uniqueFilename, err := s.uploadFilename(upload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to save file to storage: %w", err)
+		return nil, fmt.Errorf("failed to generate filename: %w", err)
 	}
 
 	// Hash password if provided
 	var passwordHash *string
 	if password != nil && *password != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+		hash, err := s.hashPassword(*password)
 		if err != nil {
-			s.storage.Delete(storagePath) // Clean up on error
-			return nil, fmt.Errorf("failed to hash password: %w", err)
+			return nil, err
 		}
-		hashStr := string(hash)
-		passwordHash = &hashStr
+		passwordHash = &hash
 	}
 
 	// Generate or validate slug
@@ -92,45 +440,134 @@ func (s *FileService) SaveFile(fileHeader *multipart.FileHeader, expiresAt *time
 
 	if slug != nil && *slug != "" {
 		// User provided custom slug - validate and check uniqueness
+		*slug = s.normalizeSlug(*slug)
 		if err := s.validateSlug(*slug); err != nil {
-			s.storage.Delete(storagePath) // Clean up on error
 			return nil, err
 		}
-		if err := s.checkSlugUnique(*slug); err != nil {
-			s.storage.Delete(storagePath) // Clean up on error
+		if err := s.checkSlugUnique(domain, *slug); err != nil {
 			return nil, err
 		}
 		fileSlug = *slug
 		// Make original filename unique if duplicate exists
-		uniqueOriginalName = s.makeOriginalNameUnique(fileHeader.Filename, uniqueFilename)
+		uniqueOriginalName, err = s.makeOriginalNameUnique(domain, upload.Filename, uniqueFilename)
+		if err != nil {
+			return nil, err
+		}
+	} else if useContentSlug {
+		// Content-addressed slug - derived from the content hash
+		uniqueOriginalName, err = s.makeOriginalNameUnique(domain, upload.Filename, uniqueFilename)
+		if err != nil {
+			return nil, err
+		}
+		fileSlug, err = s.contentAddressedSlug(domain, contentHash)
+		if err != nil {
+			return nil, err
+		}
+	} else if s.slugTemplate != "" {
+		// Slug from SLUG_TEMPLATE - keep the original name for downloads
+		uniqueOriginalName, err = s.makeOriginalNameUnique(domain, upload.Filename, uniqueFilename)
+		if err != nil {
+			return nil, err
+		}
+		fileSlug, err = s.slugFromTemplate(domain, upload.Filename, uploadedAt)
+		if err != nil {
+			return nil, err
+		}
+	} else if s.strictSlugs || (s.transliterateSlugs && !isASCII(upload.Filename)) {
+		// Strict mode or non-ASCII filename - keep the original name for downloads, but use a URL-safe slug
+		uniqueOriginalName, err = s.makeOriginalNameUnique(domain, upload.Filename, uniqueFilename)
+		if err != nil {
+			return nil, err
+		}
+		fileSlug, err = s.generateSlugFromFilename(domain, upload.Filename)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		// No custom slug provided - use original filename as slug
 		// Make both slug and original name unique together (same value)
-		uniqueOriginalName, err = s.makeFilenameAndSlugUnique(fileHeader.Filename, uniqueFilename)
+		uniqueOriginalName, err = s.makeFilenameAndSlugUnique(domain, upload.Filename, uniqueFilename)
+		if errors.Is(err, ErrFilenameTaken) {
+			return nil, err
+		}
 		if err != nil {
-			s.storage.Delete(storagePath) // Clean up on error
 			return nil, fmt.Errorf("failed to generate unique filename: %w", err)
 		}
 		fileSlug = uniqueOriginalName // Slug is the same as the unique original name
 	}
 
+	// Save to storage backend (reusing an identical object in CAS mode). This happens
+	// only once everything else has been validated, and the content is discarded again
+	// if the record can't be committed.
+	storagePath, pendingKey, unlock, err := s.storeContent(upload, uniqueFilename, contentHash)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	// Create database record
 	file := &models.File{
+		CreatedAt:    now,
 		Filename:     uniqueFilename,
 		OriginalName: uniqueOriginalName,
 		FilePath:     storagePath,
-		FileSize:     fileHeader.Size,
-		ContentType:  fileHeader.Header.Get("Content-Type"),
+		FileSize:     upload.Size,
+		ContentType:  contentType,
 		Slug:         fileSlug,
+		Domain:       domain,
 		PasswordHash: passwordHash,
+		AccessTokens: accessTokens,
 		ExpiresAt:    expiresAt,
+
+		ExpiresAfterFirstDownload: opts.ExpiresAfterFirstDownload,
+		LockedUntil:               opts.LockedUntil,
+		DeclaredContentType:       declaredType,
+		SniffedContentType:        sniffedType,
+		ContentHash:               contentHash,
+		MaxDownloads:              opts.MaxDownloads,
+		Language:                  opts.Language,
+		OriginalUploadedAt:        uploadedAt,
+		ClientMetadata:            clientMetadata,
+		InProgress:                upload.Live,
+		StorageBackend:            upload.Backend,
 	}
 
-	if err := database.DB.Create(file).Error; err != nil {
-		s.storage.Delete(storagePath) // Clean up on error
+	// Create the record and settle the content's pending upload together. The pending
+	// upload is claimed first, so of concurrent registrations of a direct upload, the
+	// ones that lose fail with ErrUploadRegistered rather than on the slug they share.
+	_, dbSpan := tracing.Start(s.context(), "db.createFile")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := settlePendingUpload(tx, upload, pendingKey); err != nil {
+			return err
+		}
+		return tx.Create(file).Error
+	})
+	tracing.End(dbSpan, err)
+	if err != nil {
+		s.discardContent(upload, storagePath, pendingKey) // Clean up on error
+		if isUniqueViolation(err, "slug") {
+			return nil, ErrSlugTaken // Claimed by a concurrent upload since it was checked
+		}
+		if isUniqueViolation(err, "original_name") {
+			return nil, ErrFilenameTaken // Likewise for the name (see idx_domain_original_name)
+		}
 		return nil, fmt.Errorf("failed to create database record: %w", err)
 	}
 
+	// Propagate the lock to the storage backend if supported
+	if err := s.lockStorageObject(file); err != nil {
+		database.DB.Unscoped().Delete(file) // Clean up on error
+		if pendingKey != "" {
+			journalContent(upload, pendingKey) // Track the object again until it is gone
+		}
+		s.discardContent(upload, storagePath, pendingKey)
+		return nil, err
+	}
+
+	s.tagStorageObject(file)
+
+	events.Publish(events.TypeUpload, file.ID, file.Slug, file.OriginalName)
+
 	return file, nil
 }
 
@@ -151,27 +588,33 @@ func (s *FileService) GetFile(id uint) (*models.File, error) {
 	return &file, nil
 }
 
-// GetFileBySlug retrieves a file by its slug
-func (s *FileService) GetFileBySlug(slug string) (*models.File, error) {
-	var file models.File
-	if err := database.DB.Where("slug = ?", slug).First(&file).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrFileNotFound
-		}
-		return nil, err
-	}
-
-	if file.IsExpired() {
-		return nil, ErrFileExpired
-	}
+// GetFileBySlug retrieves a file by its slug within a domain's namespace
+// ("" for the default host), served from the metadata cache when possible
+func (s *FileService) GetFileBySlug(domain, slug string) (*models.File, error) {
+	return s.lookupFile(slugCacheKey(domain, slug), "domain = ? AND slug = ?", domain, slug)
+}
 
-	return &file, nil
+// GetFileByOriginalName retrieves a file by its original filename within a domain's namespace,
+// served from the metadata cache when possible
+func (s *FileService) GetFileByOriginalName(domain, originalName string) (*models.File, error) {
+	return s.lookupFile(nameCacheKey(domain, originalName), "domain = ? AND original_name = ?", domain, originalName)
 }
 
-// GetFileByOriginalName retrieves a file by its original filename
-func (s *FileService) GetFileByOriginalName(originalName string) (*models.File, error) {
+// lookupFile finds an active file by a query, caching the result under key.
+// Cached files are re-checked for expiry and moderation on every hit.
+func (s *FileService) lookupFile(key string, query string, args ...interface{}) (*models.File, error) {
+	if cached, ok := s.cache.Get(key); ok {
+		if cached.IsExpired() {
+			return nil, ErrFileExpired
+		}
+		if cached.IsDisabled() {
+			return nil, ErrFileDisabled
+		}
+		return cached, nil
+	}
+
 	var file models.File
-	if err := database.DB.Where("original_name = ?", originalName).First(&file).Error; err != nil {
+	if err := database.DB.Where(query, args...).First(&file).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrFileNotFound
 		}
@@ -182,34 +625,143 @@ func (s *FileService) GetFileByOriginalName(originalName string) (*models.File,
 		return nil, ErrFileExpired
 	}
 
+	if file.IsDisabled() {
+		return nil, ErrFileDisabled
+	}
+
+	s.cache.Put(key, &file)
+
 	return &file, nil
 }
 
+// ListFilter narrows a file listing to an expiry window and sets its order
+type ListFilter struct {
+	ExpiresAfter     *time.Time // Only files expiring after this time
+	ExpiresBefore    *time.Time // Only files expiring before this time
+	IncludePermanent bool       // Also list files without an expiry date when a window is set
+	Sort             string     // Column to sort by, "-" prefixed for descending (empty = DEFAULT_LIST_SORT)
+}
+
 // ListFiles retrieves all non-expired files
 func (s *FileService) ListFiles() ([]models.File, error) {
+	return s.ListFilesMatching(ListFilter{})
+}
+
+// ListFilesMatching retrieves the non-expired files matching a filter. Files without
+// an expiry date are only listed in an expiry window if IncludePermanent is set.
+func (s *FileService) ListFilesMatching(filter ListFilter) ([]models.File, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = s.defaultListSort
+	}
+	order, err := listOrder(sort)
+	if err != nil {
+		return nil, err
+	}
+
+	query := database.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+
+	if filter.ExpiresAfter != nil || filter.ExpiresBefore != nil {
+		conds := []string{"expires_at IS NOT NULL"}
+		var args []interface{}
+		if filter.ExpiresAfter != nil {
+			conds = append(conds, "expires_at > ?")
+			args = append(args, *filter.ExpiresAfter)
+		}
+		if filter.ExpiresBefore != nil {
+			conds = append(conds, "expires_at < ?")
+			args = append(args, *filter.ExpiresBefore)
+		}
+		window := strings.Join(conds, " AND ")
+		if filter.IncludePermanent {
+			window = "(" + window + ") OR expires_at IS NULL"
+		}
+		query = query.Where(window, args...)
+	}
+
 	var files []models.File
-	if err := database.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
-		Order("created_at DESC").
-		Find(&files).Error; err != nil {
+	if err := query.Order(order).Find(&files).Error; err != nil {
 		return nil, err
 	}
 	return files, nil
 }
 
-// UpdateFile updates a file's expiry date, password, and/or slug
-func (s *FileService) UpdateFile(id uint, expiresAt *time.Time, password *string, slug *string) (*models.File, error) {
+// UpdateFile updates a file's expiry date, password, slug, and/or lock
+func (s *FileService) UpdateFile(id uint, opts UpdateOptions) (*models.File, error) {
+	expiresAt, password, slug := opts.ExpiresAt, opts.Password, opts.Slug
+
 	file, err := s.GetFile(id)
 	if err != nil {
 		return nil, err
 	}
 
+	// Locked files can't be modified until the lock ends
+	if file.IsLocked() {
+		return nil, ErrFileLocked
+	}
+
+	// Check the resulting expiry against the resulting lock
+	newExpiresAt, newLockedUntil := file.ExpiresAt, file.LockedUntil
+	if expiresAt != nil {
+		newExpiresAt = expiresAt
+	}
+	if opts.LockedUntil != nil {
+		newLockedUntil = opts.LockedUntil
+	}
+	if err := validateLockExpiry(newExpiresAt, newLockedUntil); err != nil {
+		return nil, err
+	}
+
 	updates := make(map[string]interface{})
 
+	// Update lock
+	if opts.LockedUntil != nil {
+		updates["locked_until"] = opts.LockedUntil
+	}
+
+	// Update moderation state
+	if opts.Disabled != nil {
+		if *opts.Disabled {
+			if !file.IsDisabled() {
+				updates["disabled_at"] = time.Now()
+			}
+		} else {
+			updates["disabled_at"] = nil
+		}
+	}
+
 	// Update expiry date
 	if expiresAt != nil {
 		updates["expires_at"] = expiresAt
 	}
 
+	// Update download limit
+	if opts.MaxDownloads != nil {
+		if *opts.MaxDownloads <= 0 {
+			updates["max_downloads"] = nil
+		} else {
+			updates["max_downloads"] = *opts.MaxDownloads
+		}
+	}
+
+	// Override the stored content type (the declared and sniffed types are kept)
+	if opts.ContentType != nil {
+		contentType, err := NormalizeContentType(*opts.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		updates["content_type"] = contentType
+	}
+
+	// Replace the client metadata (e.g., a key re-wrapped for new recipients)
+	if opts.ClientMetadata != nil {
+		clientMetadata, err := normalizeClientMetadata(opts.ClientMetadata)
+		if err != nil {
+			return nil, err
+		}
+		updates["client_metadata"] = clientMetadataColumn(clientMetadata)
+	}
+
 	// Update password
 	if password != nil {
 		if *password == "" {
@@ -217,15 +769,30 @@ func (s *FileService) UpdateFile(id uint, expiresAt *time.Time, password *string
 			updates["password_hash"] = nil
 		} else {
 			// Set new password
-			hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+			hash, err := s.hashPassword(*password)
 			if err != nil {
-				return nil, fmt.Errorf("failed to hash password: %w", err)
+				return nil, err
 			}
-			updates["password_hash"] = string(hash)
+			updates["password_hash"] = hash
+		}
+	}
+
+	// Update access list
+	if opts.AccessTokens != nil {
+		hashes, err := hashAccessTokens(*opts.AccessTokens)
+		if err != nil {
+			return nil, err
+		}
+		if updates["access_tokens"], err = accessTokensColumn(hashes); err != nil {
+			return nil, fmt.Errorf("failed to encode access list: %w", err)
 		}
 	}
 
 	// Update slug
+	if slug != nil && *slug != "" {
+		normalized := s.normalizeSlug(*slug)
+		slug = &normalized
+	}
 	if slug != nil && *slug != "" && *slug != file.Slug {
 		// Validate new slug
 		if err := s.validateSlug(*slug); err != nil {
@@ -233,19 +800,50 @@ func (s *FileService) UpdateFile(id uint, expiresAt *time.Time, password *string
 		}
 		// Check if slug is unique (excluding current file and soft-deleted files)
 		var count int64
-		database.DB.Model(&models.File{}).Where("slug = ? AND id != ? AND deleted_at IS NULL", *slug, id).Count(&count)
+		database.DB.Model(&models.File{}).Where("domain = ? AND slug = ? AND id != ? AND deleted_at IS NULL", file.Domain, *slug, id).Count(&count)
 		if count > 0 {
 			return nil, ErrSlugTaken
 		}
 		updates["slug"] = *slug
 	}
 
-	if err := database.DB.Model(file).Updates(updates).Error; err != nil {
+	previous := *file // Updates also writes the new values into file
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(file).Updates(updates).Error; err != nil {
+			return err
+		}
+		// Keep links to the old slug working
+		if newSlug, renamed := updates["slug"].(string); renamed {
+			return recordSlugChange(tx, file, previous.Slug, newSlug)
+		}
+		return nil
+	})
+	if err != nil {
+		if isUniqueViolation(err, "slug") {
+			return nil, ErrSlugTaken
+		}
+		if isUniqueViolation(err, "original_name") {
+			return nil, ErrFilenameTaken
+		}
 		return nil, fmt.Errorf("failed to update file: %w", err)
 	}
+	s.cache.InvalidateFile(id)
 
 	// Reload to get updated values
-	return s.GetFile(id)
+	updated, err := s.GetFile(id)
+	if err != nil {
+		return nil, err
+	}
+	purgeCDN(&previous, updated)
+
+	if opts.LockedUntil != nil {
+		if err := s.lockStorageObject(updated); err != nil {
+			return nil, err
+		}
+	}
+	s.tagStorageObject(updated)
+
+	return updated, nil
 }
 
 // DeleteFile deletes a file from storage and database
@@ -255,8 +853,14 @@ func (s *FileService) DeleteFile(id uint) error {
 		return err
 	}
 
-	// Delete file from storage
-	if err := s.storage.Delete(file.FilePath); err != nil {
+	if file.IsLocked() {
+		return ErrFileLocked
+	}
+
+	// Delete file from storage (kept while other files share it in CAS mode)
+	unlock := s.lockContent()
+	defer unlock()
+	if err := s.releaseContent(file.StorageBackend, file.FilePath, file.ID); err != nil {
 		return fmt.Errorf("failed to delete file from storage: %w", err)
 	}
 
@@ -264,13 +868,127 @@ func (s *FileService) DeleteFile(id uint) error {
 	if err := database.DB.Delete(file).Error; err != nil {
 		return fmt.Errorf("failed to delete from database: %w", err)
 	}
+	s.cache.InvalidateFile(file.ID)
+	purgeCDN(file)
+	s.dropImageVariants(file.ID)
+	dropSlugHistory(file.ID)
+
+	events.Publish(events.TypeDelete, file.ID, file.Slug, file.OriginalName)
 
 	return nil
 }
 
-// GetFileReader returns a reader for the file content from storage
+// PruneMissingFile soft-deletes a file whose storage object no longer exists,
+// so the catalog stays consistent after out-of-band deletions. It only runs when
+// AUTO_PRUNE_MISSING is enabled, and never prunes locked files.
+// Callers must only use it after storage reported ErrObjectNotFound, not on transient errors.
+func (s *FileService) PruneMissingFile(file *models.File) error {
+	if !s.pruneMissing || file.IsLocked() {
+		return nil
+	}
+
+	if err := database.DB.Delete(file).Error; err != nil {
+		return fmt.Errorf("failed to prune file record: %w", err)
+	}
+	s.cache.InvalidateFile(file.ID)
+	purgeCDN(file)
+	s.dropImageVariants(file.ID)
+	dropSlugHistory(file.ID)
+
+	log.Printf("Pruned file %d (%s): storage object %s is missing", file.ID, file.OriginalName, file.FilePath)
+	events.Publish(events.TypeDelete, file.ID, file.Slug, file.OriginalName)
+
+	return nil
+}
+
+// ActivateExpiry starts the relative expiry of a file on its first download.
+// The update only applies while expires_at is still NULL, so concurrent first
+// downloads can't overwrite each other's expiry time.
+func (s *FileService) ActivateExpiry(file *models.File) error {
+	if !file.HasPendingExpiry() {
+		return nil
+	}
+
+	expiresAt := time.Now().Add(*file.ExpiresAfterFirstDownload)
+	// A file can't expire before its lock ends
+	if file.LockedUntil != nil && expiresAt.Before(*file.LockedUntil) {
+		expiresAt = *file.LockedUntil
+	}
+	result := database.DB.Model(&models.File{}).
+		Where("id = ? AND expires_at IS NULL AND expires_after_first_download IS NOT NULL", file.ID).
+		Update("expires_at", expiresAt)
+	if result.Error != nil {
+		return fmt.Errorf("failed to activate expiry: %w", result.Error)
+	}
+	s.cache.InvalidateFile(file.ID)
+
+	// Another download may have activated it first; reload the stored value
+	if result.RowsAffected == 0 {
+		var current models.File
+		if err := database.DB.Select("expires_at").First(&current, file.ID).Error; err != nil {
+			return fmt.Errorf("failed to reload expiry: %w", err)
+		}
+		file.ExpiresAt = current.ExpiresAt
+		return nil
+	}
+
+	file.ExpiresAt = &expiresAt
+	s.tagStorageObject(file)
+	return nil
+}
+
+// GetFileReader returns a reader for the file content from storage. The content of a
+// live upload is followed until the upload ends.
 func (s *FileService) GetFileReader(file *models.File) (io.ReadCloser, error) {
-	return s.storage.Get(file.FilePath)
+	if file.InProgress {
+		if live, ok := liveUploads.Load(file.ID); ok {
+			return s.openLive(file, live.(*liveUpload))
+		}
+	}
+	return s.storageFor(file.StorageBackend).Get(file.FilePath)
+}
+
+// GetFileRangeReader returns a reader for length bytes of a file's content starting at
+// offset, for resumed and partial downloads. Backends that can't read ranges (and live
+// uploads) are read from the start, skipping what comes before offset.
+func (s *FileService) GetFileRangeReader(file *models.File, offset, length int64) (io.ReadCloser, error) {
+	if rangeReader, ok := storage.AsRangeReader(s.storageFor(file.StorageBackend)); ok && !file.InProgress {
+		return rangeReader.GetRange(file.FilePath, offset, length)
+	}
+	reader, err := s.GetFileReader(file)
+	if err != nil {
+		return nil, err
+	}
+	sliced, err := SliceReader(reader, offset, length)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return sliced, nil
+}
+
+// SliceReader returns a reader for length bytes of reader's content starting at offset,
+// discarding what comes before it. Closing it closes reader.
+func SliceReader(reader io.ReadCloser, offset, length int64) (io.ReadCloser, error) {
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		return nil, fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, length), reader}, nil
+}
+
+// hashPassword checks a new file password against the length limit and hashes it
+func (s *FileService) hashPassword(password string) (string, error) {
+	if len(password) > s.maxPasswordLength {
+		return "", &PasswordTooLongError{Max: s.maxPasswordLength}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
 }
 
 // ValidatePassword checks if the provided password matches the file's password hash
@@ -283,6 +1001,12 @@ func (s *FileService) ValidatePassword(file *models.File, password string) error
 		return ErrPasswordRequired
 	}
 
+	// bcrypt would only compare the first 72 bytes, letting a longer guess that starts
+	// with the password through; no file password can be that long
+	if len(password) > maxBcryptPasswordLength {
+		return ErrInvalidPassword
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(*file.PasswordHash), []byte(password)); err != nil {
 		return ErrInvalidPassword
 	}
@@ -290,47 +1014,82 @@ func (s *FileService) ValidatePassword(file *models.File, password string) error
 	return nil
 }
 
-// ReplaceFileByOriginalName replaces an existing file's content while preserving metadata
-func (s *FileService) ReplaceFileByOriginalName(existingFile *models.File, fileHeader *multipart.FileHeader) (*models.File, error) {
-	// Generate new unique filename
-	uniqueFilename, err := s.generateUniqueFilename(fileHeader.Filename)
+// ReplaceFileByOriginalName replaces an existing file's content while preserving metadata.
+// The client metadata describes the content, so it is replaced too (nil removes it).
+// The new content is stored on the file's storage backend.
+func (s *FileService) ReplaceFileByOriginalName(existingFile *models.File, upload *Upload, clientMetadata json.RawMessage) (*models.File, error) {
+	if existingFile.IsLocked() {
+		return nil, ErrFileLocked
+	}
+	upload.Backend = existingFile.StorageBackend
+
+	// Compare the declared content type with the actual content
+	declaredType := upload.ContentType
+	sniffedType, err := sniffContentType(upload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate filename: %w", err)
+		return nil, err
+	}
+	contentType, err := resolveContentType(s.contentTypePolicy, declaredType, sniffedType)
+	if err != nil {
+		return nil, err
 	}
 
-	// Open uploaded file
-	src, err := fileHeader.Open()
+	contentHash, err := uploadContentHash(upload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+		return nil, err
 	}
-	defer src.Close()
 
-	// Save new file to storage backend
-	storagePath, err := s.storage.Save(src, uniqueFilename, fileHeader.Size)
+	// Generate new unique filename
+	uniqueFilename, err := s.uploadFilename(upload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to save file to storage: %w", err)
+		return nil, fmt.Errorf("failed to generate filename: %w", err)
 	}
 
-	// Delete old file from storage
-	if err := s.storage.Delete(existingFile.FilePath); err != nil {
-		// Try to clean up new file if old deletion fails
-		s.storage.Delete(storagePath)
-		return nil, fmt.Errorf("failed to delete old file from storage: %w", err)
+	// Save new file to storage backend
+	oldBackend, oldPath := existingFile.StorageBackend, existingFile.FilePath
+	storagePath, pendingKey, unlock, err := s.storeContent(upload, uniqueFilename, contentHash)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
 	// Update database record with new file details
 	updates := map[string]interface{}{
 		"filename":     uniqueFilename,
 		"file_path":    storagePath,
-		"file_size":    fileHeader.Size,
-		"content_type": fileHeader.Header.Get("Content-Type"),
+		"file_size":    upload.Size,
+		"content_type": contentType,
+
+		"declared_content_type": declaredType,
+		"sniffed_content_type":  sniffedType,
+		"content_hash":          contentHash,
+		"client_metadata":       clientMetadataColumn(clientMetadata),
 	}
 
-	if err := database.DB.Model(existingFile).Updates(updates).Error; err != nil {
-		// Old file is already deleted, so we can't fully rollback
+	// Commit the record first: until then it keeps pointing at the old content, so a
+	// failed update only needs the new object deleted again
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(existingFile).Updates(updates).Error; err != nil {
+			return err
+		}
+		return settlePendingUpload(tx, upload, pendingKey)
+	}); err != nil {
+		s.discardContent(upload, storagePath, pendingKey)
 		return nil, fmt.Errorf("failed to update database record: %w", err)
 	}
 
+	// Then release the old content (unless it is unchanged in CAS mode). The record is
+	// already consistent; an object that can't be deleted now is left to cleanup.
+	if storagePath != oldPath {
+		if err := s.releaseContent(oldBackend, oldPath, existingFile.ID); err != nil {
+			log.Printf("Warning: failed to delete replaced content %s of file %d: %v", oldPath, existingFile.ID, err)
+			journalReleased(oldBackend, oldPath)
+		}
+	}
+	s.cache.InvalidateFile(existingFile.ID)
+	purgeCDN(existingFile)
+	s.dropImageVariants(existingFile.ID) // Made from the old content
+
 	// Reload to get updated values
 	return s.GetFile(existingFile.ID)
 }
@@ -338,24 +1097,188 @@ func (s *FileService) ReplaceFileByOriginalName(existingFile *models.File, fileH
 // CleanupExpiredFiles removes expired files from storage and database
 func (s *FileService) CleanupExpiredFiles() error {
 	var expiredFiles []models.File
-	if err := database.DB.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).
+	now := time.Now()
+	if err := database.DB.Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Where("locked_until IS NULL OR locked_until <= ?", now).
 		Find(&expiredFiles).Error; err != nil {
 		return err
 	}
 
 	for _, file := range expiredFiles {
-		// Delete file from storage
-		if err := s.storage.Delete(file.FilePath); err != nil {
+		unlock := s.lockContent()
+
+		// Delete file from storage (kept while other files share it in CAS mode)
+		if err := s.releaseContent(file.StorageBackend, file.FilePath, file.ID); err != nil {
 			// Log error but continue
 			fmt.Printf("Warning: failed to delete expired file %s: %v\n", file.FilePath, err)
 		}
 
 		// Delete from database
 		if err := database.DB.Delete(&file).Error; err != nil {
+			unlock()
 			fmt.Printf("Warning: failed to delete expired file record %d: %v\n", file.ID, err)
+			continue
+		}
+		unlock()
+		s.cache.InvalidateFile(file.ID)
+		purgeCDN(&file)
+		s.dropImageVariants(file.ID)
+		dropSlugHistory(file.ID)
+
+		events.Publish(events.TypeExpiry, file.ID, file.Slug, file.OriginalName)
+	}
+
+	// Remove direct uploads that were presigned but never registered
+	if err := s.cleanupPendingUploads(); err != nil {
+		fmt.Printf("Warning: failed to clean up pending uploads: %v\n", err)
+	}
+
+	// Remove live uploads whose writer went away
+	if err := s.cleanupInterruptedLiveUploads(); err != nil {
+		fmt.Printf("Warning: failed to clean up interrupted live uploads: %v\n", err)
+	}
+
+	return nil
+}
+
+// findContentAddressedFile returns an active file with the given content hash whose slug
+// was derived from that hash, or nil if there is none
+func (s *FileService) findContentAddressedFile(domain, contentHash string) *models.File {
+	var candidates []models.File
+	if err := database.DB.Where("domain = ? AND content_hash = ?", domain, contentHash).Find(&candidates).Error; err != nil {
+		return nil
+	}
+
+	for i := range candidates {
+		file := &candidates[i]
+		if file.IsExpired() || file.IsDisabled() {
+			continue
+		}
+		if len(file.Slug) >= s.contentHashSlugLength && strings.HasPrefix(contentHash, file.Slug) {
+			return file
+		}
+	}
+	return nil
+}
+
+// sharesSettings reports whether an upload may be given an existing file with the same
+// content instead of a file of its own: neither may restrict access (password, access
+// list, download limit, lock, or client metadata), and both must expire the same way and
+// be stored on the same backend. Handing out the existing file otherwise would drop the
+// upload's protection, or grant the existing file's.
+func (s *FileService) sharesSettings(file *models.File, upload *Upload, opts SaveOptions, expiresAt *time.Time) bool {
+	if (opts.Password != nil && *opts.Password != "") || len(opts.AccessTokens) > 0 ||
+		opts.MaxDownloads != nil || opts.LockedUntil != nil || len(opts.ClientMetadata) > 0 {
+		return false
+	}
+	if file.HasPassword() || file.HasAccessList() || file.MaxDownloads != nil ||
+		file.LockedUntil != nil || file.ClientMetadata != nil {
+		return false
+	}
+	return equalTimes(file.ExpiresAt, expiresAt) &&
+		equalDurations(file.ExpiresAfterFirstDownload, opts.ExpiresAfterFirstDownload) &&
+		file.Language == opts.Language &&
+		s.sameBackend(file.StorageBackend, upload.Backend)
+}
+
+// equalTimes reports whether two optional times are both unset or the same instant
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// equalDurations reports whether two optional durations are both unset or equal
+func equalDurations(a, b *time.Duration) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// contentAddressedSlug returns a slug made from a prefix of the content hash.
+// If the prefix is already taken (e.g., by a custom slug), a longer prefix is used.
+func (s *FileService) contentAddressedSlug(domain, contentHash string) (string, error) {
+	for length := s.contentHashSlugLength; length <= len(contentHash); length += 4 {
+		candidate := contentHash[:length]
+		if err := s.checkSlugUnique(domain, candidate); err == nil {
+			return candidate, nil
 		}
 	}
+	return "", ErrSlugTaken
+}
+
+// lockStorageObject applies the file's lock to the storage backend, if the backend supports locking
+func (s *FileService) lockStorageObject(file *models.File) error {
+	if !file.IsLocked() {
+		return nil
+	}
+
+	locker, ok := storage.AsLocker(s.storageFor(file.StorageBackend))
+	if !ok {
+		return nil
+	}
 
+	if err := locker.Lock(file.FilePath, *file.LockedUntil); err != nil {
+		return fmt.Errorf("failed to lock file in storage: %w", err)
+	}
+	return nil
+}
+
+// tagStorageObject sets the storage object's tags from the file's metadata, if the backend
+// tags objects (S3_OBJECT_TAGS). Tags only feed storage lifecycle rules and the cleanup
+// job still removes expired files, so failures are logged rather than returned.
+func (s *FileService) tagStorageObject(file *models.File) {
+	tagger, ok := storage.AsTagger(s.storageFor(file.StorageBackend))
+	if !ok || file.InProgress {
+		return
+	}
+
+	vars := map[string]string{
+		"id":           strconv.FormatUint(uint64(file.ID), 10),
+		"slug":         file.Slug,
+		"domain":       file.Domain,
+		"content_type": file.ContentType,
+		"created_date": file.CreatedAt.UTC().Format(time.DateOnly),
+	}
+
+	// A shared object (CAS mode) must outlive every file using it: tag the latest expiry,
+	// or none if any of them never expires
+	expiresAt := file.ExpiresAt
+	if s.storageMode == StorageModeCAS {
+		var sharing []models.File
+		if err := database.DB.Select("expires_at").
+			Where("file_path = ? AND id != ?", file.FilePath, file.ID).
+			Find(&sharing).Error; err != nil {
+			log.Printf("Warning: not tagging %s: failed to load files sharing it: %v", file.FilePath, err)
+			return
+		}
+		for _, other := range sharing {
+			if expiresAt == nil || other.ExpiresAt == nil {
+				expiresAt = nil
+				break
+			}
+			if other.ExpiresAt.After(*expiresAt) {
+				expiresAt = other.ExpiresAt
+			}
+		}
+	}
+	if expiresAt != nil {
+		vars["expires"] = expiresAt.UTC().Format(time.RFC3339)
+		vars["expires_date"] = expiresAt.UTC().Format(time.DateOnly)
+	}
+
+	if err := tagger.Tag(file.FilePath, vars); err != nil {
+		log.Printf("Warning: failed to tag storage object of file %d: %v", file.ID, err)
+	}
+}
+
+// validateLockExpiry ensures an expiry time doesn't fall before the lock end time
+func validateLockExpiry(expiresAt, lockedUntil *time.Time) error {
+	if expiresAt != nil && lockedUntil != nil && expiresAt.Before(*lockedUntil) {
+		return ErrInvalidExpiry
+	}
 	return nil
 }
 
@@ -376,43 +1299,55 @@ func (s *FileService) generateUniqueFilename(originalName string) (string, error
 	return uniqueID + ext, nil
 }
 
-// makeOriginalNameUnique ensures the original filename is unique by appending hex prefix if needed
-func (s *FileService) makeOriginalNameUnique(originalName, uniqueFilename string) string {
-	// Check if original name already exists (excluding soft-deleted)
-	var count int64
-	database.DB.Model(&models.File{}).Where("original_name = ? AND deleted_at IS NULL", originalName).Count(&count)
-
-	if count == 0 {
-		// No duplicate, return as-is
-		return originalName
+// makeOriginalNameUnique ensures the original filename is unique, renaming it as
+// FILENAME_COLLISION says (by default appending a hex suffix) or returning ErrFilenameTaken
+func (s *FileService) makeOriginalNameUnique(domain, originalName, uniqueFilename string) (string, error) {
+	if !s.originalNameTaken(domain, originalName) {
+		return originalName, nil
+	}
+	switch s.collisionStrategy {
+	case CollisionReject:
+		return "", ErrFilenameTaken
+	case CollisionSuffixCounter:
+		return s.counterName(domain, originalName, false)
 	}
 
-	// Duplicate found - append first 5 chars of unique filename
+	// Append the first 5 chars of the unique filename,
+	// using more of it in the unlikely case that name is taken too
 	ext := filepath.Ext(originalName)
 	basename := strings.TrimSuffix(originalName, ext)
-
-	// Extract first 5 chars from the hex filename (excluding extension)
 	hexFilename := strings.TrimSuffix(uniqueFilename, filepath.Ext(uniqueFilename))
-	prefix := ""
-	if len(hexFilename) >= 5 {
-		prefix = hexFilename[:5]
-	} else {
-		prefix = hexFilename
+
+	candidate := originalName
+	for length := 5; s.originalNameTaken(domain, candidate) && length <= len(hexFilename); length++ {
+		candidate = fmt.Sprintf("%s-%s%s", basename, hexFilename[:length], ext)
 	}
+	return candidate, nil
+}
 
-	return fmt.Sprintf("%s-%s%s", basename, prefix, ext)
+// originalNameTaken checks whether an active file in the domain already has the original name
+func (s *FileService) originalNameTaken(domain, originalName string) bool {
+	var count int64
+	database.DB.Model(&models.File{}).Where("domain = ? AND original_name = ? AND deleted_at IS NULL", domain, originalName).Count(&count)
+	return count > 0
 }
 
 // makeFilenameAndSlugUnique ensures both the original filename and slug are unique (returns same value for both)
-func (s *FileService) makeFilenameAndSlugUnique(originalName, uniqueFilename string) (string, error) {
-	// Check if original name already exists in either original_name or slug columns (excluding soft-deleted)
+func (s *FileService) makeFilenameAndSlugUnique(domain, originalName, uniqueFilename string) (string, error) {
+	// Check if original name already exists in the domain's original_name or slug columns (excluding soft-deleted)
 	var count int64
-	database.DB.Model(&models.File{}).Where("(original_name = ? OR slug = ?) AND deleted_at IS NULL", originalName, originalName).Count(&count)
+	database.DB.Model(&models.File{}).Where("domain = ? AND (original_name = ? OR slug = ?) AND deleted_at IS NULL", domain, originalName, originalName).Count(&count)
 
 	if count == 0 {
 		// No duplicate, return as-is
 		return originalName, nil
 	}
+	switch s.collisionStrategy {
+	case CollisionReject:
+		return "", ErrFilenameTaken
+	case CollisionSuffixCounter:
+		return s.counterName(domain, originalName, true)
+	}
 
 	// Duplicate found - append random suffix before extension
 	ext := filepath.Ext(originalName)
@@ -430,7 +1365,7 @@ func (s *FileService) makeFilenameAndSlugUnique(originalName, uniqueFilename str
 		uniqueName := fmt.Sprintf("%s-%s%s", basename, suffix, ext)
 
 		// Check if this is unique (excluding soft-deleted)
-		database.DB.Model(&models.File{}).Where("(original_name = ? OR slug = ?) AND deleted_at IS NULL", uniqueName, uniqueName).Count(&count)
+		database.DB.Model(&models.File{}).Where("domain = ? AND (original_name = ? OR slug = ?) AND deleted_at IS NULL", domain, uniqueName, uniqueName).Count(&count)
 		if count == 0 {
 			return uniqueName, nil
 		}
@@ -442,38 +1377,77 @@ func (s *FileService) makeFilenameAndSlugUnique(originalName, uniqueFilename str
 // validateSlug checks if a slug is in valid format
 func (s *FileService) validateSlug(slug string) error {
 	if len(slug) < 1 || len(slug) > 100 {
-		return ErrInvalidSlug
+		return &InvalidSlugError{Reason: "must be 1-100 characters"}
+	}
+	// "." and ".." are path segments, not slugs
+	if strings.Trim(slug, ".") == "" {
+		return &InvalidSlugError{Reason: "must not consist only of dots"}
+	}
+	if s.strictSlugs {
+		if !strictSlugRegex.MatchString(slug) {
+			return &InvalidSlugError{Reason: "use lowercase letters, numbers, and hyphens only"}
+		}
+		return nil
 	}
 	if !slugRegex.MatchString(slug) {
-		return ErrInvalidSlug
+		return &InvalidSlugError{Reason: "use letters, numbers, dots, hyphens, and underscores only"}
 	}
 	return nil
 }
 
-// checkSlugUnique checks if a slug is already taken
-func (s *FileService) checkSlugUnique(slug string) error {
+// normalizeSlug prepares a custom slug for validation (lowercased in strict mode)
+func (s *FileService) normalizeSlug(slug string) string {
+	slug = strings.TrimSpace(slug)
+	if s.strictSlugs {
+		slug = strings.ToLower(slug)
+	}
+	return slug
+}
+
+// SlugPath returns the URL path of a share link, escaping each segment of the slug
+// (slugs from SLUG_TEMPLATE may contain "/")
+func SlugPath(slug string) string {
+	segments := strings.Split(slug, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// checkSlugUnique checks if a slug is already taken within a domain
+func (s *FileService) checkSlugUnique(domain, slug string) error {
 	var count int64
-	database.DB.Model(&models.File{}).Where("slug = ? AND deleted_at IS NULL", slug).Count(&count)
+	database.DB.Model(&models.File{}).Where("domain = ? AND slug = ? AND deleted_at IS NULL", domain, slug).Count(&count)
 	if count > 0 {
 		return ErrSlugTaken
 	}
 	return nil
 }
 
-// generateSlugFromFilename creates a URL-safe slug from a filename
-func (s *FileService) generateSlugFromFilename(filename string) (string, error) {
-	// Keep the full filename including extension as the slug
-	slug := filename
-
-	// Replace spaces and underscores with hyphens
-	slug = strings.ReplaceAll(slug, " ", "-")
-	slug = strings.ReplaceAll(slug, "_", "-")
+// CheckSlugAvailable checks whether a custom slug can be used for a new file in the domain,
+// without uploading anything. Returns ErrSlugTaken, ErrInvalidSlug, or ErrUnknownDomain otherwise.
+func (s *FileService) CheckSlugAvailable(domain, slug string) error {
+	domain, err := resolveDomain(domain)
+	if err != nil {
+		return err
+	}
+	slug = s.normalizeSlug(slug)
+	if err := s.validateSlug(slug); err != nil {
+		return err
+	}
+	return s.checkSlugUnique(domain, slug)
+}
 
-	// Remove consecutive hyphens
-	slug = regexp.MustCompile(`-+`).ReplaceAllString(slug, "-")
+// isUniqueViolation reports whether err is a unique index violation involving the files column
+func isUniqueViolation(err error, column string) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") && strings.Contains(msg, "files."+column)
+}
 
-	// Trim hyphens from start and end
-	slug = strings.Trim(slug, "-")
+// generateSlugFromFilename creates a URL-safe slug from a filename
+func (s *FileService) generateSlugFromFilename(domain, filename string) (string, error) {
+	// Keep the full filename including extension as the slug
+	slug := s.slugify(filename)
 
 	// If slug is empty, generate random
 	if slug == "" {
@@ -485,7 +1459,7 @@ func (s *FileService) generateSlugFromFilename(filename string) (string, error)
 	// Make unique by appending random suffix if taken
 	originalSlug := slug
 	for i := 0; i < 100; i++ {
-		if err := s.checkSlugUnique(slug); err == nil {
+		if err := s.checkSlugUnique(domain, slug); err == nil {
 			return slug, nil
 		}
 
@@ -499,3 +1473,68 @@ func (s *FileService) generateSlugFromFilename(filename string) (string, error)
 
 	return "", fmt.Errorf("failed to generate unique slug")
 }
+
+// slugify turns text into slug form: transliterated if enabled, spaces and underscores
+// as hyphens, lowercased in strict mode, and without repeated or surrounding hyphens
+func (s *FileService) slugify(slug string) string {
+	// Transliterate non-ASCII characters (e.g., Cyrillic/CJK) if enabled
+	if s.transliterateSlugs && !isASCII(slug) {
+		slug = transliterate(slug)
+	}
+
+	// Replace spaces and underscores with hyphens
+	slug = strings.ReplaceAll(slug, " ", "-")
+	slug = strings.ReplaceAll(slug, "_", "-")
+
+	// In strict mode, everything but lowercase letters and numbers becomes a hyphen
+	// (e.g., "Report.PDF" -> "report-pdf")
+	if s.strictSlugs {
+		slug = nonStrictSlugChars.ReplaceAllString(strings.ToLower(slug), "-")
+	}
+
+	// Remove consecutive hyphens
+	slug = regexp.MustCompile(`-+`).ReplaceAllString(slug, "-")
+
+	// Trim hyphens from start and end
+	return strings.Trim(slug, "-")
+}
+
+// isASCII reports whether a string contains only ASCII characters
+func isASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeFilename strips directory components and control characters from an
+// uploaded filename (e.g., "../../etc/passwd" -> "passwd"), so it can't break
+// /d/ URLs or Content-Disposition headers, or escape a directory
+func sanitizeFilename(filename string) string {
+	// Treat backslashes as separators too, then keep only the last path element
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+
+	filename = strings.TrimSpace(filename)
+	if strings.Trim(filename, "./") == "" {
+		return "file"
+	}
+	return filename
+}
+
+// transliterate converts a filename to a lowercase ASCII approximation (e.g., "привет.txt" -> "privet.txt")
+func transliterate(filename string) string {
+	ascii := strings.ToLower(unidecode.Unidecode(filename))
+	ascii = strings.TrimSpace(ascii)
+	ascii = nonASCIISlugChars.ReplaceAllString(ascii, "-")
+	// Avoid a dangling hyphen before the extension (e.g., "wen-jian-.pdf")
+	return strings.ReplaceAll(ascii, "-.", ".")
+}
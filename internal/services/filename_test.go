@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMaxFilenameLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    string
+		filename string
+		wantErr  error
+	}{
+		{"default limit", "", strings.Repeat("a", 251) + ".txt", nil},
+		{"over the default limit", "", strings.Repeat("a", 252) + ".txt", ErrFilenameTooLong},
+		{"within the limit", "10", "notes.txt", nil},
+		{"at the limit", "10", "notes1.txt", nil},
+		{"over the limit", "10", "notes12.txt", ErrFilenameTooLong},
+		{"counted in bytes", "10", "äääää.txt", ErrFilenameTooLong},
+		{"counted after sanitizing", "10", "../../dir/notes.txt", nil},
+		{"invalid limit uses the default", "none", strings.Repeat("a", 20) + ".txt", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_FILENAME_LENGTH", tt.limit)
+			s := newTestService(t)
+
+			file, err := s.SaveFileFromReader(tt.filename, "", bytesOf("content"), SaveOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(file.OriginalName) > 255 {
+				t.Fatalf("stored a %d-byte filename", len(file.OriginalName))
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{"/absolute/path/notes.txt", "notes.txt"},
+		{`C:\Users\me\evil.exe`, "evil.exe"},
+		{`..\..\boot.ini`, "boot.ini"},
+		{"line\nbreak\x00.txt", "linebreak.txt"},
+		{"  spaced.txt  ", "spaced.txt"},
+		{"..", "file"},
+		{"/", "file"},
+		{"", "file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := sanitizeFilename(tt.filename); got != tt.want {
+				t.Fatalf("sanitizeFilename(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadStripsDirectories(t *testing.T) {
+	s := newTestService(t)
+
+	file := mustSave(t, s, "../../outside.txt", []byte("content"), SaveOptions{})
+	if file.OriginalName != "outside.txt" {
+		t.Fatalf("original name = %q, want outside.txt", file.OriginalName)
+	}
+	if got := readContent(t, s, file); string(got) != "content" {
+		t.Fatalf("file reads %q", got)
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/events"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// HardDeleteFile permanently removes a file's record, whether it is active or already
+// soft-deleted, along with its storage object (kept while other files share it in CAS
+// mode), cached image variants and slug history. Download log entries, reports and audit
+// log entries referring to the file are kept. Locked files can't be removed.
+func (s *FileService) HardDeleteFile(id uint) error {
+	var file models.File
+	if err := database.DB.Unscoped().First(&file, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+	return s.hardDelete(&file)
+}
+
+// PurgeDeletedFiles permanently removes the files soft-deleted more than olderThan ago
+// (see HardDeleteFile) and returns how many were removed. Files that can't be removed
+// are logged and skipped.
+func (s *FileService) PurgeDeletedFiles(olderThan time.Duration) (int, error) {
+	var files []models.File
+	if err := database.DB.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at <= ?", time.Now().Add(-olderThan)).
+		Find(&files).Error; err != nil {
+		return 0, fmt.Errorf("failed to load deleted files: %w", err)
+	}
+
+	purged := 0
+	for i := range files {
+		if err := s.hardDelete(&files[i]); err != nil {
+			log.Printf("Warning: failed to purge deleted file %d: %v", files[i].ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// hardDelete permanently removes a file loaded with Unscoped
+func (s *FileService) hardDelete(file *models.File) error {
+	if file.IsLocked() {
+		return ErrFileLocked
+	}
+
+	// A soft-deleted file's object is normally gone already; deleting it again is harmless
+	unlock := s.lockContent()
+	defer unlock()
+	if file.FilePath != "" {
+		if err := s.releaseContent(file.StorageBackend, file.FilePath, file.ID); err != nil {
+			return fmt.Errorf("failed to delete file from storage: %w", err)
+		}
+	}
+
+	if err := database.DB.Unscoped().Delete(file).Error; err != nil {
+		return fmt.Errorf("failed to delete from database: %w", err)
+	}
+	s.dropImageVariants(file.ID)
+	dropSlugHistory(file.ID)
+
+	if !file.DeletedAt.Valid {
+		s.cache.InvalidateFile(file.ID)
+		purgeCDN(file)
+		events.Publish(events.TypeDelete, file.ID, file.Slug, file.OriginalName)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+// softDelete marks a file deleted at the given time directly in the database, leaving its
+// content in storage (as when deleting the object failed, or before purging existed)
+func softDelete(t *testing.T, file *models.File, at time.Time) {
+	t.Helper()
+	if err := database.DB.Model(&models.File{}).Where("id = ?", file.ID).UpdateColumn("deleted_at", at).Error; err != nil {
+		t.Fatalf("soft deleting file %d: %v", file.ID, err)
+	}
+}
+
+func TestPurgeDeletedFiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		deletedAgo time.Duration // How long ago the file was soft-deleted (0 = active)
+		locked     bool
+		olderThan  time.Duration
+		wantPurged bool
+	}{
+		{"deleted long ago", 48 * time.Hour, false, 24 * time.Hour, true},
+		{"deleted recently", time.Hour, false, 24 * time.Hour, false},
+		{"all deleted files", time.Minute, false, 0, true},
+		{"active", 0, false, 0, false},
+		{"locked", 48 * time.Hour, true, 24 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newTestDatabase(t)
+			s := newTestServiceWith(t, storage.NewSingleRegistry("local", local))
+			opts := SaveOptions{}
+			if tt.locked {
+				opts.LockedUntil = ptr(time.Now().Add(time.Hour))
+			}
+			file := mustSave(t, s, "notes.txt", []byte("notes"), opts)
+			if err := s.RecordDownload(file); err != nil {
+				t.Fatalf("RecordDownload: %v", err)
+			}
+			if tt.deletedAgo > 0 {
+				softDelete(t, file, time.Now().Add(-tt.deletedAgo))
+			}
+
+			purged, err := s.PurgeDeletedFiles(tt.olderThan)
+			if err != nil {
+				t.Fatalf("PurgeDeletedFiles: %v", err)
+			}
+			if (purged == 1) != tt.wantPurged {
+				t.Fatalf("purged %d files, want purged: %v", purged, tt.wantPurged)
+			}
+
+			var rows int64
+			database.DB.Unscoped().Model(&models.File{}).Where("id = ?", file.ID).Count(&rows)
+			if (rows == 0) != tt.wantPurged {
+				t.Errorf("%d records left (including deleted ones), want purged: %v", rows, tt.wantPurged)
+			}
+			exists, err := local.Exists(file.FilePath)
+			if err != nil {
+				t.Fatalf("Exists: %v", err)
+			}
+			if exists == tt.wantPurged {
+				t.Errorf("content stored = %v, want purged: %v", exists, tt.wantPurged)
+			}
+
+			// Download log entries outlive the file
+			var downloads int64
+			database.DB.Model(&models.Download{}).Where("file_id = ?", file.ID).Count(&downloads)
+			if downloads != 1 {
+				t.Errorf("%d download log entries, want the 1 logged", downloads)
+			}
+		})
+	}
+}
+
+func TestHardDeleteFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, s *FileService) uint // Returns the ID to delete
+		wantErr  error
+		wantRows int64 // Records left with the ID, including deleted ones
+	}{
+		{"active file", func(t *testing.T, s *FileService) uint {
+			return mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{}).ID
+		}, nil, 0},
+		{"soft-deleted file", func(t *testing.T, s *FileService) uint {
+			file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{})
+			if err := s.DeleteFile(file.ID); err != nil {
+				t.Fatalf("DeleteFile: %v", err)
+			}
+			return file.ID
+		}, nil, 0},
+		{"locked file", func(t *testing.T, s *FileService) uint {
+			return mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{LockedUntil: ptr(time.Now().Add(time.Hour))}).ID
+		}, ErrFileLocked, 1},
+		{"missing file", func(t *testing.T, s *FileService) uint { return 999 }, ErrFileNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			id := tt.setup(t, s)
+
+			if err := s.HardDeleteFile(id); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("HardDeleteFile error = %v, want %v", err, tt.wantErr)
+			}
+			var rows int64
+			database.DB.Unscoped().Model(&models.File{}).Where("id = ?", id).Count(&rows)
+			if rows != tt.wantRows {
+				t.Errorf("%d records left, want %d", rows, tt.wantRows)
+			}
+		})
+	}
+}
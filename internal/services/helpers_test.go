@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/storage"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService returns a file service with a fresh, migrated database and local
+// storage in temporary directories. Settings set with t.Setenv beforehand apply.
+func newTestService(t *testing.T) *FileService {
+	t.Helper()
+	local := newTestDatabase(t)
+	return newTestServiceWith(t, storage.NewSingleRegistry("local", local))
+}
+
+// newTestServiceWith returns a file service storing files on the given backends. The
+// database must have been set up with newTestDatabase.
+func newTestServiceWith(t *testing.T, backends *storage.Registry) *FileService {
+	t.Helper()
+	s := NewFileService(backends)
+	s.cache = newFileCache(defaultFileCacheSize, defaultFileCacheTTL) // Not shared between tests
+	return s
+}
+
+// newTestDatabase sets up a fresh, migrated database and returns local storage in a
+// temporary directory
+func newTestDatabase(t *testing.T) *storage.LocalStorage {
+	t.Helper()
+	dir := t.TempDir()
+	if err := database.Initialize(filepath.Join(dir, "test.db"), 5000); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	database.DB.Logger = logger.Discard
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	local, err := storage.NewLocalStorage(filepath.Join(dir, "data"), 0)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return local
+}
+
+// mustSave uploads content as a new file, failing the test on error
+func mustSave(t *testing.T, s *FileService, filename string, content []byte, opts SaveOptions) *models.File {
+	t.Helper()
+	file, err := s.SaveFileFromReader(filename, "", bytes.NewReader(content), opts)
+	if err != nil {
+		t.Fatalf("saving %s: %v", filename, err)
+	}
+	return file
+}
+
+// readContent returns a file's stored content
+func readContent(t *testing.T, s *FileService, file *models.File) []byte {
+	t.Helper()
+	reader, err := s.GetFileReader(file)
+	if err != nil {
+		t.Fatalf("opening file %d: %v", file.ID, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading file %d: %v", file.ID, err)
+	}
+	return content
+}
+
+// bytesOf returns a reader for content
+func bytesOf(content string) *bytes.Reader {
+	return bytes.NewReader([]byte(content))
+}
+
+// ptr returns a pointer to v
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// ImportResult is the outcome of importing one file from disk
+type ImportResult struct {
+	Path    string       // Path of the file on disk
+	File    *models.File // Created file, or the existing file with the same content when skipped
+	Skipped bool         // Content was already imported
+	Err     error        // Set if the file couldn't be imported
+}
+
+// ImportSummary counts the outcomes of a directory import
+type ImportSummary struct {
+	Imported int
+	Skipped  int
+	Failed   int
+}
+
+// ImportDir saves every regular file under dir (recursively, skipping dotfiles) as a new
+// file, with the slug derived from its filename. Files whose content is already stored
+// (same SHA-256) are skipped, so an interrupted import can simply be run again.
+// With keepModTimes, each file's modification time becomes its original upload time.
+// report, if not nil, is called with the outcome of each file.
+// With REQUIRE_EXPIRY set, it returns ErrExpiryRequired before importing anything
+// unless opts gives the files an expiry.
+func (s *FileService) ImportDir(dir string, opts SaveOptions, keepModTimes bool, report func(ImportResult)) (ImportSummary, error) {
+	var summary ImportSummary
+	if s.requireExpiry && opts.Policy == "" && opts.ExpiresAt == nil {
+		return summary, ErrExpiryRequired
+	}
+
+	record := func(result ImportResult) {
+		switch {
+		case result.Err != nil:
+			summary.Failed++
+		case result.Skipped:
+			summary.Skipped++
+		default:
+			summary.Imported++
+		}
+		if report != nil {
+			report(result)
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return summary, err
+	}
+	if !info.IsDir() {
+		return summary, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			record(ImportResult{Path: path, Err: err})
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != dir {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil // Directories are walked; symlinks and devices are ignored
+		}
+
+		file, skipped, err := s.importFile(path, opts, keepModTimes)
+		record(ImportResult{Path: path, File: file, Skipped: skipped, Err: err})
+		return nil
+	})
+	return summary, err
+}
+
+// importFile saves one file from disk, or returns the existing file with the same content
+func (s *FileService) importFile(path string, opts SaveOptions, keepModTime bool) (*models.File, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if keepModTime {
+		modTime := info.ModTime()
+		if now := time.Now(); modTime.After(now) {
+			modTime = now // Clock skew or a bad timestamp; an upload can't be in the future
+		}
+		opts.UploadedAt = &modTime
+	}
+
+	upload := &Upload{
+		Filename:    filepath.Base(path),
+		ContentType: mime.TypeByExtension(filepath.Ext(path)), // Stands in for a client-declared type
+		Size:        info.Size(),
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}
+
+	contentHash, err := hashContent(upload)
+	if err != nil {
+		return nil, false, err
+	}
+	var existing models.File
+	err = database.DB.Where("content_hash = ?", contentHash).Order("id").First(&existing).Error
+	if err == nil {
+		return &existing, true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	file, err := s.saveUpload(upload, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	return file, false, nil
+}
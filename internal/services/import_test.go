@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTree creates files (relative path -> content) under dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+func TestImportDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		existing string // Content already stored before the import, if any
+		want     ImportSummary
+	}{
+		{"flat directory", map[string]string{"a.txt": "a", "b.txt": "b"}, "", ImportSummary{Imported: 2}},
+		{"nested directories", map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deeper/c.txt": "c"}, "", ImportSummary{Imported: 3}},
+		{"dotfiles and dot directories", map[string]string{"a.txt": "a", ".env": "secret", ".git/config": "config"}, "", ImportSummary{Imported: 1}},
+		{"duplicate content in the tree", map[string]string{"a.txt": "same", "b.txt": "same"}, "", ImportSummary{Imported: 1, Skipped: 1}},
+		{"content already stored", map[string]string{"a.txt": "a", "b.txt": "b"}, "a", ImportSummary{Imported: 1, Skipped: 1}},
+		{"empty directory", nil, "", ImportSummary{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			if tt.existing != "" {
+				mustSave(t, s, "existing.txt", []byte(tt.existing), SaveOptions{})
+			}
+
+			var results []ImportResult
+			summary, err := s.ImportDir(dir, SaveOptions{}, false, func(result ImportResult) {
+				results = append(results, result)
+			})
+			if err != nil {
+				t.Fatalf("ImportDir: %v", err)
+			}
+			if summary != tt.want {
+				t.Fatalf("summary = %+v, want %+v", summary, tt.want)
+			}
+			if len(results) != tt.want.Imported+tt.want.Skipped {
+				t.Fatalf("%d files reported, want %d", len(results), tt.want.Imported+tt.want.Skipped)
+			}
+			for _, result := range results {
+				if result.File == nil {
+					t.Fatalf("%s reported without a file", result.Path)
+				}
+				if content := string(readContent(t, s, result.File)); content != tt.files[mustRel(t, dir, result.Path)] {
+					t.Errorf("%s imported as %q", result.Path, content)
+				}
+			}
+
+			// Running it again skips everything
+			again, err := s.ImportDir(dir, SaveOptions{}, false, nil)
+			if err != nil {
+				t.Fatalf("second ImportDir: %v", err)
+			}
+			if again.Imported != 0 || again.Skipped != tt.want.Imported+tt.want.Skipped {
+				t.Fatalf("second import summary = %+v, want everything skipped", again)
+			}
+		})
+	}
+}
+
+func TestImportDirModTimes(t *testing.T) {
+	past := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	future := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name         string
+		modTime      time.Time
+		keepModTimes bool
+		wantPast     bool // Whether the original upload time should be the file's mtime
+	}{
+		{"kept", past, true, true},
+		{"not kept", past, false, false},
+		{"future mtime is clamped", future, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"a.txt": "a"})
+			if err := os.Chtimes(filepath.Join(dir, "a.txt"), tt.modTime, tt.modTime); err != nil {
+				t.Fatalf("Chtimes: %v", err)
+			}
+
+			var result ImportResult
+			before := time.Now()
+			if _, err := s.ImportDir(dir, SaveOptions{}, tt.keepModTimes, func(r ImportResult) { result = r }); err != nil {
+				t.Fatalf("ImportDir: %v", err)
+			}
+			if result.File == nil {
+				t.Fatalf("import failed: %v", result.Err)
+			}
+
+			uploadedAt := result.File.OriginalUploadedAt
+			if tt.wantPast {
+				if !uploadedAt.Equal(tt.modTime) {
+					t.Fatalf("original upload time = %v, want %v", uploadedAt, tt.modTime)
+				}
+			} else if uploadedAt.Before(before.Add(-time.Second)) || uploadedAt.After(time.Now()) {
+				t.Fatalf("original upload time = %v, want the import time", uploadedAt)
+			}
+		})
+	}
+}
+
+func TestImportDirErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"file.txt": "content"})
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"missing directory", filepath.Join(dir, "missing")},
+		{"not a directory", filepath.Join(dir, "file.txt")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			summary, err := s.ImportDir(tt.path, SaveOptions{}, false, nil)
+			if err == nil {
+				t.Fatal("ImportDir succeeded")
+			}
+			if summary != (ImportSummary{}) {
+				t.Fatalf("summary = %+v, want nothing imported", summary)
+			}
+		})
+	}
+}
+
+func TestImportDirRequireExpiry(t *testing.T) {
+	setRetentionPolicies(t, "week=7d")
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name         string
+		opts         SaveOptions
+		wantErr      error
+		wantImported int
+	}{
+		{"no expiry", SaveOptions{}, ErrExpiryRequired, 0},
+		{"policy", SaveOptions{Policy: "week"}, nil, 2},
+		{"expiry date", SaveOptions{ExpiresAt: &tomorrow}, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REQUIRE_EXPIRY", "true")
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+			s := newTestService(t)
+
+			reported := 0
+			summary, err := s.ImportDir(dir, tt.opts, false, func(ImportResult) { reported++ })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ImportDir error = %v, want %v", err, tt.wantErr)
+			}
+			if summary.Imported != tt.wantImported || summary.Failed != 0 || reported != tt.wantImported {
+				t.Fatalf("summary = %+v with %d reported, want %d imported", summary, reported, tt.wantImported)
+			}
+		})
+	}
+}
+
+// mustRel returns path relative to dir
+func mustRel(t *testing.T, dir, path string) string {
+	t.Helper()
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		t.Fatalf("Rel: %v", err)
+	}
+	return filepath.ToSlash(rel)
+}
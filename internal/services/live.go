@@ -0,0 +1,181 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+var (
+	ErrLiveUploadUnsupported = errors.New("storage backend does not support live uploads")
+	ErrLiveUploadFailed      = errors.New("live upload failed")
+	ErrLiveUploadStalled     = errors.New("live upload stalled")
+)
+
+const (
+	livePollInterval = 100 * time.Millisecond // How often a download following a live upload checks for new content
+	liveIdleTimeout  = 5 * time.Minute        // How long a download waits for a stalled live upload
+)
+
+// liveUpload is a live upload still being written by this process
+type liveUpload struct {
+	done chan struct{} // Closed when the upload ends
+	err  error         // Why the upload failed (set before done is closed)
+}
+
+// liveUploads holds the live uploads in progress, by file ID
+var liveUploads sync.Map
+
+// SaveLive creates a file before its content has arrived, then stores the content as it
+// is read from r. Until r is exhausted the file is marked in progress, and downloads
+// follow the growing content (see GetFileReader). Requires a backend that can read
+// objects while they are written (local storage). Live uploads always create a new file.
+func (s *FileService) SaveLive(filename, contentType string, r io.Reader, opts SaveOptions) (*models.File, error) {
+	backend, err := s.resolveBackend(opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := storage.AsTailer(s.storageFor(backend)); !ok {
+		return nil, ErrLiveUploadUnsupported
+	}
+
+	// The record is created with an empty object, so downloads can open it right away
+	opts.Replace = false
+	file, err := s.saveUpload(&Upload{
+		Filename:    filename,
+		ContentType: contentType,
+		Live:        true,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("")), nil
+		},
+		Backend: backend,
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	live := &liveUpload{done: make(chan struct{})}
+	liveUploads.Store(file.ID, live)
+	defer func() {
+		close(live.done)
+		liveUploads.Delete(file.ID)
+	}()
+
+	hasher := sha256.New()
+	counter := &byteCounter{}
+	if _, err := s.storageFor(backend).Save(io.TeeReader(r, io.MultiWriter(hasher, counter)), file.Filename, -1); err != nil {
+		live.err = err
+		s.discardLive(file)
+		return nil, fmt.Errorf("failed to save file to storage: %w", err)
+	}
+
+	updates := map[string]interface{}{
+		"file_size":    counter.n,
+		"content_hash": hex.EncodeToString(hasher.Sum(nil)),
+		"in_progress":  false,
+	}
+	if err := database.DB.Model(file).Updates(updates).Error; err != nil {
+		live.err = err
+		s.discardLive(file)
+		return nil, fmt.Errorf("failed to update database record: %w", err)
+	}
+	s.cache.InvalidateFile(file.ID)
+
+	return s.GetFile(file.ID)
+}
+
+// discardLive removes a live upload that failed, with its content
+func (s *FileService) discardLive(file *models.File) {
+	unlock := s.lockContent()
+	defer unlock()
+	if err := s.releaseContent(file.StorageBackend, file.FilePath, file.ID); err != nil {
+		log.Printf("Warning: failed to delete content of failed live upload %d: %v", file.ID, err)
+	}
+	database.DB.Unscoped().Delete(file)
+	s.cache.InvalidateFile(file.ID)
+}
+
+// cleanupInterruptedLiveUploads deletes files whose live upload was cut short, e.g. by a
+// restart, once they have been in progress without a writer for the pending upload grace period
+func (s *FileService) cleanupInterruptedLiveUploads() error {
+	var files []models.File
+	if err := database.DB.Where("in_progress = ? AND updated_at <= ?", true, time.Now().Add(-pendingUploadGrace)).
+		Find(&files).Error; err != nil {
+		return err
+	}
+
+	for i := range files {
+		if _, ok := liveUploads.Load(files[i].ID); ok {
+			continue // Still being written
+		}
+		log.Printf("Removing interrupted live upload %d (%s)", files[i].ID, files[i].OriginalName)
+		s.discardLive(&files[i])
+	}
+	return nil
+}
+
+// openLive opens the content of a live upload still being written, following it
+// until the upload ends
+func (s *FileService) openLive(file *models.File, live *liveUpload) (io.ReadCloser, error) {
+	tailer, ok := storage.AsTailer(s.storageFor(file.StorageBackend))
+	if !ok {
+		return nil, ErrLiveUploadUnsupported
+	}
+	reader, err := tailer.Tail(file.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	return &tailReader{ReadCloser: reader, live: live}, nil
+}
+
+// tailReader reads a live upload's content, waiting at the end for more until the upload ends.
+// A failed or stalled upload ends the read with an error, so the download isn't taken as complete.
+type tailReader struct {
+	io.ReadCloser
+	live *liveUpload
+}
+
+// Read reads available content, waiting for the upload to write more at the end
+func (t *tailReader) Read(p []byte) (int, error) {
+	idleSince := time.Now()
+	for {
+		n, err := t.ReadCloser.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+
+		select {
+		case <-t.live.done:
+			if t.live.err != nil {
+				return 0, ErrLiveUploadFailed
+			}
+			// Read whatever was written between the last read and the end of the upload
+			return t.ReadCloser.Read(p)
+		case <-time.After(livePollInterval):
+		}
+		if time.Since(idleSince) > liveIdleTimeout {
+			return 0, ErrLiveUploadStalled
+		}
+	}
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter struct {
+	n int64
+}
+
+// Write counts p
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+func TestOriginalNamesAreUnique(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    []string // Original names uploaded before
+		deleteFirst bool     // Delete the first existing file before the upload
+		upload      string
+		wantRenamed bool
+	}{
+		{"free name", []string{"other.pdf"}, false, "report.pdf", false},
+		{"taken name", []string{"report.pdf"}, false, "report.pdf", true},
+		{"taken name and renamed copy", []string{"report.pdf", "report.pdf"}, false, "report.pdf", true},
+		{"name freed by deletion", []string{"report.pdf"}, true, "report.pdf", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			var existing []*models.File
+			for i, name := range tt.existing {
+				existing = append(existing, mustSave(t, s, name, []byte{byte(i)}, SaveOptions{}))
+			}
+			if tt.deleteFirst {
+				if err := s.DeleteFile(existing[0].ID); err != nil {
+					t.Fatalf("DeleteFile: %v", err)
+				}
+			}
+
+			file := mustSave(t, s, tt.upload, []byte("new"), SaveOptions{})
+			if renamed := file.OriginalName != tt.upload; renamed != tt.wantRenamed {
+				t.Fatalf("uploaded %s as %s, want renamed: %v", tt.upload, file.OriginalName, tt.wantRenamed)
+			}
+
+			// Every active file is found by its own name
+			for _, f := range append(existing, file) {
+				if tt.deleteFirst && f == existing[0] {
+					continue
+				}
+				found, err := s.GetFileByOriginalName("", f.OriginalName)
+				if err != nil {
+					t.Fatalf("GetFileByOriginalName(%s): %v", f.OriginalName, err)
+				}
+				if found.ID != f.ID {
+					t.Fatalf("%s found file %d, want %d", f.OriginalName, found.ID, f.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestOriginalNameUniqueIndex(t *testing.T) {
+	tests := []struct {
+		name          string
+		domain        string
+		deleteFirst   bool
+		wantInsertErr bool
+	}{
+		{"duplicate in the same domain", "", false, true},
+		{"duplicate in another domain", "files.example.com", false, false},
+		{"duplicate of a deleted file", "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			first := mustSave(t, s, "report.pdf", []byte("first"), SaveOptions{})
+			if tt.deleteFirst {
+				if err := database.DB.Delete(&models.File{}, first.ID).Error; err != nil {
+					t.Fatalf("soft delete: %v", err)
+				}
+			}
+
+			// Inserted directly, as a concurrent upload that passed the name check would be
+			dup := *first
+			dup.ID = 0
+			dup.Filename = "dup-" + first.Filename
+			dup.Slug = "dup-" + first.Slug
+			dup.FilePath = "dup-" + first.FilePath
+			dup.Domain = tt.domain
+			err := database.DB.Create(&dup).Error
+			if (err != nil) != tt.wantInsertErr {
+				t.Fatalf("insert error = %v, want error: %v", err, tt.wantInsertErr)
+			}
+		})
+	}
+}
+
+// raceNextFile makes the next file record created lose a race: a rival upload of the
+// same original name (with its own slug) is inserted just before it, in its transaction
+func raceNextFile(t *testing.T) {
+	t.Helper()
+	raced := false
+	err := database.DB.Callback().Create().Before("gorm:create").Register("test:race", func(db *gorm.DB) {
+		file, ok := db.Statement.Dest.(*models.File)
+		if !ok || raced {
+			return
+		}
+		raced = true
+		rival := *file
+		rival.Filename = "rival-" + file.Filename
+		rival.FilePath = "rival-" + file.FilePath
+		rival.Slug = "rival-" + file.Slug
+		if err := db.Session(&gorm.Session{NewDB: true}).Create(&rival).Error; err != nil {
+			t.Errorf("inserting the rival upload: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("registering the race: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Callback().Create().Remove("test:race") })
+}
+
+func TestOriginalNameRace(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		slug     string // Custom slug, which keeps the slug from colliding
+		race     bool
+		wantErr  error
+	}{
+		{"no race", "", "", false, nil},
+		{"name taken as the slug", "", "", true, ErrFilenameTaken},
+		{"name taken with a custom slug", "", "mine", true, ErrFilenameTaken},
+		{"name taken when rejecting collisions", "reject", "mine", true, ErrFilenameTaken},
+		{"name taken when counting", "suffix-counter", "mine", true, ErrFilenameTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FILENAME_COLLISION", tt.strategy)
+			s := newTestService(t)
+			seed := mustSave(t, s, "seed.txt", []byte("seed"), SaveOptions{})
+			if tt.race {
+				raceNextFile(t)
+			}
+
+			opts := SaveOptions{}
+			if tt.slug != "" {
+				opts.Slug = ptr(tt.slug)
+			}
+			_, err := s.SaveFileFromReader("report.pdf", "", bytesOf("report"), opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+
+			// The losing upload leaves neither a record nor content behind
+			var count int64
+			database.DB.Model(&models.File{}).Where("original_name = ?", "report.pdf").Count(&count)
+			if count != 0 {
+				t.Errorf("%d records named report.pdf after the failed save, want 0", count)
+			}
+			if objects := storedObjects(t, seed); len(objects) != 1 {
+				t.Errorf("stored objects %v, want only the seed's", objects)
+			}
+		})
+	}
+}
+
+func TestGetFileByOriginalNameNotFound(t *testing.T) {
+	s := newTestService(t)
+	mustSave(t, s, "report.pdf", []byte("report"), SaveOptions{})
+
+	tests := []struct {
+		domain string
+		name   string
+	}{
+		{"", "missing.pdf"},
+		{"", "REPORT.PDF"},
+		{"files.example.com", "report.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain+"/"+tt.name, func(t *testing.T) {
+			if _, err := s.GetFileByOriginalName(tt.domain, tt.name); !errors.Is(err, ErrFileNotFound) {
+				t.Fatalf("GetFileByOriginalName error = %v, want ErrFileNotFound", err)
+			}
+		})
+	}
+}
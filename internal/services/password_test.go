@@ -0,0 +1,60 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPasswordLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		setting  string // MAX_PASSWORD_LENGTH
+		password string
+		wantErr  error
+		wantMax  int // Limit reported when too long
+	}{
+		{"72 ASCII bytes", "", strings.Repeat("a", 72), nil, 0},
+		{"73 ASCII bytes", "", strings.Repeat("a", 73), ErrPasswordTooLong, 72},
+		{"72 bytes in 36 runes", "", strings.Repeat("é", 36), nil, 0},
+		{"74 bytes in 37 runes", "", strings.Repeat("é", 37), ErrPasswordTooLong, 72},
+		{"73 bytes in 25 runes", "", strings.Repeat("€", 24) + "a", ErrPasswordTooLong, 72},
+		{"76 bytes in 19 runes", "", strings.Repeat("😀", 19), ErrPasswordTooLong, 72},
+		{"lower limit", "16", strings.Repeat("a", 17), ErrPasswordTooLong, 16},
+		{"limit above bcrypt's ignored", "100", strings.Repeat("a", 73), ErrPasswordTooLong, 72},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_PASSWORD_LENGTH", tt.setting)
+			if utf8.RuneCountInString(tt.password) >= 100 {
+				t.Fatalf("test password has %d characters, want under 100", utf8.RuneCountInString(tt.password))
+			}
+			s := newTestService(t)
+
+			file, err := s.SaveFileFromReader("secret.txt", "", bytesOf("secret"), SaveOptions{Password: ptr(tt.password)})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var lengthErr *PasswordTooLongError
+				if !errors.As(err, &lengthErr) || lengthErr.Max != tt.wantMax {
+					t.Fatalf("save error = %v, want the limit of %d bytes", err, tt.wantMax)
+				}
+				return
+			}
+
+			// The whole password is checked, not just a prefix
+			if err := s.ValidatePassword(file, tt.password); err != nil {
+				t.Errorf("ValidatePassword with the password: %v", err)
+			}
+			if err := s.ValidatePassword(file, tt.password[:len(tt.password)-1]); !errors.Is(err, ErrInvalidPassword) {
+				t.Errorf("ValidatePassword with a prefix = %v, want ErrInvalidPassword", err)
+			}
+			if err := s.ValidatePassword(file, tt.password+"x"); !errors.Is(err, ErrInvalidPassword) {
+				t.Errorf("ValidatePassword with a longer guess = %v, want ErrInvalidPassword", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownPolicy is returned when an upload names a retention policy that isn't configured
+var ErrUnknownPolicy = errors.New("unknown retention policy")
+
+// RetentionPolicy is a named expiry duration configured by the admin (RETENTION_POLICIES)
+type RetentionPolicy struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"-"`
+	Label    string        `json:"duration"` // Duration as configured (e.g., "7d")
+	Seconds  int64         `json:"seconds"`
+}
+
+var (
+	retentionPoliciesOnce sync.Once
+	retentionPolicies     []RetentionPolicy
+)
+
+// getRetentionPolicies returns the policies configured in RETENTION_POLICIES
+// (e.g., "short=1h,standard=7d,archive=90d"), in configuration order
+func getRetentionPolicies() []RetentionPolicy {
+	retentionPoliciesOnce.Do(func() {
+		for _, entry := range strings.Split(os.Getenv("RETENTION_POLICIES"), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			name, durationStr, ok := strings.Cut(entry, "=")
+			name, durationStr = strings.TrimSpace(name), strings.TrimSpace(durationStr)
+			duration, err := ParseDuration(durationStr)
+			if !ok || name == "" || err != nil || duration <= 0 {
+				log.Printf("Warning: invalid RETENTION_POLICIES entry %q, skipping", entry)
+				continue
+			}
+
+			retentionPolicies = append(retentionPolicies, RetentionPolicy{
+				Name:     name,
+				Duration: duration,
+				Label:    durationStr,
+				Seconds:  int64(duration / time.Second),
+			})
+		}
+	})
+	return retentionPolicies
+}
+
+// ParseDuration parses a Go duration, also accepting whole days (e.g., "7d")
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// lookupRetentionPolicy finds a configured policy by name
+func lookupRetentionPolicy(name string) (RetentionPolicy, error) {
+	for _, policy := range getRetentionPolicies() {
+		if policy.Name == name {
+			return policy, nil
+		}
+	}
+	return RetentionPolicy{}, ErrUnknownPolicy
+}
+
+// RequireExpiry reports whether uploads must have an expiry date (REQUIRE_EXPIRY)
+func (s *FileService) RequireExpiry() bool {
+	return s.requireExpiry
+}
+
+// RetentionPolicies returns the configured retention policies
+func (s *FileService) RetentionPolicies() []RetentionPolicy {
+	return getRetentionPolicies()
+}
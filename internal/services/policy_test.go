@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicies(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []RetentionPolicy
+	}{
+		{"unset", "", nil},
+		{"configuration order", "short=1h, standard=7d ,archive=90d", []RetentionPolicy{
+			{Name: "short", Duration: time.Hour, Label: "1h", Seconds: 3600},
+			{Name: "standard", Duration: 7 * 24 * time.Hour, Label: "7d", Seconds: 7 * 86400},
+			{Name: "archive", Duration: 90 * 24 * time.Hour, Label: "90d", Seconds: 90 * 86400},
+		}},
+		{"invalid entries skipped", "nameless=,=1h,week=7d,bad,never=0d,back=-1h,days=xd,,", []RetentionPolicy{
+			{Name: "week", Duration: 7 * 24 * time.Hour, Label: "7d", Seconds: 7 * 86400},
+		}},
+		{"spaces around the name and duration", " day = 24h ", []RetentionPolicy{
+			{Name: "day", Duration: 24 * time.Hour, Label: "24h", Seconds: 86400},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRetentionPolicies(t, tt.value)
+			got := getRetentionPolicies()
+			if len(got) != len(tt.want) {
+				t.Fatalf("policies = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("policy %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSaveWithPolicy(t *testing.T) {
+	setRetentionPolicies(t, "short=1h,week=7d")
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name       string
+		opts       SaveOptions
+		wantErr    error
+		wantExpiry time.Duration // Expected time from the upload to the expiry
+	}{
+		{"hours", SaveOptions{Policy: "short"}, nil, time.Hour},
+		{"days", SaveOptions{Policy: "week"}, nil, 7 * 24 * time.Hour},
+		{"unknown policy", SaveOptions{Policy: "forever"}, ErrUnknownPolicy, 0},
+		{"names are case-sensitive", SaveOptions{Policy: "Week"}, ErrUnknownPolicy, 0},
+		{"policy with an expiry date", SaveOptions{Policy: "week", ExpiresAt: &tomorrow}, ErrInvalidExpiry, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file, err := s.SaveFileFromReader("notes.txt", "", bytes.NewReader([]byte("notes")), tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if file.ExpiresAt == nil {
+				t.Fatal("policy upload has no expiry")
+			}
+			if got := file.ExpiresAt.Sub(file.OriginalUploadedAt); got != tt.wantExpiry {
+				t.Errorf("expires %v after the upload, want %v", got, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestContentTypePolicy(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	exe := append([]byte("MZ"), make([]byte, 64)...)
+
+	tests := []struct {
+		name     string
+		policy   string
+		content  []byte
+		declared string
+		wantErr  error
+		want     string
+	}{
+		{"sniffed by default", "", exe, "image/png", nil, "application/x-msdownload"},
+		{"sniffed", ContentTypeTrustSniffed, exe, "image/png", nil, "application/x-msdownload"},
+		{"declared", ContentTypeTrustDeclared, exe, "image/png", nil, "image/png"},
+		{"nothing declared", ContentTypeTrustDeclared, png, "", nil, "image/png"},
+		{"mismatch rejected", ContentTypeReject, exe, "image/png", ErrContentTypeMismatch, ""},
+		{"match accepted", ContentTypeReject, png, "image/png", nil, "image/png"},
+		{"generic declaration accepted", ContentTypeReject, png, "application/octet-stream", nil, "image/png"},
+		{"unknown policy falls back to sniffed", "trust_nobody", exe, "image/png", nil, "application/x-msdownload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONTENT_TYPE_POLICY", tt.policy)
+			s := newTestService(t)
+
+			file, err := s.SaveFileFromReader("upload.png", tt.declared, bytes.NewReader(tt.content), SaveOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if file.ContentType != tt.want {
+				t.Errorf("content type = %q, want %q", file.ContentType, tt.want)
+			}
+			// Both types are kept whichever is served
+			if file.DeclaredContentType != tt.declared {
+				t.Errorf("declared content type = %q, want %q", file.DeclaredContentType, tt.declared)
+			}
+			if file.SniffedContentType == "" {
+				t.Error("sniffed content type not stored")
+			}
+		})
+	}
+}
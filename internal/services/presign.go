@@ -0,0 +1,249 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/storage"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDirectUploadUnsupported = errors.New("storage backend does not support direct uploads")
+	ErrUploadNotFound          = errors.New("pending upload not found")
+	ErrUploadIncomplete        = errors.New("uploaded object not found in storage")
+	ErrUploadMismatch          = errors.New("uploaded object does not match the presigned upload")
+	ErrUploadRegistered        = errors.New("upload already registered")
+	ErrInvalidUploadSize       = errors.New("invalid upload size")
+)
+
+// defaultPresignExpiry is how long a presigned upload URL stays valid when PRESIGN_EXPIRY is not set
+const defaultPresignExpiry = time.Hour
+
+// defaultMaxDirectUploadSize is the largest direct upload when PRESIGN_MAX_SIZE is not set
+// (5 GB, the S3 limit for a single PUT)
+const defaultMaxDirectUploadSize = 5 << 30
+
+// pendingUploadGrace is how long after its URL expires a pending upload can still be
+// registered before the cleanup job deletes it and its object
+const pendingUploadGrace = 24 * time.Hour
+
+// PresignedUpload tells the client where and how to upload content directly to storage
+type PresignedUpload struct {
+	Key       string            `json:"key"`     // Pass to the register endpoint once the upload has finished
+	URL       string            `json:"url"`     // Presigned URL to send the content to
+	Method    string            `json:"method"`  // HTTP method for the upload
+	Headers   map[string]string `json:"headers"` // Headers the upload request must carry
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// getPresignExpiry returns the validity of presigned upload URLs (PRESIGN_EXPIRY)
+func getPresignExpiry() time.Duration {
+	expiryStr := os.Getenv("PRESIGN_EXPIRY")
+	if expiryStr == "" {
+		return defaultPresignExpiry
+	}
+
+	expiry, err := time.ParseDuration(expiryStr)
+	if err != nil || expiry <= 0 || expiry > 7*24*time.Hour {
+		log.Printf("Warning: invalid PRESIGN_EXPIRY value, using default (%s)", defaultPresignExpiry)
+		return defaultPresignExpiry
+	}
+	return expiry
+}
+
+// getMaxDirectUploadSize returns the largest accepted direct upload in bytes (PRESIGN_MAX_SIZE)
+func getMaxDirectUploadSize() int64 {
+	sizeStr := os.Getenv("PRESIGN_MAX_SIZE")
+	if sizeStr == "" {
+		return defaultMaxDirectUploadSize
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size <= 0 {
+		log.Printf("Warning: invalid PRESIGN_MAX_SIZE value, using default (%d)", int64(defaultMaxDirectUploadSize))
+		return defaultMaxDirectUploadSize
+	}
+	return size
+}
+
+// PresignUpload reserves a storage key for a file of exactly size bytes and returns a URL
+// the client can upload it to directly, on the named storage backend ("" for the primary).
+// The file is created by RegisterUpload afterwards.
+func (s *FileService) PresignUpload(filename, contentType string, size int64, backend string) (*PresignedUpload, error) {
+	backend, err := s.resolveBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+	presigner, ok := storage.AsPresigner(s.storageFor(backend))
+	if !ok {
+		return nil, ErrDirectUploadUnsupported
+	}
+
+	filename = sanitizeFilename(filename)
+	if len(filename) > s.maxFilenameLength {
+		return nil, ErrFilenameTooLong
+	}
+	if size <= 0 || size > s.maxDirectUploadSize {
+		return nil, ErrInvalidUploadSize
+	}
+	if contentType == "" {
+		contentType = genericContentType
+	}
+
+	key, err := s.generateUniqueFilename(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate filename: %w", err)
+	}
+
+	url, err := presigner.PresignPut(key, contentType, size, s.presignExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := &models.PendingUpload{
+		Key:            key,
+		Filename:       filename,
+		ContentType:    contentType,
+		Size:           size,
+		ExpiresAt:      time.Now().Add(s.presignExpiry),
+		StorageBackend: backend,
+	}
+	if err := database.DB.Create(pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to record pending upload: %w", err)
+	}
+
+	return &PresignedUpload{
+		Key:       key,
+		URL:       url,
+		Method:    "PUT",
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: models.JSONTime(pending.ExpiresAt),
+	}, nil
+}
+
+// RegisterUpload creates the file for a presigned upload once the client has uploaded it.
+// The object must exist and match the size and content type the URL was signed for.
+// If registration fails (e.g., the slug is taken) the object is kept, so it can be retried.
+func (s *FileService) RegisterUpload(key string, opts SaveOptions) (*models.File, error) {
+	var pending models.PendingUpload
+	if err := database.DB.Where(&models.PendingUpload{Key: key}).First(&pending).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	// The object is on the backend the URL was signed for
+	backend := s.storageFor(pending.StorageBackend)
+	presigner, ok := storage.AsPresigner(backend)
+	if !ok {
+		return nil, ErrDirectUploadUnsupported
+	}
+
+	info, err := presigner.Stat(pending.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, ErrUploadIncomplete
+		}
+		return nil, err
+	}
+	if info.Size != pending.Size || mediaType(info.ContentType) != mediaType(pending.ContentType) {
+		return nil, ErrUploadMismatch
+	}
+
+	file, err := s.saveUpload(&Upload{
+		Filename:    pending.Filename,
+		ContentType: pending.ContentType,
+		Size:        info.Size,
+		StoredPath:  pending.Key,
+		Open: func() (io.ReadCloser, error) {
+			return backend.Get(pending.Key)
+		},
+		Backend: s.backendName(pending.StorageBackend),
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil // The pending upload is settled along with the file record
+}
+
+// settlePendingUpload removes the pending upload of an object that now belongs to a
+// file record, in the transaction that records it (no-op for an empty key). A presigned
+// upload is claimed by exactly one registration: if its pending upload is already gone,
+// a concurrent registration has recorded the object, and ErrUploadRegistered rolls this
+// one back, so two files never share it.
+func settlePendingUpload(tx *gorm.DB, upload *Upload, key string) error {
+	if key == "" {
+		return nil
+	}
+	result := tx.Where(&models.PendingUpload{Key: key}).Delete(&models.PendingUpload{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if upload.StoredPath != "" && result.RowsAffected != 1 {
+		return ErrUploadRegistered
+	}
+	return nil
+}
+
+// cleanupPendingUploads deletes presigned uploads that were never registered, with their
+// objects. This also recovers uploads interrupted (e.g., by a crash) between storing
+// their content and committing the file record.
+func (s *FileService) cleanupPendingUploads() error {
+	var stale []models.PendingUpload
+	if err := database.DB.Where("expires_at <= ?", time.Now().Add(-pendingUploadGrace)).
+		Find(&stale).Error; err != nil {
+		return err
+	}
+
+	for _, pending := range stale {
+		unlock := s.lockContent()
+
+		// Keep the object if a file was registered for it after all. Local storage
+		// returns full paths, so the key is also matched against stored filenames
+		// and, for content-addressed objects, content hashes.
+		var refs int64
+		database.DB.Model(&models.File{}).
+			Where("(file_path = ? OR filename = ? OR content_hash = ?) AND storage_backend IN ?",
+				pending.Key, pending.Key, pending.Key, s.backendAliases(pending.StorageBackend)).
+			Count(&refs)
+		if refs == 0 {
+			if err := s.storageFor(pending.StorageBackend).Delete(pending.Key); err != nil {
+				log.Printf("Warning: failed to delete unregistered upload %s: %v", pending.Key, err)
+			}
+		}
+		database.DB.Delete(&pending)
+		unlock()
+	}
+	return nil
+}
+
+// uploadContentHash hashes an upload's content. Objects uploaded directly to storage
+// aren't read back through the server, so they have no hash; live uploads get theirs
+// once the content is complete.
+func uploadContentHash(upload *Upload) (string, error) {
+	if upload.StoredPath != "" || upload.Live {
+		return "", nil
+	}
+	if upload.Source != nil && upload.Source.ContentHash != "" {
+		return upload.Source.ContentHash, nil
+	}
+	return hashContent(upload)
+}
+
+// uploadFilename returns the unique stored filename for an upload: the key of a direct
+// upload, or a newly generated name
+func (s *FileService) uploadFilename(upload *Upload) (string, error) {
+	if upload.StoredPath != "" {
+		return upload.StoredPath, nil
+	}
+	return s.generateUniqueFilename(upload.Filename)
+}
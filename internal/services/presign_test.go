@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+// presignStorage is local storage that accepts direct uploads, standing in for S3.
+// Tests write the "uploaded" object with Save under the presigned key.
+type presignStorage struct {
+	*storage.LocalStorage
+	contentType string          // Reported by Stat for every object
+	statBarrier *sync.WaitGroup // If set, Stat waits until this many calls have arrived
+}
+
+func (p *presignStorage) PresignPut(path, contentType string, size int64, expires time.Duration) (string, error) {
+	return "https://bucket.example.com/" + path, nil
+}
+
+func (p *presignStorage) Stat(path string) (storage.ObjectInfo, error) {
+	if p.statBarrier != nil {
+		p.statBarrier.Done()
+		p.statBarrier.Wait()
+	}
+
+	reader, err := p.Get(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return storage.ObjectInfo{}, storage.ErrObjectNotFound
+		}
+		return storage.ObjectInfo{}, err
+	}
+	defer reader.Close()
+	info, err := reader.(*os.File).Stat()
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	return storage.ObjectInfo{Size: info.Size(), ContentType: p.contentType}, nil
+}
+
+// newPresignTestService returns a file service whose storage accepts direct uploads
+func newPresignTestService(t *testing.T) (*FileService, *presignStorage) {
+	t.Helper()
+	backend := &presignStorage{LocalStorage: newTestDatabase(t), contentType: "text/plain"}
+	return newTestServiceWith(t, storage.NewSingleRegistry("s3", backend)), backend
+}
+
+// presignAndUpload reserves a direct upload and stores its content as the client would
+func presignAndUpload(t *testing.T, s *FileService, backend *presignStorage, content []byte) string {
+	t.Helper()
+	presigned, err := s.PresignUpload("direct.txt", "text/plain", int64(len(content)), "")
+	if err != nil {
+		t.Fatalf("PresignUpload: %v", err)
+	}
+	if _, err := backend.Save(bytes.NewReader(content), presigned.Key, int64(len(content))); err != nil {
+		t.Fatalf("uploading to the presigned key: %v", err)
+	}
+	return presigned.Key
+}
+
+func TestRegisterUpload(t *testing.T) {
+	s, backend := newPresignTestService(t)
+	key := presignAndUpload(t, s, backend, []byte("direct content"))
+
+	file, err := s.RegisterUpload(key, SaveOptions{})
+	if err != nil {
+		t.Fatalf("RegisterUpload: %v", err)
+	}
+	if got := string(readContent(t, s, file)); got != "direct content" {
+		t.Fatalf("content = %q, want %q", got, "direct content")
+	}
+
+	if _, err := s.RegisterUpload(key, SaveOptions{}); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("registering again = %v, want ErrUploadNotFound", err)
+	}
+}
+
+func TestRegisterUploadConcurrently(t *testing.T) {
+	s, backend := newPresignTestService(t)
+	key := presignAndUpload(t, s, backend, []byte("direct content"))
+
+	// Every registration finds the pending upload before any of them records a file
+	const registrations = 8
+	backend.statBarrier = &sync.WaitGroup{}
+	backend.statBarrier.Add(registrations)
+
+	var wg sync.WaitGroup
+	errs := make([]error, registrations)
+	for i := range registrations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = s.RegisterUpload(key, SaveOptions{})
+		}()
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrUploadRegistered):
+		default:
+			t.Errorf("unexpected registration error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d registrations succeeded, want 1", succeeded)
+	}
+
+	var files int64
+	database.DB.Model(&models.File{}).Where("file_path = ?", key).Count(&files)
+	if files != 1 {
+		t.Fatalf("%d files point at the uploaded object, want 1", files)
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/yorukot/sharing/internal/cdn"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+var (
+	cdnPurgerOnce sync.Once
+	cdnPurger     *cdn.Purger
+	cdnBaseURL    string
+)
+
+// getCDNPurger returns the CDN purge webhook configured with CDN_PURGE_URL and
+// CDN_PURGE_AUTH, or nil if purging is disabled. Purged URLs are built from BASE_URL.
+func getCDNPurger() *cdn.Purger {
+	cdnPurgerOnce.Do(func() {
+		endpoint := os.Getenv("CDN_PURGE_URL")
+		if endpoint == "" {
+			return
+		}
+
+		cdnBaseURL = strings.TrimRight(os.Getenv("BASE_URL"), "/")
+		if cdnBaseURL == "" {
+			log.Printf("Warning: CDN_PURGE_URL is set but BASE_URL is not, CDN purging is disabled")
+			return
+		}
+
+		cdnPurger = cdn.NewPurger(endpoint, os.Getenv("CDN_PURGE_AUTH"))
+	})
+	return cdnPurger
+}
+
+// purgeCDN asks the CDN to drop its cached copies of the files' public URLs.
+// Pass the file as it was before a change as well as after, so old slugs are purged too.
+func purgeCDN(files ...*models.File) {
+	purger := getCDNPurger()
+	if purger == nil {
+		return
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		for _, u := range publicFileURLs(file) {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	purger.Purge(urls)
+}
+
+// publicFileURLs returns the public share and download URLs of a file
+func publicFileURLs(file *models.File) []string {
+	baseURL := cdnBaseURL
+	if file.Domain != "" {
+		scheme, _, _ := strings.Cut(baseURL, "://")
+		baseURL = scheme + "://" + file.Domain
+	}
+
+	urls := []string{baseURL + SlugPath(file.Slug)}
+	if strings.TrimSpace(file.OriginalName) != "" {
+		urls = append(urls, baseURL+"/d/"+url.PathEscape(file.OriginalName))
+	}
+	return urls
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+func TestPublicFileURLs(t *testing.T) {
+	previous := cdnBaseURL
+	cdnBaseURL = "https://files.example.com"
+	t.Cleanup(func() { cdnBaseURL = previous })
+
+	tests := []struct {
+		name string
+		file models.File
+		want []string
+	}{
+		{"default domain", models.File{Slug: "report", OriginalName: "report.pdf"},
+			[]string{"https://files.example.com/report", "https://files.example.com/d/report.pdf"}},
+		{"custom domain", models.File{Slug: "report", OriginalName: "report.pdf", Domain: "share.example.org"},
+			[]string{"https://share.example.org/report", "https://share.example.org/d/report.pdf"}},
+		{"escaped name", models.File{Slug: "q1", OriginalName: "Q1 report #2.pdf"},
+			[]string{"https://files.example.com/q1", "https://files.example.com/d/Q1%20report%20%232.pdf"}},
+		{"no original name", models.File{Slug: "imported"},
+			[]string{"https://files.example.com/imported"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := publicFileURLs(&tt.file); !slices.Equal(got, tt.want) {
+				t.Fatalf("publicFileURLs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
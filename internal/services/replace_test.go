@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"github.com/yorukot/sharing/internal/storage"
+	"gorm.io/gorm"
+)
+
+// failingDeleteStorage is local storage whose deletes fail
+type failingDeleteStorage struct {
+	*storage.LocalStorage
+}
+
+func (f *failingDeleteStorage) Delete(path string) error {
+	return errors.New("delete failed")
+}
+
+// storedObjects returns the names of the objects stored next to a file's object
+func storedObjects(t *testing.T, file *models.File) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(file.FilePath))
+	if err != nil {
+		t.Fatalf("reading data directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestReplaceFileUpdatesContent(t *testing.T) {
+	s := newTestService(t)
+	old := mustSave(t, s, "report.txt", []byte("old content"), SaveOptions{})
+
+	replaced := mustSave(t, s, "report.txt", []byte("new content"), SaveOptions{Replace: true})
+	if replaced.ID != old.ID {
+		t.Fatalf("replacing gave file %d, want the existing file %d", replaced.ID, old.ID)
+	}
+	if got := readContent(t, s, replaced); string(got) != "new content" {
+		t.Fatalf("replaced file reads %q", got)
+	}
+	if _, err := os.Stat(old.FilePath); !os.IsNotExist(err) {
+		t.Fatalf("old content still stored after replacing (stat: %v)", err)
+	}
+}
+
+func TestReplaceFileKeepsOldFileWhenUpdateFails(t *testing.T) {
+	s := newTestService(t)
+	old := mustSave(t, s, "report.txt", []byte("old content"), SaveOptions{})
+
+	const callback = "test:fail_update"
+	database.DB.Callback().Update().Before("gorm:update").Register(callback, func(db *gorm.DB) {
+		db.AddError(errors.New("update failed"))
+	})
+	_, err := s.SaveFileFromReader("report.txt", "", bytesOf("new content"), SaveOptions{Replace: true})
+	database.DB.Callback().Update().Remove(callback)
+	if err == nil {
+		t.Fatal("replacing succeeded although the record update failed")
+	}
+
+	current, err := s.GetFile(old.ID)
+	if err != nil {
+		t.Fatalf("GetFile: %v", err)
+	}
+	if current.FilePath != old.FilePath {
+		t.Fatalf("record points at %q after a failed update, want %q", current.FilePath, old.FilePath)
+	}
+	if got := readContent(t, s, current); string(got) != "old content" {
+		t.Fatalf("file reads %q after a failed replace, want the old content", got)
+	}
+	if objects := storedObjects(t, old); len(objects) != 1 {
+		t.Fatalf("stored objects after a failed replace = %v, want only the old one", objects)
+	}
+}
+
+func TestReplaceFileStaysConsistentWhenReleaseFails(t *testing.T) {
+	backend := &failingDeleteStorage{LocalStorage: newTestDatabase(t)}
+	s := newTestServiceWith(t, storage.NewSingleRegistry("local", backend))
+	old := mustSave(t, s, "report.txt", []byte("old content"), SaveOptions{})
+
+	replaced, err := s.SaveFileFromReader("report.txt", "", bytesOf("new content"), SaveOptions{Replace: true})
+	if err != nil {
+		t.Fatalf("replacing failed because the old content couldn't be deleted: %v", err)
+	}
+	if got := readContent(t, s, replaced); string(got) != "new content" {
+		t.Fatalf("replaced file reads %q", got)
+	}
+
+	// The old object is left for the pending upload cleanup
+	var pending models.PendingUpload
+	if err := database.DB.Where(&models.PendingUpload{Key: old.FilePath}).First(&pending).Error; err != nil {
+		t.Fatalf("old content wasn't recorded for cleanup: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReportNotFound      = errors.New("report not found")
+	ErrInvalidReportStatus = errors.New("invalid report status")
+)
+
+// maxReportReasonLength caps the stored reason text
+const maxReportReasonLength = 1000
+
+// ReportService handles abuse reports
+type ReportService struct {
+	autoDisableThreshold int64 // Reporter IPs with open reports needed to disable a file (0 = never)
+}
+
+// NewReportService creates a new report service instance
+func NewReportService(autoDisableThreshold int64) *ReportService {
+	return &ReportService{
+		autoDisableThreshold: autoDisableThreshold,
+	}
+}
+
+// CreateReport records an abuse report against the file with the given slug in a domain's namespace.
+// If open reports from as many different IPs as the auto-disable threshold accumulate,
+// the file is disabled.
+func (s *ReportService) CreateReport(domain, slug, reason, reporterIP string) (*models.Report, error) {
+	var file models.File
+	if err := database.DB.Where("domain = ? AND slug = ?", domain, slug).First(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+
+	if len(reason) > maxReportReasonLength {
+		reason = reason[:maxReportReasonLength]
+	}
+
+	report := &models.Report{
+		FileID:     file.ID,
+		Slug:       slug,
+		Reason:     reason,
+		ReporterIP: reporterIP,
+		Status:     models.ReportStatusOpen,
+	}
+	if err := database.DB.Create(report).Error; err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	if s.autoDisableThreshold > 0 && !file.IsDisabled() {
+		// Count reporters rather than reports, so one client can't disable a file alone
+		var reporters int64
+		database.DB.Model(&models.Report{}).
+			Where("file_id = ? AND status = ?", file.ID, models.ReportStatusOpen).
+			Distinct("reporter_ip").
+			Count(&reporters)
+
+		if reporters >= s.autoDisableThreshold {
+			if err := database.DB.Model(&file).Update("disabled_at", time.Now()).Error; err != nil {
+				return nil, fmt.Errorf("failed to disable reported file: %w", err)
+			}
+			getFileCache().InvalidateFile(file.ID)
+			purgeCDN(&file)
+		}
+	}
+
+	return report, nil
+}
+
+// ListReports retrieves reports, optionally filtered by status, newest first
+func (s *ReportService) ListReports(status string) ([]models.Report, error) {
+	query := database.DB.Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var reports []models.Report
+	if err := query.Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// UpdateReportStatus triages a report (open, resolved, or dismissed)
+func (s *ReportService) UpdateReportStatus(id uint, status string) (*models.Report, error) {
+	switch status {
+	case models.ReportStatusOpen, models.ReportStatusResolved, models.ReportStatusDismissed:
+	default:
+		return nil, ErrInvalidReportStatus
+	}
+
+	var report models.Report
+	if err := database.DB.First(&report, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportNotFound
+		}
+		return nil, err
+	}
+
+	if err := database.DB.Model(&report).Update("status", status).Error; err != nil {
+		return nil, fmt.Errorf("failed to update report: %w", err)
+	}
+
+	return &report, nil
+}
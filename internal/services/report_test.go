@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreateReportAutoDisable(t *testing.T) {
+	tests := []struct {
+		name         string
+		reporters    []string
+		wantDisabled bool
+	}{
+		{"one reporter repeating reports", []string{"198.51.100.1", "198.51.100.1", "198.51.100.1"}, false},
+		{"fewer reporters than the threshold", []string{"198.51.100.1"}, false},
+		{"enough different reporters", []string{"198.51.100.1", "198.51.100.1", "198.51.100.2"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			reports := NewReportService(2)
+			file := mustSave(t, s, "reported.txt", []byte("content"), SaveOptions{})
+
+			for _, ip := range tt.reporters {
+				if _, err := reports.CreateReport("", file.Slug, "abuse", ip); err != nil {
+					t.Fatalf("CreateReport: %v", err)
+				}
+			}
+
+			_, err := s.GetFileBySlug("", file.Slug)
+			if disabled := errors.Is(err, ErrFileDisabled); disabled != tt.wantDisabled {
+				t.Fatalf("file disabled = %v (lookup error %v), want %v", disabled, err, tt.wantDisabled)
+			}
+		})
+	}
+}
+
+func TestCreateReportUnknownSlug(t *testing.T) {
+	newTestService(t)
+	if _, err := NewReportService(1).CreateReport("", "missing", "abuse", "198.51.100.1"); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("CreateReport for an unknown slug = %v, want ErrFileNotFound", err)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// SessionService stores web UI sessions in the database, so they survive restarts and
+// can be revoked on logout
+type SessionService struct{}
+
+// NewSessionService creates a new session service instance
+func NewSessionService() *SessionService {
+	return &SessionService{}
+}
+
+// sessionTokenHash returns the stored form of a session id, so the table alone can't be
+// used to forge cookies
+func sessionTokenHash(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create records a new session, dropping sessions that have already expired
+func (s *SessionService) Create(id string, expiresAt time.Time) error {
+	if err := database.DB.Where("expires_at <= ?", time.Now()).Delete(&models.WebSession{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	session := &models.WebSession{TokenHash: sessionTokenHash(id), ExpiresAt: expiresAt}
+	if err := database.DB.Create(session).Error; err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// Active reports whether a session exists and hasn't expired
+func (s *SessionService) Active(id string) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.WebSession{}).
+		Where("token_hash = ? AND expires_at > ?", sessionTokenHash(id), time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to look up session: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Revoke deletes a session, so its cookie is no longer accepted
+func (s *SessionService) Revoke(id string) error {
+	if err := database.DB.Where("token_hash = ?", sessionTokenHash(id)).Delete(&models.WebSession{}).Error; err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
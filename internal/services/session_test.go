@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionService(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		revoke    bool
+		lookup    string // Session id looked up, "" for the created one
+		want      bool
+	}{
+		{"active session", time.Hour, false, "", true},
+		{"revoked session", time.Hour, true, "", false},
+		{"expired session", -time.Second, false, "", false},
+		{"unknown session", time.Hour, false, "0123456789abcdef", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDatabase(t)
+			sessions := NewSessionService()
+
+			const id = "fedcba9876543210"
+			if err := sessions.Create(id, time.Now().Add(tt.expiresIn)); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if tt.revoke {
+				if err := sessions.Revoke(id); err != nil {
+					t.Fatalf("Revoke: %v", err)
+				}
+			}
+
+			lookup := tt.lookup
+			if lookup == "" {
+				lookup = id
+			}
+			active, err := sessions.Active(lookup)
+			if err != nil {
+				t.Fatalf("Active: %v", err)
+			}
+			if active != tt.want {
+				t.Errorf("Active = %v, want %v", active, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCustomSlugValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		strict   bool
+		slug     string
+		wantSlug string
+		wantErr  bool
+	}{
+		{"simple", false, "my-document", "my-document", false},
+		{"dots and underscores", false, "report_2024.pdf", "report_2024.pdf", false},
+		{"unicode", false, "файл", "файл", false},
+		{"symbols", false, "report@2024", "", true},
+		{"only dots", false, "..", "", true},
+		{"too long", false, strings.Repeat("a", 101), "", true},
+		{"strict simple", true, "my-document", "my-document", false},
+		{"strict lowercases", true, "My-Document", "my-document", false},
+		{"strict dots", true, "report.pdf", "", true},
+		{"strict underscores", true, "my_document", "", true},
+		{"strict unicode", true, "файл", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.strict {
+				t.Setenv("SLUG_STRICT", "true")
+			}
+			s := newTestService(t)
+
+			file, err := s.SaveFileFromReader("notes.txt", "", bytesOf("notes"), SaveOptions{Slug: &tt.slug})
+			if tt.wantErr {
+				var slugErr *InvalidSlugError
+				if !errors.Is(err, ErrInvalidSlug) || !errors.As(err, &slugErr) || slugErr.Reason == "" {
+					t.Fatalf("save error = %v, want an InvalidSlugError with a reason", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			if file.Slug != tt.wantSlug {
+				t.Fatalf("slug = %q, want %q", file.Slug, tt.wantSlug)
+			}
+		})
+	}
+}
+
+func TestGeneratedSlugStrictMode(t *testing.T) {
+	tests := []struct {
+		strict   bool
+		filename string
+		wantSlug string
+	}{
+		{false, "My Report.pdf", "My Report.pdf"},
+		{true, "My Report.pdf", "my-report-pdf"},
+		{true, "Über_Plan v2.txt", "ber-plan-v2-txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if tt.strict {
+				t.Setenv("SLUG_STRICT", "true")
+			}
+			s := newTestService(t)
+
+			file := mustSave(t, s, tt.filename, []byte("content"), SaveOptions{})
+			if file.Slug != tt.wantSlug {
+				t.Fatalf("slug for %q = %q, want %q", tt.filename, file.Slug, tt.wantSlug)
+			}
+			if !tt.strict {
+				return
+			}
+			if err := s.validateSlug(file.Slug); err != nil {
+				t.Fatalf("generated slug %q is invalid in strict mode: %v", file.Slug, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// recordSlugChange remembers a file's old slug after a rename, so links to it keep
+// working. The new slug is current again, so any history entry for it is dropped;
+// an old slug another file was renamed away from is taken over by this file.
+func recordSlugChange(tx *gorm.DB, file *models.File, oldSlug, newSlug string) error {
+	if err := tx.Where("domain = ? AND slug IN ?", file.Domain, []string{oldSlug, newSlug}).
+		Delete(&models.SlugHistory{}).Error; err != nil {
+		return fmt.Errorf("failed to update slug history: %w", err)
+	}
+	entry := &models.SlugHistory{FileID: file.ID, Domain: file.Domain, Slug: oldSlug}
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record slug history: %w", err)
+	}
+	return nil
+}
+
+// GetFileByFormerSlug retrieves the file that was shared under a slug before being
+// renamed, for redirecting old links. Callers must look the slug up with GetFileBySlug
+// first: a file currently using the slug takes precedence over its history.
+func (s *FileService) GetFileByFormerSlug(domain, slug string) (*models.File, error) {
+	var entry models.SlugHistory
+	if err := database.DB.Where("domain = ? AND slug = ?", domain, slug).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+
+	file, err := s.GetFile(entry.FileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDisabled() {
+		return nil, ErrFileDisabled
+	}
+	return file, nil
+}
+
+// dropSlugHistory deletes a removed file's former slugs, so they stop redirecting and
+// can be reused. Failures only leave dead entries behind, so they are logged.
+func dropSlugHistory(fileID uint) {
+	if err := database.DB.Where("file_id = ?", fileID).Delete(&models.SlugHistory{}).Error; err != nil {
+		log.Printf("Warning: failed to delete slug history of file %d: %v", fileID, err)
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetFileByFormerSlug(t *testing.T) {
+	tests := []struct {
+		name    string
+		renames []string // Slugs the file is renamed to, in order
+		after   func(t *testing.T, s *FileService, fileID uint)
+		lookup  string
+		wantErr error
+	}{
+		{"renamed once", []string{"second"}, nil, "first", nil},
+		{"renamed twice", []string{"second", "third"}, nil, "first", nil},
+		{"intermediate slug", []string{"second", "third"}, nil, "second", nil},
+		{"current slug isn't a former one", []string{"second"}, nil, "second", ErrFileNotFound},
+		{"renamed back", []string{"second", "first"}, nil, "first", ErrFileNotFound},
+		{"never used", []string{"second"}, nil, "other", ErrFileNotFound},
+		{"file deleted", []string{"second"}, func(t *testing.T, s *FileService, fileID uint) {
+			if err := s.DeleteFile(fileID); err != nil {
+				t.Fatalf("DeleteFile: %v", err)
+			}
+		}, "first", ErrFileNotFound},
+		{"file disabled", []string{"second"}, func(t *testing.T, s *FileService, fileID uint) {
+			if _, err := s.UpdateFile(fileID, UpdateOptions{Disabled: ptr(true)}); err != nil {
+				t.Fatalf("disabling: %v", err)
+			}
+		}, "first", ErrFileDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{Slug: ptr("first")})
+			for _, slug := range tt.renames {
+				if _, err := s.UpdateFile(file.ID, UpdateOptions{Slug: ptr(slug)}); err != nil {
+					t.Fatalf("renaming to %s: %v", slug, err)
+				}
+			}
+			if tt.after != nil {
+				tt.after(t, s, file.ID)
+			}
+
+			found, err := s.GetFileByFormerSlug("", tt.lookup)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetFileByFormerSlug(%s) error = %v, want %v", tt.lookup, err, tt.wantErr)
+			}
+			if err == nil && found.ID != file.ID {
+				t.Fatalf("GetFileByFormerSlug(%s) = file %d, want %d", tt.lookup, found.ID, file.ID)
+			}
+		})
+	}
+}
+
+func TestFormerSlugTakenOver(t *testing.T) {
+	s := newTestService(t)
+	first := mustSave(t, s, "a.txt", []byte("a"), SaveOptions{Slug: ptr("shared")})
+	second := mustSave(t, s, "b.txt", []byte("b"), SaveOptions{Slug: ptr("other")})
+
+	// first gives up "shared", which second then takes and gives up again
+	steps := []struct {
+		fileID uint
+		slug   string
+		want   uint // File the former slug "shared" leads to after the step, or 0 for none
+	}{
+		{first.ID, "renamed", first.ID},
+		{second.ID, "shared", 0},
+		{second.ID, "moved", second.ID},
+	}
+
+	for _, step := range steps {
+		if _, err := s.UpdateFile(step.fileID, UpdateOptions{Slug: ptr(step.slug)}); err != nil {
+			t.Fatalf("renaming file %d to %s: %v", step.fileID, step.slug, err)
+		}
+		found, err := s.GetFileByFormerSlug("", "shared")
+		switch {
+		case step.want == 0 && !errors.Is(err, ErrFileNotFound):
+			t.Fatalf("after renaming file %d to %s, former slug lookup = %v, want ErrFileNotFound", step.fileID, step.slug, err)
+		case step.want != 0 && (err != nil || found.ID != step.want):
+			t.Fatalf("after renaming file %d to %s, former slug leads to %v (%v), want file %d", step.fileID, step.slug, found, err, step.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SlugTemplateVars are the placeholders SLUG_TEMPLATE may use
+var SlugTemplateVars = []string{
+	"date", // Upload date, YYYY-MM-DD (UTC; original_uploaded_at when given)
+	"yyyy", // Upload year
+	"mm",   // Upload month, 01-12
+	"dd",   // Upload day of the month, 01-31
+	"name", // Filename without its extension
+	"ext",  // Extension without the dot (empty if there is none)
+	"rand", // 8 random hex characters
+}
+
+// reservedSlugPrefixes are the first path segments of the server's own routes. Slugs
+// made from a template never start with them, or their links would never be reached.
+var reservedSlugPrefixes = []string{"api", "web", "static", "brand", "health", "d", "report"}
+
+// maxTemplateNameLength is the most characters of the filename {name} takes, so long
+// filenames leave room for the rest of the template
+const maxTemplateNameLength = 60
+
+// invalidSlugSegmentChars matches characters a slug segment can't contain
+var invalidSlugSegmentChars = regexp.MustCompile(`[^a-zA-Z0-9\p{L}\p{N}._-]+`)
+
+// parseSlugTemplate checks a slug template (e.g., "{date}/{name}"): placeholders must be
+// from SlugTemplateVars, and the text around them must be valid slug characters, with
+// "/" separating path segments. An empty template returns "".
+func (s *FileService) parseSlugTemplate(template string) (string, error) {
+	template = strings.Trim(strings.TrimSpace(template), "/")
+	if template == "" {
+		return "", nil
+	}
+
+	for rest := template; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.Contains(rest, "}") {
+				return "", fmt.Errorf("unmatched }")
+			}
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unmatched {")
+		}
+		if name := rest[start+1 : start+end]; !slices.Contains(SlugTemplateVars, name) {
+			return "", fmt.Errorf("unknown placeholder {%s} (supported: %s)", name, strings.Join(SlugTemplateVars, ", "))
+		}
+		rest = rest[start+end+1:]
+	}
+
+	// Render with sample values to check the literal text
+	sample := s.renderSlugTemplate(template, "name.txt", time.Now())
+	for _, segment := range sample {
+		if err := s.validateSlug(segment); err != nil {
+			return "", fmt.Errorf("template gives invalid slugs: %w", err)
+		}
+	}
+	if first, _, _ := strings.Cut(template, "/"); isReservedSlugPrefix(first) {
+		return "", fmt.Errorf("slugs would start with the reserved path /%s/", first)
+	}
+	return template, nil
+}
+
+// slugFromTemplate generates a unique slug for a new file from SLUG_TEMPLATE. Taken slugs
+// are retried with a fresh {rand}, or with a random suffix if the template has none.
+func (s *FileService) slugFromTemplate(domain, filename string, uploadedAt time.Time) (string, error) {
+	for i := 0; i < 100; i++ {
+		segments := s.renderSlugTemplate(s.slugTemplate, filename, uploadedAt)
+		if isReservedSlugPrefix(segments[0]) {
+			segments[0] += "-" + randomSlugSuffix()
+		}
+		if i > 0 && !strings.Contains(s.slugTemplate, "{rand}") {
+			last := segments[len(segments)-1]
+			ext := filepath.Ext(last)
+			segments[len(segments)-1] = strings.TrimSuffix(last, ext) + "-" + randomSlugSuffix() + ext
+		}
+
+		slug := strings.Join(segments, "/")
+		if err := s.validateTemplateSlug(slug); err != nil {
+			return "", err
+		}
+		if err := s.checkSlugUnique(domain, slug); err == nil {
+			return slug, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate unique slug")
+}
+
+// renderSlugTemplate fills in a slug template's placeholders and returns the resulting
+// path segments. Segments left empty (e.g., {ext} of a file without one) are dropped.
+func (s *FileService) renderSlugTemplate(template, filename string, uploadedAt time.Time) []string {
+	uploadedAt = uploadedAt.UTC()
+	ext := filepath.Ext(filename)
+	name := []rune(strings.TrimSuffix(filename, ext))
+	if len(name) > maxTemplateNameLength {
+		name = name[:maxTemplateNameLength]
+	}
+	randomBytes := make([]byte, 4)
+	rand.Read(randomBytes)
+
+	replacer := strings.NewReplacer(
+		"{date}", uploadedAt.Format("2006-01-02"),
+		"{yyyy}", uploadedAt.Format("2006"),
+		"{mm}", uploadedAt.Format("01"),
+		"{dd}", uploadedAt.Format("02"),
+		"{name}", s.slugSegment(string(name)),
+		"{ext}", s.slugSegment(strings.TrimPrefix(ext, ".")),
+		"{rand}", hex.EncodeToString(randomBytes),
+	)
+
+	var segments []string
+	for _, segment := range strings.Split(replacer.Replace(template), "/") {
+		if segment = strings.Trim(segment, "-."); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		segments = []string{"file-" + hex.EncodeToString(randomBytes)}
+	}
+	return segments
+}
+
+// slugSegment turns a placeholder value into slug characters; anything else becomes a hyphen
+func (s *FileService) slugSegment(value string) string {
+	return s.slugify(invalidSlugSegmentChars.ReplaceAllString(value, "-"))
+}
+
+// validateTemplateSlug checks a slug made from a template: 1-100 characters in all, and
+// every segment a valid slug
+func (s *FileService) validateTemplateSlug(slug string) error {
+	if len(slug) > 100 {
+		return &InvalidSlugError{Reason: "must be 1-100 characters"}
+	}
+	for _, segment := range strings.Split(slug, "/") {
+		if err := s.validateSlug(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isReservedSlugPrefix reports whether a slug's first path segment is one of the server's routes
+func isReservedSlugPrefix(segment string) bool {
+	return slices.Contains(reservedSlugPrefixes, strings.ToLower(segment))
+}
+
+// randomSlugSuffix returns 4 random hex characters to make a slug unique
+func randomSlugSuffix() string {
+	randomBytes := make([]byte, 2)
+	rand.Read(randomBytes)
+	return hex.EncodeToString(randomBytes)
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidSort is returned for a listing sort on an unknown column
+var ErrInvalidSort = errors.New("invalid sort")
+
+// DefaultListSort is the listing order when DEFAULT_LIST_SORT is not set (newest first)
+const DefaultListSort = "-created_at"
+
+// ListSortColumns are the columns file listings can be sorted by
+var ListSortColumns = []string{"created_at", "updated_at", "expires_at", "file_size", "original_name", "download_count", "original_uploaded_at"}
+
+// getDefaultListSort returns the listing order used when no sort is given (DEFAULT_LIST_SORT)
+func getDefaultListSort() string {
+	sort := strings.ToLower(strings.TrimSpace(os.Getenv("DEFAULT_LIST_SORT")))
+	if sort == "" {
+		return DefaultListSort
+	}
+	if _, err := listOrder(sort); err != nil {
+		log.Printf("Warning: invalid DEFAULT_LIST_SORT value, using default (%s)", DefaultListSort)
+		return DefaultListSort
+	}
+	return sort
+}
+
+// listOrder returns the ORDER BY clause for a listing sort: a column, ascending, or
+// prefixed with "-" for descending. Files without an expiry date sort last by expires_at.
+func listOrder(sort string) (string, error) {
+	column, descending := strings.CutPrefix(sort, "-")
+	if !slices.Contains(ListSortColumns, column) {
+		return "", ErrInvalidSort
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	order := column + " " + direction
+	if column == "expires_at" {
+		order = "expires_at IS NULL, " + order
+	}
+	return order + ", id " + direction, nil
+}
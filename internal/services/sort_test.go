@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestListFilesSort(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultSort string // DEFAULT_LIST_SORT
+		sort        string
+		wantErr     error
+		want        []string
+	}{
+		{"newest first by default", "", "", nil, []string{"a.txt", "c.txt", "b.txt"}},
+		{"by name", "", "original_name", nil, []string{"a.txt", "b.txt", "c.txt"}},
+		{"by size", "", "file_size", nil, []string{"c.txt", "a.txt", "b.txt"}},
+		{"by size, descending", "", "-file_size", nil, []string{"b.txt", "a.txt", "c.txt"}},
+		{"oldest first", "", "created_at", nil, []string{"b.txt", "c.txt", "a.txt"}},
+		{"configured default", "file_size", "", nil, []string{"c.txt", "a.txt", "b.txt"}},
+		{"configured default, normalized", " -FILE_SIZE ", "", nil, []string{"b.txt", "a.txt", "c.txt"}},
+		{"explicit sort over the configured default", "file_size", "original_name", nil, []string{"a.txt", "b.txt", "c.txt"}},
+		{"invalid configured default", "size", "", nil, []string{"a.txt", "c.txt", "b.txt"}},
+		{"unknown column", "", "size", ErrInvalidSort, nil},
+		{"unlisted column", "", "password_hash", ErrInvalidSort, nil},
+		{"double descending", "", "--file_size", ErrInvalidSort, nil},
+		{"invalid sort with a configured default", "file_size", "size", ErrInvalidSort, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEFAULT_LIST_SORT", tt.defaultSort)
+			s := newTestService(t)
+			mustSave(t, s, "b.txt", []byte("bbb"), SaveOptions{})
+			mustSave(t, s, "c.txt", []byte("c"), SaveOptions{})
+			mustSave(t, s, "a.txt", []byte("aa"), SaveOptions{})
+
+			files, err := s.ListFilesMatching(ListFilter{Sort: tt.sort})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ListFilesMatching error = %v, want %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, file.OriginalName)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
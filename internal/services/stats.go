@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"gorm.io/gorm"
+)
+
+// Stats intervals for DownloadStats
+const (
+	StatsIntervalHour  = "hour"
+	StatsIntervalDay   = "day"
+	StatsIntervalWeek  = "week"
+	StatsIntervalMonth = "month"
+)
+
+// maxStatsBuckets caps the length of a stats time series
+const maxStatsBuckets = 1000
+
+// statsGranularity is the size of the buckets aggregated in SQL. Every time zone
+// offset is a multiple of 15 minutes, so these fold exactly into local buckets.
+const statsGranularity = 15 * time.Minute
+
+var (
+	ErrInvalidInterval = errors.New("invalid stats interval")
+	ErrInvalidRange    = errors.New("invalid stats range")
+)
+
+// StatsBucket is the number of downloads in one interval, starting at Start
+type StatsBucket struct {
+	Start     time.Time `json:"start"`
+	Downloads int64     `json:"downloads"`
+}
+
+// DownloadStats is a download time series for a file
+type DownloadStats struct {
+	FileID   uint          `json:"file_id"`
+	Interval string        `json:"interval"`
+	Timezone string        `json:"timezone"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Total    int64         `json:"total"`
+	Buckets  []StatsBucket `json:"buckets"`
+}
+
+// DownloadStats returns a file's downloads between from and to, bucketed by interval
+// in the given time zone. Buckets without downloads are included with a zero count.
+func (s *FileService) DownloadStats(id uint, interval string, from, to time.Time, loc *time.Location) (*DownloadStats, error) {
+	switch interval {
+	case StatsIntervalHour, StatsIntervalDay, StatsIntervalWeek, StatsIntervalMonth:
+	default:
+		return nil, ErrInvalidInterval
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	var file models.File
+	if err := database.DB.Select("id").First(&file, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+
+	// Build the empty series first, so the range can be rejected before querying
+	stats := &DownloadStats{
+		FileID:   id,
+		Interval: interval,
+		Timezone: loc.String(),
+		From:     models.JSONTime(from.In(loc)),
+		To:       models.JSONTime(to.In(loc)),
+		Buckets:  []StatsBucket{},
+	}
+	index := make(map[int64]int)
+	for start := bucketStart(from.In(loc), interval); start.Before(to); start = nextBucket(start, interval) {
+		if len(stats.Buckets) == maxStatsBuckets {
+			return nil, ErrInvalidRange
+		}
+		index[start.Unix()] = len(stats.Buckets)
+		stats.Buckets = append(stats.Buckets, StatsBucket{Start: start})
+	}
+
+	// Aggregate in SQL at a fine, zone-independent granularity, then fold into local buckets
+	var rows []struct {
+		Slot  int64
+		Count int64
+	}
+	granularity := int64(statsGranularity / time.Second)
+	err := database.DB.Model(&models.Download{}).
+		Select("(CAST(strftime('%s', created_at) AS INTEGER) / ?) * ? AS slot, COUNT(*) AS count", granularity, granularity).
+		Where("file_id = ? AND created_at >= ? AND created_at < ?", id, from.UTC(), to.UTC()).
+		Group("slot").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate downloads: %w", err)
+	}
+
+	for _, row := range rows {
+		start := bucketStart(time.Unix(row.Slot, 0).In(loc), interval)
+		if i, ok := index[start.Unix()]; ok {
+			stats.Buckets[i].Downloads += row.Count
+			stats.Total += row.Count
+		}
+	}
+
+	return stats, nil
+}
+
+// bucketStart returns the start of the interval containing t, in t's location
+func bucketStart(t time.Time, interval string) time.Time {
+	year, month, day := t.Date()
+	switch interval {
+	case StatsIntervalHour:
+		// Subtract the local minutes rather than rebuilding the time, so repeated DST hours stay distinct
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case StatsIntervalWeek:
+		// Weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case StatsIntervalMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// nextBucket returns the start of the interval after the one starting at start
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case StatsIntervalHour:
+		return start.Add(time.Hour)
+	case StatsIntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case StatsIntervalMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
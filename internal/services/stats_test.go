@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// logDownloadsAt records downloads of a file at the given times
+func logDownloadsAt(t *testing.T, fileID uint, times ...string) {
+	t.Helper()
+	for _, value := range times {
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", value, err)
+		}
+		if err := database.DB.Create(&models.Download{FileID: fileID, CreatedAt: at.UTC()}).Error; err != nil {
+			t.Fatalf("logging download: %v", err)
+		}
+	}
+}
+
+func TestDownloadStats(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	downloads := []string{
+		"2026-01-05T10:00:00Z", // Monday
+		"2026-01-05T10:30:00Z",
+		"2026-01-05T20:00:00Z", // Tuesday in Tokyo
+		"2026-01-07T08:00:00Z",
+		"2026-02-02T12:00:00Z",
+	}
+
+	tests := []struct {
+		name     string
+		interval string
+		from, to string
+		loc      *time.Location
+		want     []int64
+	}{
+		{"hours", StatsIntervalHour, "2026-01-05T09:00:00Z", "2026-01-05T12:00:00Z", time.UTC, []int64{0, 2, 0}},
+		{"days", StatsIntervalDay, "2026-01-05T00:00:00Z", "2026-01-08T00:00:00Z", time.UTC, []int64{3, 0, 1}},
+		{"days in another zone", StatsIntervalDay, "2026-01-04T15:00:00Z", "2026-01-07T15:00:00Z", tokyo, []int64{2, 1, 1}},
+		{"weeks start on Monday", StatsIntervalWeek, "2026-01-05T00:00:00Z", "2026-01-19T00:00:00Z", time.UTC, []int64{4, 0}},
+		{"months", StatsIntervalMonth, "2026-01-01T00:00:00Z", "2026-03-01T00:00:00Z", time.UTC, []int64{4, 1}},
+		{"range excludes downloads", StatsIntervalDay, "2026-01-06T00:00:00Z", "2026-01-07T00:00:00Z", time.UTC, []int64{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{})
+			other := mustSave(t, s, "other.txt", []byte("other"), SaveOptions{})
+			logDownloadsAt(t, file.ID, downloads...)
+			logDownloadsAt(t, other.ID, downloads...)
+
+			from, _ := time.Parse(time.RFC3339, tt.from)
+			to, _ := time.Parse(time.RFC3339, tt.to)
+			stats, err := s.DownloadStats(file.ID, tt.interval, from, to, tt.loc)
+			if err != nil {
+				t.Fatalf("DownloadStats: %v", err)
+			}
+
+			var got []int64
+			var total int64
+			for _, bucket := range stats.Buckets {
+				got = append(got, bucket.Downloads)
+				total += bucket.Downloads
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("buckets = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("buckets = %v, want %v", got, tt.want)
+				}
+			}
+			if stats.Total != total {
+				t.Errorf("total = %d, want %d", stats.Total, total)
+			}
+			if start := stats.Buckets[0].Start; start.Location() != tt.loc {
+				t.Errorf("buckets start in %s, want %s", start.Location(), tt.loc)
+			}
+		})
+	}
+}
+
+func TestDownloadStatsErrors(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		fileID   uint // 0 for the saved file
+		interval string
+		to       time.Time
+		wantErr  error
+	}{
+		{"unknown interval", 0, "minute", from.Add(time.Hour), ErrInvalidInterval},
+		{"empty range", 0, StatsIntervalDay, from, ErrInvalidRange},
+		{"reversed range", 0, StatsIntervalDay, from.Add(-time.Hour), ErrInvalidRange},
+		{"too many buckets", 0, StatsIntervalHour, from.AddDate(0, 3, 0), ErrInvalidRange},
+		{"unknown file", 9999, StatsIntervalDay, from.AddDate(0, 0, 1), ErrFileNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			file := mustSave(t, s, "notes.txt", []byte("notes"), SaveOptions{})
+			id := file.ID
+			if tt.fileID != 0 {
+				id = tt.fileID
+			}
+
+			if _, err := s.DownloadStats(id, tt.interval, from, tt.to, time.UTC); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DownloadStats error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
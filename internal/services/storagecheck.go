@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yorukot/sharing/internal/storage"
+)
+
+// Storage check steps, in the order they run
+const (
+	StorageCheckWrite  = "write"  // Save a sentinel object
+	StorageCheckRead   = "read"   // Read it back
+	StorageCheckVerify = "verify" // Compare the content read with what was written
+	StorageCheckDelete = "delete" // Delete it and confirm it is gone
+)
+
+// storageCheckPrefix starts the keys of sentinel objects, so a leftover one is recognizable
+const storageCheckPrefix = "storage-check-"
+
+// StorageCheck is the result of a round-trip check of one storage backend
+type StorageCheck struct {
+	Backend    string `json:"backend"`
+	OK         bool   `json:"ok"`
+	Step       string `json:"step,omitempty"`  // Step that failed (see StorageCheckWrite)
+	Error      string `json:"error,omitempty"` // Why it failed, as reported by the backend
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// CheckStorage checks that the storage backends work with the configured credentials and
+// permissions: it writes a small sentinel object to each one, reads it back, compares the
+// content, and deletes it. A backend name ("" for all) checks just that backend.
+func (s *FileService) CheckStorage(backend string) ([]StorageCheck, error) {
+	names := s.backends.Names()
+	if backend != "" {
+		name, err := s.resolveBackend(backend)
+		if err != nil {
+			return nil, err
+		}
+		names = []string{name}
+	}
+
+	checks := make([]StorageCheck, 0, len(names))
+	for _, name := range names {
+		start := time.Now()
+		check := StorageCheck{Backend: name, OK: true}
+		if step, err := storageRoundTrip(s.storageFor(name)); err != nil {
+			check.OK, check.Step, check.Error = false, step, err.Error()
+		}
+		check.DurationMS = time.Since(start).Milliseconds()
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// storageRoundTrip writes, reads back, verifies, and deletes a sentinel object, returning
+// the step that failed. The object is deleted whenever it was written.
+func storageRoundTrip(backend storage.Storage) (string, error) {
+	randomBytes := make([]byte, 8)
+	rand.Read(randomBytes)
+	key := storageCheckPrefix + hex.EncodeToString(randomBytes)
+	content := []byte("sharing storage check " + key)
+
+	path, err := backend.Save(bytes.NewReader(content), key, int64(len(content)))
+	if err != nil {
+		return StorageCheckWrite, err
+	}
+
+	step, err := readSentinel(backend, path, content)
+	if err != nil {
+		backend.Delete(path)
+		return step, err
+	}
+
+	if err := backend.Delete(path); err != nil {
+		return StorageCheckDelete, err
+	}
+	if exists, err := backend.Exists(path); err != nil {
+		return StorageCheckDelete, err
+	} else if exists {
+		return StorageCheckDelete, fmt.Errorf("object %s still exists after it was deleted", path)
+	}
+	return "", nil
+}
+
+// readSentinel reads a sentinel object back and compares it with the content written
+func readSentinel(backend storage.Storage, path string, content []byte) (string, error) {
+	reader, err := backend.Get(path)
+	if err != nil {
+		return StorageCheckRead, err
+	}
+	defer reader.Close()
+
+	read, err := io.ReadAll(reader)
+	if err != nil {
+		return StorageCheckRead, err
+	}
+	if !bytes.Equal(read, content) {
+		return StorageCheckVerify, fmt.Errorf("read back %d bytes that differ from the %d bytes written", len(read), len(content))
+	}
+	return "", nil
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register the GIF decoder; JPEG and PNG register through their encoders
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+	"golang.org/x/image/draw"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnsupportedImageFormat = errors.New("unsupported image format")
+	ErrInvalidImageResize     = errors.New("invalid image size")
+)
+
+// ImageFormats maps the formats image downloads can be transcoded to to their content types.
+// WebP is encoded losslessly, so it is only kept when smaller than the original.
+var ImageFormats = map[string]string{
+	"webp": "image/webp",
+}
+
+// sourceFormats maps the image content types that can be transcoded or resized to the
+// format their resized copies are encoded in (GIFs become single-frame PNGs)
+var sourceFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "png",
+}
+
+// variantTypes maps the formats variants are encoded in to their content types
+var variantTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+}
+
+// How a resized image fits its box (?fit=)
+const (
+	FitContain = "contain" // Scale to fit within the box, keeping the aspect ratio
+	FitCover   = "cover"   // Scale to fill the box, cropping the overflow around the center
+)
+
+const (
+	defaultTranscodeMaxSize = 20 * 1024 * 1024 // Largest image transcoded by default, in bytes
+	maxTranscodePixels      = 50_000_000       // Largest image transcoded, in pixels (decoded images are held in memory)
+	maxResizeDimension      = 8192             // Largest width or height IMAGE_RESIZE_SIZES may allow
+	resizedJPEGQuality      = 85
+)
+
+// transcodeMu runs one transcode at a time: they are CPU and memory heavy, and it keeps
+// concurrent downloads of the same image from transcoding it twice
+var transcodeMu sync.Mutex
+
+var (
+	imageProcessingOnce sync.Once
+	imageTranscoding    bool  // Downloads may be transcoded to smaller formats (IMAGE_TRANSCODING)
+	imageProcessMax     int64 // Largest image transcoded or resized, in bytes (IMAGE_TRANSCODE_MAX_SIZE)
+	imageResizeSizes    []int // Widths and heights images may be resized to (IMAGE_RESIZE_SIZES; none = resizing disabled)
+)
+
+// loadImageProcessing reads the image transcoding and resizing settings once
+// (IMAGE_TRANSCODING, IMAGE_TRANSCODE_MAX_SIZE, IMAGE_RESIZE_SIZES)
+func loadImageProcessing() {
+	imageProcessingOnce.Do(func() {
+		imageTranscoding, _ = strconv.ParseBool(os.Getenv("IMAGE_TRANSCODING"))
+
+		imageProcessMax = defaultTranscodeMaxSize
+		if sizeStr := os.Getenv("IMAGE_TRANSCODE_MAX_SIZE"); sizeStr != "" {
+			size, err := strconv.ParseInt(sizeStr, 10, 64)
+			if err != nil || size <= 0 {
+				log.Printf("Warning: invalid IMAGE_TRANSCODE_MAX_SIZE value, using default (%d)", defaultTranscodeMaxSize)
+			} else {
+				imageProcessMax = size
+			}
+		}
+
+		for _, sizeStr := range strings.Split(os.Getenv("IMAGE_RESIZE_SIZES"), ",") {
+			if sizeStr = strings.TrimSpace(sizeStr); sizeStr == "" {
+				continue
+			}
+			size, err := strconv.Atoi(sizeStr)
+			if err != nil || size <= 0 || size > maxResizeDimension {
+				log.Printf("Warning: invalid IMAGE_RESIZE_SIZES entry %q (1-%d), ignoring it", sizeStr, maxResizeDimension)
+				continue
+			}
+			imageResizeSizes = append(imageResizeSizes, size)
+		}
+		slices.Sort(imageResizeSizes)
+		imageResizeSizes = slices.Compact(imageResizeSizes)
+	})
+}
+
+// canProcessImage reports whether a file is an image small enough to transcode or resize
+func canProcessImage(file *models.File) bool {
+	loadImageProcessing()
+	return sourceFormats[file.ContentType] != "" && !file.InProgress &&
+		file.ContentHash != "" && file.FileSize <= imageProcessMax
+}
+
+// CanTranscode reports whether a file's downloads may be transcoded to another image format
+func CanTranscode(file *models.File) bool {
+	return canProcessImage(file) && imageTranscoding
+}
+
+// CanResize reports whether a file's downloads may be resized
+func CanResize(file *models.File) bool {
+	return canProcessImage(file) && len(imageResizeSizes) > 0
+}
+
+// ImageResizeSizes returns the widths and heights images may be resized to, smallest first
+func ImageResizeSizes() []int {
+	loadImageProcessing()
+	return imageResizeSizes
+}
+
+// VariantContentType returns the content type of a variant's format
+func VariantContentType(variant *models.ImageVariant) string {
+	return variantTypes[variant.Format]
+}
+
+// ImageResize is the size an image download asks for. A zero width or height leaves
+// that side free; both zero is the full size.
+type ImageResize struct {
+	Width  int
+	Height int
+	Fit    string // FitContain or FitCover
+}
+
+// ParseImageResize parses the width, height and fit of a resize request. Widths and
+// heights must be listed in IMAGE_RESIZE_SIZES, and cover needs both.
+func ParseImageResize(width, height, fit string) (ImageResize, error) {
+	var resize ImageResize
+	for _, side := range []struct {
+		value string
+		dest  *int
+	}{{width, &resize.Width}, {height, &resize.Height}} {
+		if side.value == "" {
+			continue
+		}
+		size, err := strconv.Atoi(side.value)
+		if err != nil || !slices.Contains(ImageResizeSizes(), size) {
+			return ImageResize{}, ErrInvalidImageResize
+		}
+		*side.dest = size
+	}
+
+	switch strings.ToLower(fit) {
+	case "", FitContain:
+		resize.Fit = FitContain
+	case FitCover:
+		if resize.Width == 0 || resize.Height == 0 {
+			return ImageResize{}, ErrInvalidImageResize
+		}
+		resize.Fit = FitCover
+	default:
+		return ImageResize{}, ErrInvalidImageResize
+	}
+	return resize, nil
+}
+
+// IsZero reports whether the resize asks for the full size
+func (r ImageResize) IsZero() bool {
+	return r.Width == 0 && r.Height == 0
+}
+
+// key identifies the size in variant records, e.g. "800x600-cover" ("" = full size)
+func (r ImageResize) key() string {
+	if r.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d-%s", r.Width, r.Height, r.Fit)
+}
+
+// target returns the scale an image of the given size is resized by, and the part of
+// the scaled image that is kept (cover crops it to the box). Images are never enlarged.
+func (r ImageResize) target(width, height int) (float64, image.Rectangle) {
+	scaleX, scaleY := 1.0, 1.0
+	if r.Width > 0 {
+		scaleX = float64(r.Width) / float64(width)
+	}
+	if r.Height > 0 {
+		scaleY = float64(r.Height) / float64(height)
+	}
+	scale := min(scaleX, scaleY, 1)
+	if r.Fit == FitCover {
+		scale = min(max(scaleX, scaleY), 1)
+	}
+
+	scaledWidth := max(1, int(math.Round(float64(width)*scale)))
+	scaledHeight := max(1, int(math.Round(float64(height)*scale)))
+	keptWidth, keptHeight := scaledWidth, scaledHeight
+	if r.Fit == FitCover {
+		keptWidth, keptHeight = min(keptWidth, r.Width), min(keptHeight, r.Height)
+	}
+	x, y := (scaledWidth-keptWidth)/2, (scaledHeight-keptHeight)/2
+	return scale, image.Rect(x, y, x+keptWidth, y+keptHeight)
+}
+
+// ImageVariant returns the file's image in format and size, transcoding or resizing it
+// and caching the result in storage on first use. An empty format keeps the image's own
+// (for resizing only). It returns nil when the original should be served instead: the
+// file can't be transcoded or resized (see CanTranscode and CanResize), or the variant
+// wouldn't be any better.
+func (s *FileService) ImageVariant(file *models.File, format string, resize ImageResize) (*models.ImageVariant, error) {
+	if _, ok := ImageFormats[format]; format != "" && !ok {
+		return nil, ErrUnsupportedImageFormat
+	}
+	if !CanTranscode(file) {
+		format = ""
+	}
+	if !CanResize(file) {
+		resize = ImageResize{}
+	}
+	if format == "" {
+		if resize.IsZero() {
+			return nil, nil
+		}
+		format = sourceFormats[file.ContentType]
+	}
+
+	if variant, err := findImageVariant(file, format, resize.key()); err != nil || variant != nil {
+		return servableVariant(variant), err
+	}
+
+	transcodeMu.Lock()
+	defer transcodeMu.Unlock()
+
+	// Another download may have made it while this one waited
+	if variant, err := findImageVariant(file, format, resize.key()); err != nil || variant != nil {
+		return servableVariant(variant), err
+	}
+
+	variant, err := s.transcodeImage(file, format, resize)
+	if err != nil {
+		return nil, err
+	}
+	return servableVariant(variant), nil
+}
+
+// OpenImageVariant returns a reader for a variant's content
+func (s *FileService) OpenImageVariant(variant *models.ImageVariant) (io.ReadCloser, error) {
+	return s.storage.Get(variant.FilePath)
+}
+
+// servableVariant returns the variant if it has content to serve, or nil
+func servableVariant(variant *models.ImageVariant) *models.ImageVariant {
+	if variant == nil || variant.FilePath == "" {
+		return nil
+	}
+	return variant
+}
+
+// findImageVariant returns the cached variant of the file's current content, or nil.
+// A variant of content the file no longer has is never returned.
+func findImageVariant(file *models.File, format, resize string) (*models.ImageVariant, error) {
+	var variant models.ImageVariant
+	err := database.DB.Where("file_id = ? AND format = ? AND resize = ? AND content_hash = ?", file.ID, format, resize, file.ContentHash).
+		First(&variant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up image variant: %w", err)
+	}
+	return &variant, nil
+}
+
+// transcodeImage converts the file's image to format and size, stores the result, and
+// records the variant so the work isn't repeated. Full-size copies are only stored when
+// smaller than the original; images already within the size are served as they are.
+func (s *FileService) transcodeImage(file *models.File, format string, resize ImageResize) (*models.ImageVariant, error) {
+	// A stale variant of replaced content may still hold the (file, format, size) slot
+	stale := database.DB.Where("file_id = ? AND format = ? AND resize = ?", file.ID, format, resize.key())
+	if err := s.deleteImageVariants(stale); err != nil {
+		return nil, err
+	}
+
+	reader, err := s.storageFor(file.StorageBackend).Get(file.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer reader.Close()
+
+	// Check the dimensions before decoding, so small files can't expand to huge images
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(reader, &header))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+	scale, kept := resize.target(config.Width, config.Height)
+	resized := kept.Dx() != config.Width || kept.Dy() != config.Height
+	converted := format != sourceFormats[file.ContentType]
+
+	variant := &models.ImageVariant{FileID: file.ID, Format: format, Resize: resize.key(), ContentHash: file.ContentHash}
+	if int64(config.Width)*int64(config.Height) <= maxTranscodePixels && (resized || converted) {
+		img, _, err := image.Decode(io.MultiReader(&header, reader))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		if resized {
+			img = scaleImage(img, scale, kept)
+		}
+
+		var encoded bytes.Buffer
+		if err := encodeImage(&encoded, img, format); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+		}
+
+		if resized || int64(encoded.Len()) < file.FileSize {
+			// Each requested size gets its own object, even when it is the full size
+			key := fmt.Sprintf("variant-%d-%s.%s", file.ID, file.ContentHash[:16], format)
+			if !resize.IsZero() {
+				keyHash := sha256.Sum256([]byte(resize.key()))
+				key = fmt.Sprintf("variant-%d-%s-%x.%s", file.ID, file.ContentHash[:16], keyHash[:6], format)
+			}
+			if variant.FilePath, err = s.storage.Save(bytes.NewReader(encoded.Bytes()), key, int64(encoded.Len())); err != nil {
+				return nil, fmt.Errorf("failed to store %s variant: %w", format, err)
+			}
+			variant.FileSize = int64(encoded.Len())
+		}
+	}
+
+	if err := database.DB.Create(variant).Error; err != nil {
+		if variant.FilePath != "" {
+			s.storage.Delete(variant.FilePath)
+		}
+		return nil, fmt.Errorf("failed to record image variant: %w", err)
+	}
+	return variant, nil
+}
+
+// scaleImage scales an image by scale and returns the kept part of the result
+func scaleImage(src image.Image, scale float64, kept image.Rectangle) image.Image {
+	bounds := src.Bounds()
+	from := image.Rect(
+		bounds.Min.X+int(float64(kept.Min.X)/scale), bounds.Min.Y+int(float64(kept.Min.Y)/scale),
+		bounds.Min.X+int(math.Round(float64(kept.Max.X)/scale)), bounds.Min.Y+int(math.Round(float64(kept.Max.Y)/scale)),
+	).Intersect(bounds)
+
+	dst := image.NewRGBA(image.Rect(0, 0, kept.Dx(), kept.Dy()))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, from, draw.Src, nil)
+	return dst
+}
+
+// encodeImage encodes an image in one of the variant formats
+func encodeImage(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "webp":
+		return nativewebp.Encode(w, img, nil)
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: resizedJPEGQuality})
+	case "png":
+		return png.Encode(w, img)
+	}
+	return ErrUnsupportedImageFormat
+}
+
+// deleteImageVariants removes the cached variants matching a query from storage and the database
+func (s *FileService) deleteImageVariants(query *gorm.DB) error {
+	var variants []models.ImageVariant
+	if err := query.Find(&variants).Error; err != nil {
+		return fmt.Errorf("failed to load image variants: %w", err)
+	}
+
+	for _, variant := range variants {
+		if variant.FilePath != "" {
+			if err := s.storage.Delete(variant.FilePath); err != nil {
+				return fmt.Errorf("failed to delete image variant: %w", err)
+			}
+		}
+		if err := database.DB.Delete(&variant).Error; err != nil {
+			return fmt.Errorf("failed to delete image variant record: %w", err)
+		}
+	}
+	return nil
+}
+
+// dropImageVariants deletes a file's cached variants after its content was replaced or
+// removed. Failures only leave stale variants behind, so they are logged.
+func (s *FileService) dropImageVariants(fileID uint) {
+	if err := s.deleteImageVariants(database.DB.Where("file_id = ?", fileID)); err != nil {
+		log.Printf("Warning: failed to delete image variants of file %d: %v", fileID, err)
+	}
+}
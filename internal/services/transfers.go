@@ -0,0 +1,102 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+const (
+	transferFlushInterval = 5 * time.Second // Longest a recorded transfer waits to be written
+	transferFlushSize     = 500             // Pending transfers that trigger an early write
+)
+
+// transferLog buffers transfer records and writes them in batches, so downloads don't
+// wait on the database
+var transferLog struct {
+	once    sync.Once
+	enabled bool // TRANSFER_ACCOUNTING
+
+	mu      sync.Mutex
+	pending []models.Transfer
+	flushMu sync.Mutex    // Serializes writes, so a failed batch is retried in order
+	full    chan struct{} // Wakes the writer when transferFlushSize is reached
+}
+
+// loadTransferLog reads TRANSFER_ACCOUNTING once and starts the background writer if it is enabled
+func loadTransferLog() {
+	transferLog.once.Do(func() {
+		transferLog.enabled, _ = strconv.ParseBool(os.Getenv("TRANSFER_ACCOUNTING"))
+		if !transferLog.enabled {
+			return
+		}
+
+		transferLog.full = make(chan struct{}, 1)
+		go func() {
+			ticker := time.NewTicker(transferFlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-transferLog.full:
+				}
+				FlushTransfers()
+			}
+		}()
+	})
+}
+
+// RecordTransfer records the bytes of a file's content a download request delivered, to be
+// written with the next batch. Requests that sent nothing aren't recorded. It does nothing
+// unless TRANSFER_ACCOUNTING is enabled.
+func RecordTransfer(fileID uint, client string, bytes int64, complete bool) {
+	loadTransferLog()
+	if !transferLog.enabled || bytes == 0 {
+		return
+	}
+
+	transferLog.mu.Lock()
+	transferLog.pending = append(transferLog.pending, models.Transfer{
+		CreatedAt: time.Now().UTC(), // Stored in UTC so range queries compare as text
+		FileID:    fileID,
+		Client:    client,
+		Bytes:     bytes,
+		Complete:  complete,
+	})
+	full := len(transferLog.pending) >= transferFlushSize
+	transferLog.mu.Unlock()
+
+	if full {
+		select {
+		case transferLog.full <- struct{}{}:
+		default: // A write is already due
+		}
+	}
+}
+
+// FlushTransfers writes the recorded transfers that are still pending. Failed writes are
+// kept and retried with the next batch. Call it before exiting, once downloads have ended.
+func FlushTransfers() {
+	transferLog.flushMu.Lock()
+	defer transferLog.flushMu.Unlock()
+
+	transferLog.mu.Lock()
+	batch := transferLog.pending
+	transferLog.pending = nil
+	transferLog.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := database.DB.CreateInBatches(batch, 100).Error; err != nil {
+		log.Printf("Warning: failed to record %d transfers, retrying later: %v", len(batch), err)
+		transferLog.mu.Lock()
+		transferLog.pending = append(batch, transferLog.pending...)
+		transferLog.mu.Unlock()
+	}
+}
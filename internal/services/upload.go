@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// ErrFileTooLarge is returned when streamed content exceeds the caller's size limit
+var ErrFileTooLarge = errors.New("file too large")
+
+// Upload is the content and metadata of a file being saved
+type Upload struct {
+	Filename    string                        // Original filename
+	ContentType string                        // Content type declared by the client
+	Size        int64                         // Content length in bytes
+	Open        func() (io.ReadCloser, error) // Opens the content (called once per pass: sniff, hash, store)
+	StoredPath  string                        // Storage key the content was already uploaded to directly (empty for regular uploads)
+	Live        bool                          // Content is written after the record is created (SaveLive); Open returns it empty
+	Source      *models.File                  // File being cloned (CloneFile); its hash and content types carry over
+	Backend     string                        // Storage backend the content is stored on (resolved from SaveOptions.Storage if empty)
+}
+
+// uploadFromFileHeader wraps a multipart form file as an Upload
+func uploadFromFileHeader(fileHeader *multipart.FileHeader) *Upload {
+	return &Upload{
+		Filename:    fileHeader.Filename,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		Size:        fileHeader.Size,
+		Open: func() (io.ReadCloser, error) {
+			return fileHeader.Open()
+		},
+	}
+}
+
+// SaveFileFromReader saves content read from r as a new file.
+// The content is buffered in memory, so callers should limit its size.
+func (s *FileService) SaveFileFromReader(filename, contentType string, r io.Reader, opts SaveOptions) (*models.File, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+
+	return s.saveUpload(&Upload{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		},
+	}, opts)
+}
+
+// SaveFileFromStream saves content read from r as a new file.
+// The content is spooled to a temporary file rather than memory; reading more than
+// maxSize bytes returns ErrFileTooLarge. Read errors from r are returned wrapped.
+func (s *FileService) SaveFileFromStream(filename, contentType string, r io.Reader, maxSize int64, opts SaveOptions) (*models.File, error) {
+	tmp, err := os.CreateTemp("", "sharing-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+	if size > maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	return s.saveUpload(&Upload{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(tmp.Name())
+		},
+	}, opts)
+}
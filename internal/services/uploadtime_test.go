@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setRetentionPolicies sets RETENTION_POLICIES for the test, rereading it on next use
+func setRetentionPolicies(t *testing.T, value string) {
+	t.Setenv("RETENTION_POLICIES", value)
+	reset := func() {
+		retentionPoliciesOnce = sync.Once{}
+		retentionPolicies = nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestSaveOriginalUploadTime(t *testing.T) {
+	setRetentionPolicies(t, "week=7d")
+	lastMonth := time.Now().Add(-30 * 24 * time.Hour).Truncate(time.Second)
+	yesterday := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name         string
+		opts         SaveOptions
+		wantErr      error
+		wantUploaded *time.Time // nil for the time of the upload
+		wantExpires  *time.Time // Expected expiry, if any
+	}{
+		{"upload time", SaveOptions{}, nil, nil, nil},
+		{"imported upload time", SaveOptions{UploadedAt: &lastMonth}, nil, &lastMonth, nil},
+		{"policy counts from the upload time", SaveOptions{UploadedAt: &yesterday, Policy: "week"}, nil, &yesterday, ptr(yesterday.Add(7 * 24 * time.Hour))},
+		{"future upload time", SaveOptions{UploadedAt: &tomorrow}, ErrInvalidUploadTime, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			before := time.Now()
+			file, err := s.SaveFileFromReader("notes.txt", "", bytesOf("notes"), tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			stored, err := s.GetFile(file.ID)
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			if stored.CreatedAt.Before(before.Add(-time.Second)) {
+				t.Errorf("created_at = %v, want the time of the upload", stored.CreatedAt)
+			}
+			if tt.wantUploaded == nil {
+				if !stored.OriginalUploadedAt.Equal(stored.CreatedAt) {
+					t.Errorf("original upload time = %v, want created_at %v", stored.OriginalUploadedAt, stored.CreatedAt)
+				}
+			} else if !stored.OriginalUploadedAt.Equal(*tt.wantUploaded) {
+				t.Errorf("original upload time = %v, want %v", stored.OriginalUploadedAt, *tt.wantUploaded)
+			}
+			if tt.wantExpires != nil && (stored.ExpiresAt == nil || !stored.ExpiresAt.Equal(*tt.wantExpires)) {
+				t.Errorf("expires at %v, want %v", stored.ExpiresAt, *tt.wantExpires)
+			}
+		})
+	}
+}
+
+func TestListFilesByOriginalUploadTime(t *testing.T) {
+	s := newTestService(t)
+	old := time.Now().Add(-48 * time.Hour)
+	older := time.Now().Add(-72 * time.Hour)
+	mustSave(t, s, "b.txt", []byte("b"), SaveOptions{UploadedAt: &old})
+	mustSave(t, s, "c.txt", []byte("c"), SaveOptions{})
+	mustSave(t, s, "a.txt", []byte("a"), SaveOptions{UploadedAt: &older})
+
+	tests := []struct {
+		sort    string
+		want    []string
+		wantErr error
+	}{
+		{"original_uploaded_at", []string{"a.txt", "b.txt", "c.txt"}, nil},
+		{"-original_uploaded_at", []string{"c.txt", "b.txt", "a.txt"}, nil},
+		{"created_at", []string{"b.txt", "c.txt", "a.txt"}, nil},
+		{"uploaded_at", nil, ErrInvalidSort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			files, err := s.ListFilesMatching(ListFilter{Sort: tt.sort})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ListFilesMatching error = %v, want %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, file := range files {
+				names = append(names, file.OriginalName)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Fatalf("listed %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
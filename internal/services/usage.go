@@ -0,0 +1,41 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// Usage scopes
+const (
+	UsageScopeInstance = "instance" // Totals of every file (the admin key, API_KEY)
+)
+
+// Usage is how much an API key has stored, and the limits it uploads under
+type Usage struct {
+	Scope     string      `json:"scope"`
+	FileCount int64       `json:"file_count"`
+	BytesUsed int64       `json:"bytes_used"`
+	Limits    UsageLimits `json:"limits"`
+}
+
+// UsageLimits are the quotas an API key uploads under (nil = unlimited)
+type UsageLimits struct {
+	MaxFiles *int64 `json:"max_files"`
+	MaxBytes *int64 `json:"max_bytes"`
+}
+
+// Usage returns the files stored on the instance and their total size. API_KEY is the
+// only key and has no quotas, so its usage is instance-wide and its limits are unlimited.
+// Files sharing content (STORAGE_MODE=cas) each count their full size.
+func (s *FileService) Usage() (*Usage, error) {
+	usage := &Usage{Scope: UsageScopeInstance}
+	err := database.DB.Model(&models.File{}).
+		Select("COUNT(*), COALESCE(SUM(file_size), 0)").
+		Row().Scan(&usage.FileCount, &usage.BytesUsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute usage: %w", err)
+	}
+	return usage, nil
+}
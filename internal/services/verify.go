@@ -0,0 +1,63 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/yorukot/sharing/internal/models"
+)
+
+// ErrNoChecksum is returned when verifying a file that has no recorded content hash
+// (e.g., uploaded directly to storage)
+var ErrNoChecksum = errors.New("file has no stored checksum")
+
+// Verification is the result of checking a file's stored content against its checksum
+type Verification struct {
+	FileID       uint      `json:"file_id"`
+	ExpectedHash string    `json:"expected_hash"` // SHA-256 recorded at upload
+	ActualHash   string    `json:"actual_hash"`   // SHA-256 of the content in storage
+	ExpectedSize int64     `json:"expected_size"`
+	ActualSize   int64     `json:"actual_size"`
+	Match        bool      `json:"match"`
+	VerifiedAt   time.Time `json:"verified_at"`
+}
+
+// VerifyFile reads a file's content back from storage and compares its SHA-256 and
+// size with those recorded at upload, to detect corruption such as bit rot
+func (s *FileService) VerifyFile(file *models.File) (*Verification, error) {
+	if file.ContentHash == "" {
+		return nil, ErrNoChecksum
+	}
+
+	reader, err := s.storageFor(file.StorageBackend).Get(file.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	result := &Verification{
+		FileID:       file.ID,
+		ExpectedHash: file.ContentHash,
+		ActualHash:   hex.EncodeToString(hasher.Sum(nil)),
+		ExpectedSize: file.FileSize,
+		ActualSize:   size,
+		VerifiedAt:   models.JSONTime(time.Now()),
+	}
+	result.Match = result.ActualHash == result.ExpectedHash && result.ActualSize == result.ExpectedSize
+	if !result.Match {
+		log.Printf("Warning: file %d (%s) failed verification: stored content hash %s, expected %s",
+			file.ID, file.FilePath, result.ActualHash, result.ExpectedHash)
+	}
+	return result, nil
+}
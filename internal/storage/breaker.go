@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrStorageUnavailable is returned without calling the backend while the circuit breaker is open
+var ErrStorageUnavailable = errors.New("storage temporarily unavailable")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Operations reach the backend
+	BreakerOpen     = "open"      // Operations fail fast until a probe succeeds
+	BreakerHalfOpen = "half-open" // A probe is checking whether the backend has recovered
+)
+
+// breakerProbeKey is the object looked up to probe the backend (it doesn't need to exist)
+const breakerProbeKey = ".sharing-health-probe"
+
+// CircuitBreaker wraps a storage backend and stops calling it after a number of consecutive
+// failures. While open, operations fail immediately with ErrStorageUnavailable, and the
+// backend is probed after every cooldown until it responds again.
+// Missing objects (ErrObjectNotFound) are not failures.
+type CircuitBreaker struct {
+	backend   Storage
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int    // Consecutive failures while closed
+	trips    uint64 // Times the breaker has opened
+}
+
+// NewCircuitBreaker wraps backend with a breaker that opens after threshold consecutive
+// failures and probes the backend every cooldown while open
+func NewCircuitBreaker(backend Storage, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		backend:   backend,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// Unwrap returns the wrapped backend
+func (b *CircuitBreaker) Unwrap() Storage {
+	return b.backend
+}
+
+// State returns the current breaker state (closed, open, or half-open)
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Available reports whether operations currently reach the backend
+func (b *CircuitBreaker) Available() bool {
+	return b.State() == BreakerClosed
+}
+
+// Trips returns how many times the breaker has opened since the process started
+func (b *CircuitBreaker) Trips() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.trips
+}
+
+// allow returns ErrStorageUnavailable unless the breaker is closed
+func (b *CircuitBreaker) allow() error {
+	if !b.Available() {
+		return ErrStorageUnavailable
+	}
+	return nil
+}
+
+// record counts the outcome of a backend call, opening the breaker at the threshold
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || errors.Is(err, ErrObjectNotFound) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.trips++
+		log.Printf("Storage circuit breaker opened after %d consecutive failures (last: %v)", b.failures, err)
+		go b.probe()
+	}
+}
+
+// probe checks the backend after every cooldown and closes the breaker once it responds
+func (b *CircuitBreaker) probe() {
+	for {
+		time.Sleep(b.cooldown)
+
+		b.mu.Lock()
+		b.state = BreakerHalfOpen
+		b.mu.Unlock()
+
+		_, err := b.backend.Exists(breakerProbeKey)
+
+		b.mu.Lock()
+		if err == nil {
+			b.state = BreakerClosed
+			b.failures = 0
+			b.mu.Unlock()
+			log.Println("Storage circuit breaker closed: backend is responding again")
+			return
+		}
+		b.state = BreakerOpen
+		b.mu.Unlock()
+		log.Printf("Storage circuit breaker still open: probe failed: %v", err)
+	}
+}
+
+// Save saves a file through the breaker
+func (b *CircuitBreaker) Save(reader io.Reader, filename string, size int64) (string, error) {
+	if err := b.allow(); err != nil {
+		return "", err
+	}
+	path, err := b.backend.Save(reader, filename, size)
+	b.record(err)
+	return path, err
+}
+
+// Get opens a file through the breaker
+func (b *CircuitBreaker) Get(path string) (io.ReadCloser, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	reader, err := b.backend.Get(path)
+	b.record(err)
+	return reader, err
+}
+
+// GetRange reads part of a file through the breaker (the backend must implement RangeReader, see AsRangeReader)
+func (b *CircuitBreaker) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	rangeReader, ok := b.backend.(RangeReader)
+	if !ok {
+		return nil, fmt.Errorf("storage backend does not support range reads")
+	}
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	reader, err := rangeReader.GetRange(path, offset, length)
+	b.record(err)
+	return reader, err
+}
+
+// Delete removes a file through the breaker
+func (b *CircuitBreaker) Delete(path string) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := b.backend.Delete(path)
+	b.record(err)
+	return err
+}
+
+// Exists checks a file through the breaker
+func (b *CircuitBreaker) Exists(path string) (bool, error) {
+	if err := b.allow(); err != nil {
+		return false, err
+	}
+	exists, err := b.backend.Exists(path)
+	b.record(err)
+	return exists, err
+}
+
+// Lock locks a file through the breaker (the backend must implement Locker, see AsLocker)
+func (b *CircuitBreaker) Lock(path string, until time.Time) error {
+	locker, ok := b.backend.(Locker)
+	if !ok {
+		return fmt.Errorf("storage backend does not support locking")
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := locker.Lock(path, until)
+	b.record(err)
+	return err
+}
+
+// Tag tags a file through the breaker (the backend must implement Tagger, see AsTagger)
+func (b *CircuitBreaker) Tag(path string, vars map[string]string) error {
+	tagger, ok := b.backend.(Tagger)
+	if !ok {
+		return fmt.Errorf("storage backend does not support tagging")
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := tagger.Tag(path, vars)
+	b.record(err)
+	return err
+}
+
+// Tail opens a growing file through the breaker (the backend must implement Tailer, see AsTailer)
+func (b *CircuitBreaker) Tail(path string) (io.ReadCloser, error) {
+	tailer, ok := b.backend.(Tailer)
+	if !ok {
+		return nil, fmt.Errorf("storage backend does not support live uploads")
+	}
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	reader, err := tailer.Tail(path)
+	b.record(err)
+	return reader, err
+}
+
+// PresignPut presigns an upload through the breaker (the backend must implement Presigner, see AsPresigner)
+func (b *CircuitBreaker) PresignPut(path, contentType string, size int64, expires time.Duration) (string, error) {
+	presigner, ok := b.backend.(Presigner)
+	if !ok {
+		return "", fmt.Errorf("storage backend does not support direct uploads")
+	}
+	if err := b.allow(); err != nil {
+		return "", err
+	}
+	// Presigning is computed locally and says nothing about the backend's health
+	return presigner.PresignPut(path, contentType, size, expires)
+}
+
+// Stat reads object info through the breaker (the backend must implement Presigner, see AsPresigner)
+func (b *CircuitBreaker) Stat(path string) (ObjectInfo, error) {
+	presigner, ok := b.backend.(Presigner)
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("storage backend does not support direct uploads")
+	}
+	if err := b.allow(); err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := presigner.Stat(path)
+	b.record(err)
+	return info, err
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errBackendDown = errors.New("backend down")
+
+// flakyStorage is local storage that fails every call while down. If probeGate is set,
+// its Exists calls, which the breaker probes with, send on probed and wait for probeGate.
+type flakyStorage struct {
+	*LocalStorage
+	down      atomic.Bool
+	calls     atomic.Int32
+	probed    chan struct{}
+	probeGate chan struct{}
+}
+
+func newFlakyStorage(t *testing.T) *flakyStorage {
+	t.Helper()
+	local, err := NewLocalStorage(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return &flakyStorage{LocalStorage: local}
+}
+
+func (f *flakyStorage) Delete(path string) error {
+	f.calls.Add(1)
+	if f.down.Load() {
+		return errBackendDown
+	}
+	return f.LocalStorage.Delete(path)
+}
+
+func (f *flakyStorage) Exists(path string) (bool, error) {
+	f.calls.Add(1)
+	if f.probeGate != nil {
+		f.probed <- struct{}{}
+		<-f.probeGate
+	}
+	if f.down.Load() {
+		return false, errBackendDown
+	}
+	return f.LocalStorage.Exists(path)
+}
+
+// waitForState waits until the breaker reaches state, failing the test after a second
+func waitForState(t *testing.T, b *CircuitBreaker, state string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for b.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("breaker is %s, want %s", b.State(), state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		succeed   bool // A successful call after the failures
+		notFound  int  // Calls for missing objects after that
+		wantState string
+	}{
+		{"below the threshold", 2, false, 0, BreakerClosed},
+		{"at the threshold", 3, false, 0, BreakerOpen},
+		{"success resets the count", 2, true, 0, BreakerClosed},
+		{"missing objects are not failures", 2, false, 5, BreakerClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFlakyStorage(t)
+			b := NewCircuitBreaker(backend, 3, time.Hour)
+
+			backend.down.Store(true)
+			for i := 0; i < tt.failures; i++ {
+				if err := b.Delete("file"); !errors.Is(err, errBackendDown) {
+					t.Fatalf("Delete error = %v, want the backend's", err)
+				}
+			}
+			backend.down.Store(false)
+			if tt.succeed {
+				if _, err := b.Exists("file"); err != nil {
+					t.Fatalf("Exists: %v", err)
+				}
+				backend.down.Store(true)
+				b.Delete("file")
+				backend.down.Store(false)
+			}
+			for i := 0; i < tt.notFound; i++ {
+				if _, err := b.Get("missing"); !errors.Is(err, ErrObjectNotFound) {
+					t.Fatalf("Get error = %v, want ErrObjectNotFound", err)
+				}
+			}
+
+			if got := b.State(); got != tt.wantState {
+				t.Fatalf("state = %s, want %s", got, tt.wantState)
+			}
+			if tt.wantState != BreakerOpen {
+				return
+			}
+
+			// While open, calls fail fast without reaching the backend
+			calls := backend.calls.Load()
+			if err := b.Delete("file"); !errors.Is(err, ErrStorageUnavailable) {
+				t.Fatalf("Delete while open error = %v, want ErrStorageUnavailable", err)
+			}
+			if backend.calls.Load() != calls {
+				t.Fatal("open breaker called the backend")
+			}
+			if b.Available() || b.Trips() != 1 {
+				t.Fatalf("available = %v, trips = %d, want unavailable after 1 trip", b.Available(), b.Trips())
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerProbesUntilBackendRecovers(t *testing.T) {
+	backend := newFlakyStorage(t)
+	backend.probed = make(chan struct{})
+	backend.probeGate = make(chan struct{})
+	b := NewCircuitBreaker(backend, 1, time.Millisecond)
+
+	backend.down.Store(true)
+	b.Delete("file")
+	if b.State() != BreakerOpen {
+		t.Fatalf("state after a failure = %s, want %s", b.State(), BreakerOpen)
+	}
+
+	// The probe is half-open while it waits on the backend, and calls still fail fast
+	<-backend.probed
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("state while probing = %s, want %s", b.State(), BreakerHalfOpen)
+	}
+	if err := b.Delete("file"); !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("Delete while half-open error = %v, want ErrStorageUnavailable", err)
+	}
+
+	// A failed probe leaves the breaker open, and it probes again after the cooldown
+	backend.probeGate <- struct{}{}
+	<-backend.probed
+	if b.Available() {
+		t.Fatal("breaker closed after a failed probe")
+	}
+
+	// A successful probe closes it
+	backend.down.Store(false)
+	backend.probeGate <- struct{}{}
+	waitForState(t, b, BreakerClosed)
+
+	calls := backend.calls.Load()
+	b.Delete("file")
+	if backend.calls.Load() == calls {
+		t.Fatal("closed breaker didn't call the backend")
+	}
+	if b.Trips() != 1 {
+		t.Fatalf("trips = %d, want 1", b.Trips())
+	}
+}
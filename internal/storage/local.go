@@ -7,26 +7,74 @@ import (
 	"path/filepath"
 )
 
+// MaxShardDepth is the deepest directory sharding LocalStorage supports
+const MaxShardDepth = 4
+
 // LocalStorage implements the Storage interface using the local filesystem
 type LocalStorage struct {
-	dataDir string
+	dataDir    string
+	shardDepth int // Directory levels derived from the filename (0 = flat)
 }
 
-// NewLocalStorage creates a new local filesystem storage backend
-func NewLocalStorage(dataDir string) (*LocalStorage, error) {
+// NewLocalStorage creates a new local filesystem storage backend.
+// With a shardDepth above 0, files are stored in nested directories named after
+// pairs of leading filename characters (e.g., depth 2: dataDir/ab/cd/abcdef...),
+// so no single directory grows to hold every upload.
+func NewLocalStorage(dataDir string, shardDepth int) (*LocalStorage, error) {
 	// Ensure data directory exists
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
+	if shardDepth < 0 || shardDepth > MaxShardDepth {
+		return nil, fmt.Errorf("shard depth must be between 0 and %d", MaxShardDepth)
+	}
+
 	return &LocalStorage{
-		dataDir: dataDir,
+		dataDir:    dataDir,
+		shardDepth: shardDepth,
 	}, nil
 }
 
+// shardPath returns where a file with the given name is stored at the configured depth
+func (l *LocalStorage) shardPath(filename string) string {
+	if len(filename) < 2*l.shardDepth {
+		return filepath.Join(l.dataDir, filename) // Too short to shard
+	}
+
+	parts := []string{l.dataDir}
+	for i := 0; i < l.shardDepth; i++ {
+		parts = append(parts, filename[2*i:2*i+2])
+	}
+	return filepath.Join(append(parts, filename)...)
+}
+
+// locate returns the path a stored file can be found at. Stored paths are used as is;
+// if the file isn't there, the flat and sharded locations for its name are checked too,
+// so files moved between layouts (e.g., after changing LOCAL_SHARD_DEPTH) stay reachable.
+func (l *LocalStorage) locate(path string) string {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return path
+	}
+
+	name := filepath.Base(path)
+	for _, candidate := range []string{l.shardPath(name), filepath.Join(l.dataDir, name)} {
+		if candidate == path {
+			continue
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return path
+}
+
 // Save saves a file to the local filesystem
 func (l *LocalStorage) Save(reader io.Reader, filename string, size int64) (string, error) {
-	filePath := filepath.Join(l.dataDir, filename)
+	filePath := l.shardPath(filename)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create shard directory: %w", err)
+	}
 
 	// Create destination file
 	dst, err := os.Create(filePath)
@@ -46,19 +94,42 @@ func (l *LocalStorage) Save(reader io.Reader, filename string, size int64) (stri
 
 // Get retrieves a file from the local filesystem
 func (l *LocalStorage) Get(path string) (io.ReadCloser, error) {
-	file, err := os.Open(path)
+	file, err := os.Open(l.locate(path))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("file not found: %w", err)
+			return nil, fmt.Errorf("%w: %v", ErrObjectNotFound, err)
 		}
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	return file, nil
 }
 
+// GetRange opens a file at offset, reading at most length bytes
+func (l *LocalStorage) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := l.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	file := reader.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// Tail opens a file that may still be growing. Reads at the current end of the file
+// return io.EOF, and later reads pick up whatever has been appended since.
+func (l *LocalStorage) Tail(path string) (io.ReadCloser, error) {
+	return l.Get(path)
+}
+
 // Delete removes a file from the local filesystem
 func (l *LocalStorage) Delete(path string) error {
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(l.locate(path)); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 	return nil
@@ -66,7 +137,7 @@ func (l *LocalStorage) Delete(path string) error {
 
 // Exists checks if a file exists on the local filesystem
 func (l *LocalStorage) Exists(path string) (bool, error) {
-	_, err := os.Stat(path)
+	_, err := os.Stat(l.locate(path))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
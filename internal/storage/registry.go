@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ErrUnknownBackend is returned for a storage backend name that isn't configured
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Registry holds the configured storage backends by name. New files are stored on the
+// primary backend unless another one is chosen, and each file is read from and deleted
+// on the backend it was stored on.
+type Registry struct {
+	primary  string
+	backends map[string]Storage
+	names    []string // In registration order
+}
+
+// NewRegistry creates a registry whose primary backend is the one registered under the given name
+func NewRegistry(primary string) *Registry {
+	return &Registry{primary: primary, backends: make(map[string]Storage)}
+}
+
+// NewSingleRegistry creates a registry holding just one backend, which is the primary
+// (e.g., for deployments with a single STORAGE_TYPE)
+func NewSingleRegistry(name string, backend Storage) *Registry {
+	r := NewRegistry(name)
+	r.Register(name, backend)
+	return r
+}
+
+// Register adds a backend under a name, replacing any backend registered under it before
+func (r *Registry) Register(name string, backend Storage) {
+	if _, ok := r.backends[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.backends[name] = backend
+}
+
+// PrimaryName returns the name of the primary backend
+func (r *Registry) PrimaryName() string {
+	return r.primary
+}
+
+// Primary returns the primary backend
+func (r *Registry) Primary() Storage {
+	return r.For(r.primary)
+}
+
+// Names returns the names of the registered backends, in registration order
+func (r *Registry) Names() []string {
+	return slices.Clone(r.names)
+}
+
+// Resolve returns the registered name a backend is chosen by ("" for the primary), or
+// ErrUnknownBackend if there is none
+func (r *Registry) Resolve(name string) (string, error) {
+	if name == "" {
+		name = r.primary
+	}
+	if _, ok := r.backends[name]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	return name, nil
+}
+
+// For returns the backend registered under a name ("" for the primary). A name that isn't
+// registered (e.g., a backend removed from the configuration) gets a backend whose
+// operations all fail with ErrUnknownBackend.
+func (r *Registry) For(name string) Storage {
+	name, err := r.Resolve(name)
+	if err != nil {
+		return unknownBackend{err: err}
+	}
+	return r.backends[name]
+}
+
+// Wrap returns a registry of the same backends, each wrapped by wrap (e.g., NewTraced)
+func (r *Registry) Wrap(wrap func(Storage) Storage) *Registry {
+	wrapped := NewRegistry(r.primary)
+	for _, name := range r.names {
+		wrapped.Register(name, wrap(r.backends[name]))
+	}
+	return wrapped
+}
+
+// unknownBackend stands in for a backend that isn't configured
+type unknownBackend struct {
+	err error
+}
+
+func (u unknownBackend) Save(io.Reader, string, int64) (string, error) { return "", u.err }
+func (u unknownBackend) Get(string) (io.ReadCloser, error)             { return nil, u.err }
+func (u unknownBackend) Delete(string) error                           { return u.err }
+func (u unknownBackend) Exists(string) (bool, error)                   { return false, u.err }
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// wrappedStorage stands in for a wrapper such as Traced
+type wrappedStorage struct {
+	Storage
+}
+
+// newTestRegistry returns a registry of local backends in temporary directories, with
+// the first name as the primary
+func newTestRegistry(t *testing.T, names ...string) (*Registry, map[string]*LocalStorage) {
+	t.Helper()
+	registry := NewRegistry(names[0])
+	backends := make(map[string]*LocalStorage)
+	for _, name := range names {
+		local, err := NewLocalStorage(t.TempDir(), 0)
+		if err != nil {
+			t.Fatalf("NewLocalStorage: %v", err)
+		}
+		registry.Register(name, local)
+		backends[name] = local
+	}
+	return registry, backends
+}
+
+func TestRegistryResolve(t *testing.T) {
+	registry, _ := newTestRegistry(t, "local", "s3")
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"", "local", nil}, // Default selection
+		{"local", "local", nil},
+		{"s3", "s3", nil},
+		{"gcs", "", ErrUnknownBackend},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registry.Resolve(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Resolve(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryFor(t *testing.T) {
+	registry, backends := newTestRegistry(t, "local", "s3")
+
+	if registry.For("") != Storage(backends["local"]) || registry.Primary() != Storage(backends["local"]) {
+		t.Fatal("the primary backend isn't the default")
+	}
+	if registry.For("s3") != Storage(backends["s3"]) {
+		t.Fatal("For(\"s3\") didn't return the backend registered as s3")
+	}
+
+	unknown := registry.For("gcs")
+	if _, err := unknown.Get("key"); !errors.Is(err, ErrUnknownBackend) {
+		t.Fatalf("Get on an unknown backend = %v, want ErrUnknownBackend", err)
+	}
+	if err := unknown.Delete("key"); !errors.Is(err, ErrUnknownBackend) {
+		t.Fatalf("Delete on an unknown backend = %v, want ErrUnknownBackend", err)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	registry, _ := newTestRegistry(t, "local", "s3")
+
+	replacement, err := NewLocalStorage(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	registry.Register("local", replacement)
+
+	if got := registry.Names(); !slices.Equal(got, []string{"local", "s3"}) {
+		t.Fatalf("Names() = %v, want registration order without duplicates", got)
+	}
+	if registry.For("local") != Storage(replacement) {
+		t.Fatal("registering a name again didn't replace its backend")
+	}
+}
+
+func TestNewSingleRegistry(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	registry := NewSingleRegistry("local", local)
+
+	if registry.PrimaryName() != "local" || registry.Primary() != Storage(local) {
+		t.Fatal("the single backend isn't the primary")
+	}
+	if got := registry.Names(); !slices.Equal(got, []string{"local"}) {
+		t.Fatalf("Names() = %v, want [local]", got)
+	}
+}
+
+func TestRegistryWrap(t *testing.T) {
+	registry, _ := newTestRegistry(t, "local", "s3")
+
+	var wrapped []Storage
+	result := registry.Wrap(func(st Storage) Storage {
+		wrapped = append(wrapped, st)
+		return wrappedStorage{st}
+	})
+
+	if _, ok := result.For("s3").(wrappedStorage); !ok {
+		t.Fatal("For(\"s3\") didn't return the wrapped backend")
+	}
+	if len(wrapped) != 2 {
+		t.Fatalf("wrapped %d backends, want 2", len(wrapped))
+	}
+	if result.PrimaryName() != "local" || !slices.Equal(result.Names(), registry.Names()) {
+		t.Fatal("wrapping changed the registered names")
+	}
+}
@@ -1,19 +1,29 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3Storage implements the Storage interface using S3-compatible storage
 type S3Storage struct {
-	client *s3.Client
-	bucket string
+	client         *s3.Client
+	bucket         string
+	objectLockMode types.ObjectLockRetentionMode
+	tagTemplate    []objectTag // Tags set on saved objects (empty = no tagging)
+
+	secondary    *S3Storage // Replica read when the primary fails (nil = no failover)
+	mirrorWrites bool       // Also save and delete objects in the secondary
 }
 
 // S3Config holds configuration for S3 storage
@@ -24,6 +34,13 @@ type S3Config struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	UsePathStyle    bool
+	ObjectLockMode  string // "GOVERNANCE" or "COMPLIANCE" to propagate file locks to S3 Object Lock (empty disables)
+	TagTemplate     string // Object tags, e.g. "app=sharing,expires={expires_date}" (empty disables, see parseTagTemplate)
+
+	// Secondary is a replica bucket (e.g., in another region) that reads fall back to
+	// when the primary fails. Its own Secondary is ignored.
+	Secondary    *S3Config
+	MirrorWrites bool // Also save and delete objects in Secondary (when it isn't replicated by S3)
 }
 
 // NewS3Storage creates a new S3 storage backend
@@ -59,40 +76,212 @@ func NewS3Storage(config S3Config) (*S3Storage, error) {
 		o.UsePathStyle = config.UsePathStyle
 	})
 
-	return &S3Storage{
-		client: client,
-		bucket: config.Bucket,
-	}, nil
+	tagTemplate, err := parseTagTemplate(config.TagTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 tag template: %w", err)
+	}
+
+	backend := &S3Storage{
+		client:         client,
+		bucket:         config.Bucket,
+		objectLockMode: types.ObjectLockRetentionMode(config.ObjectLockMode),
+		tagTemplate:    tagTemplate,
+	}
+
+	if config.Secondary != nil {
+		secondaryConfig := *config.Secondary
+		secondaryConfig.Secondary = nil
+		secondary, err := NewS3Storage(secondaryConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create secondary S3 storage: %w", err)
+		}
+		backend.secondary = secondary
+		backend.mirrorWrites = config.MirrorWrites
+	}
+
+	return backend, nil
 }
 
-// Save uploads a file to S3
+const (
+	multipartThreshold = 64 << 20 // Content larger than this (or of unknown size) is uploaded in parts
+	multipartPartSize  = 8 << 20  // Size of each part, unless the content needs larger ones
+	maxMultipartParts  = 10000    // Most parts S3 allows in one upload
+)
+
+// Save uploads a file to S3. Content of unknown size (-1) or larger than
+// multipartThreshold is uploaded in parts as it is read, instead of in a single request.
 func (s *S3Storage) Save(reader io.Reader, filename string, size int64) (string, error) {
 	ctx := context.Background()
 
 	// Use filename as the S3 key
 	key := filename
 
-	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+	if size < 0 || size > multipartThreshold {
+		if err := s.saveMultipart(ctx, reader, key, size); err != nil {
+			return "", err
+		}
+	} else {
+		_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+			Body:   reader,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to upload to S3: %w", err)
+		}
+	}
+
+	if s.secondary != nil && s.mirrorWrites {
+		s.mirrorSave(reader, key, size)
+	}
+
+	return key, nil
+}
+
+// saveMultipart uploads content to S3 in a multipart upload, one part at a time as it is
+// read. If anything fails, the multipart upload is aborted, so its parts don't linger in
+// the bucket.
+func (s *S3Storage) saveMultipart(ctx context.Context, reader io.Reader, key string, size int64) error {
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
-		Body:   reader,
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to upload to S3: %w", err)
+		return fmt.Errorf("failed to start multipart upload to S3: %w", err)
 	}
 
-	return key, nil
+	parts, err := s.uploadParts(ctx, reader, key, created.UploadId, size)
+	if err == nil {
+		_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(key),
+			UploadId:        created.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		_, abortErr := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(key),
+			UploadId: created.UploadId,
+		})
+		if abortErr != nil {
+			log.Printf("Warning: failed to abort multipart upload of %s: %v", key, abortErr)
+		}
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+	return nil
 }
 
-// Get downloads a file from S3
+// uploadParts reads content in parts of multipartPartSize (larger if a known size needs
+// more than maxMultipartParts of them) and uploads each one. Empty content is uploaded
+// as a single empty part, since a multipart upload needs at least one.
+func (s *S3Storage) uploadParts(ctx context.Context, reader io.Reader, key string, uploadID *string, size int64) ([]types.CompletedPart, error) {
+	partSize := int64(multipartPartSize)
+	if size > partSize*maxMultipartParts {
+		partSize = (size + maxMultipartParts - 1) / maxMultipartParts
+	}
+
+	buf := make([]byte, partSize)
+	var parts []types.CompletedPart
+	for partNumber := int32(1); ; partNumber++ {
+		n, readErr := io.ReadFull(reader, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("failed to read content: %w", readErr)
+		}
+		if n == 0 && len(parts) > 0 {
+			return parts, nil
+		}
+		if partNumber > maxMultipartParts {
+			return nil, fmt.Errorf("content exceeds %d parts of %d bytes", maxMultipartParts, partSize)
+		}
+
+		output, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(s.bucket),
+			Key:           aws.String(key),
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(buf[:n]),
+			ContentLength: aws.Int64(int64(n)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: output.ETag, PartNumber: aws.Int32(partNumber)})
+
+		if readErr != nil {
+			return parts, nil // Content ended within this part
+		}
+	}
+}
+
+// mirrorSave copies a newly saved object to the secondary bucket. The primary copy is
+// already stored, so failures are logged rather than failing the upload.
+func (s *S3Storage) mirrorSave(reader io.Reader, key string, size int64) {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		log.Printf("Warning: not mirroring %s to the secondary S3 bucket: content can't be re-read", key)
+		return
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Warning: failed to mirror %s to the secondary S3 bucket: %v", key, err)
+		return
+	}
+	if _, err := s.secondary.Save(reader, key, size); err != nil {
+		log.Printf("Warning: failed to mirror %s to the secondary S3 bucket: %v", key, err)
+	}
+}
+
+// Get downloads a file from S3, falling back to the secondary bucket if the primary fails
 func (s *S3Storage) Get(path string) (io.ReadCloser, error) {
+	body, err := s.get(path, "")
+	if err == nil || s.secondary == nil {
+		return body, err
+	}
+
+	body, secondaryErr := s.secondary.get(path, "")
+	if secondaryErr != nil {
+		return nil, err // The primary's error says more (e.g., an outage rather than replication lag)
+	}
+	log.Printf("Read %s from the secondary S3 bucket: %v", path, err)
+	return body, nil
+}
+
+// GetRange downloads length bytes of a file starting at offset, falling back to the
+// secondary bucket like Get
+func (s *S3Storage) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	body, err := s.get(path, byteRange)
+	if err == nil || s.secondary == nil {
+		return body, err
+	}
+
+	body, secondaryErr := s.secondary.get(path, byteRange)
+	if secondaryErr != nil {
+		return nil, err
+	}
+	log.Printf("Read %s from the secondary S3 bucket: %v", path, err)
+	return body, nil
+}
+
+// get downloads a file, or a byte range of it (e.g., "bytes=0-99"; "" for all), from
+// this bucket only
+func (s *S3Storage) get(path, byteRange string) (io.ReadCloser, error) {
 	ctx := context.Background()
 
-	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(path),
-	})
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+	result, err := s.client.GetObject(ctx, input)
 	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, path)
+		}
 		return nil, fmt.Errorf("failed to download from S3: %w", err)
 	}
 
@@ -111,11 +300,31 @@ func (s *S3Storage) Delete(path string) error {
 		return fmt.Errorf("failed to delete from S3: %w", err)
 	}
 
+	if s.secondary != nil && s.mirrorWrites {
+		if err := s.secondary.Delete(path); err != nil {
+			log.Printf("Warning: failed to delete %s from the secondary S3 bucket: %v", path, err)
+		}
+	}
+
 	return nil
 }
 
-// Exists checks if a file exists in S3
+// Exists checks if a file exists in S3. With a secondary bucket, an object that can
+// be read from the replica counts as existing.
 func (s *S3Storage) Exists(path string) (bool, error) {
+	exists, err := s.exists(path)
+	if (err == nil && exists) || s.secondary == nil {
+		return exists, err
+	}
+
+	if secondaryExists, secondaryErr := s.secondary.exists(path); secondaryErr == nil && secondaryExists {
+		return true, nil
+	}
+	return exists, err
+}
+
+// exists checks if a file exists in this bucket only
+func (s *S3Storage) exists(path string) (bool, error) {
 	ctx := context.Background()
 
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
@@ -123,9 +332,104 @@ func (s *S3Storage) Exists(path string) (bool, error) {
 		Key:    aws.String(path),
 	})
 	if err != nil {
-		// Check if error is "not found"
-		return false, nil
+		// Only a "not found" response means the object is missing; other errors may be transient
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check object in S3: %w", err)
 	}
 
 	return true, nil
 }
+
+// Lock applies S3 Object Lock retention to an object (no-op unless ObjectLockMode is configured)
+func (s *S3Storage) Lock(path string, until time.Time) error {
+	if s.objectLockMode == "" {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	_, err := s.client.PutObjectRetention(ctx, &s3.PutObjectRetentionInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+		Retention: &types.ObjectLockRetention{
+			Mode:            s.objectLockMode,
+			RetainUntilDate: aws.Time(until),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set S3 object retention: %w", err)
+	}
+
+	return nil
+}
+
+// Tag sets an object's tags from the tag template with PutObjectTagging (no-op unless
+// TagTemplate is configured). Tags whose value renders empty are left out.
+func (s *S3Storage) Tag(path string, vars map[string]string) error {
+	if len(s.tagTemplate) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	var tagSet []types.Tag
+	for _, tag := range s.tagTemplate {
+		if value := tag.render(vars); value != "" {
+			tagSet = append(tagSet, types.Tag{Key: aws.String(tag.key), Value: aws.String(value)})
+		}
+	}
+
+	_, err := s.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(path),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set S3 object tags: %w", err)
+	}
+
+	return nil
+}
+
+// PresignPut returns a presigned PutObject URL. The content type and length are part of
+// the signature, so S3 rejects uploads that don't match them.
+func (s *S3Storage) PresignPut(path, contentType string, size int64, expires time.Duration) (string, error) {
+	ctx := context.Background()
+
+	presigned, err := s3.NewPresignClient(s.client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(path),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 upload: %w", err)
+	}
+
+	return presigned.URL, nil
+}
+
+// Stat reads an object's size and content type with HeadObject
+func (s *S3Storage) Stat(path string) (ObjectInfo, error) {
+	ctx := context.Background()
+
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, path)
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to check object in S3: %w", err)
+	}
+
+	return ObjectInfo{
+		Size:        aws.ToInt64(result.ContentLength),
+		ContentType: aws.ToString(result.ContentType),
+	}, nil
+}
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an S3 endpoint that keeps single and multipart uploads in memory and serves them back
+type fakeS3 struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	parts     map[int][]byte // Parts of the multipart upload in progress
+	puts      int            // Single-request uploads
+	completed int            // Completed multipart uploads
+	aborted   int            // Aborted multipart uploads
+	failPart  int            // Part number to refuse (0 = none)
+	failStart bool           // Refuse to start multipart uploads
+	failGet   bool           // Refuse downloads, as during an outage
+}
+
+// newFakeS3Config starts a fake S3 endpoint and returns the config of its bucket
+func newFakeS3Config(t *testing.T) (*fakeS3, S3Config) {
+	t.Helper()
+	fake := &fakeS3{objects: make(map[string][]byte), parts: make(map[int][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "bucket",
+		Region:          "us-east-1",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		UsePathStyle:    true,
+	}
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Storage) {
+	t.Helper()
+	fake, config := newFakeS3Config(t)
+	st, err := NewS3Storage(config)
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return fake, st
+}
+
+// denied responds with an S3 error the client doesn't retry
+func denied(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusForbidden)
+	io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>denied</Message></Error>`)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		if f.failStart {
+			denied(w)
+			return
+		}
+		io.WriteString(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>`+key+`</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		if n == f.failPart {
+			denied(w)
+			return
+		}
+		f.parts[n] = body
+		w.Header().Set("ETag", `"part-`+strconv.Itoa(n)+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var req struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		xml.Unmarshal(body, &req)
+		var content []byte
+		for _, part := range req.Parts {
+			content = append(content, f.parts[part.PartNumber]...)
+		}
+		f.objects[key] = content
+		f.completed++
+		io.WriteString(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>`+key+`</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.parts = make(map[int][]byte)
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.puts++
+		w.Header().Set("ETag", `"object"`)
+	case r.Method == http.MethodGet:
+		if f.failGet {
+			denied(w)
+			return
+		}
+		content, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`)
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			content = content[start : end+1]
+		}
+		w.Write(content)
+	default:
+		http.Error(w, "unexpected request", http.StatusNotImplemented)
+	}
+}
+
+func TestS3SaveMultipart(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), (2*multipartPartSize+1024)/16)
+
+	tests := []struct {
+		name        string
+		content     []byte
+		size        int64 // Declared size (-1 = unknown)
+		failPart    int
+		failStart   bool
+		wantErr     bool
+		wantPut     bool
+		wantParts   int
+		wantAborted bool
+	}{
+		{"known small size", []byte("hello"), 5, 0, false, false, true, 0, false},
+		{"unknown size", []byte("hello"), -1, 0, false, false, false, 1, false},
+		{"unknown size, empty", nil, -1, 0, false, false, false, 1, false},
+		{"unknown size, several parts", large, -1, 0, false, false, false, 3, false},
+		{"part refused", large, -1, 2, false, true, false, 0, true},
+		{"upload not started", []byte("hello"), -1, 0, true, true, false, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, st := newFakeS3(t)
+			fake.failPart = tt.failPart
+			fake.failStart = tt.failStart
+
+			// Uploads of unknown size stream from the request, which can't seek
+			var content io.Reader = bytes.NewReader(tt.content)
+			if tt.size < 0 {
+				content = io.MultiReader(content)
+			}
+			key, err := st.Save(content, "object-key", tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Save error = %v, want error: %v", err, tt.wantErr)
+			}
+			if (fake.aborted > 0) != tt.wantAborted {
+				t.Fatalf("aborted %d multipart uploads, want aborted: %v", fake.aborted, tt.wantAborted)
+			}
+			if tt.wantErr {
+				if _, stored := fake.objects["object-key"]; stored {
+					t.Fatal("failed upload left an object")
+				}
+				return
+			}
+
+			if key != "object-key" {
+				t.Fatalf("Save = %q, want the key", key)
+			}
+			if (fake.puts > 0) != tt.wantPut {
+				t.Fatalf("%d single-request uploads, want single request: %v", fake.puts, tt.wantPut)
+			}
+			if len(fake.parts) != tt.wantParts || (tt.wantParts > 0) != (fake.completed == 1) {
+				t.Fatalf("%d parts in %d completed uploads, want %d parts", len(fake.parts), fake.completed, tt.wantParts)
+			}
+			if !bytes.Equal(fake.objects["object-key"], tt.content) {
+				t.Fatalf("stored %d bytes, want the %d bytes of content", len(fake.objects["object-key"]), len(tt.content))
+			}
+		})
+	}
+}
+
+func TestS3ReadFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		primary      string // Content in the primary bucket ("" = missing)
+		primaryDown  bool
+		secondary    string // Content in the secondary bucket ("" = missing)
+		noSecondary  bool
+		want         string
+		wantNotFound bool // The error must be ErrObjectNotFound
+		wantOtherErr bool // The error must be the primary's, not ErrObjectNotFound
+	}{
+		{"primary", "primary copy", false, "secondary copy", false, "primary copy", false, false},
+		{"primary down", "primary copy", true, "secondary copy", false, "secondary copy", false, false},
+		{"missing from the primary", "", false, "secondary copy", false, "secondary copy", false, false},
+		{"primary down, missing from the secondary", "primary copy", true, "", false, "", false, true},
+		{"missing from both", "", false, "", false, "", true, false},
+		{"missing without a secondary", "", false, "", true, "", true, false},
+		{"primary down without a secondary", "primary copy", true, "", true, "", false, true},
+	}
+
+	reads := []struct {
+		name string
+		read func(st *S3Storage) (io.ReadCloser, error)
+		part func(content string) string
+	}{
+		{"Get", func(st *S3Storage) (io.ReadCloser, error) { return st.Get("object-key") }, func(content string) string { return content }},
+		{"GetRange", func(st *S3Storage) (io.ReadCloser, error) { return st.GetRange("object-key", 2, 4) }, func(content string) string { return content[2:6] }},
+	}
+
+	for _, tt := range tests {
+		for _, read := range reads {
+			t.Run(tt.name+"/"+read.name, func(t *testing.T) {
+				primary, config := newFakeS3Config(t)
+				primary.failGet = tt.primaryDown
+				if tt.primary != "" {
+					primary.objects["object-key"] = []byte(tt.primary)
+				}
+				if !tt.noSecondary {
+					secondary, secondaryConfig := newFakeS3Config(t)
+					if tt.secondary != "" {
+						secondary.objects["object-key"] = []byte(tt.secondary)
+					}
+					config.Secondary = &secondaryConfig
+				}
+				st, err := NewS3Storage(config)
+				if err != nil {
+					t.Fatalf("NewS3Storage: %v", err)
+				}
+
+				body, err := read.read(st)
+				switch {
+				case tt.wantNotFound:
+					if !errors.Is(err, ErrObjectNotFound) {
+						t.Fatalf("error = %v, want ErrObjectNotFound", err)
+					}
+					return
+				case tt.wantOtherErr:
+					if err == nil || errors.Is(err, ErrObjectNotFound) {
+						t.Fatalf("error = %v, want the primary's failure", err)
+					}
+					return
+				case err != nil:
+					t.Fatalf("read: %v", err)
+				}
+				defer body.Close()
+
+				got, err := io.ReadAll(body)
+				if err != nil {
+					t.Fatalf("reading the body: %v", err)
+				}
+				if want := read.part(tt.want); string(got) != want {
+					t.Fatalf("read %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package storage
 
 import (
+	"errors"
 	"io"
+	"time"
 )
 
+// ErrObjectNotFound is returned when a stored object does not exist in the backend
+var ErrObjectNotFound = errors.New("storage object not found")
+
 // Storage defines the interface for file storage backends
 type Storage interface {
 	// Save saves a file with the given filename and returns the storage path/key
@@ -18,3 +23,111 @@ type Storage interface {
 	// Exists checks if a file exists in storage
 	Exists(path string) (bool, error)
 }
+
+// Locker is implemented by backends that can enforce a retention lock on stored objects
+type Locker interface {
+	// Lock prevents the object from being deleted or overwritten until the given time
+	Lock(path string, until time.Time) error
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// Presigner is implemented by backends that let clients upload content directly,
+// without streaming it through the server
+type Presigner interface {
+	// PresignPut returns a URL that accepts a PUT of exactly size bytes with the given
+	// content type to the object path, valid for the given duration
+	PresignPut(path, contentType string, size int64, expires time.Duration) (string, error)
+
+	// Stat returns the size and content type of a stored object (ErrObjectNotFound if it is missing)
+	Stat(path string) (ObjectInfo, error)
+}
+
+// Tailer is implemented by backends that can read an object while Save is still writing it
+type Tailer interface {
+	// Tail opens the object at path for reading. Unlike Get's readers, reaching the end
+	// returns io.EOF without ending the stream: data written later can still be read.
+	Tail(path string) (io.ReadCloser, error)
+}
+
+// Tagger is implemented by backends that can tag stored objects, e.g., for S3 lifecycle rules
+type Tagger interface {
+	// Tag replaces the object's tags with the backend's tag template, filling in its
+	// {name} placeholders from vars (see ObjectTagVars). It is a no-op without a template.
+	Tag(path string, vars map[string]string) error
+}
+
+// RangeReader is implemented by backends that can read part of an object without
+// reading what comes before it
+type RangeReader interface {
+	// GetRange returns a reader for length bytes of the object, starting at offset
+	GetRange(path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// wrapper is implemented by storages that delegate to another backend (e.g., CircuitBreaker)
+type wrapper interface {
+	Unwrap() Storage
+}
+
+// AsLocker returns st as a Locker if the backend (behind any wrappers) supports locking
+func AsLocker(st Storage) (Locker, bool) {
+	if !supports[Locker](st) {
+		return nil, false
+	}
+	locker, ok := st.(Locker)
+	return locker, ok
+}
+
+// AsPresigner returns st as a Presigner if the backend (behind any wrappers) supports direct uploads
+func AsPresigner(st Storage) (Presigner, bool) {
+	if !supports[Presigner](st) {
+		return nil, false
+	}
+	presigner, ok := st.(Presigner)
+	return presigner, ok
+}
+
+// AsTailer returns st as a Tailer if the backend (behind any wrappers) can read growing objects
+func AsTailer(st Storage) (Tailer, bool) {
+	if !supports[Tailer](st) {
+		return nil, false
+	}
+	tailer, ok := st.(Tailer)
+	return tailer, ok
+}
+
+// AsTagger returns st as a Tagger if the backend (behind any wrappers) can tag objects
+func AsTagger(st Storage) (Tagger, bool) {
+	if !supports[Tagger](st) {
+		return nil, false
+	}
+	tagger, ok := st.(Tagger)
+	return tagger, ok
+}
+
+// AsRangeReader returns st as a RangeReader if the backend (behind any wrappers) can read parts of objects
+func AsRangeReader(st Storage) (RangeReader, bool) {
+	if !supports[RangeReader](st) {
+		return nil, false
+	}
+	rangeReader, ok := st.(RangeReader)
+	return rangeReader, ok
+}
+
+// supports reports whether st and every backend it wraps implement T
+func supports[T any](st Storage) bool {
+	for {
+		if _, ok := st.(T); !ok {
+			return false
+		}
+		w, ok := st.(wrapper)
+		if !ok {
+			return true
+		}
+		st = w.Unwrap()
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ObjectTagVars are the placeholders a tag template may use, filled in from the file's metadata
+var ObjectTagVars = []string{
+	"id",           // File ID
+	"slug",         // Share link slug
+	"domain",       // Custom domain (empty for the default host)
+	"content_type", // MIME type
+	"expires",      // Expiry time in RFC3339, UTC (empty if the file never expires)
+	"expires_date", // Expiry date, YYYY-MM-DD (empty if the file never expires)
+	"created_date", // Upload date, YYYY-MM-DD
+}
+
+const (
+	maxObjectTags     = 10          // Most tags S3 allows on one object
+	maxObjectTagKey   = 128         // Longest S3 tag key
+	maxObjectTagValue = 256         // Longest S3 tag value
+	tagPunctuation    = "+-=._:/@ " // Characters S3 allows in tags besides letters and digits
+)
+
+// objectTag is one key=value pair of a tag template
+type objectTag struct {
+	key   string
+	value string // May contain {name} placeholders
+}
+
+// parseTagTemplate parses an object tag template: comma-separated key=value pairs whose
+// values may contain {name} placeholders from ObjectTagVars (e.g., "app=sharing,
+// expires={expires_date}"). An empty template returns no tags.
+func parseTagTemplate(template string) ([]objectTag, error) {
+	var tags []objectTag
+	for _, pair := range strings.Split(template, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !found || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		if len(key) > maxObjectTagKey || strings.ContainsAny(key, "{}") || sanitizeTag(key) != key {
+			return nil, fmt.Errorf("invalid tag key %q", key)
+		}
+		if slices.ContainsFunc(tags, func(t objectTag) bool { return t.key == key }) {
+			return nil, fmt.Errorf("duplicate tag key %q", key)
+		}
+		if err := checkPlaceholders(value); err != nil {
+			return nil, fmt.Errorf("tag %q: %w", key, err)
+		}
+		tags = append(tags, objectTag{key: key, value: value})
+	}
+
+	if len(tags) > maxObjectTags {
+		return nil, fmt.Errorf("at most %d tags are allowed, got %d", maxObjectTags, len(tags))
+	}
+	return tags, nil
+}
+
+// checkPlaceholders ensures every {name} in a template value is a known variable
+func checkPlaceholders(value string) error {
+	for rest := value; ; {
+		before, after, found := strings.Cut(rest, "{")
+		if strings.Contains(before, "}") {
+			return fmt.Errorf("unmatched }")
+		}
+		if !found {
+			return nil
+		}
+		name, after, found := strings.Cut(after, "}")
+		if !found {
+			return fmt.Errorf("unmatched {")
+		}
+		if !slices.Contains(ObjectTagVars, name) {
+			return fmt.Errorf("unknown placeholder {%s} (supported: %s)", name, strings.Join(ObjectTagVars, ", "))
+		}
+		rest = after
+	}
+}
+
+// render fills in the tag's placeholders, replacing characters S3 doesn't allow in tag
+// values with "_" and cutting it to S3's length limit
+func (t objectTag) render(vars map[string]string) string {
+	replacements := make([]string, 0, 2*len(ObjectTagVars))
+	for _, name := range ObjectTagVars {
+		replacements = append(replacements, "{"+name+"}", vars[name])
+	}
+	value := strings.TrimSpace(sanitizeTag(strings.NewReplacer(replacements...).Replace(t.value)))
+
+	if runes := []rune(value); len(runes) > maxObjectTagValue {
+		value = string(runes[:maxObjectTagValue])
+	}
+	return value
+}
+
+// sanitizeTag replaces characters S3 doesn't allow in tags with "_". Allowed are letters,
+// digits, spaces, and + - = . _ : / @.
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(tagPunctuation, r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
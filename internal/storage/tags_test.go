@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseTagTemplate(t *testing.T) {
+	var eleven []string
+	for i := 0; i <= maxObjectTags; i++ {
+		eleven = append(eleven, fmt.Sprintf("k%d=v", i))
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     []objectTag
+		wantErr  string // Part of the error message ("" for no error)
+	}{
+		{"empty", "", nil, ""},
+		{"static", "app=sharing", []objectTag{{"app", "sharing"}}, ""},
+		{"placeholders and spaces", " app = sharing , expires={expires_date} ", []objectTag{{"app", "sharing"}, {"expires", "{expires_date}"}}, ""},
+		{"empty pairs skipped", "a=1,,b=2,", []objectTag{{"a", "1"}, {"b", "2"}}, ""},
+		{"empty value", "note=", []objectTag{{"note", ""}}, ""},
+		{"ten tags", strings.Join(eleven[:maxObjectTags], ","), nil, ""},
+		{"eleven tags", strings.Join(eleven, ","), nil, "at most 10 tags"},
+		{"duplicate key", "app=a,app=b", nil, `duplicate tag key "app"`},
+		{"missing =", "app", nil, "expected key=value"},
+		{"missing key", "=sharing", nil, "expected key=value"},
+		{"placeholder in the key", "{slug}=x", nil, "invalid tag key"},
+		{"disallowed character in the key", "a*b=x", nil, "invalid tag key"},
+		{"key too long", strings.Repeat("k", maxObjectTagKey+1) + "=x", nil, "invalid tag key"},
+		{"unknown placeholder", "owner={user}", nil, "unknown placeholder {user}"},
+		{"unmatched {", "slug={slug", nil, "unmatched {"},
+		{"unmatched }", "slug=slug}", nil, "unmatched }"},
+		{"unmatched } before a placeholder", "slug=x}{slug}", nil, "unmatched }"},
+		{"nested {", "slug={{slug}}", nil, "unknown placeholder"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTagTemplate(tt.template)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseTagTemplate(%q) error = %v, want %q", tt.template, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTagTemplate(%q): %v", tt.template, err)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseTagTemplate(%q) = %v, want %v", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTag(t *testing.T) {
+	vars := map[string]string{
+		"id":           "7",
+		"slug":         "report.pdf",
+		"content_type": "application/pdf",
+		"expires_date": "2026-05-01",
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		vars  map[string]string
+		want  string
+	}{
+		{"static", "sharing", vars, "sharing"},
+		{"placeholders", "{id}/{slug}", vars, "7/report.pdf"},
+		{"empty variable", "never{expires}", vars, "never"},
+		{"disallowed characters replaced", "{slug}", map[string]string{"slug": "a*b?c#d"}, "a_b_c_d"},
+		{"allowed punctuation kept", "{slug}", map[string]string{"slug": "a+b-c=d.e_f:g/h@i j"}, "a+b-c=d.e_f:g/h@i j"},
+		{"letters of any script kept", "{slug}", map[string]string{"slug": "報告書.pdf"}, "報告書.pdf"},
+		{"surrounding spaces trimmed", " {slug} ", map[string]string{"slug": " x "}, "x"},
+		{"cut at 256 runes", "{slug}", map[string]string{"slug": strings.Repeat("é", 300)}, strings.Repeat("é", maxObjectTagValue)},
+		{"short multibyte value kept", "{slug}", map[string]string{"slug": strings.Repeat("é", maxObjectTagValue)}, strings.Repeat("é", maxObjectTagValue)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := objectTag{key: "k", value: tt.value}.render(tt.vars)
+			if got != tt.want {
+				t.Fatalf("render(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) > maxObjectTagValue {
+				t.Fatalf("render(%q) = %d runes (valid UTF-8: %v), want at most %d", tt.value, utf8.RuneCountInString(got), utf8.ValidString(got), maxObjectTagValue)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yorukot/sharing/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Traced records a span for every storage operation, as a child of the span in its context
+type Traced struct {
+	backend Storage
+	ctx     context.Context
+	name    string // Backend type, recorded on every span
+}
+
+// NewTraced wraps a storage backend so its operations are traced under ctx's span
+func NewTraced(ctx context.Context, backend Storage) *Traced {
+	return &Traced{backend: backend, ctx: ctx, name: backendName(backend)}
+}
+
+// Unwrap returns the wrapped backend
+func (t *Traced) Unwrap() Storage {
+	return t.backend
+}
+
+// Save saves a file through the wrapped backend
+func (t *Traced) Save(reader io.Reader, filename string, size int64) (string, error) {
+	_, span := tracing.Start(t.ctx, "storage.Save",
+		attribute.String("storage.backend", t.name),
+		attribute.String("storage.key", filename),
+		attribute.Int64("file.size", size),
+	)
+	path, err := t.backend.Save(reader, filename, size)
+	tracing.End(span, err)
+	return path, err
+}
+
+// Get retrieves a file through the wrapped backend. The span covers opening the object;
+// reading it is traced by the caller.
+func (t *Traced) Get(path string) (io.ReadCloser, error) {
+	_, span := tracing.Start(t.ctx, "storage.Get", t.attributes(path)...)
+	reader, err := t.backend.Get(path)
+	tracing.End(span, err)
+	return reader, err
+}
+
+// GetRange reads part of a file through the wrapped backend (which must implement RangeReader, see AsRangeReader)
+func (t *Traced) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	rangeReader, ok := t.backend.(RangeReader)
+	if !ok {
+		return nil, fmt.Errorf("storage backend does not support range reads")
+	}
+	_, span := tracing.Start(t.ctx, "storage.GetRange", t.attributes(path)...)
+	reader, err := rangeReader.GetRange(path, offset, length)
+	tracing.End(span, err)
+	return reader, err
+}
+
+// Delete removes a file through the wrapped backend
+func (t *Traced) Delete(path string) error {
+	_, span := tracing.Start(t.ctx, "storage.Delete", t.attributes(path)...)
+	err := t.backend.Delete(path)
+	tracing.End(span, err)
+	return err
+}
+
+// Exists checks a file through the wrapped backend
+func (t *Traced) Exists(path string) (bool, error) {
+	_, span := tracing.Start(t.ctx, "storage.Exists", t.attributes(path)...)
+	exists, err := t.backend.Exists(path)
+	tracing.End(span, err)
+	return exists, err
+}
+
+// Lock locks a file through the wrapped backend (which must implement Locker, see AsLocker)
+func (t *Traced) Lock(path string, until time.Time) error {
+	locker, ok := t.backend.(Locker)
+	if !ok {
+		return fmt.Errorf("storage backend does not support locking")
+	}
+	_, span := tracing.Start(t.ctx, "storage.Lock", t.attributes(path)...)
+	err := locker.Lock(path, until)
+	tracing.End(span, err)
+	return err
+}
+
+// Tag tags a file through the wrapped backend (which must implement Tagger, see AsTagger)
+func (t *Traced) Tag(path string, vars map[string]string) error {
+	tagger, ok := t.backend.(Tagger)
+	if !ok {
+		return fmt.Errorf("storage backend does not support tagging")
+	}
+	_, span := tracing.Start(t.ctx, "storage.Tag", t.attributes(path)...)
+	err := tagger.Tag(path, vars)
+	tracing.End(span, err)
+	return err
+}
+
+// PresignPut presigns an upload through the wrapped backend (which must implement Presigner, see AsPresigner)
+func (t *Traced) PresignPut(path, contentType string, size int64, expires time.Duration) (string, error) {
+	presigner, ok := t.backend.(Presigner)
+	if !ok {
+		return "", fmt.Errorf("storage backend does not support direct uploads")
+	}
+	return presigner.PresignPut(path, contentType, size, expires)
+}
+
+// Stat reads object info through the wrapped backend (which must implement Presigner, see AsPresigner)
+func (t *Traced) Stat(path string) (ObjectInfo, error) {
+	presigner, ok := t.backend.(Presigner)
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("storage backend does not support direct uploads")
+	}
+	_, span := tracing.Start(t.ctx, "storage.Stat", t.attributes(path)...)
+	info, err := presigner.Stat(path)
+	tracing.End(span, err)
+	return info, err
+}
+
+// Tail opens a growing file through the wrapped backend (which must implement Tailer, see AsTailer)
+func (t *Traced) Tail(path string) (io.ReadCloser, error) {
+	tailer, ok := t.backend.(Tailer)
+	if !ok {
+		return nil, fmt.Errorf("storage backend does not support live uploads")
+	}
+	_, span := tracing.Start(t.ctx, "storage.Tail", t.attributes(path)...)
+	reader, err := tailer.Tail(path)
+	tracing.End(span, err)
+	return reader, err
+}
+
+// attributes returns the span attributes of an operation on path
+func (t *Traced) attributes(path string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("storage.backend", t.name),
+		attribute.String("storage.path", path),
+	}
+}
+
+// backendName returns the type of the backend behind any wrappers ("local" or "s3")
+func backendName(st Storage) string {
+	for {
+		switch backend := st.(type) {
+		case *LocalStorage:
+			return "local"
+		case *S3Storage:
+			return "s3"
+		case wrapper:
+			st = backend.Unwrap()
+		default:
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	tests := []struct {
+		name      string
+		down      bool
+		op        func(st *Traced) error
+		wantSpan  string
+		wantError bool
+	}{
+		{"save", false, func(st *Traced) error {
+			_, err := st.Save(strings.NewReader("content"), "key", 7)
+			return err
+		}, "storage.Save", false},
+		{"exists", false, func(st *Traced) error {
+			_, err := st.Exists("key")
+			return err
+		}, "storage.Exists", false},
+		{"missing object", false, func(st *Traced) error {
+			_, err := st.Get("missing")
+			if errors.Is(err, ErrObjectNotFound) {
+				return nil
+			}
+			return err
+		}, "storage.Get", true},
+		{"backend failure", true, func(st *Traced) error {
+			if err := st.Delete("key"); !errors.Is(err, errBackendDown) {
+				return err
+			}
+			return nil
+		}, "storage.Delete", true},
+		{"unsupported operation", false, func(st *Traced) error {
+			if err := st.Lock("key", time.Now()); err == nil {
+				return errors.New("locking local storage succeeded")
+			}
+			return nil
+		}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFlakyStorage(t)
+			backend.down.Store(tt.down)
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+			st := NewTraced(ctx, backend)
+
+			before := len(recorder.Ended())
+			if err := tt.op(st); err != nil {
+				t.Fatal(err)
+			}
+			parent.End()
+
+			spans := recorder.Ended()[before:]
+			if tt.wantSpan == "" {
+				if len(spans) != 1 {
+					t.Fatalf("%d spans recorded for an unsupported operation, want none", len(spans)-1)
+				}
+				return
+			}
+			if len(spans) != 2 {
+				t.Fatalf("%d spans ended, want the operation's and the request's", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantSpan {
+				t.Fatalf("span name = %q, want %q", span.Name(), tt.wantSpan)
+			}
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Fatal("storage span isn't a child of the request's span")
+			}
+			if got := span.Status().Code == codes.Error; got != tt.wantError {
+				t.Fatalf("span marked failed = %v, want %v", got, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestBackendName(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		backend Storage
+		want    string
+	}{
+		{"local", local, "local"},
+		{"wrapped local", NewCircuitBreaker(local, 0, time.Second), "local"},
+		{"traced breaker", NewTraced(context.Background(), NewCircuitBreaker(local, 0, time.Second)), "local"},
+		{"unknown backend", &flakyStorage{LocalStorage: local}, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backendName(tt.backend); got != tt.want {
+				t.Fatalf("backendName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// encode bencodes a value. Supported types: string, []byte, int, int64, []interface{}, map[string]interface{}.
+func encode(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.WriteString(v)
+	case []byte:
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.Write(v)
+	case int:
+		fmt.Fprintf(buf, "i%de", v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, item := range v {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]interface{}:
+		// Dictionary keys must be sorted as raw strings
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('d')
+		for _, key := range keys {
+			if err := encode(buf, key); err != nil {
+				return err
+			}
+			if err := encode(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", value)
+	}
+	return nil
+}
+
+// Marshal returns the bencoded form of a value
+func Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,219 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+)
+
+const (
+	minPieceLength = 256 << 10 // 256 KiB
+	maxPieceLength = 16 << 20  // 16 MiB
+	targetPieces   = 1500      // Aim for roughly this many pieces per torrent
+	maxCacheSize   = 128       // Maximum number of cached piece sets
+)
+
+// ErrEmptyContent is returned for empty files, which torrent clients reject as having no pieces
+var ErrEmptyContent = errors.New("empty files cannot be shared as torrents")
+
+// Info holds the hashed content of a single-file torrent
+type Info struct {
+	Name        string
+	Length      int64
+	PieceLength int64
+	Pieces      []byte // Concatenated SHA-1 hashes, 20 bytes per piece
+}
+
+// PieceCount returns the number of pieces in the torrent
+func (i *Info) PieceCount() int {
+	return len(i.Pieces) / sha1.Size
+}
+
+// dict returns the bencodable info dictionary
+func (i *Info) dict() map[string]interface{} {
+	return map[string]interface{}{
+		"name":         i.Name,
+		"length":       i.Length,
+		"piece length": i.PieceLength,
+		"pieces":       i.Pieces,
+	}
+}
+
+// InfoHash returns the hex-encoded SHA-1 hash of the bencoded info dictionary
+func (i *Info) InfoHash() (string, error) {
+	encoded, err := Marshal(i.dict())
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// PieceLengthFor picks a power-of-two piece length for a file size
+func PieceLengthFor(size int64) int64 {
+	pieceLength := int64(minPieceLength)
+	for pieceLength < maxPieceLength && size/pieceLength > targetPieces {
+		pieceLength *= 2
+	}
+	return pieceLength
+}
+
+// HashPieces reads content from r and computes the piece hashes for a torrent.
+// Empty content has no pieces and returns ErrEmptyContent.
+func HashPieces(r io.Reader, name string, length int64) (*Info, error) {
+	if length == 0 {
+		return nil, ErrEmptyContent
+	}
+
+	pieceLength := PieceLengthFor(length)
+	buf := make([]byte, pieceLength)
+	var pieces []byte
+	var total int64
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n])
+			pieces = append(pieces, sum[:]...)
+			total += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+
+	if total != length {
+		return nil, fmt.Errorf("content length mismatch: read %d bytes, expected %d", total, length)
+	}
+
+	return &Info{
+		Name:        name,
+		Length:      length,
+		PieceLength: pieceLength,
+		Pieces:      pieces,
+	}, nil
+}
+
+// MetaInfo returns a bencoded .torrent file for the given info.
+// tracker is the announce URL and webSeed an HTTP URL serving the file; both are optional.
+func MetaInfo(info *Info, tracker, webSeed string) ([]byte, error) {
+	meta := map[string]interface{}{
+		"info":       info.dict(),
+		"created by": "sharing",
+	}
+	if tracker != "" {
+		meta["announce"] = tracker
+	}
+	if webSeed != "" {
+		meta["url-list"] = []interface{}{webSeed}
+	}
+	return Marshal(meta)
+}
+
+// MagnetLink returns a magnet URI for the given info
+func MagnetLink(info *Info, tracker, webSeed string) (string, error) {
+	infoHash, err := info.InfoHash()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("dn", info.Name)
+	params.Set("xl", fmt.Sprintf("%d", info.Length))
+	if tracker != "" {
+		params.Set("tr", tracker)
+	}
+	if webSeed != "" {
+		params.Set("ws", webSeed)
+	}
+	return "magnet:?xt=urn:btih:" + infoHash + "&" + params.Encode(), nil
+}
+
+// cacheEntry is cached info and the files it was served for
+type cacheEntry struct {
+	info  *Info
+	files map[uint]struct{}
+}
+
+// Cache stores computed torrent info by key (see the handler's cache key) and tracks
+// which file each entry belongs to, so a file's entry can be dropped when it changes
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	files   map[uint]string // File ID -> key of its entry
+}
+
+// NewCache creates an empty piece cache
+func NewCache() *Cache {
+	return &Cache{
+		entries: make(map[string]*cacheEntry),
+		files:   make(map[uint]string),
+	}
+}
+
+// Get returns cached info for a key
+func (c *Cache) Get(key string) (*Info, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return entry.info, true
+}
+
+// Put stores info for a file under a key, replacing the file's previous entry and
+// evicting an arbitrary entry when the cache is full
+func (c *Cache) Put(fileID uint, key string, info *Info) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.forget(fileID)
+	entry, ok := c.entries[key]
+	if !ok {
+		if len(c.entries) >= maxCacheSize {
+			for existing := range c.entries {
+				c.remove(existing)
+				break
+			}
+		}
+		entry = &cacheEntry{files: make(map[uint]struct{})}
+		c.entries[key] = entry
+	}
+	entry.info = info
+	entry.files[fileID] = struct{}{}
+	c.files[fileID] = key
+}
+
+// InvalidateFile drops the entry of a replaced or deleted file
+func (c *Cache) InvalidateFile(fileID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forget(fileID)
+}
+
+// forget drops a file's entry, which other files with the same key share; c.mu must be held
+func (c *Cache) forget(fileID uint) {
+	if key, ok := c.files[fileID]; ok {
+		c.remove(key)
+	}
+}
+
+// remove deletes an entry and its files; c.mu must be held
+func (c *Cache) remove(key string) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	for fileID := range entry.files {
+		delete(c.files, fileID)
+	}
+	delete(c.entries, key)
+}
@@ -0,0 +1,174 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{"string", "spam", "4:spam", false},
+		{"empty string", "", "0:", false},
+		{"bytes", []byte{0, 'a'}, "2:\x00a", false},
+		{"int", 42, "i42e", false},
+		{"negative int64", int64(-3), "i-3e", false},
+		{"list", []interface{}{"a", 1}, "l1:ai1ee", false},
+		{"keys sorted as raw strings", map[string]interface{}{"b": 1, "a": "x", "B": 2}, "d1:Bi2e1:a1:x1:bi1ee", false},
+		{"nested", map[string]interface{}{"l": []interface{}{map[string]interface{}{}}}, "d1:lldeee", false},
+		{"unsupported type", 1.5, "", true},
+		{"unsupported nested type", []interface{}{"a", true}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Marshal error = %v, want error: %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Marshal = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfoHash(t *testing.T) {
+	info, err := HashPieces(strings.NewReader("hello"), "hello.txt", 5)
+	if err != nil {
+		t.Fatalf("HashPieces: %v", err)
+	}
+
+	// sha1 of d6:lengthi5e4:name9:hello.txt12:piece lengthi262144e6:pieces20:<sha1("hello")>e
+	const want = "1e964ba3eb2a7951b0f29d338040c4b8fbe2d09b"
+	got, err := info.InfoHash()
+	if err != nil {
+		t.Fatalf("InfoHash: %v", err)
+	}
+	if got != want {
+		t.Fatalf("InfoHash = %s, want %s", got, want)
+	}
+
+	magnet, err := MagnetLink(info, "", "")
+	if err != nil {
+		t.Fatalf("MagnetLink: %v", err)
+	}
+	if !strings.HasPrefix(magnet, "magnet:?xt=urn:btih:"+want+"&") {
+		t.Fatalf("MagnetLink = %s, want the info hash %s", magnet, want)
+	}
+}
+
+func TestHashPieces(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int64
+		read       int64 // Bytes of content actually available
+		wantPieces int
+		wantErr    error // nil, ErrEmptyContent, or errAny for any other error
+	}{
+		{"empty", 0, 0, 0, ErrEmptyContent},
+		{"one byte", 1, 1, 1, nil},
+		{"one piece", minPieceLength, minPieceLength, 1, nil},
+		{"one piece plus one", minPieceLength + 1, minPieceLength + 1, 2, nil},
+		{"content shorter than its size", minPieceLength, minPieceLength - 1, 0, errAny},
+		{"content longer than its size", 1, 2, 0, errAny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := bytes.Repeat([]byte{'x'}, int(tt.read))
+			info, err := HashPieces(bytes.NewReader(content), "data.bin", tt.size)
+			switch {
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("HashPieces succeeded, want an error")
+			case tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("HashPieces error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if info.PieceCount() != tt.wantPieces {
+				t.Fatalf("PieceCount = %d, want %d", info.PieceCount(), tt.wantPieces)
+			}
+			last := content[int64(tt.wantPieces-1)*info.PieceLength:]
+			if sum := sha1.Sum(last); !bytes.Equal(info.Pieces[len(info.Pieces)-sha1.Size:], sum[:]) {
+				t.Fatal("last piece hash doesn't match the last piece of content")
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test tables
+var errAny = errors.New("any error")
+
+func TestPieceLengthFor(t *testing.T) {
+	tests := []struct {
+		size int64
+		want int64
+	}{
+		{0, minPieceLength},
+		{1, minPieceLength},
+		{targetPieces * minPieceLength, minPieceLength},
+		{(targetPieces + 1) * minPieceLength, 2 * minPieceLength},
+		{1 << 50, maxPieceLength},
+	}
+
+	for _, tt := range tests {
+		if got := PieceLengthFor(tt.size); got != tt.want {
+			t.Errorf("PieceLengthFor(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	a := &Info{Name: "a"}
+	b := &Info{Name: "b"}
+
+	tests := []struct {
+		name  string
+		steps func(c *Cache)
+		key   string
+		want  *Info // nil for a miss
+	}{
+		{"hit", func(c *Cache) { c.Put(1, "k1", a) }, "k1", a},
+		{"miss", func(c *Cache) { c.Put(1, "k1", a) }, "k2", nil},
+		{"shared by two files", func(c *Cache) { c.Put(1, "k1", a); c.Put(2, "k1", a) }, "k1", a},
+		{"replaced content drops the old entry", func(c *Cache) { c.Put(1, "k1", a); c.Put(1, "k2", b) }, "k1", nil},
+		{"replaced content is cached", func(c *Cache) { c.Put(1, "k1", a); c.Put(1, "k2", b) }, "k2", b},
+		{"invalidated", func(c *Cache) { c.Put(1, "k1", a); c.InvalidateFile(1) }, "k1", nil},
+		{"other file invalidated", func(c *Cache) { c.Put(1, "k1", a); c.Put(2, "k2", b); c.InvalidateFile(2) }, "k1", a},
+		{"unknown file invalidated", func(c *Cache) { c.Put(1, "k1", a); c.InvalidateFile(3) }, "k1", a},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache()
+			tt.steps(c)
+			got, ok := c.Get(tt.key)
+			if ok != (tt.want != nil) || got != tt.want {
+				t.Fatalf("Get(%s) = %v, %v, want %v", tt.key, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache()
+	for i := 0; i < maxCacheSize+10; i++ {
+		c.Put(uint(i), strings.Repeat("k", i+1), &Info{})
+	}
+	if len(c.entries) != maxCacheSize {
+		t.Fatalf("%d entries, want at most %d", len(c.entries), maxCacheSize)
+	}
+	if len(c.files) != maxCacheSize {
+		t.Fatalf("%d files tracked, want only those of the %d entries", len(c.files), maxCacheSize)
+	}
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// restoreGlobals puts back the tracer provider and the enabled flag after the test
+func restoreGlobals(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() {
+		if sdkProvider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok && sdkProvider != provider {
+			sdkProvider.Shutdown(context.Background())
+		}
+		otel.SetTracerProvider(provider)
+		enabled.Store(false)
+	})
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name           string
+		endpoint       string // OTEL_EXPORTER_OTLP_ENDPOINT
+		tracesEndpoint string // OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+		wantEnabled    bool
+	}{
+		{"no endpoint", "", "", false},
+		{"endpoint", "http://127.0.0.1:4318", "", true},
+		{"traces endpoint", "", "http://127.0.0.1:4318/v1/traces", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreGlobals(t)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tt.tracesEndpoint)
+
+			if err := Init(context.Background(), "test"); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			if Enabled() != tt.wantEnabled {
+				t.Fatalf("enabled = %v, want %v", Enabled(), tt.wantEnabled)
+			}
+			_, isSDK := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+			if isSDK != tt.wantEnabled {
+				t.Fatalf("SDK tracer provider installed = %v, want %v", isSDK, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestStartEnd(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+		wantEvents int
+	}{
+		{"success", nil, codes.Unset, 0},
+		{"failure", errors.New("backend down"), codes.Error, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreGlobals(t)
+			recorder := tracetest.NewSpanRecorder()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+			ctx, parent := Start(context.Background(), "parent")
+			_, span := Start(ctx, "child", attribute.String("storage.key", "abc"))
+			End(span, tt.err)
+			parent.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("%d spans ended, want 2", len(spans))
+			}
+			child := spans[0]
+			if child.Name() != "child" || child.Parent().SpanID() != spans[1].SpanContext().SpanID() {
+				t.Fatalf("span %q isn't a child of the span in its context", child.Name())
+			}
+			if child.Status().Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", child.Status().Code, tt.wantStatus)
+			}
+			if tt.err != nil && child.Status().Description != tt.err.Error() {
+				t.Fatalf("status description = %q, want %q", child.Status().Description, tt.err.Error())
+			}
+			if len(child.Events()) != tt.wantEvents {
+				t.Fatalf("%d events recorded, want %d", len(child.Events()), tt.wantEvents)
+			}
+			if attrs := child.Attributes(); len(attrs) != 1 || attrs[0].Value.AsString() != "abc" {
+				t.Fatalf("attributes = %v, want storage.key", attrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package version
+
+import (
+	"runtime"
+)
+
+// Build information, injected at build time via -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/yorukot/sharing/internal/version.Version=v1.0.0"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// DatabaseDriver is the database driver used by the service
+const DatabaseDriver = "sqlite"
+
+// Info describes the running build
+type Info struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit"`
+	BuildTime      string `json:"build_time"`
+	GoVersion      string `json:"go_version"`
+	StorageType    string `json:"storage_type"`
+	DatabaseDriver string `json:"database_driver"`
+}
+
+// Get returns build information for the running binary
+func Get(storageType string) Info {
+	return Info{
+		Version:        Version,
+		Commit:         Commit,
+		BuildTime:      BuildTime,
+		GoVersion:      runtime.Version(),
+		StorageType:    storageType,
+		DatabaseDriver: DatabaseDriver,
+	}
+}
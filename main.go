@@ -1,25 +1,48 @@
 package main
 
 import (
+	"context"
+	"embed"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
 	"github.com/yorukot/sharing/internal/database"
+	"github.com/yorukot/sharing/internal/events"
 	"github.com/yorukot/sharing/internal/handlers"
+	"github.com/yorukot/sharing/internal/metrics"
 	mw "github.com/yorukot/sharing/internal/middleware"
+	"github.com/yorukot/sharing/internal/models"
 	"github.com/yorukot/sharing/internal/services"
 	"github.com/yorukot/sharing/internal/storage"
+	"github.com/yorukot/sharing/internal/tracing"
+	"github.com/yorukot/sharing/internal/version"
 )
 
+//go:embed static
+var staticFiles embed.FS
+
+// shutdownTimeout is how long requests in progress may take to finish when the server stops
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	migrateOnly := flag.Bool("migrate", false, "apply pending database migrations and exit")
+	flag.Parse()
+
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: .env file not found, using system environment variables")
@@ -36,111 +59,442 @@ func main() {
 		dbPath = "./data/sharing.db"
 	}
 
-	// Initialize storage backend
-	storageBackend, err := initializeStorage()
+	// Run migrations standalone (e.g., as a deploy step when MIGRATE=false)
+	if *migrateOnly {
+		if err := database.Initialize(dbPath, getDBBusyTimeout()); err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer database.Close()
+
+		if err := database.Migrate(); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+		return
+	}
+
+	// Subcommands (e.g., ./sharing import-dir /srv/files)
+	if flag.Arg(0) == "import-dir" {
+		runImportDir(flag.Args()[1:], dbPath)
+		return
+	}
+
+	// Export trace spans when an OTLP endpoint is configured (OTEL_EXPORTER_OTLP_ENDPOINT)
+	if err := tracing.Init(context.Background(), version.Version); err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
+	// Initialize storage backends: the primary and any others uploads can choose
+	storageType := getStorageType()
+	backends, err := initializeBackends(storageType)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
+	// Fail fast instead of piling up requests while storage is down (STORAGE_BREAKER_THRESHOLD).
+	// Each backend has its own breaker; health and metrics report the primary's.
+	var breaker *storage.CircuitBreaker
+	if threshold := getStorageBreakerThreshold(); threshold > 0 {
+		backends = backends.Wrap(func(backend storage.Storage) storage.Storage {
+			return storage.NewCircuitBreaker(backend, threshold, getStorageBreakerCooldown())
+		})
+		breaker = backends.Primary().(*storage.CircuitBreaker)
+	}
+	storageAvailable := func() bool {
+		return breaker == nil || breaker.Available()
+	}
+
 	// Initialize database
-	if err := database.Initialize(dbPath); err != nil {
+	if err := database.Initialize(dbPath, getDBBusyTimeout()); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.Close()
 
-	// Initialize file service with storage backend
-	fileService := services.NewFileService(storageBackend)
+	// Keep web sessions in the database, so logging out revokes them
+	mw.SetSessionStore(services.NewSessionService())
+
+	// Initialize file service with storage backends
+	fileService := services.NewFileService(backends)
+
+	// Precision of timestamps in API responses
+	models.JSONTimePrecision = getAPITimePrecision()
+
+	// Maintenance mode can be toggled at runtime (PUT /api/maintenance)
+	maintenanceHandler := handlers.NewMaintenanceHandler(getMaintenanceMode())
+
+	// Run migrations in the background, so the server can report readiness meanwhile;
+	// routes that depend on the schema return 503 until they complete.
+	// With MIGRATE=false the schema is left untouched (apply it with --migrate).
+	if getAutoMigrate() {
+		go func() {
+			if err := database.Migrate(); err != nil {
+				log.Fatalf("Failed to run migrations: %v", err)
+			}
 
-	// Start background cleanup job
-	startCleanupJob(fileService)
+			// Start background cleanup job
+			startCleanupJob(fileService, maintenanceHandler.Enabled)
+		}()
+	} else {
+		database.SkipMigrations()
+		startCleanupJob(fileService, maintenanceHandler.Enabled)
+	}
 
 	// Initialize handlers
-	apiHandler := handlers.NewAPIHandler(storageBackend)
-	webHandler := handlers.NewWebHandler(storageBackend)
-	publicHandler := handlers.NewPublicHandler(storageBackend)
+	apiHandler := handlers.NewAPIHandler(backends)
+	webHandler, err := handlers.NewWebHandler(backends)
+	if err != nil {
+		log.Fatalf("Failed to load the web UI: %v", err)
+	}
+	publicHandler, err := handlers.NewPublicHandler(backends)
+	if err != nil {
+		log.Fatalf("Failed to load the public pages: %v", err)
+	}
+	versionHandler := handlers.NewVersionHandler(storageType)
+	eventsHandler := handlers.NewEventsHandler(events.Default)
+	reportHandler := handlers.NewReportHandler()
+	auditHandler := handlers.NewAuditHandler()
+	audit := auditHandler.Audit
 
 	// Setup router
 	r := chi.NewRouter()
 
 	// Global middleware
+	r.Use(mw.Tracing)
 	r.Use(middleware.Logger)
+	r.Use(mw.SlowRequestLog(getSlowRequestThreshold()))
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Compress(5))
+	trustedProxies := getTrustedProxies()
+	r.Use(mw.ForwardedProto(trustedProxies))
+	r.Use(mw.RealIP(trustedProxies))
+	r.Use(mw.Compress(5))     // Not for Range or HEAD requests, so downloads stay resumable
+	r.Use(middleware.GetHead) // HEAD is answered by GET handlers (e.g., download sizes for resuming)
+
+	// Rejects requests that need the database schema while migrations run
+	requireReady := mw.RequireReady(database.Ready)
+
+	// Bounds in-flight uploads across the API and web UI (MAX_CONCURRENT_UPLOADS), and per
+	// client IP (MAX_CONCURRENT_UPLOADS_PER_IP), which is checked first so a client at its
+	// own limit doesn't hold global slots
+	limitUploadsPerClient := mw.LimitConcurrentPerClient(getMaxConcurrentUploadsPerIP())
+	limitAllUploads := mw.LimitConcurrent(mw.NewSemaphore(getMaxConcurrentUploads()))
+	limitUploads := func(next http.Handler) http.Handler {
+		return limitUploadsPerClient(limitAllUploads(next))
+	}
+
+	// Rejects uploads before their body is read while the storage circuit breaker is open
+	requireStorage := mw.RequireStorage(storageAvailable)
+
+	// Decompresses gzip-encoded upload bodies, up to GZIP_UPLOAD_MAX_SIZE bytes
+	decompress := mw.DecompressBody(getGzipUploadMaxSize())
+
+	// Rejects uploads, updates and deletes during a maintenance window (MAINTENANCE_MODE)
+	readOnly := mw.RejectInMaintenance(maintenanceHandler.Enabled)
 
 	// API routes (protected with API key)
 	r.Route("/api", func(r chi.Router) {
+		r.Use(requireReady)
 		r.Use(mw.APIKeyAuth)
 
-		r.Post("/upload", apiHandler.UploadFile)
+		r.With(readOnly, requireStorage, limitUploads, decompress, audit("file.upload")).Post("/upload", apiHandler.UploadFile)
+		r.With(readOnly, requireStorage, limitUploads, decompress, audit("file.upload")).Post("/upload/base64", apiHandler.UploadBase64)
+		r.With(readOnly, requireStorage, limitUploads, decompress, audit("file.upload")).Post("/upload/live", apiHandler.UploadLive)
+		r.With(readOnly, requireStorage, audit("file.presign")).Post("/upload/presign", apiHandler.PresignUpload)
+		r.With(readOnly, requireStorage, limitUploads, audit("file.upload")).Post("/upload/register", apiHandler.RegisterUpload)
+		r.With(readOnly, requireStorage, limitUploads, decompress, audit("paste.create")).Post("/paste", apiHandler.CreatePaste)
 		r.Get("/files", apiHandler.ListFiles)
+		r.With(readOnly, audit("files.extend")).Post("/files/extend", apiHandler.ExtendFiles)
+		r.Post("/files/batch", apiHandler.GetFilesBatch)
 		r.Get("/files/{id}", apiHandler.GetFile)
-		r.Patch("/files/{id}", apiHandler.UpdateFile)
-		r.Delete("/files/{id}", apiHandler.DeleteFile)
+		r.With(readOnly, audit("file.update")).Patch("/files/{id}", apiHandler.UpdateFile)
+		r.With(readOnly, audit("file.delete")).Delete("/files/{id}", apiHandler.DeleteFile)
+		r.With(readOnly, requireStorage, limitUploads, audit("file.clone")).Post("/files/{id}/clone", apiHandler.CloneFile)
+		r.Get("/files/{id}/torrent", apiHandler.GetTorrent)
+		r.Get("/files/{id}/raw", apiHandler.RawFile)
+		r.Get("/files/{id}/stats", apiHandler.GetDownloadStats)
+		r.Get("/files/{id}/links", apiHandler.GetFileLinks)
+		r.Get("/files/{id}/verify", apiHandler.VerifyFile)
+		r.Get("/download/multi", apiHandler.DownloadMultiple)
 		r.Get("/download/{id}", apiHandler.DownloadFile)
+		r.Get("/version", versionHandler.GetVersion)
+		r.Get("/cache", apiHandler.GetCacheStats)
+		r.Get("/usage", apiHandler.GetUsage)
+		r.Get("/admin/access-log/verify", apiHandler.VerifyAccessLog)
+		r.Get("/admin/storage/check", apiHandler.CheckStorage)
+		r.With(readOnly, audit("files.purge")).Delete("/admin/files/deleted", apiHandler.PurgeDeletedFiles)
+		r.With(readOnly, audit("file.purge")).Delete("/admin/files/{id}/purge", apiHandler.PurgeFile)
+		r.Get("/audit", auditHandler.ListAuditLogs)
+		r.Method(http.MethodGet, "/metrics", metrics.Handler(metrics.Default,
+			metrics.Func{
+				Name: "sharing_storage_available",
+				Help: "Whether storage operations are reaching the backend (0 while the circuit breaker is open).",
+				Type: "gauge",
+				Value: func() float64 {
+					if storageAvailable() {
+						return 1
+					}
+					return 0
+				},
+			},
+			metrics.Func{
+				Name: "sharing_storage_breaker_trips_total",
+				Help: "Times the storage circuit breaker has opened.",
+				Type: "counter",
+				Value: func() float64 {
+					if breaker == nil {
+						return 0
+					}
+					return float64(breaker.Trips())
+				},
+			},
+		))
+		r.Get("/policies", apiHandler.ListPolicies)
+		r.Get("/events", eventsHandler.StreamEvents)
+		r.Get("/reports", reportHandler.ListReports)
+		r.With(readOnly, audit("report.update")).Patch("/reports/{id}", reportHandler.UpdateReport)
+		r.Get("/maintenance", maintenanceHandler.GetMaintenance)
+		r.With(audit("maintenance.set")).Put("/maintenance", maintenanceHandler.SetMaintenance)
 	})
 
 	// Web routes (protected with API key for management)
 	r.Route("/web", func(r chi.Router) {
+		r.Use(requireReady)
+
 		// Public index page (shows login if not authenticated)
 		r.Get("/", webHandler.Index)
 
+		// Web password login (only used when WEB_PASSWORD is set)
+		r.Get("/login", webHandler.LoginPage)
+		r.With(mw.CSRFProtect).Post("/login", webHandler.Login)
+		r.With(mw.CSRFProtect).Post("/logout", webHandler.Logout)
+
 		// Protected management routes
 		r.Group(func(r chi.Router) {
-			r.Use(mw.APIKeyAuth)
-
-			r.Post("/upload", webHandler.UploadFileWeb)
-			r.Get("/files", webHandler.FileList)
-			r.Get("/edit/{id}", webHandler.EditForm)
-			r.Post("/update/{id}", webHandler.UpdateFileWeb)
-			r.Delete("/files/{id}", webHandler.DeleteFileWeb)
-			r.Get("/download/{id}", webHandler.DownloadFileWeb)
+			r.Use(mw.WebAuth)
+
+			// The upload slot is taken before CSRFProtect, which may parse the multipart body
+			r.With(readOnly, requireStorage, limitUploads, mw.CSRFProtect, audit("file.upload")).Post("/upload", webHandler.UploadFileWeb)
+
+			r.Group(func(r chi.Router) {
+				r.Use(mw.CSRFProtect)
+
+				r.Get("/files", webHandler.FileList)
+				r.Get("/edit/{id}", webHandler.EditForm)
+				r.With(readOnly, audit("file.update")).Post("/update/{id}", webHandler.UpdateFileWeb)
+				r.With(readOnly, audit("file.delete")).Delete("/files/{id}", webHandler.DeleteFileWeb)
+				r.Get("/download/{id}", webHandler.DownloadFileWeb)
+			})
 		})
 	})
 
+	// Static assets for the web UI (embedded, before catch-all routes)
+	staticAssets, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		log.Fatalf("Failed to load static assets: %v", err)
+	}
+	r.Handle("/static/*", handlers.NewStaticHandler(staticAssets))
+
+	// Branding logo for public pages (BRAND_LOGO_PATH)
+	r.Get("/brand/logo", publicHandler.BrandLogo)
+
 	// Health check endpoint (before catch-all routes)
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
-	// Redirect root to web UI
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/web/", http.StatusMovedPermanently)
+	// Readiness check: 503 until database migrations have completed
+	r.Get("/health/ready", func(w http.ResponseWriter, r *http.Request) {
+		status, err := database.MigrationStatus()
+		if !database.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if err != nil {
+				w.Write([]byte("migrations " + status + ": " + err.Error()))
+				return
+			}
+			w.Write([]byte("migrations " + status))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
 	})
 
-	// Public sharing routes (no API key required)
-	// Direct download route by original filename
-	r.Get("/d/{filename}", publicHandler.DownloadByOriginalName)
+	// Storage health: 503 while the storage circuit breaker is open or probing
+	r.Get("/health/storage", func(w http.ResponseWriter, r *http.Request) {
+		if breaker == nil {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("circuit breaker disabled"))
+			return
+		}
+		if !breaker.Available() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("storage circuit breaker " + breaker.State()))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
 
-	// Share page route by slug (catch-all, must be last)
-	r.Get("/{slug}", publicHandler.SharePage)
+	// Root: redirect to the web UI by default (configurable with ROOT_REDIRECT)
+	r.Get("/", publicHandler.Root)
+
+	// Public sharing routes (no API key required), unless disabled with PUBLIC_SHARING_ENABLED=false
+	if handlers.PublicSharingEnabled() {
+		// Public abuse reporting (rate limited per IP)
+		reportLimit := mw.RateLimit(getReportRateLimit(), time.Hour)
+		r.With(requireReady, readOnly, reportLimit).Post("/report/{slug}", reportHandler.ReportFile)
+		r.With(requireReady, readOnly, reportLimit).Post("/report/*", reportHandler.ReportFile) // Slugs with "/"
+
+		// Direct download route by original filename
+		r.With(requireReady).Get("/d/{filename}", publicHandler.DownloadByOriginalName)
+
+		// Share page route by slug (catch-all, must be last), also for slugs with "/"
+		// made from SLUG_TEMPLATE
+		r.With(requireReady).Get("/{slug}", publicHandler.SharePage)
+		r.With(requireReady).Get("/*", publicHandler.SharePage)
+	} else {
+		log.Println("Public sharing is disabled; files are only reachable through the API and web UI")
+	}
 
 	// Start server
 	log.Printf("Starting server on port %s", port)
 	log.Printf("Web UI: http://localhost:%s/web/", port)
 	log.Printf("API: http://localhost:%s/api/", port)
 
-	if err := http.ListenAndServe(":"+port, r); err != nil {
+	// On SIGINT or SIGTERM, stop accepting requests and let those in progress finish (up
+	// to shutdownTimeout), so the transfers of downloads are recorded before exiting
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Println("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Warning: requests still running after %s were cut off: %v", shutdownTimeout, err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+	<-shutdownDone
+	services.FlushTransfers()
 }
 
-// initializeStorage creates and configures the storage backend based on environment variables
-func initializeStorage() (storage.Storage, error) {
+// runImportDir imports the files in a directory into the configured storage and database,
+// skipping content that was already imported, and prints a summary
+func runImportDir(args []string, dbPath string) {
+	flags := flag.NewFlagSet("import-dir", flag.ExitOnError)
+	domain := flags.String("domain", "", "custom domain for the imported links (must be listed in CUSTOM_DOMAINS)")
+	policy := flags.String("policy", "", "retention policy that sets the imported files' expiry (see RETENTION_POLICIES)")
+	keepTimes := flags.Bool("keep-times", false, "use each file's modification time as its original upload time (policy expiry counts from it)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sharing import-dir [-domain host] [-policy name] [-keep-times] <directory>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	backends, err := initializeBackends(getStorageType())
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	if err := database.Initialize(dbPath, getDBBusyTimeout()); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	if getAutoMigrate() {
+		if err := database.Migrate(); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+	} else if version, err := database.SchemaVersion(); err != nil || version < database.LatestSchemaVersion() {
+		log.Fatalf("Database schema is not up to date; run ./sharing --migrate first")
+	}
+
+	fileService := services.NewFileService(backends)
+	opts := services.SaveOptions{Domain: *domain, Policy: *policy}
+	summary, err := fileService.ImportDir(flags.Arg(0), opts, *keepTimes, func(result services.ImportResult) {
+		switch {
+		case result.Err != nil:
+			log.Printf("Failed   %s: %v", result.Path, result.Err)
+		case result.Skipped:
+			log.Printf("Skipped  %s (already imported as /%s)", result.Path, result.File.Slug)
+		default:
+			log.Printf("Imported %s -> /%s", result.Path, result.File.Slug)
+		}
+	})
+	if errors.Is(err, services.ErrExpiryRequired) {
+		log.Fatalf("REQUIRE_EXPIRY is set; pass -policy to give the imported files an expiry")
+	}
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+
+	log.Printf("Import complete: %d imported, %d skipped, %d failed", summary.Imported, summary.Skipped, summary.Failed)
+	if summary.Failed > 0 {
+		database.Close()
+		os.Exit(1)
+	}
+}
+
+// getStorageType returns the configured storage backend type
+func getStorageType() string {
 	storageType := strings.ToLower(os.Getenv("STORAGE_TYPE"))
 	if storageType == "" {
 		storageType = "local" // Default to local storage
 	}
+	return storageType
+}
+
+// getStorageBackends returns the storage backend types uploads can choose from: the primary,
+// followed by the other types listed in STORAGE_BACKENDS (comma-separated, e.g. "local,s3")
+func getStorageBackends(primary string) []string {
+	names := []string{primary}
+	for _, name := range strings.Split(os.Getenv("STORAGE_BACKENDS"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// initializeBackends creates the storage backends (see getStorageBackends), registered by
+// type with the given primary
+func initializeBackends(primary string) (*storage.Registry, error) {
+	primaryBackend, err := initializeStorage(primary)
+	if err != nil {
+		return nil, err
+	}
 
+	backends := storage.NewSingleRegistry(primary, primaryBackend)
+	for _, name := range getStorageBackends(primary)[1:] {
+		backend, err := initializeStorage(name)
+		if err != nil {
+			return nil, err
+		}
+		backends.Register(name, backend)
+	}
+	return backends, nil
+}
+
+// initializeStorage creates and configures the storage backend based on environment variables
+func initializeStorage(storageType string) (storage.Storage, error) {
 	switch storageType {
 	case "local":
 		dataDir := os.Getenv("DATA_DIR")
 		if dataDir == "" {
 			dataDir = "./data"
 		}
-		log.Printf("Using local storage: %s", dataDir)
-		return storage.NewLocalStorage(dataDir)
+		shardDepth := getLocalShardDepth()
+		log.Printf("Using local storage: %s (shard depth %d)", dataDir, shardDepth)
+		return storage.NewLocalStorage(dataDir, shardDepth)
 
 	case "s3":
 		endpoint := os.Getenv("S3_ENDPOINT")
@@ -170,6 +524,11 @@ func initializeStorage() (storage.Storage, error) {
 			}
 		}
 
+		objectLockMode := strings.ToUpper(os.Getenv("S3_OBJECT_LOCK_MODE"))
+		if objectLockMode != "" && objectLockMode != "GOVERNANCE" && objectLockMode != "COMPLIANCE" {
+			return nil, fmt.Errorf("invalid S3_OBJECT_LOCK_MODE: %s (supported: GOVERNANCE, COMPLIANCE)", objectLockMode)
+		}
+
 		config := storage.S3Config{
 			Endpoint:        endpoint,
 			Bucket:          bucket,
@@ -177,6 +536,36 @@ func initializeStorage() (storage.Storage, error) {
 			AccessKeyID:     accessKeyID,
 			SecretAccessKey: secretAccessKey,
 			UsePathStyle:    usePathStyle,
+			ObjectLockMode:  objectLockMode,
+			TagTemplate:     os.Getenv("S3_OBJECT_TAGS"),
+		}
+
+		// Optional replica bucket for read failover (S3_SECONDARY_*); unset fields reuse the primary's
+		if secondaryBucket := os.Getenv("S3_SECONDARY_BUCKET"); secondaryBucket != "" {
+			secondary := config
+			secondary.Bucket = secondaryBucket
+			secondary.ObjectLockMode = ""
+			secondary.TagTemplate = ""
+			if endpoint := os.Getenv("S3_SECONDARY_ENDPOINT"); endpoint != "" {
+				secondary.Endpoint = endpoint
+			}
+			if region := os.Getenv("S3_SECONDARY_REGION"); region != "" {
+				secondary.Region = region
+			}
+			if accessKeyID := os.Getenv("S3_SECONDARY_ACCESS_KEY_ID"); accessKeyID != "" {
+				secondary.AccessKeyID = accessKeyID
+				secondary.SecretAccessKey = os.Getenv("S3_SECONDARY_SECRET_ACCESS_KEY")
+			}
+			config.Secondary = &secondary
+
+			mirrorWrites, err := strconv.ParseBool(os.Getenv("S3_MIRROR_WRITES"))
+			if err != nil && os.Getenv("S3_MIRROR_WRITES") != "" {
+				log.Printf("Warning: invalid S3_MIRROR_WRITES value, using default (false)")
+			}
+			config.MirrorWrites = mirrorWrites
+
+			log.Printf("Using secondary S3 bucket for failover: bucket=%s, region=%s, endpoint=%s, mirror writes=%t",
+				secondary.Bucket, secondary.Region, secondary.Endpoint, mirrorWrites)
 		}
 
 		log.Printf("Using S3 storage: bucket=%s, region=%s, endpoint=%s", bucket, region, endpoint)
@@ -187,14 +576,207 @@ func initializeStorage() (storage.Storage, error) {
 	}
 }
 
-// startCleanupJob runs a background job to clean up expired files
-func startCleanupJob(fileService *services.FileService) {
+// getDBBusyTimeout returns how long SQLite waits for a lock, in milliseconds
+func getDBBusyTimeout() int {
+	timeoutStr := os.Getenv("DB_BUSY_TIMEOUT")
+	if timeoutStr == "" {
+		return 5000 // Default timeout in milliseconds
+	}
+
+	timeout, err := strconv.Atoi(timeoutStr)
+	if err != nil || timeout < 0 {
+		log.Printf("Warning: invalid DB_BUSY_TIMEOUT value, using default (5000)")
+		return 5000
+	}
+	return timeout
+}
+
+// getAutoMigrate reports whether migrations run automatically on startup (MIGRATE)
+func getAutoMigrate() bool {
+	migrateStr := os.Getenv("MIGRATE")
+	if migrateStr == "" {
+		return true
+	}
+
+	migrate, err := strconv.ParseBool(migrateStr)
+	if err != nil {
+		log.Printf("Warning: invalid MIGRATE value, using default (true)")
+		return true
+	}
+	return migrate
+}
+
+// getGzipUploadMaxSize returns the largest decompressed size of a gzip-encoded upload body
+func getGzipUploadMaxSize() int64 {
+	sizeStr := os.Getenv("GZIP_UPLOAD_MAX_SIZE")
+	if sizeStr == "" {
+		return 1 << 30 // Default: 1 GB
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size <= 0 {
+		log.Printf("Warning: invalid GZIP_UPLOAD_MAX_SIZE value, using default (1073741824)")
+		return 1 << 30
+	}
+	return size
+}
+
+// getAPITimePrecision returns the precision of timestamps in API responses (API_TIME_FORMAT):
+// whole seconds for "rfc3339", nanoseconds for "rfc3339nano"
+func getAPITimePrecision() time.Duration {
+	switch strings.ToLower(os.Getenv("API_TIME_FORMAT")) {
+	case "", "rfc3339":
+		return time.Second
+	case "rfc3339nano":
+		return time.Nanosecond
+	default:
+		log.Printf("Warning: invalid API_TIME_FORMAT value, using default (rfc3339)")
+		return time.Second
+	}
+}
+
+// getMaintenanceMode reports whether the server starts in maintenance mode (MAINTENANCE_MODE)
+func getMaintenanceMode() bool {
+	maintenanceStr := os.Getenv("MAINTENANCE_MODE")
+	if maintenanceStr == "" {
+		return false
+	}
+
+	maintenance, err := strconv.ParseBool(maintenanceStr)
+	if err != nil {
+		log.Printf("Warning: invalid MAINTENANCE_MODE value, using default (false)")
+		return false
+	}
+	return maintenance
+}
+
+// getSlowRequestThreshold returns the duration after which a request is logged as slow
+func getSlowRequestThreshold() time.Duration {
+	thresholdStr := os.Getenv("SLOW_REQUEST_THRESHOLD")
+	if thresholdStr == "" {
+		return 10 * time.Second // Default threshold
+	}
+
+	threshold, err := time.ParseDuration(thresholdStr)
+	if err != nil || threshold < 0 {
+		log.Printf("Warning: invalid SLOW_REQUEST_THRESHOLD value, using default (10s)")
+		return 10 * time.Second
+	}
+	return threshold
+}
+
+// getReportRateLimit returns the maximum abuse reports per IP per hour
+func getReportRateLimit() int {
+	limitStr := os.Getenv("REPORT_RATE_LIMIT")
+	if limitStr == "" {
+		return 5 // Default limit
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		log.Printf("Warning: invalid REPORT_RATE_LIMIT value, using default (5)")
+		return 5
+	}
+	return limit
+}
+
+// getStorageBreakerThreshold returns the consecutive storage failures that open the circuit breaker (0 = disabled)
+func getStorageBreakerThreshold() int {
+	thresholdStr := os.Getenv("STORAGE_BREAKER_THRESHOLD")
+	if thresholdStr == "" {
+		return 0 // Disabled unless configured
+	}
+
+	threshold, err := strconv.Atoi(thresholdStr)
+	if err != nil || threshold < 0 {
+		log.Printf("Warning: invalid STORAGE_BREAKER_THRESHOLD value, circuit breaker is disabled")
+		return 0
+	}
+	return threshold
+}
+
+// getStorageBreakerCooldown returns how long the storage circuit breaker stays open between recovery probes
+func getStorageBreakerCooldown() time.Duration {
+	cooldownStr := os.Getenv("STORAGE_BREAKER_COOLDOWN")
+	if cooldownStr == "" {
+		return 30 * time.Second // Default cooldown
+	}
+
+	cooldown, err := time.ParseDuration(cooldownStr)
+	if err != nil || cooldown <= 0 {
+		log.Printf("Warning: invalid STORAGE_BREAKER_COOLDOWN value, using default (30s)")
+		return 30 * time.Second
+	}
+	return cooldown
+}
+
+// getLocalShardDepth returns the number of directory levels local storage shards files into (0 = flat)
+func getLocalShardDepth() int {
+	depthStr := os.Getenv("LOCAL_SHARD_DEPTH")
+	if depthStr == "" {
+		return 0 // Default: flat
+	}
+
+	depth, err := strconv.Atoi(depthStr)
+	if err != nil || depth < 0 || depth > storage.MaxShardDepth {
+		log.Printf("Warning: invalid LOCAL_SHARD_DEPTH value, using default (0)")
+		return 0
+	}
+	return depth
+}
+
+// getTrustedProxies returns the proxies allowed to set the forwarded scheme and client IP (TRUSTED_PROXIES)
+func getTrustedProxies() []*net.IPNet {
+	proxies, err := mw.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Printf("Warning: invalid TRUSTED_PROXIES value (%v), ignoring forwarded headers", err)
+		return nil
+	}
+	return proxies
+}
+
+// getMaxConcurrentUploads returns the maximum number of uploads processed at once (0 = unlimited)
+func getMaxConcurrentUploads() int {
+	limitStr := os.Getenv("MAX_CONCURRENT_UPLOADS")
+	if limitStr == "" {
+		return 0 // Default: unlimited
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		log.Printf("Warning: invalid MAX_CONCURRENT_UPLOADS value, using default (0)")
+		return 0
+	}
+	return limit
+}
+
+// getMaxConcurrentUploadsPerIP returns the maximum number of uploads processed at once
+// for one client IP (0 = unlimited)
+func getMaxConcurrentUploadsPerIP() int {
+	limitStr := os.Getenv("MAX_CONCURRENT_UPLOADS_PER_IP")
+	if limitStr == "" {
+		return 0 // Default: unlimited
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		log.Printf("Warning: invalid MAX_CONCURRENT_UPLOADS_PER_IP value, using default (0)")
+		return 0
+	}
+	return limit
+}
+
+// startCleanupJob runs a background job to clean up expired files.
+// Runs are skipped while paused reports true (maintenance mode), since they delete files.
+func startCleanupJob(fileService *services.FileService, paused func() bool) {
 	// Run cleanup every hour
 	ticker := time.NewTicker(1 * time.Hour)
 
 	go func() {
 		// Run immediately on startup
-		if err := fileService.CleanupExpiredFiles(); err != nil {
+		if paused() {
+			log.Println("Initial cleanup skipped (maintenance mode)")
+		} else if err := fileService.CleanupExpiredFiles(); err != nil {
 			log.Printf("Cleanup error: %v", err)
 		} else {
 			log.Println("Initial cleanup completed")
@@ -202,7 +784,9 @@ func startCleanupJob(fileService *services.FileService) {
 
 		// Then run periodically
 		for range ticker.C {
-			if err := fileService.CleanupExpiredFiles(); err != nil {
+			if paused() {
+				log.Println("Cleanup skipped (maintenance mode)")
+			} else if err := fileService.CleanupExpiredFiles(); err != nil {
 				log.Printf("Cleanup error: %v", err)
 			} else {
 				log.Println("Cleanup completed")
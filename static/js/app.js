@@ -0,0 +1,234 @@
+const API_KEY_STORAGE = 'file_sharing_api_key';
+
+function getApiKey() {
+    return localStorage.getItem(API_KEY_STORAGE);
+}
+
+function setApiKey(key) {
+    localStorage.setItem(API_KEY_STORAGE, key);
+}
+
+function clearApiKey() {
+    localStorage.removeItem(API_KEY_STORAGE);
+}
+
+function login() {
+    const key = document.getElementById('api-key-input').value;
+    if (!key) {
+        showLoginError('Please enter an API key');
+        return;
+    }
+
+    // Test API key by fetching file list
+    fetch('/web/files', {
+        headers: { 'X-API-Key': key }
+    }).then(response => {
+        if (response.ok) {
+            setApiKey(key);
+            showMainContent();
+        } else {
+            showLoginError('Invalid API key');
+        }
+    }).catch(() => {
+        showLoginError('Connection error');
+    });
+}
+
+function logout() {
+    clearApiKey();
+    location.reload();
+}
+
+function showLoginError(msg) {
+    const errEl = document.getElementById('login-error');
+    errEl.textContent = msg;
+    errEl.style.display = 'block';
+}
+
+function showMainContent() {
+    document.getElementById('login-screen').classList.add('hidden');
+    document.getElementById('main-content').classList.remove('hidden');
+    updateHeaders();
+}
+
+function updateHeaders() {
+    const apiKey = getApiKey();
+    document.addEventListener('htmx:configRequest', (event) => {
+        event.detail.headers['X-API-Key'] = apiKey;
+    });
+}
+
+// Send the CSRF token with every HTMX request
+document.addEventListener('htmx:configRequest', (event) => {
+    const meta = document.querySelector('meta[name="csrf-token"]');
+    if (meta) {
+        event.detail.headers['X-CSRF-Token'] = meta.content;
+    }
+});
+
+// Send the browser's time zone so dates are shown and entered in local time
+document.addEventListener('htmx:configRequest', (event) => {
+    const tz = Intl.DateTimeFormat().resolvedOptions().timeZone;
+    if (tz) {
+        event.detail.parameters['tz'] = tz;
+    }
+});
+
+function copyShareLink(slug, domain) {
+    const origin = domain ? window.location.protocol + '//' + domain : window.location.origin;
+    const url = origin + '/' + slug;
+    navigator.clipboard.writeText(url).then(() => {
+        alert('Share link copied: ' + url);
+    });
+}
+
+// Upload progress tracking
+function formatBytes(bytes) {
+    if (bytes === 0) return '0 Bytes';
+    const k = 1024;
+    const sizes = ['Bytes', 'KB', 'MB', 'GB'];
+    const i = Math.floor(Math.log(bytes) / Math.log(k));
+    return Math.round((bytes / Math.pow(k, i)) * 100) / 100 + ' ' + sizes[i];
+}
+
+function formatAllFileSizes() {
+    // Format all file size elements on the page
+    document.querySelectorAll('.file-size').forEach(el => {
+        const bytes = parseInt(el.getAttribute('data-bytes'));
+        if (!isNaN(bytes)) {
+            el.textContent = formatBytes(bytes);
+        }
+    });
+}
+
+// Format file sizes when HTMX loads content
+document.addEventListener('htmx:afterSwap', formatAllFileSizes);
+
+// Format file sizes on initial page load
+document.addEventListener('DOMContentLoaded', formatAllFileSizes);
+
+function showProgress() {
+    const progressContainer = document.getElementById('progress-container');
+    const progressBar = document.getElementById('progress-bar');
+    const uploadButton = document.getElementById('upload-button');
+
+    progressContainer.classList.remove('hidden');
+    progressBar.style.width = '0%';
+    progressBar.className = 'progress-bar';
+    uploadButton.disabled = true;
+
+    document.getElementById('progress-percentage').textContent = '0%';
+    document.getElementById('progress-status').textContent = 'Uploading...';
+    document.getElementById('progress-size').textContent = '';
+}
+
+function hideProgress() {
+    const progressContainer = document.getElementById('progress-container');
+    const uploadButton = document.getElementById('upload-button');
+    const uploadForm = document.getElementById('upload-form');
+
+    setTimeout(() => {
+        progressContainer.classList.add('hidden');
+        uploadButton.disabled = false;
+        uploadForm.reset();
+    }, 2000);
+}
+
+function updateProgress(loaded, total) {
+    const percentage = Math.round((loaded / total) * 100);
+    const progressBar = document.getElementById('progress-bar');
+    const progressPercentage = document.getElementById('progress-percentage');
+    const progressSize = document.getElementById('progress-size');
+
+    progressBar.style.width = percentage + '%';
+    progressPercentage.textContent = percentage + '%';
+    progressSize.textContent = formatBytes(loaded) + ' / ' + formatBytes(total);
+}
+
+function setProgressComplete() {
+    const progressBar = document.getElementById('progress-bar');
+    const progressStatus = document.getElementById('progress-status');
+
+    progressBar.style.width = '100%';
+    progressBar.classList.add('complete');
+    progressStatus.textContent = 'Upload complete!';
+    document.getElementById('progress-percentage').textContent = '100%';
+}
+
+function setProgressError(message) {
+    const progressBar = document.getElementById('progress-bar');
+    const progressStatus = document.getElementById('progress-status');
+
+    progressBar.classList.add('error');
+    progressStatus.textContent = 'Upload failed: ' + (message || 'Unknown error');
+}
+
+// HTMX event listeners for upload progress
+document.addEventListener('htmx:xhr:loadstart', function(event) {
+    const form = event.detail.elt;
+    if (form && form.id === 'upload-form') {
+        showProgress();
+    }
+});
+
+document.addEventListener('htmx:xhr:progress', function(event) {
+    const form = event.detail.elt;
+    if (form && form.id === 'upload-form') {
+        const loaded = event.detail.loaded;
+        const total = event.detail.total;
+        if (total > 0) {
+            updateProgress(loaded, total);
+        }
+    }
+});
+
+document.addEventListener('htmx:afterRequest', function(event) {
+    const form = event.detail.elt;
+    if (form && form.id === 'upload-form') {
+        if (event.detail.successful) {
+            setProgressComplete();
+        } else {
+            setProgressError(event.detail.xhr?.statusText || 'Unknown error');
+        }
+        hideProgress();
+    }
+});
+
+// Drag and drop upload zone
+const dropZone = document.getElementById('drop-zone');
+if (dropZone) {
+    const fileInput = document.getElementById('file');
+
+    ['dragenter', 'dragover'].forEach(name => {
+        dropZone.addEventListener(name, (e) => {
+            e.preventDefault();
+            dropZone.classList.add('dragover');
+        });
+    });
+
+    ['dragleave', 'drop'].forEach(name => {
+        dropZone.addEventListener(name, (e) => {
+            e.preventDefault();
+            dropZone.classList.remove('dragover');
+        });
+    });
+
+    dropZone.addEventListener('drop', (e) => {
+        if (e.dataTransfer.files.length > 0) {
+            fileInput.files = e.dataTransfer.files;
+        }
+    });
+}
+
+// Check if already logged in (session cookie or stored API key)
+if (document.body.dataset.sessionAuth === 'true') {
+    document.getElementById('login-screen').classList.add('hidden');
+    document.getElementById('main-content').classList.remove('hidden');
+} else if (getApiKey()) {
+    showMainContent();
+}
+
+// Handle Enter key on login
+document.getElementById('api-key-input')?.addEventListener('keypress', (e) => {
+    if (e.key === 'Enter') login();
+});